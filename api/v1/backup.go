@@ -0,0 +1,13 @@
+package v1
+
+import "time"
+
+type BackupFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+type BackupRequest struct {
+	Name string `json:"name" binding:"required"`
+}
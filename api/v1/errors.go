@@ -11,9 +11,19 @@ var (
 	ErrInternalServerError = newError(500, "内部服务器错误")
 
 	// ErrEmailAlreadyUse more biz errors
-	ErrEmailAlreadyUse   = newError(1001, "该电子邮件已被使用。")
-	ErrCannotRefresh     = newError(1002, "无法刷新帐户。")
-	ErrAccessTokenEmpty  = newError(1003, "访问令牌为空。")
-	ErrLoginFailed       = newError(1004, "登录失败")
-	ErrCannotDeleteToken = newError(1005, "已有关联账户，请先删除关联账户。")
+	ErrEmailAlreadyUse       = newError(1001, "该电子邮件已被使用。")
+	ErrCannotRefresh         = newError(1002, "无法刷新帐户。")
+	ErrAccessTokenEmpty      = newError(1003, "访问令牌为空。")
+	ErrLoginFailed           = newError(1004, "登录失败")
+	ErrCannotDeleteToken     = newError(1005, "已有关联账户，请先删除关联账户。")
+	ErrInvalidModerationRule = newError(1006, "审查规则无效，请检查规则类型、适用产品与表达式。")
+	ErrUserSuspended         = newError(1007, "账号因多次违规已被暂停使用，请稍后再试或联系管理员。")
+	ErrInvalidStrikePolicy   = newError(1008, "违规策略无效，请检查触发次数、处理动作与暂停时长。")
+	ErrInvalidJobSchedule    = newError(1009, "任务计划无效，请检查cron表达式与时区。")
+	ErrJobRunning            = newError(1010, "任务正在执行中，请稍后再试。")
+	ErrInvalidSetting        = newError(1011, "设置无效，请检查设置名称与取值。")
+	ErrInvalidBackup         = newError(1012, "备份文件无效，请检查文件是否完整且来自本程序。")
+	ErrBackupRunning         = newError(1013, "备份或恢复正在进行中，请稍后再试。")
+	ErrUserAlreadyExists     = newError(1014, "用户名或密码已被使用。")
+	ErrAccountAlreadyExists  = newError(1015, "账号名称已被使用。")
 )
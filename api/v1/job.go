@@ -0,0 +1,51 @@
+package v1
+
+import "PandoraFuclaudePlusHelper/internal/model"
+
+type JobRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type UpdateJobRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Cron 为空时使用环境变量或默认值
+	Cron string `json:"cron" example:"5 * * * *"`
+	// Timezone 为空时使用环境变量或 JOB_TIMEZONE
+	Timezone string `json:"timezone" example:"Asia/Shanghai"`
+}
+
+type SearchJobRunRequest struct {
+	// Name 为空时查询全部任务
+	Name string `json:"name"`
+	// Status 为空时不过滤, running, success, partial, failure
+	Status   string `json:"status"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type SearchJobRunResponseData struct {
+	Total int64           `json:"total"`
+	List  []*model.JobRun `json:"list"`
+}
+
+type SearchJobRunItemRequest struct {
+	RunId int64  `json:"runId"`
+	Name  string `json:"name"`
+	// ItemType 为空时不过滤, 例如 openai_token, openai_account, claude_account, user, suspension
+	ItemType string `json:"itemType"`
+	ItemId   int64  `json:"itemId"`
+	// Status 为空时不过滤, success, failure
+	Status   string `json:"status"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type SearchJobRunItemResponseData struct {
+	Total int64               `json:"total"`
+	List  []*model.JobRunItem `json:"list"`
+}
+
+type SearchJobFailingRequest struct {
+	// Name 为空时查询全部任务
+	Name string `json:"name"`
+}
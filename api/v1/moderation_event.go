@@ -0,0 +1,61 @@
+package v1
+
+import "PandoraFuclaudePlusHelper/internal/model"
+
+type SearchModerationEventRequest struct {
+	Keyword string `json:"keyword"`
+	Product string `json:"product"`
+	// Direction 为空时不过滤, input:用户消息, output:助手回复
+	Direction string `json:"direction"`
+	// Status 为空时不过滤, 0:待审核, 1:已审核
+	Status    *int   `json:"status"`
+	UserId    int64  `json:"userId"`
+	StartTime string `json:"startTime" example:"2024-01-01 00:00:00"`
+	EndTime   string `json:"endTime" example:"2024-01-02 00:00:00"`
+	Page      int    `json:"page"`
+	PageSize  int    `json:"pageSize"`
+}
+
+type SearchModerationEventResponseData struct {
+	Total int64                    `json:"total"`
+	List  []*model.ModerationEvent `json:"list"`
+}
+
+type ReviewModerationEventRequest struct {
+	Ids  []int64 `json:"ids" binding:"required"`
+	Note string  `json:"note"`
+}
+
+type SearchStrikePolicyRequest struct {
+	Keyword string `json:"keyword"`
+}
+
+type DeleteStrikePolicyRequest struct {
+	Id int64 `json:"id" binding:"required"`
+}
+
+type SearchStrikeRequest struct {
+	Keyword string `json:"keyword"`
+}
+
+type ResetStrikeRequest struct {
+	UserId int64 `json:"userId" binding:"required"`
+}
+
+type LiftSuspensionRequest struct {
+	Id int64 `json:"id" binding:"required"`
+}
+
+type SearchSuspensionRequest struct {
+	UserId int64 `json:"userId"`
+	// Status 为空时不过滤, 1:生效中, 0:已解除
+	Status *int `json:"status"`
+}
+
+type StrikeUserResponseData struct {
+	UserId     int64                 `json:"userId"`
+	UniqueName string                `json:"uniqueName"`
+	Enable     int                   `json:"enable"`
+	Strikes    int64                 `json:"strikes"`
+	Suspension *model.UserSuspension `json:"suspension"`
+}
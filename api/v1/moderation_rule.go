@@ -0,0 +1,10 @@
+package v1
+
+type SearchModerationRuleRequest struct {
+	Keyword string `json:"keyword"`
+	Product string `json:"product"`
+}
+
+type DeleteModerationRuleRequest struct {
+	Id int64 `json:"id" binding:"required"`
+}
@@ -0,0 +1,5 @@
+package v1
+
+type HealDriftRequest struct {
+	Id int64 `json:"id" binding:"required"`
+}
@@ -0,0 +1,25 @@
+package v1
+
+import "time"
+
+type SettingItem struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	// Value 当前生效的值
+	Value string `json:"value"`
+	// Default 未修改时的值, 来自配置文件、环境变量或内置默认值
+	Default string `json:"default"`
+	// Modified 是否在后台修改过
+	Modified   bool       `json:"modified"`
+	UpdateTime *time.Time `json:"updateTime"`
+}
+
+type UpdateSettingRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Value string `json:"value"`
+}
+
+type ResetSettingRequest struct {
+	Name string `json:"name" binding:"required"`
+}
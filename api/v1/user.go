@@ -44,6 +44,8 @@ type AddUserRequest struct {
 	OpenaiToken    int64  `json:"openaiToken"`
 	Claude         int    `json:"claude"`
 	ClaudeToken    int64  `json:"claudeToken"`
+	BlockUpload    int    `json:"blockUpload"`
+	BlockImage     int    `json:"blockImage"`
 }
 
 type UpdateUserRequest struct {
@@ -56,6 +58,8 @@ type UpdateUserRequest struct {
 	OpenaiToken    int64  `json:"openaiToken"`
 	Claude         int    `json:"claude"`
 	ClaudeToken    int64  `json:"claudeToken"`
+	BlockUpload    int    `json:"blockUpload"`
+	BlockImage     int    `json:"blockImage"`
 }
 
 type SearchUserRequest struct {
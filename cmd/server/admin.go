@@ -0,0 +1,388 @@
+package main
+
+import (
+	"PandoraFuclaudePlusHelper/cmd/server/wire"
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/server"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sethvargo/go-password/password"
+)
+
+const adminPasswordUsage = `usage: admin-password [-unset] [password]
+  重置管理员密码, 未指定密码时生成随机密码; 重置后 ADMIN_PASSWORD 不再生效
+  -unset 删除重置的密码, 恢复使用 ADMIN_PASSWORD`
+
+const userUsage = `usage: user <command>
+  list [keyword]                      查看用户, 可按名称搜索
+  create -name <name> -password <password> [options]
+                                      新增用户, 指定 Token 时同时创建账号
+  disable <id|name>                   禁用用户及其账号`
+
+const tokenUsage = `usage: token import -type <openai|claude> <file>
+  从文件导入 Token, 每行为 "名称,Token" 或只有 Token, # 开头的行忽略; 文件为 - 时读取标准输入
+  OpenAI 为 Refresh Token, Claude 为 Session Token`
+
+const jobUsage = `usage: job <command>
+  list         查看任务与最后一次执行结果
+  run <name>   立即执行一次任务并等待结束, 任务暂停时同样执行`
+
+// withAdmin 构建命令行管理使用的服务, 执行前与启动服务时一样检查数据库迁移
+func withAdmin(logger *log.Logger, fn func(ctx context.Context, admin *server.Admin) error) error {
+	admin, cleanup, err := wire.NewAdminWire(logger)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := admin.Migrate.Run(ctx); err != nil {
+		return err
+	}
+	return fn(ctx, admin)
+}
+
+// runAdminPassword 执行 admin-password 子命令
+func runAdminPassword(logger *log.Logger, args []string) error {
+	flags := flag.NewFlagSet("admin-password", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), adminPasswordUsage)
+	}
+	unset := flags.Bool("unset", false, "")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() > 1 || (*unset && flags.NArg() > 0) {
+		return errors.New(adminPasswordUsage)
+	}
+
+	return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+		if *unset {
+			if err := admin.LoginService.SetAdminPassword(ctx, ""); err != nil {
+				return err
+			}
+			fmt.Println("Admin password reset removed, ADMIN_PASSWORD is used again")
+			return nil
+		}
+		adminPassword := flags.Arg(0)
+		generated := adminPassword == ""
+		if generated {
+			var err error
+			if adminPassword, err = password.Generate(12, 1, 1, false, false); err != nil {
+				return err
+			}
+		}
+		if err := admin.LoginService.SetAdminPassword(ctx, adminPassword); err != nil {
+			return err
+		}
+		if generated {
+			fmt.Println("Generated admin password:", adminPassword)
+		}
+		fmt.Println("Admin password updated")
+		return nil
+	})
+}
+
+// runUser 执行 user 子命令
+func runUser(logger *log.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) > 2 {
+			return errors.New(userUsage)
+		}
+		keyword := ""
+		if len(args) == 2 {
+			keyword = args[1]
+		}
+		return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+			users, err := admin.UserService.SearchUser(ctx, keyword)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tENABLE\tOPENAI\tCLAUDE\tEXPIRATION")
+			for _, user := range users {
+				fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", user.ID, user.UniqueName, user.Enable,
+					userToken(user.Openai, user.OpenaiToken), userToken(user.Claude, user.ClaudeToken),
+					user.ExpirationTime.Local().Format(time.DateTime))
+			}
+			return w.Flush()
+		})
+	case "create":
+		return runUserCreate(logger, args[1:])
+	case "disable":
+		if len(args) != 2 {
+			return errors.New(userUsage)
+		}
+		return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+			user, err := findUser(ctx, admin, args[1])
+			if err != nil {
+				return err
+			}
+			if user.Enable != 1 {
+				fmt.Printf("User %d %s is already disabled\n", user.ID, user.UniqueName)
+				return nil
+			}
+			user.Enable = 0
+			if err := admin.UserService.Update(ctx, user); err != nil {
+				return err
+			}
+			fmt.Printf("User %d %s disabled\n", user.ID, user.UniqueName)
+			return nil
+		})
+	}
+	return errors.New(userUsage)
+}
+
+// userToken 用户开通的服务使用的 Token, 未开通时为 -
+func userToken(enable int, tokenId int64) string {
+	if enable != 1 || tokenId <= 0 {
+		return "-"
+	}
+	return strconv.FormatInt(tokenId, 10)
+}
+
+// runUserCreate 执行 user create 子命令, 与后台新增用户相同
+func runUserCreate(logger *log.Logger, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+	name := flags.String("name", "", "用户名称")
+	userPassword := flags.String("password", "", "用户登录密码")
+	expire := flags.String("expire", "", "过期时间, 格式为 2006-01-02 15:04:05 (东八区), 默认按设置的有效天数")
+	openaiToken := flags.Int64("openai-token", 0, "OpenAI Token ID, 指定时创建 OpenAI 账号")
+	claudeToken := flags.Int64("claude-token", 0, "Claude Token ID, 指定时创建 Claude 账号")
+	blockUpload := flags.Bool("block-upload", false, "禁止上传文件")
+	blockImage := flags.Bool("block-image", false, "禁止图片输入")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() > 0 || *name == "" || *userPassword == "" {
+		flags.Usage()
+		return errors.New("-name and -password are required")
+	}
+
+	user := &model.User{
+		UniqueName:  *name,
+		Password:    *userPassword,
+		Enable:      1,
+		OpenaiToken: *openaiToken,
+		ClaudeToken: *claudeToken,
+	}
+	if *expire != "" {
+		loc, _ := time.LoadLocation("Asia/Shanghai")
+		expTime, err := time.ParseInLocation(time.DateTime, *expire, loc)
+		if err != nil {
+			return fmt.Errorf("invalid expire time: %v", err)
+		}
+		user.ExpirationTime = expTime
+	}
+	if *openaiToken > 0 {
+		user.Openai = 1
+	}
+	if *claudeToken > 0 {
+		user.Claude = 1
+	}
+	if *blockUpload {
+		user.BlockUpload = 1
+	}
+	if *blockImage {
+		user.BlockImage = 1
+	}
+
+	return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+		if err := admin.UserService.Create(ctx, user); err != nil {
+			return err
+		}
+		fmt.Printf("User %d %s created, expires at %s\n", user.ID, user.UniqueName, user.ExpirationTime.Local().Format(time.DateTime))
+		return nil
+	})
+}
+
+// findUser 按 ID 或名称查找用户
+func findUser(ctx context.Context, admin *server.Admin, key string) (*model.User, error) {
+	if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+		if user, err := admin.UserService.GetUser(ctx, id); err == nil {
+			return user, nil
+		}
+	}
+	users, err := admin.UserService.SearchUser(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.UniqueName == key {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found: %s", key)
+}
+
+// runToken 执行 token 子命令
+func runToken(logger *log.Logger, args []string) error {
+	if len(args) == 0 || args[0] != "import" {
+		return errors.New(tokenUsage)
+	}
+	flags := flag.NewFlagSet("token import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), tokenUsage)
+	}
+	tokenType := flags.String("type", "", "")
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() != 1 || (*tokenType != "openai" && *tokenType != "claude") {
+		return errors.New(tokenUsage)
+	}
+
+	var input io.Reader = os.Stdin
+	if file := flags.Arg(0); file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+	lines, err := readTokenLines(input)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return errors.New("no token found")
+	}
+
+	return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+		var failed int
+		for _, line := range lines {
+			var id int64
+			var err error
+			if *tokenType == "openai" {
+				token := &model.OpenaiToken{TokenName: line.name, RefreshToken: line.token}
+				err = admin.OpenaiTokenService.Create(ctx, token)
+				id = token.ID
+			} else {
+				token := &model.ClaudeToken{TokenName: line.name, SessionToken: line.token}
+				err = admin.ClaudeTokenService.Create(ctx, token)
+				id = token.ID
+			}
+			if err != nil {
+				failed++
+				fmt.Printf("line %d %s: failed: %v\n", line.number, line.name, err)
+				continue
+			}
+			fmt.Printf("line %d %s: imported as %d\n", line.number, line.name, id)
+		}
+		fmt.Printf("Imported %d of %d tokens\n", len(lines)-failed, len(lines))
+		if failed > 0 {
+			return fmt.Errorf("%d tokens failed to import", failed)
+		}
+		return nil
+	})
+}
+
+type tokenLine struct {
+	number int
+	name   string
+	token  string
+}
+
+// readTokenLines 读取要导入的 Token, 未指定名称时以行号命名
+func readTokenLines(r io.Reader) ([]tokenLine, error) {
+	var lines []tokenLine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		line := tokenLine{number: number, name: fmt.Sprintf("import-%d", number), token: text}
+		if name, token, ok := strings.Cut(text, ","); ok {
+			line.name, line.token = strings.TrimSpace(name), strings.TrimSpace(token)
+		}
+		if line.name == "" || line.token == "" {
+			return nil, fmt.Errorf("line %d: invalid token", number)
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// runJob 执行 job 子命令
+func runJob(logger *log.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(jobUsage)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return errors.New(jobUsage)
+		}
+		return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tCRON\tTIMEZONE\tENABLE\tLAST RUN\tSTATUS\tDESCRIPTION")
+			for _, status := range admin.Scheduler.List(ctx) {
+				lastRun, lastStatus := "-", "-"
+				if status.LastRun != nil {
+					lastRun = status.LastRun.StartTime.Local().Format(time.DateTime)
+					lastStatus = status.LastRun.Status
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", status.Name, status.Cron, status.Timezone,
+					status.Enable, lastRun, lastStatus, status.Description)
+			}
+			return w.Flush()
+		})
+	case "run":
+		if len(args) != 2 {
+			return errors.New(jobUsage)
+		}
+		return withAdmin(logger, func(ctx context.Context, admin *server.Admin) error {
+			run, err := admin.Scheduler.Run(ctx, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Job %s %s in %s: total %d, success %d, failure %d, skipped %d\n", run.Job, run.Status,
+				run.EndTime.Sub(run.StartTime).Round(time.Millisecond), run.Total, run.Success, run.Failure, run.Skipped)
+			if run.Status == model.JobStatusFailure {
+				return fmt.Errorf("job %s failed: %s", run.Job, run.Error)
+			}
+			return nil
+		})
+	}
+	return errors.New(jobUsage)
+}
+
+// runConfig 执行 config 子命令, 输出生效的配置, 密码与密钥不显示
+func runConfig(_ *log.Logger, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: config")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, item := range commonConfig.GetConfig().Masked() {
+		fmt.Fprintf(w, "%s\t%s\n", item.Name, item.Value)
+	}
+	return w.Flush()
+}
@@ -4,10 +4,42 @@ import (
 	"PandoraFuclaudePlusHelper/cmd/server/wire"
 	commonConfig "PandoraFuclaudePlusHelper/config"
 	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"fmt"
+	"os"
 )
 
+// commands 子命令, 不带子命令时启动服务
+var commands = map[string]func(logger *log.Logger, args []string) error{
+	"migrate":        runMigrate,
+	"transfer":       runTransfer,
+	"admin-password": runAdminPassword,
+	"user":           runUser,
+	"token":          runToken,
+	"job":            runJob,
+	"config":         runConfig,
+	"help":           runHelp,
+}
+
+const helpUsage = `usage: pandora-fuclaude-plus-helper [command]
+  不带子命令时启动服务
+
+commands:
+  migrate          执行或回滚数据库迁移, 查看迁移状态
+  transfer         将数据复制到其他数据库
+  admin-password   重置管理员密码
+  user             查看、新增与禁用用户
+  token            导入 OpenAI 或 Claude Token
+  job              查看任务, 立即执行一次任务
+  config           输出生效的配置, 密码与密钥不显示
+  help             显示本帮助`
+
+func runHelp(_ *log.Logger, _ []string) error {
+	fmt.Println(helpUsage)
+	return nil
+}
+
 // @title           Nunu Example API
 // @version         1.0.0
 // @description     This is a sample server celler server.
@@ -29,6 +61,22 @@ func main() {
 
 	logger := log.NewLog()
 
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(logger, os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	shutdownTracing, err := tracing.Init(logger)
+	if err != nil {
+		panic(err)
+	}
+	defer shutdownTracing(context.Background())
+
 	app, cleanup, err := wire.NewWire(logger)
 
 	defer cleanup()
@@ -46,10 +94,21 @@ func main() {
 
 // printEndpoint 打印服务启动信息
 func printEndpoint() {
-	version := commonConfig.GetConfig().Version
-	apiEndpoint := fmt.Sprintf("http://%s:%d", commonConfig.GetConfig().HttpHost, commonConfig.GetConfig().ApiPort)
-	openAiEndpoint := fmt.Sprintf("http://%s:%d", commonConfig.GetConfig().HttpHost, commonConfig.GetConfig().OpenAiPort)
-	claudeEndpoint := fmt.Sprintf("http://%s:%d", commonConfig.GetConfig().HttpHost, commonConfig.GetConfig().ClaudePort)
+	config := commonConfig.GetConfig()
+	version := config.Version
+	scheme := "http"
+	if config.TlsEnable() {
+		scheme = "https"
+	}
+	apiEndpoint := fmt.Sprintf("%s://%s:%d", scheme, config.HttpHost, config.ApiPort)
+	if config.SinglePort {
+		fmt.Printf("PandoraFuclaudePlusHelper [%s] started in single port mode at %s\n", version, apiEndpoint)
+		fmt.Printf("PandoraFuclaudePlusHelper [%s] OpenAI Reverse hostname: [%s], path prefix: [%s]\n", version, config.OpenAiHostname, config.OpenAiPathPrefix)
+		fmt.Printf("PandoraFuclaudePlusHelper [%s] Claude Reverse hostname: [%s], path prefix: [%s]\n", version, config.ClaudeHostname, config.ClaudePathPrefix)
+		return
+	}
+	openAiEndpoint := fmt.Sprintf("%s://%s:%d", scheme, config.HttpHost, config.OpenAiPort)
+	claudeEndpoint := fmt.Sprintf("%s://%s:%d", scheme, config.HttpHost, config.ClaudePort)
 	fmt.Printf("PandoraFuclaudePlusHelper [%s] API started at %s\n", version, apiEndpoint)
 	fmt.Printf("PandoraFuclaudePlusHelper [%s] OpenAI Reverse started at %s\n", version, openAiEndpoint)
 	fmt.Printf("PandoraFuclaudePlusHelper [%s] Claude Reverse started at %s\n", version, claudeEndpoint)
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"PandoraFuclaudePlusHelper/cmd/server/wire"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: migrate <command>
+  up [version]   执行未执行的迁移, 指定版本时只执行到该版本
+  down [steps]   回滚最近执行的迁移, 默认回滚 1 个
+  status         查看迁移状态`
+
+// runMigrate 执行 migrate 子命令
+func runMigrate(logger *log.Logger, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+	migrator, cleanup, err := wire.NewMigratorWire(logger)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		var target int64
+		if len(args) == 2 {
+			if target, err = strconv.ParseInt(args[1], 10, 64); err != nil || target <= 0 {
+				return fmt.Errorf("invalid version: %s", args[1])
+			}
+		}
+		if err := migrator.Up(ctx, target); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid steps: %s", args[1])
+			}
+		}
+		if err := migrator.Down(ctx, steps); err != nil {
+			return err
+		}
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED")
+	for _, status := range statuses {
+		state, applied := "pending", ""
+		if status.Applied {
+			state, applied = "applied", status.AppliedTime.Local().Format(time.DateTime)
+		}
+		if status.Unknown {
+			state = "unknown"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/transfer"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+)
+
+const transferUsage = `usage: transfer -to-driver <driver> -to-dsn <dsn> [options]
+  将源数据库的全部数据复制到目标数据库, 保留主键与时间, 完成后校验行数`
+
+// runTransfer 执行 transfer 子命令
+func runTransfer(logger *log.Logger, args []string) error {
+	config := commonConfig.GetConfig()
+	flags := flag.NewFlagSet("transfer", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), transferUsage)
+		flags.PrintDefaults()
+	}
+	fromDriver := flags.String("from-driver", config.DatabaseDriver, "源数据库驱动: sqlite, mysql 或 postgres, 默认为当前配置")
+	fromDsn := flags.String("from-dsn", config.DatabaseDsn, "源数据库连接串, 默认为当前配置")
+	toDriver := flags.String("to-driver", "", "目标数据库驱动: sqlite, mysql 或 postgres")
+	toDsn := flags.String("to-dsn", "", "目标数据库连接串")
+	clear := flags.Bool("clear", false, "目标表中已有数据时先清空")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() > 0 || *toDriver == "" || *toDsn == "" {
+		flags.Usage()
+		return errors.New("-to-driver and -to-dsn are required")
+	}
+	if *fromDriver == *toDriver && *fromDsn == *toDsn {
+		return errors.New("source and target database are the same")
+	}
+
+	source, err := repository.OpenDB(logger, *fromDriver, *fromDsn)
+	if err != nil {
+		return fmt.Errorf("open source database: %w", err)
+	}
+	defer closeDB(source)
+	target, err := repository.OpenDB(logger, *toDriver, *toDsn)
+	if err != nil {
+		return fmt.Errorf("open target database: %w", err)
+	}
+	defer closeDB(target)
+
+	fmt.Printf("Transfer %s -> %s\n", *fromDriver, *toDriver)
+	results, err := transfer.NewTransfer(logger, source, target).Run(context.Background(), *clear)
+	if len(results) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TABLE\tSOURCE\tCOPIED\tTARGET")
+		var total int64
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", result.Table, result.Source, result.Copied, result.Target)
+			total += result.Copied
+		}
+		w.Flush()
+		if err == nil {
+			fmt.Printf("Transferred %d rows in %d tables, row counts verified\n", total, len(results))
+		}
+	}
+	return err
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
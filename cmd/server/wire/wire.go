@@ -7,13 +7,18 @@ import (
 	commonConfig "PandoraFuclaudePlusHelper/config"
 	"PandoraFuclaudePlusHelper/internal/handler"
 	"PandoraFuclaudePlusHelper/internal/middleware"
+	"PandoraFuclaudePlusHelper/internal/migration"
+	"PandoraFuclaudePlusHelper/internal/moderation"
 	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/scheduler"
 	"PandoraFuclaudePlusHelper/internal/server"
 	"PandoraFuclaudePlusHelper/internal/service"
 	"PandoraFuclaudePlusHelper/pkg/app"
+	"PandoraFuclaudePlusHelper/pkg/certs"
 	"PandoraFuclaudePlusHelper/pkg/jwt"
 	"PandoraFuclaudePlusHelper/pkg/log"
 	serverType "PandoraFuclaudePlusHelper/pkg/server"
+	"PandoraFuclaudePlusHelper/pkg/server/dispatch"
 	"PandoraFuclaudePlusHelper/pkg/server/http"
 	"PandoraFuclaudePlusHelper/pkg/server/reverse/claude"
 	"PandoraFuclaudePlusHelper/pkg/server/reverse/openai"
@@ -32,6 +37,13 @@ var repositorySet = wire.NewSet(
 	repository.NewClaudeAccountRepository,
 	repository.NewConversationRepository,
 	repository.NewUserRepository,
+	repository.NewModerationRuleRepository,
+	repository.NewModerationEventRepository,
+	repository.NewStrikeRepository,
+	repository.NewJobRepository,
+	repository.NewSettingRepository,
+	repository.NewBackupRepository,
+	repository.NewReconcileRepository,
 )
 
 var serviceCoordinatorSet = wire.NewSet(
@@ -47,10 +59,20 @@ var serviceSet = wire.NewSet(
 	service.NewOpenaiAccountService,
 	service.NewClaudeTokenService,
 	service.NewClaudeAccountService,
+	service.NewModerationRuleService,
+	service.NewModerationEventService,
+	service.NewStrikeService,
+	service.NewJobService,
+	service.NewSettings,
+	service.NewSettingService,
+	service.NewBackupService,
+	service.NewReconcileService,
+	scheduler.NewScheduler,
 	server.NewTask,
 )
 
 var migrateSet = wire.NewSet(
+	migration.NewMigrator,
 	server.NewMigrate,
 )
 
@@ -62,23 +84,42 @@ var handlerSet = wire.NewSet(
 	handler.NewOpenaiAccountHandler,
 	handler.NewClaudeTokenHandler,
 	handler.NewClaudeAccountHandler,
+	handler.NewModerationRuleHandler,
+	handler.NewModerationEventHandler,
+	handler.NewStrikeHandler,
+	handler.NewJobHandler,
+	handler.NewSettingHandler,
+	handler.NewBackupHandler,
+	handler.NewReconcileHandler,
 )
 
 var serverSet = wire.NewSet(
+	server.NewCertReloader,
+	server.NewHttpsRedirect,
+	server.NewMetricsCollector,
 	server.NewHTTPServer,
 	server.NewChatGPTReverseProxyServer,
 	server.NewClaudeReverseProxyServer,
+	server.NewDispatchServer,
 	server.NewJob,
 )
 
 // build App
-func newApp(httpServer *http.Server, openaiServer *openai.Server, claudeServer *claude.Server, job *server.Job, task *server.Task, migrate *server.Migrate) *app.App {
+func newApp(httpServer *http.Server, openaiServer *openai.Server, claudeServer *claude.Server, dispatchServer *dispatch.Server, reloader *certs.Reloader, redirect *server.HttpsRedirect, job *server.Job, task *server.Task, migrate *server.Migrate) *app.App {
 	servers := []serverType.Server{
-		httpServer,
 		job,
-		migrate,
-		openaiServer,
-		claudeServer,
+	}
+	if commonConfig.GetConfig().SinglePort {
+		// 单端口模式下由分发服务器统一监听
+		servers = append(servers, dispatchServer)
+	} else {
+		servers = append(servers, httpServer, openaiServer, claudeServer)
+	}
+	if reloader != nil {
+		servers = append(servers, reloader)
+		if commonConfig.GetConfig().TlsRedirectHttp {
+			servers = append(servers, redirect)
+		}
 	}
 	if commonConfig.GetConfig().EnableTask {
 		servers = append(servers, task)
@@ -86,6 +127,7 @@ func newApp(httpServer *http.Server, openaiServer *openai.Server, claudeServer *
 	return app.NewApp(
 		app.WithServer(servers...),
 		app.WithName("demo-server"),
+		app.WithBeforeStart(migrate.Run),
 	)
 }
 
@@ -99,7 +141,30 @@ func NewWire(*log.Logger) (*app.App, func(), error) {
 		sid.NewSid,
 		jwt.NewJwt,
 		middleware.NewConversationLoggerMiddleware,
+		middleware.NewModerationMiddleware,
+		moderation.NewManager,
 		newApp,
 	))
 
 }
+
+// NewAdminWire 命令行管理复用接口的服务, 不创建 HTTP 与反向代理服务
+func NewAdminWire(*log.Logger) (*server.Admin, func(), error) {
+	panic(wire.Build(
+		repositorySet,
+		serviceSet,
+		migrateSet,
+		sid.NewSid,
+		jwt.NewJwt,
+		moderation.NewManager,
+		server.NewAdmin,
+	))
+}
+
+// NewMigratorWire 命令行执行数据库迁移时只需要数据库连接
+func NewMigratorWire(*log.Logger) (*migration.Migrator, func(), error) {
+	panic(wire.Build(
+		repository.NewDB,
+		migration.NewMigrator,
+	))
+}
@@ -10,13 +10,18 @@ import (
 	"PandoraFuclaudePlusHelper/config"
 	"PandoraFuclaudePlusHelper/internal/handler"
 	"PandoraFuclaudePlusHelper/internal/middleware"
+	"PandoraFuclaudePlusHelper/internal/migration"
+	"PandoraFuclaudePlusHelper/internal/moderation"
 	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/scheduler"
 	"PandoraFuclaudePlusHelper/internal/server"
 	"PandoraFuclaudePlusHelper/internal/service"
 	"PandoraFuclaudePlusHelper/pkg/app"
+	"PandoraFuclaudePlusHelper/pkg/certs"
 	"PandoraFuclaudePlusHelper/pkg/jwt"
 	"PandoraFuclaudePlusHelper/pkg/log"
 	server2 "PandoraFuclaudePlusHelper/pkg/server"
+	"PandoraFuclaudePlusHelper/pkg/server/dispatch"
 	"PandoraFuclaudePlusHelper/pkg/server/http"
 	"PandoraFuclaudePlusHelper/pkg/server/reverse/claude"
 	"PandoraFuclaudePlusHelper/pkg/server/reverse/openai"
@@ -33,63 +38,148 @@ func NewWire(logger *log.Logger) (*app.App, func(), error) {
 	repositoryRepository := repository.NewRepository(logger, db)
 	transaction := repository.NewTransaction(repositoryRepository)
 	sidSid := sid.NewSid()
-	serviceService := service.NewService(transaction, logger, sidSid, jwtJWT)
+	settingRepository := repository.NewSettingRepository(repositoryRepository)
+	settings := service.NewSettings(logger, settingRepository)
+	serviceService := service.NewService(transaction, logger, sidSid, jwtJWT, settings)
 	userRepository := repository.NewUserRepository(repositoryRepository)
 	openaiTokenRepository := repository.NewOpenaiTokenRepository(repositoryRepository)
 	openaiAccountRepository := repository.NewOpenaiAccountRepository(repositoryRepository)
 	claudeTokenRepository := repository.NewClaudeTokenRepository(repositoryRepository)
 	claudeAccountRepository := repository.NewClaudeAccountRepository(repositoryRepository)
-	loginService := service.NewLoginService(serviceService, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository)
+	strikeRepository := repository.NewStrikeRepository(repositoryRepository)
+	loginService := service.NewLoginService(serviceService, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, strikeRepository, settingRepository)
 	loginHandler := handler.NewLoginHandler(handlerHandler, loginService)
-	coordinator := service.NewServiceCoordinator(serviceService, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository)
-	openaiAccountService := service.NewOpenaiAccountService(serviceService, openaiTokenRepository, openaiAccountRepository, coordinator)
+	coordinator := service.NewServiceCoordinator(serviceService, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, strikeRepository)
+	openaiAccountService := service.NewOpenaiAccountService(serviceService, openaiTokenRepository, openaiAccountRepository, strikeRepository, coordinator)
 	openaiAccountHandler := handler.NewOpenaiAccountHandler(handlerHandler, openaiAccountService)
 	openaiTokenService := service.NewOpenaiTokenService(serviceService, openaiTokenRepository, openaiAccountRepository, coordinator)
 	openaiTokenHandler := handler.NewOpenaiTokenHandler(handlerHandler, openaiTokenService)
-	userService := service.NewUserService(serviceService, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, coordinator)
+	userService := service.NewUserService(serviceService, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, strikeRepository, coordinator)
 	userHandler := handler.NewUserHandler(handlerHandler, userService)
 	claudeTokenService := service.NewClaudeTokenService(serviceService, claudeTokenRepository, claudeAccountRepository, coordinator)
 	claudeTokenHandler := handler.NewClaudeTokenHandler(handlerHandler, claudeTokenService)
-	claudeAccountService := service.NewClaudeAccountService(serviceService, claudeTokenRepository, claudeAccountRepository, coordinator)
+	claudeAccountService := service.NewClaudeAccountService(serviceService, claudeTokenRepository, claudeAccountRepository, strikeRepository, coordinator)
 	claudeAccountHandler := handler.NewClaudeAccountHandler(handlerHandler, claudeAccountService)
-	httpServer := server.NewHTTPServer(logger, jwtJWT, loginHandler, openaiAccountHandler, openaiTokenHandler, userHandler, claudeTokenHandler, claudeAccountHandler)
+	moderationRuleRepository := repository.NewModerationRuleRepository(repositoryRepository)
+	manager := moderation.NewManager(logger, moderationRuleRepository)
+	moderationRuleService := service.NewModerationRuleService(serviceService, moderationRuleRepository, manager)
+	moderationRuleHandler := handler.NewModerationRuleHandler(handlerHandler, moderationRuleService)
+	moderationEventRepository := repository.NewModerationEventRepository(repositoryRepository)
+	moderationEventService := service.NewModerationEventService(serviceService, moderationEventRepository)
+	moderationEventHandler := handler.NewModerationEventHandler(handlerHandler, moderationEventService)
+	strikeService := service.NewStrikeService(serviceService, strikeRepository, moderationEventRepository, userRepository, openaiAccountRepository, claudeAccountRepository, userService, coordinator)
+	strikeHandler := handler.NewStrikeHandler(handlerHandler, strikeService)
+	jobRepository := repository.NewJobRepository(repositoryRepository)
+	schedulerScheduler := scheduler.NewScheduler(logger, jobRepository)
+	jobService := service.NewJobService(serviceService, schedulerScheduler, jobRepository)
+	jobHandler := handler.NewJobHandler(handlerHandler, jobService)
+	settingService := service.NewSettingService(serviceService, settingRepository)
+	settingHandler := handler.NewSettingHandler(handlerHandler, settingService)
+	backupRepository := repository.NewBackupRepository(repositoryRepository)
+	backupService := service.NewBackupService(serviceService, backupRepository, settingRepository, manager)
+	backupHandler := handler.NewBackupHandler(handlerHandler, backupService)
+	reconcileRepository := repository.NewReconcileRepository(repositoryRepository)
+	reconcileService := service.NewReconcileService(serviceService, reconcileRepository, openaiTokenRepository, openaiAccountRepository, coordinator)
+	reconcileHandler := handler.NewReconcileHandler(handlerHandler, reconcileService)
+	reloader := server.NewCertReloader(logger)
+	metricsCollector := server.NewMetricsCollector(logger, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository)
+	httpServer := server.NewHTTPServer(logger, jwtJWT, settings, reloader, loginHandler, openaiAccountHandler, openaiTokenHandler, userHandler, claudeTokenHandler, claudeAccountHandler, moderationRuleHandler, moderationEventHandler, strikeHandler, jobHandler, settingHandler, backupHandler, reconcileHandler, metricsCollector)
 	conversationRepository := repository.NewConversationRepository(repositoryRepository)
 	conversationLoggerMiddleware := middleware.NewConversationLoggerMiddleware(logger, conversationRepository)
-	openaiServer := server.NewChatGPTReverseProxyServer(logger, conversationLoggerMiddleware)
-	claudeServer := server.NewClaudeReverseProxyServer(logger, conversationLoggerMiddleware)
+	moderationMiddleware := middleware.NewModerationMiddleware(logger, manager, jwtJWT, moderationEventService, strikeService, settings)
+	openaiServer := server.NewChatGPTReverseProxyServer(logger, reloader, conversationLoggerMiddleware, moderationMiddleware, settings)
+	claudeServer := server.NewClaudeReverseProxyServer(logger, reloader, conversationLoggerMiddleware, moderationMiddleware, settings, jwtJWT)
+	dispatchServer := server.NewDispatchServer(logger, reloader, httpServer, openaiServer, claudeServer)
+	httpsRedirect := server.NewHttpsRedirect(logger)
 	job := server.NewJob(logger)
-	task := server.NewTask(logger, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, userRepository, openaiAccountService, claudeAccountService)
-	migrate := server.NewMigrate(db, logger)
-	appApp := newApp(httpServer, openaiServer, claudeServer, job, task, migrate)
+	task := server.NewTask(logger, schedulerScheduler, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, userRepository, openaiAccountService, claudeAccountService, strikeService, backupService, reconcileService)
+	migrator := migration.NewMigrator(db, logger)
+	migrate := server.NewMigrate(migrator, logger)
+	appApp := newApp(httpServer, openaiServer, claudeServer, dispatchServer, reloader, httpsRedirect, job, task, migrate)
 	return appApp, func() {
 	}, nil
 }
 
+func NewAdminWire(logger *log.Logger) (*server.Admin, func(), error) {
+	db := repository.NewDB(logger)
+	migrator := migration.NewMigrator(db, logger)
+	migrate := server.NewMigrate(migrator, logger)
+	repositoryRepository := repository.NewRepository(logger, db)
+	transaction := repository.NewTransaction(repositoryRepository)
+	sidSid := sid.NewSid()
+	jwtJWT := jwt.NewJwt()
+	settingRepository := repository.NewSettingRepository(repositoryRepository)
+	settings := service.NewSettings(logger, settingRepository)
+	serviceService := service.NewService(transaction, logger, sidSid, jwtJWT, settings)
+	userRepository := repository.NewUserRepository(repositoryRepository)
+	openaiTokenRepository := repository.NewOpenaiTokenRepository(repositoryRepository)
+	openaiAccountRepository := repository.NewOpenaiAccountRepository(repositoryRepository)
+	claudeTokenRepository := repository.NewClaudeTokenRepository(repositoryRepository)
+	claudeAccountRepository := repository.NewClaudeAccountRepository(repositoryRepository)
+	strikeRepository := repository.NewStrikeRepository(repositoryRepository)
+	loginService := service.NewLoginService(serviceService, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, strikeRepository, settingRepository)
+	coordinator := service.NewServiceCoordinator(serviceService, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, strikeRepository)
+	userService := service.NewUserService(serviceService, userRepository, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, strikeRepository, coordinator)
+	openaiTokenService := service.NewOpenaiTokenService(serviceService, openaiTokenRepository, openaiAccountRepository, coordinator)
+	claudeTokenService := service.NewClaudeTokenService(serviceService, claudeTokenRepository, claudeAccountRepository, coordinator)
+	jobRepository := repository.NewJobRepository(repositoryRepository)
+	schedulerScheduler := scheduler.NewScheduler(logger, jobRepository)
+	openaiAccountService := service.NewOpenaiAccountService(serviceService, openaiTokenRepository, openaiAccountRepository, strikeRepository, coordinator)
+	claudeAccountService := service.NewClaudeAccountService(serviceService, claudeTokenRepository, claudeAccountRepository, strikeRepository, coordinator)
+	moderationEventRepository := repository.NewModerationEventRepository(repositoryRepository)
+	strikeService := service.NewStrikeService(serviceService, strikeRepository, moderationEventRepository, userRepository, openaiAccountRepository, claudeAccountRepository, userService, coordinator)
+	backupRepository := repository.NewBackupRepository(repositoryRepository)
+	moderationRuleRepository := repository.NewModerationRuleRepository(repositoryRepository)
+	manager := moderation.NewManager(logger, moderationRuleRepository)
+	backupService := service.NewBackupService(serviceService, backupRepository, settingRepository, manager)
+	reconcileRepository := repository.NewReconcileRepository(repositoryRepository)
+	reconcileService := service.NewReconcileService(serviceService, reconcileRepository, openaiTokenRepository, openaiAccountRepository, coordinator)
+	task := server.NewTask(logger, schedulerScheduler, openaiTokenRepository, openaiAccountRepository, claudeTokenRepository, claudeAccountRepository, userRepository, openaiAccountService, claudeAccountService, strikeService, backupService, reconcileService)
+	admin := server.NewAdmin(migrate, loginService, userService, openaiTokenService, claudeTokenService, schedulerScheduler, task)
+	return admin, func() {
+	}, nil
+}
+
+func NewMigratorWire(logger *log.Logger) (*migration.Migrator, func(), error) {
+	db := repository.NewDB(logger)
+	migrator := migration.NewMigrator(db, logger)
+	return migrator, func() {
+	}, nil
+}
+
 // wire.go:
 
-var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewOpenaiTokenRepository, repository.NewOpenaiAccountRepository, repository.NewClaudeTokenRepository, repository.NewClaudeAccountRepository, repository.NewConversationRepository, repository.NewUserRepository)
+var repositorySet = wire.NewSet(repository.NewDB, repository.NewRepository, repository.NewTransaction, repository.NewOpenaiTokenRepository, repository.NewOpenaiAccountRepository, repository.NewClaudeTokenRepository, repository.NewClaudeAccountRepository, repository.NewConversationRepository, repository.NewUserRepository, repository.NewModerationRuleRepository, repository.NewModerationEventRepository, repository.NewStrikeRepository, repository.NewJobRepository, repository.NewSettingRepository, repository.NewBackupRepository, repository.NewReconcileRepository)
 
 var serviceCoordinatorSet = wire.NewSet(service.NewServiceCoordinator)
 
-var serviceSet = wire.NewSet(service.NewService, serviceCoordinatorSet, service.NewLoginService, service.NewUserService, service.NewOpenaiTokenService, service.NewOpenaiAccountService, service.NewClaudeTokenService, service.NewClaudeAccountService, server.NewTask)
+var serviceSet = wire.NewSet(service.NewService, serviceCoordinatorSet, service.NewLoginService, service.NewUserService, service.NewOpenaiTokenService, service.NewOpenaiAccountService, service.NewClaudeTokenService, service.NewClaudeAccountService, service.NewModerationRuleService, service.NewModerationEventService, service.NewStrikeService, service.NewJobService, service.NewSettings, service.NewSettingService, service.NewBackupService, service.NewReconcileService, scheduler.NewScheduler, server.NewTask)
 
-var migrateSet = wire.NewSet(server.NewMigrate)
+var migrateSet = wire.NewSet(migration.NewMigrator, server.NewMigrate)
 
-var handlerSet = wire.NewSet(handler.NewHandler, handler.NewLoginHandler, handler.NewUserHandler, handler.NewOpenaiTokenHandler, handler.NewOpenaiAccountHandler, handler.NewClaudeTokenHandler, handler.NewClaudeAccountHandler)
+var handlerSet = wire.NewSet(handler.NewHandler, handler.NewLoginHandler, handler.NewUserHandler, handler.NewOpenaiTokenHandler, handler.NewOpenaiAccountHandler, handler.NewClaudeTokenHandler, handler.NewClaudeAccountHandler, handler.NewModerationRuleHandler, handler.NewModerationEventHandler, handler.NewStrikeHandler, handler.NewJobHandler, handler.NewSettingHandler, handler.NewBackupHandler, handler.NewReconcileHandler)
 
-var serverSet = wire.NewSet(server.NewHTTPServer, server.NewChatGPTReverseProxyServer, server.NewClaudeReverseProxyServer, server.NewJob)
+var serverSet = wire.NewSet(server.NewCertReloader, server.NewHttpsRedirect, server.NewMetricsCollector, server.NewHTTPServer, server.NewChatGPTReverseProxyServer, server.NewClaudeReverseProxyServer, server.NewDispatchServer, server.NewJob)
 
 // build App
-func newApp(httpServer *http.Server, openaiServer *openai.Server, claudeServer *claude.Server, job *server.Job, task *server.Task, migrate *server.Migrate) *app.App {
+func newApp(httpServer *http.Server, openaiServer *openai.Server, claudeServer *claude.Server, dispatchServer *dispatch.Server, reloader *certs.Reloader, redirect *server.HttpsRedirect, job *server.Job, task *server.Task, migrate *server.Migrate) *app.App {
 	servers := []server2.Server{
-		httpServer,
 		job,
-		migrate,
-		openaiServer,
-		claudeServer,
+	}
+	if config.GetConfig().SinglePort {
+		// 单端口模式下由分发服务器统一监听
+		servers = append(servers, dispatchServer)
+	} else {
+		servers = append(servers, httpServer, openaiServer, claudeServer)
+	}
+	if reloader != nil {
+		servers = append(servers, reloader)
+		if config.GetConfig().TlsRedirectHttp {
+			servers = append(servers, redirect)
+		}
 	}
 	if config.GetConfig().EnableTask {
 		servers = append(servers, task)
 	}
-	return app.NewApp(app.WithServer(servers...), app.WithName("demo-server"))
+	return app.NewApp(app.WithServer(servers...), app.WithName("demo-server"), app.WithBeforeStart(migrate.Run))
 }
@@ -7,58 +7,116 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
 )
 
 type Config struct {
-	DataDir            string
-	AdminPassword      string
-	ApiKey             string
-	TokenUrl           string
-	ShareTokenUrl      string
-	ShareTokenInfoUrl  string
-	CheckSubscribeUrl  string
-	OpenAiSite         string
-	OpenAiAuthSite     string
-	ClaudeSite         string
-	ClaudeAuthSite     string
-	ModerationEndpoint string
-	ModerationApiKey   string
-	ModerationMessage  string
-	HiddenUserInfo     bool
-	EnableTask         bool
-	LogFileName        string
-	LogLevel           string
-	LogMaxSize         int
-	LogMaxBackups      int
-	LogMaxAge          int
-	LogCompress        bool
-	LogEncoding        string
-	Env                string
-	DatabaseDriver     string
-	DatabaseDsn        string
-	AppKey             string
-	AppSecurity        string
-	HttpHost           string
-	ApiPort            int
-	OpenAiPort         int
-	ClaudePort         int
-	StartTime          time.Time
-	Version            string
-	Secret             string
+	DataDir                    string
+	AdminPassword              string
+	ApiKey                     string
+	TokenUrl                   string
+	ShareTokenUrl              string
+	ShareTokenInfoUrl          string
+	CheckSubscribeUrl          string
+	OpenAiSite                 string
+	OpenAiAuthSite             string
+	ClaudeSite                 string
+	ClaudeAuthSite             string
+	ModerationEndpoint         string
+	ModerationApiKey           string
+	ModerationMessage          string
+	ModerationProvidersChatGPT string
+	ModerationProvidersClaude  string
+	ModerationWebhookUrl       string
+	ModerationWebhookToken     string
+	ModerationCategories       string
+	ModerationCacheTtl         int
+	ModerationFailPolicy       string
+	ModerationTimeout          int
+	ModerationOutput           bool
+	ModerationOutputInterval   int
+	ModerationImageProviders   string
+	ModerationImageModel       string
+	ModerationImageMaxSize     int
+	StrikeSuspendMessage       string
+	StrikeDisableMessage       string
+	HiddenUserInfo             bool
+	ClaudeHiddenEmail          string
+	ClaudeHiddenName           string
+	ClaudeHiddenOrg            string
+	EnableTask                 bool
+	JobTimezone                string
+	JobRunRetention            int
+	JobLock                    bool
+	JobLockTtl                 int
+	JobInstance                string
+	RefreshWorkers             int
+	RefreshTimeout             int
+	UpstreamConcurrency        int
+	UpstreamHostConcurrency    string
+	LogFileName                string
+	LogLevel                   string
+	LogMaxSize                 int
+	LogMaxBackups              int
+	LogMaxAge                  int
+	LogCompress                bool
+	LogEncoding                string
+	Env                        string
+	DatabaseDriver             string
+	DatabaseDsn                string
+	DatabaseMaxIdleConns       int
+	DatabaseMaxOpenConns       int
+	DatabaseConnMaxLifetime    int
+	DatabaseConnMaxIdleTime    int
+	DatabaseAutoMigrate        bool
+	BackupKeep                 int
+	ReconcileAutoHeal          bool
+	AppKey                     string
+	AppSecurity                string
+	HttpHost                   string
+	ApiPort                    int
+	OpenAiPort                 int
+	ClaudePort                 int
+	SinglePort                 bool
+	ApiHostname                string
+	OpenAiHostname             string
+	ClaudeHostname             string
+	OpenAiPathPrefix           string
+	ClaudePathPrefix           string
+	TlsCertFile                string
+	TlsKeyFile                 string
+	TlsCerts                   string
+	TlsReloadInterval          int
+	TlsRedirectHttp            bool
+	TlsRedirectPort            int
+	MetricsToken               string
+	OtelExporter               string
+	OtelEndpoint               string
+	OtelServiceName            string
+	StartTime                  time.Time
+	Version                    string
+	Secret                     string
 }
 
+// ModerationEnable 是否配置了 OpenAI 审查接口
 func (config *Config) ModerationEnable() bool {
 	return config.ModerationEndpoint != "" && config.ModerationApiKey != ""
 }
 
-var globalConfig *Config
+// TlsEnable 是否配置了 HTTPS 证书
+func (config *Config) TlsEnable() bool {
+	return (config.TlsCertFile != "" && config.TlsKeyFile != "") || config.TlsCerts != ""
+}
+
+var globalConfig atomic.Pointer[Config]
 var Version = "0.0.0"
 var initMutex sync.Mutex
 
-// InitConfig 初始化全局配置
+// InitConfig 初始化全局配置, 配置有误时输出所有错误并退出
 func InitConfig() {
 	initMutex.Lock()
 	defer initMutex.Unlock()
@@ -69,70 +127,160 @@ func InitConfig() {
 		fmt.Printf("No .env file found")
 	}
 
+	file, err := configFile()
+	if err != nil {
+		exitWithErrors([]string{err.Error()})
+	}
+	v := viper.New()
+	if file != "" {
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			exitWithErrors([]string{fmt.Sprintf("read config file %s: %v", file, err)})
+		}
+	}
+	config, errs := loadConfig(v)
+	if len(errs) > 0 {
+		exitWithErrors(errs)
+	}
+	config.AdminPassword = getAdminPassword()
+	config.StartTime = time.Now()
+	config.Version = getVersion()
+	config.Secret = getSecret()
+	globalConfig.Store(config)
+
+	if file != "" {
+		fmt.Println("Loaded config file:", file)
+		watchConfig(v)
+	}
+}
+
+// loadConfig 从配置文件与环境变量构建配置, 返回未知配置项、无法解析和校验失败的错误
+func loadConfig(v *viper.Viper) (*Config, []string) {
+	values, err := readFile(v)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("config file %s: %v", v.ConfigFileUsed(), err)}
+	}
+	configSource.reset(values)
+	config := buildConfig()
+	errs := configSource.loadErrors()
+	for _, key := range configSource.unknown() {
+		errs = append(errs, fmt.Sprintf("unknown config key %s in %s", key, v.ConfigFileUsed()))
+	}
+	return config, append(errs, config.validate()...)
+}
+
+// exitWithErrors 输出配置错误并退出程序
+func exitWithErrors(errs []string) {
+	fmt.Println("Invalid configuration:")
+	for _, err := range errs {
+		fmt.Println("  -", err)
+	}
+	os.Exit(-1)
+}
+
+// buildConfig 读取所有配置项, 管理员密码、密钥等只在启动时生成的项由 InitConfig 填充
+func buildConfig() *Config {
 	dataDir := getEnvStr("DATA_DIR", "/data")
-	driver, dsn := getDbConfig(dataDir)
 	logFileName := fmt.Sprintf("%s/%s", dataDir, getEnvStr("LOG_FILE_NAME", "logs/server.log"))
 	apiKey := getEnvStr("API_KEY", "dad04481-fa3f-494e-b90c-b822128073e5")
 	defaultCheckSubscribeUrl := fmt.Sprintf("https://chat.oaifree.com/%s/backend-api/models?history_and_training_disabled=false", apiKey)
+	// 管理员密码与密钥只登记配置项, 避免配置文件中的这些项被视为未知项
+	configSource.lookup("ADMIN_PASSWORD")
+	configSource.lookup("SECRET")
+	configSource.lookup("VERSION")
+	configSource.lookup("CONFIG_FILE")
 
-	globalConfig = &Config{
-		DataDir:            dataDir,
-		AdminPassword:      getAdminPassword(),
-		ApiKey:             apiKey,
-		TokenUrl:           getEnvStr("TOKEN_URL", "https://token.oaifree.com/api/auth/refresh"),
-		ShareTokenUrl:      getEnvStr("SHARE_TOKEN_URL", "https://chat.oaifree.com/token/register"),
-		ShareTokenInfoUrl:  getEnvStr("SHARE_TOKEN_INFO_URL", "https://chat.oaifree.com/token/info"),
-		CheckSubscribeUrl:  getEnvStr("CHECK_SUBSCRIBE_URL", defaultCheckSubscribeUrl),
-		OpenAiSite:         getEnvStr("OPENAI_SITE", "https://new.oaifree.com"),
-		OpenAiAuthSite:     getEnvStr("OPENAI_AUTH_SITE|SHARE_TOKEN_AUTH", "https://new.oaifree.com"),
-		ClaudeSite:         getEnvStr("CLAUDE_SITE", "https://demo.fuclaude.com"),
-		ClaudeAuthSite:     getEnvStr("CLAUDE_AUTH_SITE|FUCLAUDE_LOGIN_AUTH", "https://demo.fuclaude.com"),
-		ModerationEndpoint: getEnvStr("MODERATION_ENDPOINT", "https://api.openai.com"),
-		ModerationApiKey:   getEnvStr("MODERATION_API_KEY", ""),
-		ModerationMessage:  getEnvStr("MODERATION_MESSAGE", "Your message has been blocked due to inappropriate content"),
-		HiddenUserInfo:     getEnvBool("HIDDEN_USER_INFO", false),
-		EnableTask:         getEnvBool("ENABLE_TASK", true),
-		LogFileName:        logFileName,
-		LogLevel:           getEnvStr("LOG_LEVEL", "info"),
-		LogMaxSize:         getEnvInt("LOG_MAX_SIZE", 10),
-		LogMaxBackups:      getEnvInt("LOG_MAX_BACKUPS", 15),
-		LogMaxAge:          getEnvInt("LOG_MAX_AGE", 30),
-		LogCompress:        getEnvBool("LOG_COMPRESS", true),
-		LogEncoding:        getEnvStr("LOG_ENCODING", "console"),
-		Env:                getEnvStr("ENV", "dev"),
-		DatabaseDriver:     driver,
-		DatabaseDsn:        dsn,
-		AppKey:             getEnvStr("APP_KEY", ""),
-		AppSecurity:        getEnvStr("APP_SECURITY", ""),
-		HttpHost:           getEnvStr("HTTP_HOST", "0.0.0.0"),
-		ApiPort:            getEnvInt("HTTP_PORT|API_PORT", 5000),
-		OpenAiPort:         getEnvInt("OPENAI_PORT", 5001),
-		ClaudePort:         getEnvInt("CLAUDE_PORT", 5002),
-		StartTime:          time.Now(),
-		Version:            getVersion(),
-		Secret:             getSecret(),
-	}
-}
-
-// getDbConfig 获取数据库配置
-func getDbConfig(dataDir string) (string, string) {
-	driver := getEnvStr("DATABASE_DRIVER", "sqlite")
-	dsn := ""
-	if driver == "sqlite" {
-		dsn = getEnvStr("DATABASE_DSN", "pandora-plus-helper.db")
-		dsn = fmt.Sprintf("%s/%s", dataDir, dsn)
-	} else if driver == "mysql" {
-		dsn = getEnvStr("DATABASE_DSN", "")
-		if len(dsn) == 0 {
-			// 未配置 mysql dsn,退出程序
-			fmt.Println("Database dsn not configured")
-			os.Exit(-1)
-		}
-	} else {
-		fmt.Println("Database driver not supported")
-		os.Exit(-1)
+	return &Config{
+		DataDir:                    dataDir,
+		ApiKey:                     apiKey,
+		TokenUrl:                   getEnvStr("TOKEN_URL", "https://token.oaifree.com/api/auth/refresh"),
+		ShareTokenUrl:              getEnvStr("SHARE_TOKEN_URL", "https://chat.oaifree.com/token/register"),
+		ShareTokenInfoUrl:          getEnvStr("SHARE_TOKEN_INFO_URL", "https://chat.oaifree.com/token/info"),
+		CheckSubscribeUrl:          getEnvStr("CHECK_SUBSCRIBE_URL", defaultCheckSubscribeUrl),
+		OpenAiSite:                 getEnvStr("OPENAI_SITE", "https://new.oaifree.com"),
+		OpenAiAuthSite:             getEnvStr("OPENAI_AUTH_SITE|SHARE_TOKEN_AUTH", "https://new.oaifree.com"),
+		ClaudeSite:                 getEnvStr("CLAUDE_SITE", "https://demo.fuclaude.com"),
+		ClaudeAuthSite:             getEnvStr("CLAUDE_AUTH_SITE|FUCLAUDE_LOGIN_AUTH", "https://demo.fuclaude.com"),
+		ModerationEndpoint:         getEnvStr("MODERATION_ENDPOINT", "https://api.openai.com"),
+		ModerationApiKey:           getEnvStr("MODERATION_API_KEY", ""),
+		ModerationMessage:          getEnvStr("MODERATION_MESSAGE", "Your message has been blocked due to inappropriate content"),
+		ModerationProvidersChatGPT: getEnvStr("MODERATION_PROVIDERS_CHATGPT", ""),
+		ModerationProvidersClaude:  getEnvStr("MODERATION_PROVIDERS_CLAUDE", ""),
+		ModerationWebhookUrl:       getEnvStr("MODERATION_WEBHOOK_URL", ""),
+		ModerationWebhookToken:     getEnvStr("MODERATION_WEBHOOK_TOKEN", ""),
+		ModerationCategories:       getEnvStr("MODERATION_CATEGORIES", ""),
+		ModerationCacheTtl:         getEnvInt("MODERATION_CACHE_TTL", 300),
+		ModerationFailPolicy:       getEnvStr("MODERATION_FAIL_POLICY", "closed"),
+		ModerationTimeout:          getEnvInt("MODERATION_TIMEOUT", 10),
+		ModerationOutput:           getEnvBool("MODERATION_OUTPUT", false),
+		ModerationOutputInterval:   getEnvInt("MODERATION_OUTPUT_INTERVAL", 500),
+		ModerationImageProviders:   getEnvStr("MODERATION_IMAGE_PROVIDERS", ""),
+		ModerationImageModel:       getEnvStr("MODERATION_IMAGE_MODEL", "omni-moderation-latest"),
+		ModerationImageMaxSize:     getEnvInt("MODERATION_IMAGE_MAX_SIZE", 20),
+		StrikeSuspendMessage:       getEnvStr("STRIKE_SUSPEND_MESSAGE", "Your account has been suspended until {until} due to repeated policy violations"),
+		StrikeDisableMessage:       getEnvStr("STRIKE_DISABLE_MESSAGE", "Your account has been disabled due to repeated policy violations"),
+		HiddenUserInfo:             getEnvBool("HIDDEN_USER_INFO", false),
+		ClaudeHiddenEmail:          getEnvStr("CLAUDE_HIDDEN_EMAIL", "admin@anthropic.com"),
+		ClaudeHiddenName:           getEnvStr("CLAUDE_HIDDEN_NAME", "admin"),
+		ClaudeHiddenOrg:            getEnvStr("CLAUDE_HIDDEN_ORGANIZATION", "Organization"),
+		EnableTask:                 getEnvBool("ENABLE_TASK", true),
+		JobTimezone:                getEnvStr("JOB_TIMEZONE", "UTC"),
+		JobRunRetention:            getEnvInt("JOB_RUN_RETENTION", 30),
+		JobLock:                    getEnvBool("JOB_LOCK", true),
+		JobLockTtl:                 getEnvInt("JOB_LOCK_TTL", 60),
+		JobInstance:                getEnvStr("JOB_INSTANCE", ""),
+		RefreshWorkers:             getEnvInt("REFRESH_WORKERS", 8),
+		RefreshTimeout:             getEnvInt("REFRESH_TIMEOUT", 60),
+		UpstreamConcurrency:        getEnvInt("UPSTREAM_CONCURRENCY", 4),
+		UpstreamHostConcurrency:    getEnvStr("UPSTREAM_HOST_CONCURRENCY", ""),
+		LogFileName:                logFileName,
+		LogLevel:                   getEnvStr("LOG_LEVEL", "info"),
+		LogMaxSize:                 getEnvInt("LOG_MAX_SIZE", 10),
+		LogMaxBackups:              getEnvInt("LOG_MAX_BACKUPS", 15),
+		LogMaxAge:                  getEnvInt("LOG_MAX_AGE", 30),
+		LogCompress:                getEnvBool("LOG_COMPRESS", true),
+		LogEncoding:                getEnvStr("LOG_ENCODING", "console"),
+		Env:                        getEnvStr("ENV", "dev"),
+		DatabaseDriver:             getEnvStr("DATABASE_DRIVER", "sqlite"),
+		DatabaseDsn:                getDbDsn(dataDir),
+		DatabaseMaxIdleConns:       getEnvInt("DATABASE_MAX_IDLE_CONNS", 10),
+		DatabaseMaxOpenConns:       getEnvInt("DATABASE_MAX_OPEN_CONNS", 100),
+		DatabaseConnMaxLifetime:    getEnvInt("DATABASE_CONN_MAX_LIFETIME", 3600),
+		DatabaseConnMaxIdleTime:    getEnvInt("DATABASE_CONN_MAX_IDLE_TIME", 0),
+		DatabaseAutoMigrate:        getEnvBool("DATABASE_AUTO_MIGRATE", true),
+		BackupKeep:                 getEnvInt("BACKUP_KEEP", 7),
+		ReconcileAutoHeal:          getEnvBool("RECONCILE_AUTO_HEAL", false),
+		AppKey:                     getEnvStr("APP_KEY", ""),
+		AppSecurity:                getEnvStr("APP_SECURITY", ""),
+		HttpHost:                   getEnvStr("HTTP_HOST", "0.0.0.0"),
+		ApiPort:                    getEnvInt("HTTP_PORT|API_PORT", 5000),
+		OpenAiPort:                 getEnvInt("OPENAI_PORT", 5001),
+		ClaudePort:                 getEnvInt("CLAUDE_PORT", 5002),
+		SinglePort:                 getEnvBool("SINGLE_PORT", false),
+		ApiHostname:                getEnvStr("API_HOSTNAME", ""),
+		OpenAiHostname:             getEnvStr("OPENAI_HOSTNAME", ""),
+		ClaudeHostname:             getEnvStr("CLAUDE_HOSTNAME", ""),
+		OpenAiPathPrefix:           getEnvStr("OPENAI_PATH_PREFIX", ""),
+		ClaudePathPrefix:           getEnvStr("CLAUDE_PATH_PREFIX", ""),
+		TlsCertFile:                getEnvStr("TLS_CERT_FILE", ""),
+		TlsKeyFile:                 getEnvStr("TLS_KEY_FILE", ""),
+		TlsCerts:                   getEnvStr("TLS_CERTS", ""),
+		TlsReloadInterval:          getEnvInt("TLS_RELOAD_INTERVAL", 30),
+		TlsRedirectHttp:            getEnvBool("TLS_REDIRECT_HTTP", false),
+		TlsRedirectPort:            getEnvInt("TLS_REDIRECT_PORT", 80),
+		MetricsToken:               getEnvStr("METRICS_TOKEN", ""),
+		OtelExporter:               getEnvStr("OTEL_EXPORTER", ""),
+		OtelEndpoint:               getEnvStr("OTEL_ENDPOINT", ""),
+		OtelServiceName:            getEnvStr("OTEL_SERVICE_NAME", "PandoraFuclaudePlusHelper"),
 	}
-	return driver, dsn
+}
+
+// getDbDsn 获取数据库连接, sqlite 的数据库文件位于数据目录下
+func getDbDsn(dataDir string) string {
+	if getEnvStr("DATABASE_DRIVER", "sqlite") == "sqlite" {
+		return fmt.Sprintf("%s/%s", dataDir, getEnvStr("DATABASE_DSN", "pandora-plus-helper.db"))
+	}
+	return getEnvStr("DATABASE_DSN", "")
 }
 
 // getAdminPassword 获取管理员密码
@@ -180,67 +328,54 @@ func getVersion() string {
 	return getEnvStr("VERSION", "0.0.0")
 }
 
-// getEnvStr 返回第一个存在的环境变量的值，如果都不存在，则返回 defaultValue。
+// GetJobEnv 返回定时任务的环境变量配置, 例如 JOB_REFRESH_ALL_TOKEN_CRON, 未配置的项为空
+func GetJobEnv(job string) (cron string, timezone string, enable string) {
+	prefix := "JOB_" + strings.ToUpper(job) + "_"
+	return getEnvStr(prefix+"CRON", ""), getEnvStr(prefix+"TIMEZONE", ""), getEnvStr(prefix+"ENABLE", "")
+}
+
+// getEnvStr 返回第一个存在的配置项的值，环境变量优先于配置文件，如果都不存在，则返回 defaultValue。
 func getEnvStr(key, defaultValue string) string {
-	// 用 "|" 分割 key 字符串，处理多个环境变量名。
-	keys := strings.Split(key, "|")
-	// 遍历所有的键名。
-	for _, k := range keys {
-		// 检查环境变量是否存在。
-		if value, exists := os.LookupEnv(k); exists {
-			// 如果找到，返回环境变量的值。
-			return value
-		}
+	if _, value, exists := configSource.lookup(key); exists {
+		return value
 	}
-	// 如果所有环境变量都不存在，返回默认值。
 	return defaultValue
 }
 
-// getEnvInt 返回第一个存在的环境变量的整数值，如果都不存在或转换失败，则返回默认值。
+// getEnvInt 返回第一个存在的配置项的整数值，如果都不存在，则返回默认值，无法转换时记录配置错误。
 func getEnvInt(key string, defaultValue int) int {
-	// 用 "|" 分割 key 字符串，支持多个环境变量名。
-	keys := strings.Split(key, "|")
-	// 遍历所有的键名。
-	for _, k := range keys {
-		// 检查环境变量是否存在。
-		if value, exists := os.LookupEnv(k); exists {
-			// 尝试将字符串转换为整数。
-			intValue, err := strconv.Atoi(value)
-			if err == nil {
-				// 如果转换成功，返回整数值。
-				return intValue
-			}
-		}
+	name, value, exists := configSource.lookup(key)
+	if !exists {
+		return defaultValue
 	}
-	// 如果所有环境变量都不存在或转换失败，返回默认值。
-	return defaultValue
+	intValue, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		configSource.invalid(name, value, "integer")
+		return defaultValue
+	}
+	return intValue
 }
 
-// getEnvBool 返回第一个存在的环境变量的布尔值，如果都不存在或转换失败，则返回默认值。
+// getEnvBool 返回第一个存在的配置项的布尔值，如果都不存在，则返回默认值，无法转换时记录配置错误。
 func getEnvBool(key string, defaultValue bool) bool {
-	// 用 "|" 分割 key 字符串，支持多个环境变量名。
-	keys := strings.Split(key, "|")
-	// 遍历所有的键名。
-	for _, k := range keys {
-		// 检查环境变量是否存在。
-		if value, exists := os.LookupEnv(k); exists {
-			// 尝试将字符串转换为布尔值。
-			boolValue, err := strconv.ParseBool(value)
-			if err == nil {
-				// 如果转换成功，返回布尔值。
-				return boolValue
-			}
-		}
+	name, value, exists := configSource.lookup(key)
+	if !exists {
+		return defaultValue
 	}
-	// 如果所有环境变量都不存在或转换失败，返回默认值。
-	return defaultValue
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		configSource.invalid(name, value, "boolean")
+		return defaultValue
+	}
+	return boolValue
 }
 
-// GetConfig 提供全局配置的访问
+// GetConfig 提供全局配置的访问, 配置热更新后返回新的配置
 func GetConfig() *Config {
-	if globalConfig == nil {
+	config := globalConfig.Load()
+	if config == nil {
 		fmt.Printf("Config is not initialized")
 		os.Exit(-1)
 	}
-	return globalConfig
+	return config
 }
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// secretFields 输出配置时只显示是否已配置的密码与密钥
+var secretFields = map[string]bool{
+	"AdminPassword":          true,
+	"ApiKey":                 true,
+	"ModerationApiKey":       true,
+	"ModerationWebhookToken": true,
+	"AppKey":                 true,
+	"AppSecurity":            true,
+	"MetricsToken":           true,
+	"Secret":                 true,
+}
+
+// dsnPasswordPatterns 数据库连接串中的密码: mysql 的 user:password@, postgres 的 password=
+var dsnPasswordPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^([^:@/]*):(.*)@`),
+	regexp.MustCompile(`(password=)('[^']*'|\S*)`),
+}
+
+// Item 一项配置及其生效的值
+type Item struct {
+	Name  string
+	Value string
+}
+
+// Masked 按字段顺序返回全部配置, 密码与密钥替换为 ******, 其他配置中出现的密钥(例如包含 API_KEY 的默认地址)
+// 同样替换, 数据库连接串与地址隐藏其中的密码
+func (config *Config) Masked() []Item {
+	value := reflect.ValueOf(config).Elem()
+	var secrets []string
+	for i := 0; i < value.NumField(); i++ {
+		if s, ok := value.Field(i).Interface().(string); ok && s != "" && secretFields[value.Type().Field(i).Name] {
+			secrets = append(secrets, s)
+		}
+	}
+	// 先替换较长的密钥, 避免一个密钥是另一个的一部分时只替换了一半
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+
+	items := make([]Item, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		field := value.Field(i).Interface()
+		var s string
+		switch v := field.(type) {
+		case time.Time:
+			s = v.Format(time.DateTime)
+		case string:
+			s = v
+			if secretFields[name] && s != "" {
+				s = "******"
+				break
+			}
+			for _, secret := range secrets {
+				s = strings.ReplaceAll(s, secret, "******")
+			}
+			if name == "DatabaseDsn" || strings.HasSuffix(name, "Url") || strings.HasSuffix(name, "Endpoint") {
+				s = maskDsn(s)
+			}
+		default:
+			s = fmt.Sprint(v)
+		}
+		items = append(items, Item{Name: name, Value: s})
+	}
+	return items
+}
+
+// maskDsn 隐藏数据库连接串或地址中的密码
+func maskDsn(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			// 星号在 URL 中会被转义, 先替换为占位符
+			u.User = url.UserPassword(u.User.Username(), "MASKED")
+			return strings.Replace(u.String(), ":MASKED@", ":******@", 1)
+		}
+		return dsn
+	}
+	dsn = dsnPasswordPatterns[0].ReplaceAllString(dsn, "$1:******@")
+	return dsnPasswordPatterns[1].ReplaceAllString(dsn, "${1}******")
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// reloadable 可以在运行中通过配置文件修改的配置项, 其余配置项修改后需要重启
+var reloadable = []string{
+	"ModerationEndpoint",
+	"ModerationApiKey",
+	"ModerationMessage",
+	"ModerationProvidersChatGPT",
+	"ModerationProvidersClaude",
+	"ModerationWebhookUrl",
+	"ModerationWebhookToken",
+	"ModerationCategories",
+	"ModerationCacheTtl",
+	"ModerationFailPolicy",
+	"ModerationTimeout",
+	"ModerationOutput",
+	"ModerationOutputInterval",
+	"ModerationImageProviders",
+	"ModerationImageModel",
+	"ModerationImageMaxSize",
+	"StrikeSuspendMessage",
+	"StrikeDisableMessage",
+	"HiddenUserInfo",
+	"ClaudeHiddenEmail",
+	"ClaudeHiddenName",
+	"ClaudeHiddenOrg",
+	"JobRunRetention",
+	"RefreshWorkers",
+	"RefreshTimeout",
+	"UpstreamConcurrency",
+	"UpstreamHostConcurrency",
+	"BackupKeep",
+	"ReconcileAutoHeal",
+}
+
+var (
+	reloadMutex     sync.Mutex
+	reloadCallbacks []func(config *Config)
+)
+
+// OnReload 注册配置热更新后的回调, 用于重建依赖配置的组件
+func OnReload(callback func(config *Config)) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	reloadCallbacks = append(reloadCallbacks, callback)
+}
+
+// watchConfig 监听配置文件变化, 校验通过后只更新可热更新的配置项, 校验失败时保留当前配置
+func watchConfig(v *viper.Viper) {
+	v.OnConfigChange(func(event fsnotify.Event) {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+
+		loaded, errs := loadConfig(v)
+		if len(errs) > 0 {
+			fmt.Println("Config file changed but is invalid, keeping current config:")
+			for _, err := range errs {
+				fmt.Println("  -", err)
+			}
+			return
+		}
+
+		current := GetConfig()
+		next := *current
+		target := reflect.ValueOf(&next).Elem()
+		source := reflect.ValueOf(loaded).Elem()
+		for _, name := range reloadable {
+			target.FieldByName(name).Set(source.FieldByName(name))
+		}
+		if restart := changedFields(&next, loaded); len(restart) > 0 {
+			fmt.Println("Config changes require restart:", restart)
+		}
+		if reflect.DeepEqual(*current, next) {
+			return
+		}
+		globalConfig.Store(&next)
+		fmt.Println("Config reloaded from", event.Name)
+		for _, callback := range reloadCallbacks {
+			callback(&next)
+		}
+	})
+	v.WatchConfig()
+}
+
+// changedFields 返回 loaded 中与当前配置不同且不能热更新的配置项, 启动时生成的配置项不参与比较
+func changedFields(current *Config, loaded *Config) []string {
+	var fields []string
+	a := reflect.ValueOf(current).Elem()
+	b := reflect.ValueOf(loaded).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		switch name := a.Type().Field(i).Name; name {
+		case "AdminPassword", "Secret", "StartTime", "Version":
+		default:
+			if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields
+}
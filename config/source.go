@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// source 配置来源, 环境变量优先于配置文件
+type source struct {
+	mu sync.RWMutex
+	// file 配置文件中的值, 键为大写的环境变量名
+	file map[string]string
+	// known 读取过的配置项, 用于检查配置文件中的未知项
+	known map[string]bool
+	// errors 本次加载中无法解析的配置项
+	errors []string
+}
+
+var configSource = &source{file: map[string]string{}, known: map[string]bool{}}
+
+// jobKeyPattern 定时任务的配置项按任务名称动态读取, 见 GetJobEnv
+var jobKeyPattern = regexp.MustCompile(`^JOB_[A-Z0-9_]+_(CRON|TIMEZONE|ENABLE)$`)
+
+// configFile 返回配置文件路径, 未通过 CONFIG_FILE 指定时依次查找当前目录与数据目录下的 config.yaml、config.yml、config.toml
+func configFile() (string, error) {
+	if file, ok := os.LookupEnv("CONFIG_FILE"); ok && file != "" {
+		if _, err := os.Stat(file); err != nil {
+			return "", fmt.Errorf("CONFIG_FILE %s: %w", file, err)
+		}
+		return file, nil
+	}
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "/data"
+	}
+	for _, dir := range []string{".", dataDir} {
+		for _, name := range []string{"config.yaml", "config.yml", "config.toml"} {
+			file := filepath.Join(dir, name)
+			if _, err := os.Stat(file); err == nil {
+				return file, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// readFile 读取配置文件, 嵌套的键用下划线连接, 例如 moderation.message 对应 MODERATION_MESSAGE
+func readFile(v *viper.Viper) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, key := range v.AllKeys() {
+		name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		value := v.Get(key)
+		if list, ok := value.([]interface{}); ok {
+			items := make([]string, 0, len(list))
+			for _, item := range list {
+				items = append(items, cast.ToString(item))
+			}
+			values[name] = strings.Join(items, ",")
+			continue
+		}
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+// reset 开始一次加载, 替换配置文件中的值并清空错误
+func (s *source) reset(file map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file = file
+	s.known = map[string]bool{}
+	s.errors = nil
+}
+
+// lookup 依次查找 key 中 "|" 分隔的各个名称, 环境变量优先于配置文件
+func (s *source) lookup(key string) (string, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := strings.Split(key, "|")
+	for _, k := range keys {
+		s.known[k] = true
+	}
+	for _, k := range keys {
+		if value, exists := os.LookupEnv(k); exists {
+			return k, value, true
+		}
+	}
+	for _, k := range keys {
+		if value, exists := s.file[k]; exists {
+			return k, value, true
+		}
+	}
+	return "", "", false
+}
+
+func (s *source) invalid(key string, value string, expect string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, fmt.Sprintf("%s=%q is not a valid %s", key, value, expect))
+}
+
+// unknown 返回配置文件中没有对应配置项的键
+func (s *source) unknown() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key := range s.file {
+		if !s.known[key] && !jobKeyPattern.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *source) loadErrors() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.errors...)
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type intItem struct {
+	name  string
+	value int
+}
+
+type strItem struct {
+	name  string
+	value string
+}
+
+// validate 检查配置项的取值, 返回所有错误以便启动时一次性提示
+func (config *Config) validate() []string {
+	var errs []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	for _, item := range []intItem{
+		{"HTTP_PORT", config.ApiPort},
+		{"OPENAI_PORT", config.OpenAiPort},
+		{"CLAUDE_PORT", config.ClaudePort},
+		{"TLS_REDIRECT_PORT", config.TlsRedirectPort},
+	} {
+		check(item.value > 0 && item.value <= 65535, "%s=%d must be between 1 and 65535", item.name, item.value)
+	}
+
+	for _, item := range []strItem{
+		{"TOKEN_URL", config.TokenUrl},
+		{"SHARE_TOKEN_URL", config.ShareTokenUrl},
+		{"SHARE_TOKEN_INFO_URL", config.ShareTokenInfoUrl},
+		{"CHECK_SUBSCRIBE_URL", config.CheckSubscribeUrl},
+		{"OPENAI_SITE", config.OpenAiSite},
+		{"OPENAI_AUTH_SITE", config.OpenAiAuthSite},
+		{"CLAUDE_SITE", config.ClaudeSite},
+		{"CLAUDE_AUTH_SITE", config.ClaudeAuthSite},
+		{"MODERATION_ENDPOINT", config.ModerationEndpoint},
+	} {
+		check(validUrl(item.value), "%s=%q must be an absolute http(s) url", item.name, item.value)
+	}
+	if config.ModerationWebhookUrl != "" {
+		check(validUrl(config.ModerationWebhookUrl), "MODERATION_WEBHOOK_URL=%q must be an absolute http(s) url", config.ModerationWebhookUrl)
+	}
+
+	for _, item := range []intItem{
+		{"MODERATION_CACHE_TTL", config.ModerationCacheTtl},
+		{"MODERATION_TIMEOUT", config.ModerationTimeout},
+		{"MODERATION_OUTPUT_INTERVAL", config.ModerationOutputInterval},
+		{"MODERATION_IMAGE_MAX_SIZE", config.ModerationImageMaxSize},
+		{"JOB_RUN_RETENTION", config.JobRunRetention},
+		{"REFRESH_TIMEOUT", config.RefreshTimeout},
+		{"LOG_MAX_SIZE", config.LogMaxSize},
+		{"LOG_MAX_BACKUPS", config.LogMaxBackups},
+		{"LOG_MAX_AGE", config.LogMaxAge},
+		{"TLS_RELOAD_INTERVAL", config.TlsReloadInterval},
+		{"DATABASE_MAX_IDLE_CONNS", config.DatabaseMaxIdleConns},
+		{"DATABASE_MAX_OPEN_CONNS", config.DatabaseMaxOpenConns},
+		{"DATABASE_CONN_MAX_LIFETIME", config.DatabaseConnMaxLifetime},
+		{"DATABASE_CONN_MAX_IDLE_TIME", config.DatabaseConnMaxIdleTime},
+		{"BACKUP_KEEP", config.BackupKeep},
+	} {
+		check(item.value >= 0, "%s=%d must not be negative", item.name, item.value)
+	}
+	for _, item := range []intItem{
+		{"JOB_LOCK_TTL", config.JobLockTtl},
+		{"REFRESH_WORKERS", config.RefreshWorkers},
+		{"UPSTREAM_CONCURRENCY", config.UpstreamConcurrency},
+	} {
+		check(item.value > 0, "%s=%d must be greater than 0", item.name, item.value)
+	}
+	for _, entry := range strings.Split(config.UpstreamHostConcurrency, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		host, value, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		check(ok && strings.TrimSpace(host) != "" && err == nil && n > 0, "UPSTREAM_HOST_CONCURRENCY item %q must be host=n with n greater than 0", entry)
+	}
+
+	policy := strings.ToLower(config.ModerationFailPolicy)
+	check(policy == "open" || policy == "closed", "MODERATION_FAIL_POLICY=%q must be open or closed", config.ModerationFailPolicy)
+	check(oneOf(config.LogLevel, "debug", "info", "warn", "error"), "LOG_LEVEL=%q must be debug, info, warn or error", config.LogLevel)
+	check(oneOf(config.LogEncoding, "console", "json"), "LOG_ENCODING=%q must be console or json", config.LogEncoding)
+	check(oneOf(config.DatabaseDriver, "sqlite", "mysql", "postgres"), "DATABASE_DRIVER=%q must be sqlite, mysql or postgres", config.DatabaseDriver)
+	check(config.DatabaseDriver == "sqlite" || config.DatabaseDsn != "", "DATABASE_DSN must be configured for %s", config.DatabaseDriver)
+	_, err := time.LoadLocation(config.JobTimezone)
+	check(err == nil, "JOB_TIMEZONE=%q is not a valid time zone", config.JobTimezone)
+	return errs
+}
+
+func validUrl(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func oneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
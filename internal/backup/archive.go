@@ -0,0 +1,305 @@
+package backup
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"reflect"
+	"time"
+)
+
+// FormatVersion 备份文件的格式版本, 格式不兼容时递增
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+// ErrInvalidArchive 备份文件损坏或不是本程序生成的备份
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Tables 备份的数据表, 任务执行记录、任务租约与对账结果属于运行状态, 不备份
+var Tables = []Table{
+	&model.User{},
+	&model.OpenaiToken{},
+	&model.OpenaiAccount{},
+	&model.ClaudeToken{},
+	&model.ClaudeAccount{},
+	&model.ModerationRule{},
+	&model.ModerationEvent{},
+	&model.StrikePolicy{},
+	&model.UserSuspension{},
+	&model.JobConfig{},
+	&model.Setting{},
+	&model.Conversation{},
+}
+
+// Table 备份的数据表对应的模型
+type Table interface {
+	TableName() string
+}
+
+// localRow 只属于当前部署的数据(例如重置后的管理员密码), 备份时不导出, 恢复时跳过
+type localRow interface {
+	Local() bool
+}
+
+func isLocal(row interface{}) bool {
+	local, ok := row.(localRow)
+	return ok && local.Local()
+}
+
+// GetTable 按表名查找模型, 不存在时返回 nil
+func GetTable(name string) Table {
+	for _, table := range Tables {
+		if table.TableName() == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// Manifest 备份文件的说明, 恢复前用于校验
+type Manifest struct {
+	Format        int          `json:"format"`
+	AppVersion    string       `json:"appVersion"`
+	SchemaVersion int64        `json:"schemaVersion"`
+	Driver        string       `json:"driver"`
+	CreateTime    time.Time    `json:"createTime"`
+	Tables        []*TableInfo `json:"tables"`
+}
+
+// TableInfo 备份中的一张表, 数据按行保存为 JSON Lines
+type TableInfo struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Sha256 string `json:"sha256"`
+}
+
+func tableFile(name string) string {
+	return "tables/" + name + ".jsonl"
+}
+
+// Writer 写入备份文件, 先依次写入各表, 最后写入说明
+type Writer struct {
+	zw       *zip.Writer
+	manifest *Manifest
+}
+
+func NewWriter(w io.Writer, manifest *Manifest) *Writer {
+	manifest.Format = FormatVersion
+	manifest.Tables = nil
+	return &Writer{zw: zip.NewWriter(w), manifest: manifest}
+}
+
+// TableWriter 写入一张表的数据
+type TableWriter struct {
+	info *TableInfo
+	w    io.Writer
+	hash hash.Hash
+	enc  *json.Encoder
+}
+
+// Table 开始写入一张表, 写入下一张表前之前的表自动结束
+func (w *Writer) Table(name string) (*TableWriter, error) {
+	f, err := w.create(tableFile(name))
+	if err != nil {
+		return nil, err
+	}
+	info := &TableInfo{Name: name}
+	w.manifest.Tables = append(w.manifest.Tables, info)
+	h := sha256.New()
+	return &TableWriter{info: info, w: f, hash: h, enc: json.NewEncoder(io.MultiWriter(f, h))}, nil
+}
+
+// Write 写入一批数据, rows 为模型的切片
+func (t *TableWriter) Write(rows interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(rows))
+	for i := 0; i < v.Len(); i++ {
+		if isLocal(v.Index(i).Interface()) {
+			continue
+		}
+		if err := t.enc.Encode(v.Index(i).Interface()); err != nil {
+			return err
+		}
+		t.info.Rows++
+	}
+	t.info.Sha256 = hex.EncodeToString(t.hash.Sum(nil))
+	return nil
+}
+
+func (w *Writer) create(name string) (io.Writer, error) {
+	return w.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: w.manifest.CreateTime,
+	})
+}
+
+// Close 写入说明并结束备份文件
+func (w *Writer) Close() error {
+	for _, info := range w.manifest.Tables {
+		if info.Sha256 == "" {
+			info.Sha256 = hex.EncodeToString(sha256.New().Sum(nil))
+		}
+	}
+	f, err := w.create(manifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(w.manifest); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// Reader 读取备份文件
+type Reader struct {
+	zr       *zip.ReadCloser
+	files    map[string]*zip.File
+	Manifest *Manifest
+}
+
+// Open 打开备份文件并读取说明
+func Open(path string) (*Reader, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	r := &Reader{zr: zr, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		r.files[f.Name] = f
+	}
+	f, ok := r.files[manifestName]
+	if !ok {
+		zr.Close()
+		return nil, fmt.Errorf("%w: %s not found", ErrInvalidArchive, manifestName)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+	r.Manifest = new(Manifest)
+	if err := json.NewDecoder(rc).Decode(r.Manifest); err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, manifestName, err)
+	}
+	return r, nil
+}
+
+func (r *Reader) Close() error {
+	return r.zr.Close()
+}
+
+// Validate 校验备份格式、数据库结构版本以及每张表的行数、校验和与数据, 不修改数据库
+func (r *Reader) Validate(schemaVersion int64) error {
+	m := r.Manifest
+	if m.Format != FormatVersion {
+		return fmt.Errorf("%w: unsupported format %d", ErrInvalidArchive, m.Format)
+	}
+	if m.SchemaVersion > schemaVersion {
+		return fmt.Errorf("%w: backup schema version %d is newer than database schema version %d", ErrInvalidArchive, m.SchemaVersion, schemaVersion)
+	}
+	seen := make(map[string]bool)
+	for _, info := range m.Tables {
+		table := GetTable(info.Name)
+		if table == nil {
+			return fmt.Errorf("%w: unknown table %s", ErrInvalidArchive, info.Name)
+		}
+		if seen[info.Name] {
+			return fmt.Errorf("%w: duplicate table %s", ErrInvalidArchive, info.Name)
+		}
+		seen[info.Name] = true
+		h := sha256.New()
+		var rows int64
+		err := r.rows(table, info, 500, h, func(batch interface{}) error {
+			rows += int64(reflect.ValueOf(batch).Elem().Len())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if rows != info.Rows {
+			return fmt.Errorf("%w: table %s has %d rows, expected %d", ErrInvalidArchive, info.Name, rows, info.Rows)
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != info.Sha256 {
+			return fmt.Errorf("%w: table %s checksum mismatch", ErrInvalidArchive, info.Name)
+		}
+	}
+	return nil
+}
+
+// Rows 按批读取一张表的数据, fn 的参数为指向模型切片的指针, 旧版本备份中只属于当前部署的数据被跳过
+func (r *Reader) Rows(info *TableInfo, batch int, fn func(rows interface{}) error) error {
+	table := GetTable(info.Name)
+	if table == nil {
+		return fmt.Errorf("%w: unknown table %s", ErrInvalidArchive, info.Name)
+	}
+	return r.rows(table, info, batch, io.Discard, func(rows interface{}) error {
+		v := reflect.ValueOf(rows).Elem()
+		kept := reflect.New(v.Type())
+		for i := 0; i < v.Len(); i++ {
+			if !isLocal(v.Index(i).Interface()) {
+				kept.Elem().Set(reflect.Append(kept.Elem(), v.Index(i)))
+			}
+		}
+		return fn(kept.Interface())
+	})
+}
+
+func (r *Reader) rows(table Table, info *TableInfo, batch int, h io.Writer, fn func(rows interface{}) error) error {
+	f, ok := r.files[tableFile(info.Name)]
+	if !ok {
+		return fmt.Errorf("%w: %s not found", ErrInvalidArchive, tableFile(info.Name))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer rc.Close()
+
+	elemType := reflect.TypeOf(table).Elem()
+	newBatch := func() reflect.Value {
+		return reflect.New(reflect.SliceOf(reflect.PointerTo(elemType)))
+	}
+	rows := newBatch()
+	scanner := bufio.NewScanner(io.TeeReader(rc, h))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		row := reflect.New(elemType)
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(row.Interface()); err != nil {
+			return fmt.Errorf("%w: table %s line %d: %v", ErrInvalidArchive, info.Name, line, err)
+		}
+		rows.Elem().Set(reflect.Append(rows.Elem(), row))
+		if rows.Elem().Len() >= batch {
+			if err := fn(rows.Interface()); err != nil {
+				return err
+			}
+			rows = newBatch()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: table %s: %v", ErrInvalidArchive, info.Name, err)
+	}
+	if rows.Elem().Len() > 0 {
+		return fn(rows.Interface())
+	}
+	return nil
+}
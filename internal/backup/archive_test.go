@@ -0,0 +1,208 @@
+package backup
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeArchive 写入只包含用户表与设置表的备份文件, 返回文件路径
+func writeArchive(t *testing.T, users []*model.User, settings []*model.Setting) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := NewWriter(f, &Manifest{SchemaVersion: 3, Driver: "sqlite", CreateTime: time.Now()})
+	tw, err := w.Table((&model.User{}).TableName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Write(&users); err != nil {
+		t.Fatal(err)
+	}
+	tw, err = w.Table((&model.Setting{}).TableName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Write(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readAll 读取一张表的全部数据
+func readAll(t *testing.T, r *Reader, name string) []interface{} {
+	t.Helper()
+	var rows []interface{}
+	for _, info := range r.Manifest.Tables {
+		if info.Name != name {
+			continue
+		}
+		err := r.Rows(info, 2, func(batch interface{}) error {
+			switch batch := batch.(type) {
+			case *[]*model.User:
+				for _, row := range *batch {
+					rows = append(rows, row)
+				}
+			case *[]*model.Setting:
+				for _, row := range *batch {
+					rows = append(rows, row)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rows
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	users := []*model.User{
+		{ID: 1, UniqueName: "alice", Password: "p1", Enable: 1, ExpirationTime: now, CreateTime: now, UpdateTime: now},
+		{ID: 2, UniqueName: "bob", Password: "p2", Enable: 0, ExpirationTime: now, CreateTime: now, UpdateTime: now},
+		{ID: 3, UniqueName: "carol", Password: "p3", Enable: 1, ExpirationTime: now, CreateTime: now, UpdateTime: now},
+	}
+	settings := []*model.Setting{
+		{ID: 1, Name: "moderationMessage", Value: "blocked", UpdateTime: now},
+		{ID: 2, Name: model.SettingAdminPassword, Value: "hash", UpdateTime: now},
+		{ID: 3, Name: model.SettingAdminTokenGeneration, Value: "2", UpdateTime: now},
+	}
+	r, err := Open(writeArchive(t, users, settings))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+	if err := r.Validate(3); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	gotUsers := readAll(t, r, (&model.User{}).TableName())
+	if len(gotUsers) != len(users) {
+		t.Fatalf("read %d users, want %d", len(gotUsers), len(users))
+	}
+	for i, row := range gotUsers {
+		got, want := row.(*model.User), users[i]
+		if got.ID != want.ID || got.UniqueName != want.UniqueName || got.Enable != want.Enable || !got.ExpirationTime.Equal(want.ExpirationTime) {
+			t.Errorf("user %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// 只属于当前部署的设置不写入备份
+	gotSettings := readAll(t, r, (&model.Setting{}).TableName())
+	if len(gotSettings) != 1 || gotSettings[0].(*model.Setting).Name != "moderationMessage" {
+		t.Errorf("settings = %+v, want only moderationMessage", gotSettings)
+	}
+}
+
+func TestArchiveSkipsLocalSettingsFromOldBackup(t *testing.T) {
+	// 旧版本备份的设置表包含重置后的管理员密码
+	settings := []*model.Setting{
+		{ID: 1, Name: model.SettingAdminPassword, Value: "old-hash"},
+		{ID: 2, Name: "moderationMessage", Value: "blocked"},
+	}
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	h := sha256.New()
+	tf, err := zw.Create(tableFile((&model.Setting{}).TableName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setting := range settings {
+		line, _ := json.Marshal(setting)
+		line = append(line, '\n')
+		tf.Write(line)
+		h.Write(line)
+	}
+	mf, err := zw.Create(manifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewEncoder(mf).Encode(&Manifest{
+		Format:        FormatVersion,
+		SchemaVersion: 3,
+		Tables:        []*TableInfo{{Name: (&model.Setting{}).TableName(), Rows: 2, Sha256: hex.EncodeToString(h.Sum(nil))}},
+	})
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+	if err := r.Validate(3); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	got := readAll(t, r, (&model.Setting{}).TableName())
+	if len(got) != 1 || got[0].(*model.Setting).Name != "moderationMessage" {
+		t.Errorf("settings = %+v, want only moderationMessage", got)
+	}
+}
+
+func TestArchiveValidate(t *testing.T) {
+	users := []*model.User{{ID: 1, UniqueName: "alice"}}
+	tests := []struct {
+		name          string
+		modify        func(m *Manifest)
+		schemaVersion int64
+		wantErr       bool
+	}{
+		{name: "valid", modify: func(m *Manifest) {}, schemaVersion: 3},
+		{name: "older backup schema", modify: func(m *Manifest) {}, schemaVersion: 5},
+		{name: "newer backup schema", modify: func(m *Manifest) {}, schemaVersion: 2, wantErr: true},
+		{name: "unsupported format", modify: func(m *Manifest) { m.Format = FormatVersion + 1 }, schemaVersion: 3, wantErr: true},
+		{name: "row count mismatch", modify: func(m *Manifest) { m.Tables[0].Rows++ }, schemaVersion: 3, wantErr: true},
+		{name: "checksum mismatch", modify: func(m *Manifest) { m.Tables[0].Sha256 = "00" }, schemaVersion: 3, wantErr: true},
+		{name: "unknown table", modify: func(m *Manifest) { m.Tables[0].Name = "tb_unknown" }, schemaVersion: 3, wantErr: true},
+		{name: "duplicate table", modify: func(m *Manifest) { m.Tables[1] = m.Tables[0] }, schemaVersion: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Open(writeArchive(t, users, nil))
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer r.Close()
+			tt.modify(r.Manifest)
+			err = r.Validate(tt.schemaVersion)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("Validate() error = %v, want ErrInvalidArchive", err)
+			}
+		})
+	}
+}
+
+func TestOpenInvalidArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	if err := os.WriteFile(path, []byte("not a zip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Open() error = %v, want ErrInvalidArchive", err)
+	}
+}
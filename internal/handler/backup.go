@@ -0,0 +1,117 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+)
+
+type BackupHandler struct {
+	*Handler
+	backupService service.BackupService
+}
+
+func NewBackupHandler(
+	handler *Handler,
+	backupService service.BackupService,
+) *BackupHandler {
+	return &BackupHandler{
+		Handler:       handler,
+		backupService: backupService,
+	}
+}
+
+func (h *BackupHandler) SearchBackup(ctx *gin.Context) {
+	files, err := h.backupService.SearchBackup(ctx)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, files)
+}
+
+func (h *BackupHandler) CreateBackup(ctx *gin.Context) {
+	file, err := h.backupService.CreateBackup(ctx)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, file)
+}
+
+func (h *BackupHandler) DownloadBackup(ctx *gin.Context) {
+	req := new(v1.BackupRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	path, err := h.backupService.BackupPath(ctx, req.Name)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	ctx.FileAttachment(path, req.Name)
+}
+
+func (h *BackupHandler) DeleteBackup(ctx *gin.Context) {
+	req := new(v1.BackupRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.backupService.DeleteBackup(ctx, req.Name); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+// RestoreBackup 从上传的备份文件(multipart 的 file 字段)或已有的备份(JSON 的 name)恢复数据
+func (h *BackupHandler) RestoreBackup(ctx *gin.Context) {
+	var path string
+	if ctx.ContentType() == "multipart/form-data" {
+		upload, err := ctx.FormFile("file")
+		if err != nil {
+			v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+			return
+		}
+		tmp, err := os.CreateTemp("", "restore-*.zip")
+		if err != nil {
+			h.logger.WithContext(ctx).Error("RestoreBackup CreateTemp error", zap.Any("err", err))
+			v1.HandleError(ctx, http.StatusInternalServerError, v1.ErrInternalServerError, nil)
+			return
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		if err := ctx.SaveUploadedFile(upload, tmp.Name()); err != nil {
+			h.logger.WithContext(ctx).Error("RestoreBackup SaveUploadedFile error", zap.Any("err", err))
+			v1.HandleError(ctx, http.StatusInternalServerError, v1.ErrInternalServerError, nil)
+			return
+		}
+		path = tmp.Name()
+	} else {
+		req := new(v1.BackupRequest)
+		if err := ctx.ShouldBindJSON(req); err != nil {
+			v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+			return
+		}
+		var err error
+		if path, err = h.backupService.BackupPath(ctx, req.Name); err != nil {
+			v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+			return
+		}
+	}
+
+	if err := h.backupService.RestoreBackup(ctx, path); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type JobHandler struct {
+	*Handler
+	jobService service.JobService
+}
+
+func NewJobHandler(
+	handler *Handler,
+	jobService service.JobService,
+) *JobHandler {
+	return &JobHandler{
+		Handler:    handler,
+		jobService: jobService,
+	}
+}
+
+func (h *JobHandler) SearchJob(ctx *gin.Context) {
+	v1.HandleSuccess(ctx, h.jobService.SearchJob(ctx))
+}
+
+func (h *JobHandler) TriggerJob(ctx *gin.Context) {
+	req := new(v1.JobRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.jobService.TriggerJob(ctx, req.Name); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *JobHandler) PauseJob(ctx *gin.Context) {
+	req := new(v1.JobRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.jobService.PauseJob(ctx, req.Name); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *JobHandler) ResumeJob(ctx *gin.Context) {
+	req := new(v1.JobRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.jobService.ResumeJob(ctx, req.Name); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *JobHandler) UpdateJob(ctx *gin.Context) {
+	req := new(v1.UpdateJobRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.jobService.UpdateJob(ctx, req); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *JobHandler) SearchRun(ctx *gin.Context) {
+	req := new(v1.SearchJobRunRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	runs, err := h.jobService.SearchRun(ctx, req)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, runs)
+}
+
+func (h *JobHandler) SearchItem(ctx *gin.Context) {
+	req := new(v1.SearchJobRunItemRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	items, err := h.jobService.SearchItem(ctx, req)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, items)
+}
+
+func (h *JobHandler) SearchFailing(ctx *gin.Context) {
+	req := new(v1.SearchJobFailingRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	items, err := h.jobService.SearchFailing(ctx, req.Name)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, items)
+}
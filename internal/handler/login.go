@@ -2,6 +2,7 @@ package handler
 
 import (
 	"PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/metrics"
 	"PandoraFuclaudePlusHelper/internal/service"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -37,6 +38,7 @@ func (h *LoginHandler) Login(ctx *gin.Context) {
 	}
 
 	loginType, token, rules, loginUrl, err := h.loginService.Login(ctx, &req)
+	metrics.ObserveLogin(req.Type, err)
 	if err != nil {
 		v1.HandleError(ctx, http.StatusUnauthorized, err, nil)
 		return
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type ModerationEventHandler struct {
+	*Handler
+	moderationEventService service.ModerationEventService
+}
+
+func NewModerationEventHandler(
+	handler *Handler,
+	moderationEventService service.ModerationEventService,
+) *ModerationEventHandler {
+	return &ModerationEventHandler{
+		Handler:                handler,
+		moderationEventService: moderationEventService,
+	}
+}
+
+func (h *ModerationEventHandler) SearchEvent(ctx *gin.Context) {
+	req := new(v1.SearchModerationEventRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	data, err := h.moderationEventService.SearchEvent(ctx, req)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, data)
+}
+
+func (h *ModerationEventHandler) ReviewEvent(ctx *gin.Context) {
+	req := new(v1.ReviewModerationEventRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.moderationEventService.ReviewEvent(ctx, req.Ids, req.Note); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+// ExportEvent 导出为 CSV 文件
+func (h *ModerationEventHandler) ExportEvent(ctx *gin.Context) {
+	req := new(v1.SearchModerationEventRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := h.moderationEventService.ExportEvent(ctx, req, buf); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	filename := fmt.Sprintf("moderation-events-%s.csv", time.Now().Format("20060102150405"))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	ctx.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type ModerationRuleHandler struct {
+	*Handler
+	moderationRuleService service.ModerationRuleService
+}
+
+func NewModerationRuleHandler(
+	handler *Handler,
+	moderationRuleService service.ModerationRuleService,
+) *ModerationRuleHandler {
+	return &ModerationRuleHandler{
+		Handler:               handler,
+		moderationRuleService: moderationRuleService,
+	}
+}
+
+func (h *ModerationRuleHandler) SearchRule(ctx *gin.Context) {
+	req := new(v1.SearchModerationRuleRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	rules, err := h.moderationRuleService.SearchRule(ctx, req.Keyword, req.Product)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, rules)
+}
+
+func (h *ModerationRuleHandler) CreateRule(ctx *gin.Context) {
+	req := new(model.ModerationRule)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.moderationRuleService.Create(ctx, req); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *ModerationRuleHandler) UpdateRule(ctx *gin.Context) {
+	req := new(model.ModerationRule)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.moderationRuleService.Update(ctx, req); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *ModerationRuleHandler) DeleteRule(ctx *gin.Context) {
+	req := new(v1.DeleteModerationRuleRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.moderationRuleService.DeleteRule(ctx, req.Id); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type ReconcileHandler struct {
+	*Handler
+	reconcileService service.ReconcileService
+}
+
+func NewReconcileHandler(
+	handler *Handler,
+	reconcileService service.ReconcileService,
+) *ReconcileHandler {
+	return &ReconcileHandler{
+		Handler:          handler,
+		reconcileService: reconcileService,
+	}
+}
+
+func (h *ReconcileHandler) SearchDrift(ctx *gin.Context) {
+	drifts, err := h.reconcileService.SearchDrift(ctx)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, drifts)
+}
+
+func (h *ReconcileHandler) HealDrift(ctx *gin.Context) {
+	req := new(v1.HealDriftRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.reconcileService.HealDrift(ctx, req.Id); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type SettingHandler struct {
+	*Handler
+	settingService service.SettingService
+}
+
+func NewSettingHandler(
+	handler *Handler,
+	settingService service.SettingService,
+) *SettingHandler {
+	return &SettingHandler{
+		Handler:        handler,
+		settingService: settingService,
+	}
+}
+
+func (h *SettingHandler) SearchSetting(ctx *gin.Context) {
+	v1.HandleSuccess(ctx, h.settingService.SearchSetting(ctx))
+}
+
+func (h *SettingHandler) UpdateSetting(ctx *gin.Context) {
+	req := new(v1.UpdateSettingRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.settingService.UpdateSetting(ctx, req); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *SettingHandler) ResetSetting(ctx *gin.Context) {
+	req := new(v1.ResetSettingRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.settingService.ResetSetting(ctx, req.Name); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
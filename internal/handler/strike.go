@@ -0,0 +1,147 @@
+package handler
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type StrikeHandler struct {
+	*Handler
+	strikeService service.StrikeService
+}
+
+func NewStrikeHandler(
+	handler *Handler,
+	strikeService service.StrikeService,
+) *StrikeHandler {
+	return &StrikeHandler{
+		Handler:       handler,
+		strikeService: strikeService,
+	}
+}
+
+func (h *StrikeHandler) SearchPolicy(ctx *gin.Context) {
+	req := new(v1.SearchStrikePolicyRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	policies, err := h.strikeService.SearchPolicy(ctx, req.Keyword)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, policies)
+}
+
+func (h *StrikeHandler) CreatePolicy(ctx *gin.Context) {
+	req := new(model.StrikePolicy)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.strikeService.CreatePolicy(ctx, req); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *StrikeHandler) UpdatePolicy(ctx *gin.Context) {
+	req := new(model.StrikePolicy)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.strikeService.UpdatePolicy(ctx, req); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *StrikeHandler) DeletePolicy(ctx *gin.Context) {
+	req := new(v1.DeleteStrikePolicyRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.strikeService.DeletePolicy(ctx, req.Id); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *StrikeHandler) SearchStrike(ctx *gin.Context) {
+	req := new(v1.SearchStrikeRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	users, err := h.strikeService.SearchStrike(ctx, req.Keyword)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, users)
+}
+
+func (h *StrikeHandler) ResetStrike(ctx *gin.Context) {
+	req := new(v1.ResetStrikeRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.strikeService.ResetStrike(ctx, req.UserId); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
+
+func (h *StrikeHandler) SearchSuspension(ctx *gin.Context) {
+	req := new(v1.SearchSuspensionRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	suspensions, err := h.strikeService.SearchSuspension(ctx, req.UserId, req.Status)
+	if err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, suspensions)
+}
+
+func (h *StrikeHandler) LiftSuspension(ctx *gin.Context) {
+	req := new(v1.LiftSuspensionRequest)
+
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		v1.HandleError(ctx, http.StatusBadRequest, v1.ErrBadRequest, nil)
+		return
+	}
+
+	if err := h.strikeService.LiftSuspension(ctx, req.Id); err != nil {
+		v1.HandleError(ctx, http.StatusInternalServerError, err, nil)
+		return
+	}
+	v1.HandleSuccess(ctx, nil)
+}
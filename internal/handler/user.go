@@ -68,12 +68,16 @@ func (h *UserHandler) CreateUser(ctx *gin.Context) {
 	// 定义时间格式和时区
 	const layout = "2006-01-02 15:04:05"
 	loc, _ := time.LoadLocation("Asia/Shanghai") // 加载东八区时区
-	// 在指定时区环境下解析时间字符串
-	expTime, err := time.ParseInLocation(layout, req.ExpirationTime, loc)
-	if err != nil {
-		// 如果时间解析错误，返回400错误
-		v1.HandleError(ctx, http.StatusBadRequest, fmt.Errorf("时间格式错误: %v", err), nil)
-		return
+	// 在指定时区环境下解析时间字符串, 未填写时按设置的默认有效期
+	var expTime time.Time
+	if req.ExpirationTime != "" {
+		var err error
+		expTime, err = time.ParseInLocation(layout, req.ExpirationTime, loc)
+		if err != nil {
+			// 如果时间解析错误，返回400错误
+			v1.HandleError(ctx, http.StatusBadRequest, fmt.Errorf("时间格式错误: %v", err), nil)
+			return
+		}
 	}
 
 	// 构建新的 Account 对象
@@ -86,6 +90,8 @@ func (h *UserHandler) CreateUser(ctx *gin.Context) {
 		OpenaiToken:    req.OpenaiToken,
 		Claude:         req.Claude,
 		ClaudeToken:    req.ClaudeToken,
+		BlockUpload:    req.BlockUpload,
+		BlockImage:     req.BlockImage,
 	}
 
 	if err := h.userService.Create(ctx, user); err != nil {
@@ -125,6 +131,8 @@ func (h *UserHandler) UpdateUser(ctx *gin.Context) {
 		OpenaiToken:    req.OpenaiToken,
 		Claude:         req.Claude,
 		ClaudeToken:    req.ClaudeToken,
+		BlockUpload:    req.BlockUpload,
+		BlockImage:     req.BlockImage,
 	}
 
 	if err := h.userService.Update(ctx, user); err != nil {
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "helper"
+
+// 产品标签
+const (
+	ProductApi    = "api"
+	ProductOpenai = "openai"
+	ProductClaude = "claude"
+)
+
+var (
+	requestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数",
+	}, []string{"product", "method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时, 流式响应为整个流的耗时",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"product", "method", "route"})
+
+	upstreamResponseTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_responses_total",
+		Help:      "上游响应数, 按状态码统计",
+	}, []string{"product", "status"})
+
+	upstreamErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "上游请求失败数 (连接失败、超时等)",
+	}, []string{"product"})
+
+	sseStreamsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sse_streams_in_flight",
+		Help:      "正在转发的 SSE 流数量",
+	}, []string{"product"})
+
+	moderationFlagTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "moderation_flags_total",
+		Help:      "被内容审查拦截的请求数",
+	}, []string{"product"})
+
+	moderationErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "moderation_errors_total",
+		Help:      "审查方式调用失败或超时的次数",
+	}, []string{"product", "provider"})
+
+	loginTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "登录次数, 按登录类型与结果统计",
+	}, []string{"type", "result"})
+
+	tokenRefreshTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refresh_total",
+		Help:      "定时刷新 Token 的结果, kind 为 access 或 share",
+	}, []string{"kind", "result"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "定时任务耗时",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"job"})
+
+	jobLastRun = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_last_run_timestamp_seconds",
+		Help:      "定时任务最后一次执行完成的时间",
+	}, []string{"job"})
+)
+
+// 刷新结果标签
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultSkipped = "skipped"
+)
+
+// loginTypeNames 登录类型对应的标签, 与 LoginService 中的类型一致
+var loginTypeNames = map[int]string{
+	9999: "admin",
+	1:    "openai",
+	2:    "openai_admin",
+	3:    "claude",
+	4:    "claude_account_admin",
+	5:    "claude_token_admin",
+}
+
+// Middleware 统计请求数与耗时, 未匹配路由的请求 (反代透传) 统一记为 other, 避免标签数量失控
+func Middleware(product string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "other"
+		}
+		requestTotal.WithLabelValues(product, c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		requestDuration.WithLabelValues(product, c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveUpstream 记录上游响应状态码, SSE 响应在响应体关闭前计入进行中的流
+func ObserveUpstream(product string, resp *http.Response) {
+	upstreamResponseTotal.WithLabelValues(product, strconv.Itoa(resp.StatusCode)).Inc()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" || resp.Body == nil {
+		return
+	}
+	gauge := sseStreamsInFlight.WithLabelValues(product)
+	gauge.Inc()
+	resp.Body = &streamBody{ReadCloser: resp.Body, done: gauge.Dec}
+}
+
+// ObserveUpstreamError 记录上游请求失败
+func ObserveUpstreamError(product string) {
+	upstreamErrorTotal.WithLabelValues(product).Inc()
+}
+
+// ObserveModerationFlag 记录被内容审查拦截的请求
+func ObserveModerationFlag(product string) {
+	moderationFlagTotal.WithLabelValues(product).Inc()
+}
+
+// ObserveModerationError 记录审查方式调用失败
+func ObserveModerationError(product string, provider string) {
+	moderationErrorTotal.WithLabelValues(product, provider).Inc()
+}
+
+// ObserveLogin 记录登录结果
+func ObserveLogin(loginType int, err error) {
+	name, ok := loginTypeNames[loginType]
+	if !ok {
+		name = "unknown"
+	}
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	loginTotal.WithLabelValues(name, result).Inc()
+}
+
+// ObserveTokenRefresh 记录 Token 刷新结果
+func ObserveTokenRefresh(kind string, result string) {
+	tokenRefreshTotal.WithLabelValues(kind, result).Inc()
+}
+
+// TimeJob 包装定时任务, 记录每次执行的耗时
+func TimeJob(name string, job func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		start := time.Now()
+		defer func() {
+			jobDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+			jobLastRun.WithLabelValues(name).SetToCurrentTime()
+		}()
+		job(ctx)
+	}
+}
+
+// Handler 返回 /metrics 处理器, token 不为空时要求 Authorization: Bearer <token>
+func Handler(token string) gin.HandlerFunc {
+	h := promhttp.Handler()
+	return func(c *gin.Context) {
+		if token != "" && c.GetHeader("Authorization") != "Bearer "+token {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// streamBody 在响应体关闭时执行 done, 保证只执行一次
+type streamBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *streamBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
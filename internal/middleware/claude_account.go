@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ClaudeAccountPaths 会返回 Claude 账号身份信息的接口
+var ClaudeAccountPaths = []string{
+	"/api/bootstrap",
+	"/api/bootstrap/:id1/statsig",
+	"/api/account",
+	"/api/organizations",
+	"/api/organizations/:id1",
+}
+
+var (
+	// claudeEmailKeys 邮箱字段
+	claudeEmailKeys = map[string]bool{"email_address": true, "email": true}
+	// claudeNameKeys 用户名字段
+	claudeNameKeys = map[string]bool{"full_name": true, "display_name": true}
+	// claudeOrganizationKeys 只出现在组织对象上的字段
+	claudeOrganizationKeys = []string{"billing_type", "capabilities", "rate_limit_tier"}
+	// claudeBillingKeys 账单相关字段
+	claudeBillingKeys = map[string]bool{
+		"billing_email":      true,
+		"billing_address":    true,
+		"billing_name":       true,
+		"phone_number":       true,
+		"stripe_customer_id": true,
+		"payment_method":     true,
+		"tax_id":             true,
+	}
+)
+
+// claudeHidden 替换身份信息使用的占位内容
+type claudeHidden struct {
+	email string
+	name  string
+	org   string
+	// identities 响应中真实的邮箱与姓名, 按长度从长到短排列
+	identities []string
+}
+
+// ProcessClaudeAccountResponse 处理 Claude bootstrap/account/organization 接口的响应体,
+// 将邮箱、姓名、组织名与账单信息替换为配置的占位内容
+func ProcessClaudeAccountResponse(body []byte) ([]byte, error) {
+	config := commonConfig.GetConfig()
+	return processClaudeAccount(body, &claudeHidden{
+		email: config.ClaudeHiddenEmail,
+		name:  config.ClaudeHiddenName,
+		org:   config.ClaudeHiddenOrg,
+	})
+}
+
+func processClaudeAccount(body []byte, hidden *claudeHidden) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var respData interface{}
+	if err := decoder.Decode(&respData); err != nil {
+		return nil, err
+	}
+
+	// 先收集真实的邮箱与姓名, 用于替换以其开头的名称 (例如 "xxx@gmail.com's Organization")
+	identitySet := make(map[string]bool)
+	collectClaudeIdentities(respData, identitySet)
+	hidden.identities = make([]string, 0, len(identitySet))
+	for identity := range identitySet {
+		hidden.identities = append(hidden.identities, identity)
+	}
+	// 先匹配较长的内容, 避免 "Bob" 先于 "Bob Smith" 被匹配
+	sort.Slice(hidden.identities, func(i, j int) bool {
+		return len(hidden.identities[i]) > len(hidden.identities[j])
+	})
+
+	masked := maskClaudeAccount(respData, "", hidden)
+
+	// 将修改后的数据重新编码为 JSON
+	modifiedBody, err := json.Marshal(masked)
+	if err != nil {
+		fmt.Printf("Failed to marshal modified response body, %v", err)
+		return nil, err
+	}
+	return modifiedBody, nil
+}
+
+func collectClaudeIdentities(value interface{}, identities map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if text, ok := item.(string); ok && text != "" && (claudeEmailKeys[key] || claudeNameKeys[key]) {
+				identities[text] = true
+			}
+			collectClaudeIdentities(item, identities)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectClaudeIdentities(item, identities)
+		}
+	}
+}
+
+// maskClaudeAccount 递归替换身份字段, key 为当前值所在的字段名; 只处理已知的身份字段, 其他字符串保持不变
+func maskClaudeAccount(value interface{}, key string, hidden *claudeHidden) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// 组织对象: 位于 organization(s) 字段下, 或带有组织特有的字段
+		isOrganization := key == "organization" || key == "organizations"
+		for _, orgKey := range claudeOrganizationKeys {
+			if _, ok := v[orgKey]; ok {
+				isOrganization = true
+			}
+		}
+		for itemKey, item := range v {
+			text, isString := item.(string)
+			switch {
+			case claudeEmailKeys[itemKey]:
+				if isString {
+					v[itemKey] = hidden.email
+				}
+			case claudeNameKeys[itemKey]:
+				if isString {
+					v[itemKey] = hidden.name
+				}
+			case claudeBillingKeys[itemKey]:
+				v[itemKey] = nil
+			case itemKey == "name" && isString:
+				if isOrganization {
+					v[itemKey] = hidden.org
+				} else {
+					v[itemKey] = hidden.maskName(text)
+				}
+			default:
+				v[itemKey] = maskClaudeAccount(item, itemKey, hidden)
+			}
+		}
+		return v
+	case []interface{}:
+		// 数组元素继承数组字段名, 例如 organizations 数组中的每个元素都是组织对象
+		for i, item := range v {
+			v[i] = maskClaudeAccount(item, key, hidden)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// maskName 名称等于真实的邮箱或姓名, 或以其开头并紧跟空白或撇号时替换该部分, 例如 "Bob's Organization"
+func (h *claudeHidden) maskName(name string) string {
+	for _, identity := range h.identities {
+		rest, ok := strings.CutPrefix(name, identity)
+		if !ok {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(rest); rest != "" && !unicode.IsSpace(r) && r != '\'' && r != '’' {
+			continue
+		}
+		if strings.Contains(identity, "@") {
+			return h.email + rest
+		}
+		return h.name + rest
+	}
+	return name
+}
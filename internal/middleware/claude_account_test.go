@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessClaudeAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "identity fields",
+			body: `{"account":{"uuid":"a1b2","email_address":"bob@example.com","full_name":"Bob Smith","display_name":"Bob"}}`,
+			want: `{"account":{"uuid":"a1b2","email_address":"hidden@example.com","full_name":"Hidden","display_name":"Hidden"}}`,
+		},
+		{
+			name: "organization name and billing",
+			body: `{"organizations":[{"uuid":"o1","name":"Acme","billing_type":"stripe","billing_email":"pay@acme.com"}]}`,
+			want: `{"organizations":[{"uuid":"o1","name":"Org","billing_type":"stripe","billing_email":null}]}`,
+		},
+		{
+			name: "short name does not corrupt other strings",
+			body: `{"account":{"full_name":"a","display_name":"ai","uuid":"a1-ai-ca","model":"claude-3-haiku","url":"https://claude.ai/api","created_at":"2024-01-01"}}`,
+			want: `{"account":{"full_name":"Hidden","display_name":"Hidden","uuid":"a1-ai-ca","model":"claude-3-haiku","url":"https://claude.ai/api","created_at":"2024-01-01"}}`,
+		},
+		{
+			name: "composite name with identity prefix",
+			body: `{"email_address":"bob@example.com","full_name":"Bob","memberships":[{"team":{"name":"bob@example.com's Organization"}},{"team":{"name":"Bob’s Team"}}]}`,
+			want: `{"email_address":"hidden@example.com","full_name":"Hidden","memberships":[{"team":{"name":"hidden@example.com's Organization"}},{"team":{"name":"Hidden’s Team"}}]}`,
+		},
+		{
+			name: "name only sharing a prefix is kept",
+			body: `{"full_name":"Bob","project":{"name":"Bobcat"},"title":"Bob's notes"}`,
+			want: `{"full_name":"Hidden","project":{"name":"Bobcat"},"title":"Bob's notes"}`,
+		},
+		{
+			name: "longest identity first",
+			body: `{"full_name":"Bob Smith","display_name":"Bob","team":{"name":"Bob Smith's Team"}}`,
+			want: `{"full_name":"Hidden","display_name":"Hidden","team":{"name":"Hidden's Team"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := processClaudeAccount([]byte(tt.body), &claudeHidden{email: "hidden@example.com", name: "Hidden", org: "Org"})
+			if err != nil {
+				t.Fatalf("processClaudeAccount() error = %v", err)
+			}
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatalf("unmarshal result: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+				t.Fatalf("unmarshal want: %v", err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("processClaudeAccount() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
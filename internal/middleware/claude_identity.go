@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"PandoraFuclaudePlusHelper/internal/util"
+	"PandoraFuclaudePlusHelper/pkg/jwt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClaudeIdentity 将登录链接中的身份参数写入 cookie, 并在转发给上游前移除该参数
+func ClaudeIdentity(j *jwt.JWT) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		token := query.Get(util.ClaudeIdentityKey)
+		if token == "" {
+			c.Next()
+			return
+		}
+		query.Del(util.ClaudeIdentityKey)
+		c.Request.URL.RawQuery = query.Encode()
+
+		if _, expiresAt, err := util.ParseClaudeIdentity(j, token); err == nil {
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     util.ClaudeIdentityKey,
+				Value:    token,
+				Path:     "/",
+				MaxAge:   int(time.Until(expiresAt).Seconds()),
+				HttpOnly: true,
+				Secure:   c.Request.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		c.Next()
+	}
+}
+
+// claudeAccountId 从 cookie 中解析 Claude 账号ID, 无法识别时返回 0
+func claudeAccountId(c *gin.Context, j *jwt.JWT) int64 {
+	cookie, err := c.Request.Cookie(util.ClaudeIdentityKey)
+	if err != nil || cookie.Value == "" {
+		return 0
+	}
+	accountId, _, err := util.ParseClaudeIdentity(j, cookie.Value)
+	if err != nil {
+		return 0
+	}
+	return accountId
+}
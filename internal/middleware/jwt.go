@@ -2,15 +2,18 @@ package middleware
 
 import (
 	"PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/service"
 	"PandoraFuclaudePlusHelper/pkg/jwt"
 	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
 )
 
-func StrictAuth(j *jwt.JWT, logger *log.Logger) gin.HandlerFunc {
+func StrictAuth(j *jwt.JWT, settings *service.Settings, logger *log.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		tokenString := ctx.Request.Header.Get("Authorization")
 		if tokenString == "" {
@@ -23,7 +26,7 @@ func StrictAuth(j *jwt.JWT, logger *log.Logger) gin.HandlerFunc {
 			return
 		}
 
-		claims, err := j.ParseToken(tokenString)
+		claims, err := parseAdminToken(ctx, j, settings, tokenString)
 		if err != nil {
 			logger.Error(fmt.Sprintf("token error, url: %s, params: %s", ctx.Request.URL, ctx.Params))
 			v1.HandleError(ctx, http.StatusUnauthorized, v1.ErrUnauthorized, nil)
@@ -37,7 +40,7 @@ func StrictAuth(j *jwt.JWT, logger *log.Logger) gin.HandlerFunc {
 	}
 }
 
-func NoStrictAuth(j *jwt.JWT, logger *log.Logger) gin.HandlerFunc {
+func NoStrictAuth(j *jwt.JWT, settings *service.Settings, logger *log.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		tokenString := ctx.Request.Header.Get("Authorization")
 		if tokenString == "" {
@@ -51,7 +54,7 @@ func NoStrictAuth(j *jwt.JWT, logger *log.Logger) gin.HandlerFunc {
 			return
 		}
 
-		claims, err := j.ParseToken(tokenString)
+		claims, err := parseAdminToken(ctx, j, settings, tokenString)
 		if err != nil {
 			ctx.Next()
 			return
@@ -63,6 +66,22 @@ func NoStrictAuth(j *jwt.JWT, logger *log.Logger) gin.HandlerFunc {
 	}
 }
 
+// parseAdminToken 只接受管理员令牌, 其他用途的令牌(例如 Claude 账号标识)使用同一密钥签名;
+// 重置管理员密码后代数递增, 之前签发的令牌不再有效
+func parseAdminToken(ctx context.Context, j *jwt.JWT, settings *service.Settings, tokenString string) (*jwt.MyCustomClaims, error) {
+	claims, err := j.ParseToken(tokenString, jwt.AudienceAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserId != jwt.AdminUserId {
+		return nil, errors.New("not an admin token")
+	}
+	if claims.Generation != settings.AdminTokenGeneration(ctx) {
+		return nil, errors.New("admin token has been revoked")
+	}
+	return claims, nil
+}
+
 func recoveryLoggerFunc(ctx *gin.Context, logger *log.Logger) {
 	if userInfo, ok := ctx.MustGet("claims").(*jwt.MyCustomClaims); ok {
 		logger.WithValue(ctx, zap.String("UserId", userInfo.UserId))
@@ -1,21 +1,27 @@
 package middleware
 
 import (
-	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/moderation"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"PandoraFuclaudePlusHelper/pkg/jwt"
 	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"github.com/go-resty/resty/v2"
-	"go.uber.org/zap"
 	"io"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
 )
 
 type Message struct {
@@ -26,6 +32,17 @@ type Message struct {
 		ContentType string `json:"content_type"`
 		Parts       []Part `json:"parts"`
 	} `json:"content"`
+	Metadata struct {
+		Attachments []Attachment `json:"attachments"`
+	} `json:"metadata"`
+}
+
+// Attachment ChatGPT 消息中上传的文件
+type Attachment struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Size     int    `json:"size"`
 }
 
 type Part struct {
@@ -65,11 +82,62 @@ type ChatGPTConversationRequest struct {
 }
 
 type ClaudeConversationRequest struct {
-	Prompt string
+	Prompt      string
+	Attachments []ClaudeAttachment `json:"attachments"`
+	// Files 上传的图片等文件的 uuid, 图片在上传时审查
+	Files []string `json:"files"`
+}
+
+// ClaudeAttachment Claude 对话中的附件, extracted_content 为附件中提取的文本
+type ClaudeAttachment struct {
+	FileName         string `json:"file_name"`
+	FileType         string `json:"file_type"`
+	FileSize         int    `json:"file_size"`
+	ExtractedContent string `json:"extracted_content"`
+}
+
+type ModerationMiddleware struct {
+	logger                 *log.Logger
+	manager                *moderation.Manager
+	jwt                    *jwt.JWT
+	moderationEventService service.ModerationEventService
+	strikeService          service.StrikeService
+	settings               *service.Settings
+	client                 *resty.Client
+}
+
+func NewModerationMiddleware(
+	logger *log.Logger,
+	manager *moderation.Manager,
+	jwt *jwt.JWT,
+	moderationEventService service.ModerationEventService,
+	strikeService service.StrikeService,
+	settings *service.Settings,
+) *ModerationMiddleware {
+	return &ModerationMiddleware{
+		logger:                 logger,
+		manager:                manager,
+		jwt:                    jwt,
+		moderationEventService: moderationEventService,
+		strikeService:          strikeService,
+		settings:               settings,
+		client:                 resty.New().SetTransport(tracing.Transport(nil)).SetTimeout(time.Second * 30),
+	}
 }
 
-func OpenAiContentModerationMiddleware(logger *log.Logger) gin.HandlerFunc {
+// Enabled 产品是否开启了内容审查
+func (m *ModerationMiddleware) Enabled(product string) bool {
+	return m.manager.Enabled(product)
+}
+
+func (m *ModerationMiddleware) OpenAiContentModeration() gin.HandlerFunc {
+	logger := m.logger
 	return func(c *gin.Context) {
+		// 审查配置支持热更新, 每次请求时判断是否开启
+		if !m.Enabled(model.ModerationProductOpenai) {
+			c.Next()
+			return
+		}
 		if c.Request.URL.Path == "/backend-api/conversation" {
 			// 读取cookie值
 			userId, err := c.Request.Cookie("_Secure-next-auth.user-id")
@@ -95,6 +163,20 @@ func OpenAiContentModerationMiddleware(logger *log.Logger) gin.HandlerFunc {
 				return
 			}
 
+			user := m.strikeService.ResolveUser(c, &service.ModerationIdentity{
+				Product:    model.ModerationProductOpenai,
+				ShareToken: shareToken.Value,
+			})
+			if message := m.suspended(c, user); message != "" {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"detail": gin.H{
+						"message": message,
+						"flagged": true,
+					},
+				})
+				return
+			}
+
 			body, err := io.ReadAll(c.Request.Body)
 			if err != nil {
 				logger.Info("Failed to read request body")
@@ -121,52 +203,87 @@ func OpenAiContentModerationMiddleware(logger *log.Logger) gin.HandlerFunc {
 			}
 
 			var userMessages []string
+			var imagePointers []*ImageAssetPointer
 			for _, msg := range requestBody.Messages {
 				if msg.Author.Role == "user" && (msg.Content.ContentType == "text" || msg.Content.ContentType == "multimodal_text") {
 					for _, part := range msg.Content.Parts {
 						if part.StringValue != nil {
 							userMessages = append(userMessages, *part.StringValue)
 						}
+						if part.ImageValue != nil {
+							imagePointers = append(imagePointers, part.ImageValue)
+						}
 					}
 				}
 			}
 
-			if len(userMessages) > 0 {
-				shouldBlock, err := checkContentForModeration(userMessages, logger)
-				if err != nil {
-					logger.Info(fmt.Sprintf("Failed to check content for moderation: %v", err))
-					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-						"detail": gin.H{
-							"message": "Failed to check content for moderation",
-							"flagged": true,
-						},
-					})
-					return
-				}
-				if shouldBlock {
-					// 异步记录被阻止的消息到日志文件
-					go asyncModerationLog(userId.Value, shareToken.Value, userMessages, logger)
-					logger.Info(fmt.Sprintf("User %s with share token %s sent a message that was blocked by the moderation system, message: %v", userId.Value, shareToken.Value, userMessages))
-					c.AbortWithStatusJSON(http.StatusUnavailableForLegalReasons, gin.H{
-						"detail": gin.H{
-							"message": commonConfig.GetConfig().ModerationMessage,
-							"flagged": true,
-						},
-					})
-					return
-				}
+			hash := sha1.Sum([]byte(shareToken.Value))
+			event := &model.ModerationEvent{
+				Product:        model.ModerationProductOpenai,
+				UpstreamUser:   userId.Value,
+				ShareTokenHash: hex.EncodeToString(hash[:]),
+			}
+			result, messages, err := m.moderateOpenAiInput(c, userMessages, imagePointers)
+			if err != nil {
+				logger.Info(fmt.Sprintf("Failed to check content for moderation: %v", err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"detail": gin.H{
+						"message": "Failed to check content for moderation",
+						"flagged": true,
+					},
+				})
+				return
 			}
+			if result.Action == moderation.ActionLog {
+				logger.Info(fmt.Sprintf("User %s sent a message that was logged by the moderation system (%s: %v)", userId.Value, result.Provider, result.Categories))
+				m.record(c.Request.Context(), user, result, messages, event)
+			}
+			if result.Action == moderation.ActionDeny {
+				metrics.ObserveModerationFlag(metrics.ProductOpenai)
+				logger.Info(fmt.Sprintf("User %s sent a message that was blocked by the moderation system (%s: %v)", userId.Value, result.Provider, result.Categories))
+				message := m.flag(c, user, result, messages, event)
+				c.AbortWithStatusJSON(http.StatusUnavailableForLegalReasons, gin.H{
+					"detail": gin.H{
+						"message": message,
+						"flagged": true,
+					},
+				})
+				return
+			}
+
+			m.moderateOutput(c, user, event)
+			return
 		}
 
 		c.Next()
 	}
 }
 
-func ClaudeContentModerationMiddleware(logger *log.Logger) gin.HandlerFunc {
+func (m *ModerationMiddleware) ClaudeContentModeration() gin.HandlerFunc {
+	logger := m.logger
 	return func(c *gin.Context) {
+		if !m.Enabled(model.ModerationProductClaude) {
+			c.Next()
+			return
+		}
 		re := regexp.MustCompile(`^/api/organizations/([^/]+)/chat_conversations/([^/]+)/completion$`)
 		// Claude道德检查
 		if re.MatchString(c.Request.URL.Path) {
+			user := m.strikeService.ResolveUser(c, &service.ModerationIdentity{
+				Product:         model.ModerationProductClaude,
+				ClaudeAccountId: claudeAccountId(c, m.jwt),
+			})
+			if message := m.suspended(c, user); message != "" {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"type": "error",
+					"error": gin.H{
+						"type":    "permission_error",
+						"message": message,
+					},
+				})
+				return
+			}
+
 			body, err := io.ReadAll(c.Request.Body)
 			if err != nil {
 				logger.Error("Failed to read request body")
@@ -196,9 +313,18 @@ func ClaudeContentModerationMiddleware(logger *log.Logger) gin.HandlerFunc {
 
 			var userMessages []string
 			userMessages = append(userMessages, requestBody.Prompt)
+			// 附件中提取的文本与消息一起审查, 图片在上传时审查
+			for _, attachment := range requestBody.Attachments {
+				if attachment.ExtractedContent != "" {
+					userMessages = append(userMessages, attachment.ExtractedContent)
+				}
+			}
 
+			event := &model.ModerationEvent{
+				Product: model.ModerationProductClaude,
+			}
 			if len(userMessages) > 0 {
-				shouldBlock, err := checkContentForModeration(userMessages, logger)
+				result, err := m.manager.Moderate(c, model.ModerationProductClaude, userMessages)
 				if err != nil {
 					logger.Error(fmt.Sprintf("Failed to check content for moderation: %v", err))
 					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -210,93 +336,129 @@ func ClaudeContentModerationMiddleware(logger *log.Logger) gin.HandlerFunc {
 					})
 					return
 				}
-				if shouldBlock {
-					logger.Info(fmt.Sprintf("User sent a message that was blocked by the moderation system, message: %v", userMessages))
-					go asyncModerationLog("claude", "claude", userMessages, logger)
+				if result.Action == moderation.ActionLog {
+					logger.Info(fmt.Sprintf("Claude account %d sent a message that was logged by the moderation system (%s: %v)", user.AccountId, result.Provider, result.Categories))
+					m.record(c.Request.Context(), user, result, userMessages, event)
+				}
+				if result.Action == moderation.ActionDeny {
+					metrics.ObserveModerationFlag(metrics.ProductClaude)
+					logger.Info(fmt.Sprintf("Claude account %d sent a message that was blocked by the moderation system (%s: %v)", user.AccountId, result.Provider, result.Categories))
+					message := m.flag(c, user, result, userMessages, event)
 					c.AbortWithStatusJSON(http.StatusUnavailableForLegalReasons, gin.H{
 						"type": "error",
 						"error": gin.H{
 							"type":    "moderation_error",
-							"message": commonConfig.GetConfig().ModerationMessage,
+							"message": message,
 						},
 					})
 					return
 				}
 			}
+
+			m.moderateOutput(c, user, event)
+			return
 		}
 		c.Next()
 	}
 }
 
-func checkContentForModeration(messages []string, logger *log.Logger) (bool, error) {
-	client := resty.New()
-	client.SetTimeout(time.Second * 10)
-
-	userMessage := strings.Join(messages, " ")
-	if len(userMessage) == 0 {
-		return false, nil
+// moderateOpenAiInput 审查 ChatGPT 用户消息与图片, 返回审查结果与记录到事件中的消息
+// 文本命中 deny 时不再审查图片, 图片命中 deny 时以图片的结果为准
+func (m *ModerationMiddleware) moderateOpenAiInput(c *gin.Context, texts []string, pointers []*ImageAssetPointer) (*moderation.Result, []string, error) {
+	product := model.ModerationProductOpenai
+	result := &moderation.Result{Action: moderation.ActionAllow}
+	if len(texts) > 0 {
+		var err error
+		if result, err = m.manager.Moderate(c, product, texts); err != nil {
+			return nil, nil, err
+		}
+	}
+	if result.Action == moderation.ActionDeny || len(pointers) == 0 || !m.manager.ImageEnabled() {
+		return result, texts, nil
 	}
 
-	resp, err := client.R().
-		SetHeader("Content-Type", "application/json").
-		SetHeader("Authorization", fmt.Sprintf("Bearer %s", commonConfig.GetConfig().ModerationApiKey)).
-		SetBody(map[string]interface{}{
-			"input": userMessage,
-		}).
-		Post(fmt.Sprintf("%s/v1/moderations", commonConfig.GetConfig().ModerationEndpoint))
-
+	images, err := m.fetchOpenAiImages(c, c.Request.Header, pointers)
 	if err != nil {
-		return false, err
+		if !m.manager.FailOpen() {
+			return nil, nil, err
+		}
+		m.logger.WithContext(c).Warn(fmt.Sprintf("Failed to fetch images for moderation, skipped: %v", err))
+		return result, texts, nil
 	}
-
-	if resp.StatusCode() != http.StatusOK {
-		logger.Error("Moderation API returned an error: {}", zap.Any("body", resp.Body()))
-		return true, fmt.Errorf("moderation API returned an error: %d", resp.StatusCode())
+	imageResult, err := m.manager.ModerateImages(c, product, images)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		logger.Error("Failed to unmarshal moderation response: {}", zap.Error(err))
-		return true, err
+	if imageResult.Action == moderation.ActionDeny || (imageResult.Action == moderation.ActionLog && result.Action == moderation.ActionAllow) {
+		messages := make([]string, 0, len(texts)+len(images))
+		messages = append(messages, texts...)
+		for _, image := range images {
+			messages = append(messages, imageMessage(image))
+		}
+		return imageResult, messages, nil
 	}
+	return result, texts, nil
+}
 
-	results, ok := result["results"].([]interface{})
-	if !ok {
-		return true, fmt.Errorf("unexpected response format")
+// suspended 用户处于暂停中时返回提示信息
+func (m *ModerationMiddleware) suspended(c *gin.Context, user *service.ModerationUser) string {
+	suspension, err := m.strikeService.ActiveSuspension(c, user.UserId)
+	if err != nil {
+		m.logger.WithContext(c).Error(fmt.Sprintf("Failed to check suspension: %v", err))
+		return ""
 	}
-
-	for _, r := range results {
-		if flagged, ok := r.(map[string]interface{})["flagged"].(bool); ok && flagged {
-			return true, nil
-		}
+	if suspension == nil {
+		return ""
 	}
-
-	return false, nil
+	return m.strikeService.SuspensionMessage(c, suspension)
 }
 
-// asyncModerationLog 异步记录被阻止的消息到日志文件
-func asyncModerationLog(userId string, shareToken string, messages []string, logger *log.Logger) {
-	logMessage := fmt.Sprintf("%s | %s | %s | %s\n",
-		time.Now().Format(time.DateTime),
-		userId,
-		shareToken,
-		strings.Join(messages, ", "))
+// flag 保存审查事件并检查违规策略, 返回给用户的提示信息
+// 客户端断开后仍需完成记录, 因此不使用请求的取消信号
+func (m *ModerationMiddleware) flag(c *gin.Context, user *service.ModerationUser, result *moderation.Result, messages []string, event *model.ModerationEvent) string {
+	ctx := context.WithoutCancel(c.Request.Context())
+	fillEvent(event, user, result, messages)
+	event.Direction = model.ModerationDirectionInput
+	event.Action = model.ModerationActionBlock
+	event.Strike = 1
+	if err := m.moderationEventService.RecordEvent(ctx, event); err != nil {
+		return m.settings.ModerationMessage(ctx)
+	}
 
-	moderationLog := fmt.Sprintf("%s/%s", commonConfig.GetConfig().DataDir, "logs/moderation.log")
+	suspension, err := m.strikeService.Strike(ctx, user.UserId, event.Product)
+	if err != nil || suspension == nil {
+		return m.settings.ModerationMessage(ctx)
+	}
+	return m.strikeService.SuspensionMessage(ctx, suspension)
+}
 
-	file, err := os.OpenFile(moderationLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to open log file: %v", err))
-		return
+// record 异步保存不计入违规次数的审查事件, 不阻塞请求
+func (m *ModerationMiddleware) record(ctx context.Context, user *service.ModerationUser, result *moderation.Result, messages []string, event *model.ModerationEvent) {
+	ctx = context.WithoutCancel(ctx)
+	fillEvent(event, user, result, messages)
+	if event.Direction == "" {
+		event.Direction = model.ModerationDirectionInput
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to close log file: %v", err))
-		}
-	}(file)
+	if event.Action == "" {
+		event.Action = model.ModerationActionLog
+	}
+	event.Strike = 0
+	go func() {
+		_ = m.moderationEventService.RecordEvent(ctx, event)
+	}()
+}
 
-	if _, err := file.WriteString(logMessage); err != nil {
-		logger.Error(fmt.Sprintf("Failed to write to log file: %v", err))
+func fillEvent(event *model.ModerationEvent, user *service.ModerationUser, result *moderation.Result, messages []string) {
+	event.UserId = user.UserId
+	event.UserName = user.UserName
+	event.AccountId = user.AccountId
+	event.Account = user.Account
+	event.Provider = result.Provider
+	event.Categories = strings.Join(result.Categories, ",")
+	event.Reason = result.Reason
+	event.Message = strings.Join(messages, "\n")
+	if len(result.Scores) > 0 {
+		scores, _ := json.Marshal(result.Scores)
+		event.Scores = string(scores)
 	}
 }
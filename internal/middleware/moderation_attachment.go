@@ -0,0 +1,295 @@
+package middleware
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/moderation"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用户被禁止上传文件或输入图片时的提示
+const (
+	uploadBlockedMessage = "File uploads are disabled for your account"
+	imageBlockedMessage  = "Image input is disabled for your account"
+)
+
+// claudeUploadPath Claude 上传图片与文件的接口
+var claudeUploadPath = regexp.MustCompile(`^/api/(?:organizations/)?[^/]+/(?:upload|upload-file|convert_document)$|^/api/convert_document$`)
+
+// OpenAiAttachmentPolicy 按用户策略拦截 ChatGPT 的文件上传与图片输入, 不依赖是否开启内容审查
+func (m *ModerationMiddleware) OpenAiAttachmentPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || (c.Request.URL.Path != "/backend-api/files" && c.Request.URL.Path != "/backend-api/conversation") {
+			c.Next()
+			return
+		}
+		shareToken, err := c.Request.Cookie("_Secure-next-auth.share-token")
+		if err != nil || shareToken.Value == "" {
+			c.Next()
+			return
+		}
+		user := m.strikeService.ResolveUser(c, &service.ModerationIdentity{
+			Product:    model.ModerationProductOpenai,
+			ShareToken: shareToken.Value,
+		})
+		if !user.BlockUpload && !user.BlockImage {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+		message := ""
+		if c.Request.URL.Path == "/backend-api/files" {
+			// 图片的 use_case 为 multimodal, 其他文件为 my_files 等
+			var request struct {
+				UseCase string `json:"use_case"`
+			}
+			_ = json.Unmarshal(body, &request)
+			if user.BlockUpload {
+				message = uploadBlockedMessage
+			} else if request.UseCase == "multimodal" {
+				message = imageBlockedMessage
+			}
+		} else {
+			var request ChatGPTConversationRequest
+			_ = json.Unmarshal(body, &request)
+			for _, msg := range request.Messages {
+				if user.BlockUpload && len(msg.Metadata.Attachments) > 0 {
+					message = uploadBlockedMessage
+				}
+				for _, part := range msg.Content.Parts {
+					if user.BlockImage && part.ImageValue != nil {
+						message = imageBlockedMessage
+					}
+				}
+			}
+		}
+		if message != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"detail": gin.H{
+					"message": message,
+					"flagged": true,
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ClaudeAttachmentPolicy 按用户策略拦截 Claude 的文件上传与图片输入, 开启图片审查时在上传时审查图片
+func (m *ModerationMiddleware) ClaudeAttachmentPolicy() gin.HandlerFunc {
+	completionPath := regexp.MustCompile(`^/api/organizations/([^/]+)/chat_conversations/([^/]+)/completion$`)
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		upload := claudeUploadPath.MatchString(path)
+		if c.Request.Method != http.MethodPost || (!upload && !completionPath.MatchString(path)) {
+			c.Next()
+			return
+		}
+		user := m.strikeService.ResolveUser(c, &service.ModerationIdentity{
+			Product:         model.ModerationProductClaude,
+			ClaudeAccountId: claudeAccountId(c, m.jwt),
+		})
+		imageEnabled := upload && m.manager.ImageEnabled()
+		if !user.BlockUpload && !user.BlockImage && !imageEnabled {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+		if !upload {
+			var request ClaudeConversationRequest
+			_ = json.Unmarshal(body, &request)
+			switch {
+			case user.BlockUpload && (len(request.Attachments) > 0 || len(request.Files) > 0):
+				claudeAbort(c, http.StatusForbidden, "permission_error", uploadBlockedMessage)
+				return
+			case user.BlockImage && len(request.Files) > 0:
+				claudeAbort(c, http.StatusForbidden, "permission_error", imageBlockedMessage)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if user.BlockUpload {
+			claudeAbort(c, http.StatusForbidden, "permission_error", uploadBlockedMessage)
+			return
+		}
+		image, err := multipartImage(c.Request.Header.Get("Content-Type"), body)
+		if err != nil {
+			m.logger.WithContext(c).Info(fmt.Sprintf("Failed to read uploaded file: %v", err))
+		}
+		if image == nil {
+			c.Next()
+			return
+		}
+		if user.BlockImage {
+			claudeAbort(c, http.StatusForbidden, "permission_error", imageBlockedMessage)
+			return
+		}
+		if !imageEnabled {
+			c.Next()
+			return
+		}
+
+		result, err := m.manager.ModerateImages(c, model.ModerationProductClaude, []*moderation.Image{image})
+		if err != nil {
+			m.logger.WithContext(c).Error(fmt.Sprintf("Failed to check image for moderation: %v", err))
+			claudeAbort(c, http.StatusInternalServerError, "internal_server_error", "Failed to check content for moderation")
+			return
+		}
+		messages := []string{imageMessage(image)}
+		event := &model.ModerationEvent{Product: model.ModerationProductClaude}
+		switch result.Action {
+		case moderation.ActionLog:
+			m.record(c.Request.Context(), user, result, messages, event)
+		case moderation.ActionDeny:
+			metrics.ObserveModerationFlag(metrics.ProductClaude)
+			m.logger.WithContext(c).Info(fmt.Sprintf("Claude account %d uploaded an image that was blocked by the moderation system (%s: %v)", user.AccountId, result.Provider, result.Categories))
+			claudeAbort(c, http.StatusUnavailableForLegalReasons, "moderation_error", m.flag(c, user, result, messages, event))
+			return
+		}
+		c.Next()
+	}
+}
+
+func claudeAbort(c *gin.Context, status int, errorType string, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errorType,
+			"message": message,
+		},
+	})
+}
+
+// multipartImage 从上传请求中取出图片, 不是图片时返回 nil
+func multipartImage(contentType string, body []byte) (*moderation.Image, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, err
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		partType := part.Header.Get("Content-Type")
+		if !strings.HasPrefix(partType, "image/") {
+			return nil, nil
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		return &moderation.Image{Name: part.FileName(), ContentType: partType, Data: data}, nil
+	}
+}
+
+// imageMessage 审查事件中记录的图片信息, 不保存图片内容
+func imageMessage(image *moderation.Image) string {
+	return fmt.Sprintf("[image] %s sha256:%s", image.Name, image.Hash())
+}
+
+// fetchOpenAiImages 通过上游的文件下载接口取回对话中引用的图片, 使用与当前请求相同的身份
+func (m *ModerationMiddleware) fetchOpenAiImages(ctx context.Context, header http.Header, pointers []*ImageAssetPointer) ([]*moderation.Image, error) {
+	site := strings.TrimSuffix(commonConfig.GetConfig().OpenAiSite, "/")
+	maxSize := int64(commonConfig.GetConfig().ModerationImageMaxSize) << 20
+	images := make([]*moderation.Image, 0, len(pointers))
+	for _, pointer := range pointers {
+		// asset_pointer 形如 file-service://file-xxx 或 sediment://file_xxx
+		_, fileId, ok := strings.Cut(pointer.AssetPointer, "://")
+		if !ok || fileId == "" {
+			return nil, fmt.Errorf("unsupported asset pointer: %s", pointer.AssetPointer)
+		}
+
+		var download struct {
+			DownloadUrl string `json:"download_url"`
+		}
+		resp, err := m.client.R().
+			SetContext(ctx).
+			SetHeader("Cookie", header.Get("Cookie")).
+			SetHeader("Authorization", header.Get("Authorization")).
+			SetResult(&download).
+			ForceContentType("application/json").
+			Get(fmt.Sprintf("%s/backend-api/files/%s/download", site, fileId))
+		if err != nil {
+			return nil, err
+		}
+		if !resp.IsSuccess() || download.DownloadUrl == "" {
+			return nil, fmt.Errorf("get download url of %s failed: %d", fileId, resp.StatusCode())
+		}
+
+		request := m.client.R().SetContext(ctx).SetDoNotParseResponse(true)
+		downloadUrl := download.DownloadUrl
+		if strings.HasPrefix(downloadUrl, "/") {
+			downloadUrl = site + downloadUrl
+			request.SetHeader("Cookie", header.Get("Cookie")).SetHeader("Authorization", header.Get("Authorization"))
+		}
+		resp, err = request.Get(downloadUrl)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readLimited(resp.RawBody(), maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if !resp.IsSuccess() {
+			return nil, fmt.Errorf("download %s failed: %d", fileId, resp.StatusCode())
+		}
+		contentType := resp.Header().Get("Content-Type")
+		if !strings.HasPrefix(contentType, "image/") {
+			contentType = http.DetectContentType(data)
+		}
+		images = append(images, &moderation.Image{Name: fileId, ContentType: contentType, Data: data})
+	}
+	return images, nil
+}
+
+// readLimited 读取并关闭响应体, 超过 limit 时返回错误
+func readLimited(body io.ReadCloser, limit int64) ([]byte, error) {
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errors.New("image is too large")
+	}
+	return data, nil
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/moderation"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderateOutput 审查助手回复, 未开启时直接执行后续处理器
+//
+// 回复由代理按行转换, 累计新增的文本达到间隔或回复结束前审查一次, 命中时写入错误事件并结束响应
+func (m *ModerationMiddleware) moderateOutput(c *gin.Context, user *service.ModerationUser, input *model.ModerationEvent) {
+	config := commonConfig.GetConfig()
+	if !config.ModerationOutput {
+		c.Next()
+		return
+	}
+
+	output := &outputModeration{
+		middleware: m,
+		ctx:        c.Request.Context(),
+		user:       user,
+		input:      input,
+		interval:   config.ModerationOutputInterval,
+	}
+	if input.Product == model.ModerationProductClaude {
+		output.stream = &claudeOutputStream{}
+	} else {
+		output.stream = &chatGPTOutputStream{}
+	}
+	setResponseTransform(c, &ResponseTransform{SSE: output.transform})
+	c.Next()
+}
+
+// outputStream 从 SSE 数据行中提取助手回复
+type outputStream interface {
+	// parse 解析一行 data, 返回回复是否结束
+	parse(data string) bool
+	text() string
+	// errorEvent 中断回复时写入的错误事件
+	errorEvent(message string) []byte
+}
+
+// outputModeration 一次回复的审查状态
+type outputModeration struct {
+	middleware *ModerationMiddleware
+	ctx        context.Context
+	user       *service.ModerationUser
+	input      *model.ModerationEvent
+	stream     outputStream
+	interval   int
+	checked    int
+	logged     bool
+}
+
+// transform 解析一行 data 并原样返回, 回复需要中断时返回 StreamStop, 结束当前事件并写入错误事件
+func (o *outputModeration) transform(data []byte) ([]byte, error) {
+	done := o.stream.parse(strings.TrimSpace(string(data)))
+	length := utf8.RuneCountInString(o.stream.text())
+	if (done && length > o.checked) || length-o.checked >= o.interval {
+		o.checked = length
+		if message, ok := o.check(); !ok {
+			return nil, &StreamStop{Tail: append([]byte("\n"), o.stream.errorEvent(message)...)}
+		}
+	}
+	return data, nil
+}
+
+// check 审查当前累计的回复, 返回 false 时需要中断回复
+func (o *outputModeration) check() (string, bool) {
+	m := o.middleware
+	product := o.input.Product
+	texts := []string{o.stream.text()}
+	result, err := m.manager.Moderate(o.ctx, product, texts)
+	if err != nil {
+		m.logger.WithContext(o.ctx).Error(fmt.Sprintf("Failed to check output for moderation: %v", err))
+		return "Failed to check content for moderation", false
+	}
+
+	switch result.Action {
+	case moderation.ActionDeny:
+		metrics.ObserveModerationFlag(product)
+		m.logger.WithContext(o.ctx).Info(fmt.Sprintf("Assistant response to user %d was blocked by the moderation system (%s: %v)", o.user.UserId, result.Provider, result.Categories))
+		m.record(o.ctx, o.user, result, texts, o.outputEvent(model.ModerationActionBlock))
+		return m.settings.ModerationMessage(o.ctx), false
+	case moderation.ActionLog:
+		if !o.logged {
+			o.logged = true
+			m.record(o.ctx, o.user, result, texts, o.outputEvent(model.ModerationActionLog))
+		}
+	}
+	return "", true
+}
+
+func (o *outputModeration) outputEvent(action string) *model.ModerationEvent {
+	return &model.ModerationEvent{
+		Product:        o.input.Product,
+		UpstreamUser:   o.input.UpstreamUser,
+		ShareTokenHash: o.input.ShareTokenHash,
+		Direction:      model.ModerationDirectionOutput,
+		Action:         action,
+	}
+}
+
+// chatGPTOutputStream ChatGPT 回复, 兼容完整消息与增量 (delta) 两种格式
+type chatGPTOutputStream struct {
+	content string
+}
+
+func (s *chatGPTOutputStream) parse(data string) bool {
+	if data == "[DONE]" {
+		return true
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return false
+	}
+	if message, ok := event["message"].(map[string]interface{}); ok {
+		s.parseMessage(message)
+		return false
+	}
+
+	// 增量格式: {"v": {"message": ...}}、{"p": "/message/content/parts/0", "o": "append", "v": "..."}、{"v": "..."}、{"o": "patch", "v": [...]}
+	switch v := event["v"].(type) {
+	case map[string]interface{}:
+		if message, ok := v["message"].(map[string]interface{}); ok {
+			s.parseMessage(message)
+		}
+	case string:
+		if path, _ := event["p"].(string); path == "" || path == "/message/content/parts/0" {
+			s.content += v
+		}
+	case []interface{}:
+		for _, item := range v {
+			op, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			text, _ := op["v"].(string)
+			if path, _ := op["p"].(string); path == "/message/content/parts/0" && op["o"] == "append" {
+				s.content += text
+			}
+		}
+	}
+	return false
+}
+
+func (s *chatGPTOutputStream) parseMessage(message map[string]interface{}) {
+	if author, ok := message["author"].(map[string]interface{}); !ok || author["role"] != "assistant" {
+		return
+	}
+	if content, ok := message["content"].(map[string]interface{}); ok {
+		if parts, ok := content["parts"].([]interface{}); ok && len(parts) > 0 {
+			if text, ok := parts[0].(string); ok {
+				s.content = text
+			}
+		}
+	}
+}
+
+func (s *chatGPTOutputStream) text() string {
+	return s.content
+}
+
+func (s *chatGPTOutputStream) errorEvent(message string) []byte {
+	data, _ := json.Marshal(gin.H{"message": nil, "error": message})
+	return []byte(fmt.Sprintf("data: %s\n\ndata: [DONE]\n\n", data))
+}
+
+// claudeOutputStream Claude 回复, 兼容 completion 与 content_block_delta 两种格式
+type claudeOutputStream struct {
+	content strings.Builder
+}
+
+func (s *claudeOutputStream) parse(data string) bool {
+	var event struct {
+		Type       string  `json:"type"`
+		Completion *string `json:"completion"`
+		StopReason *string `json:"stop_reason"`
+		Delta      struct {
+			Text string `json:"text"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return false
+	}
+	if event.Completion != nil {
+		s.content.WriteString(*event.Completion)
+		return event.StopReason != nil
+	}
+	switch event.Type {
+	case "content_block_delta":
+		s.content.WriteString(event.Delta.Text)
+	case "message_stop":
+		return true
+	}
+	return false
+}
+
+func (s *claudeOutputStream) text() string {
+	return s.content.String()
+}
+
+func (s *claudeOutputStream) errorEvent(message string) []byte {
+	data, _ := json.Marshal(gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "moderation_error",
+			"message": message,
+		},
+	})
+	return []byte(fmt.Sprintf("event: error\ndata: %s\n\n", data))
+}
@@ -1,13 +1,22 @@
 package middleware
 
 import (
+	"PandoraFuclaudePlusHelper/internal/metrics"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"bufio"
 	"bytes"
 	"compress/lzw"
+	"errors"
 	"fmt"
 	"github.com/andybalholm/brotli"
 	"github.com/gin-gonic/gin"
 	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
+	"mime"
+	"net"
+	"net/url"
+	"time"
 
 	"compress/gzip"
 	"github.com/klauspost/compress/flate"
@@ -21,354 +30,572 @@ import (
 	"strings"
 )
 
-// CreateProxyHandler 创建代理处理函数
+// defaultMaxTransformBodySize 完整响应体转换允许读取的默认最大字节数
+const defaultMaxTransformBodySize = 10 << 20
+
+// responseTransformKey 当前请求的响应转换在 gin.Context 中的键
+const responseTransformKey = "responseTransform"
+
+// proxyClient 代理共享的 HTTP 客户端, 复用到上游的连接
+var proxyClient = &http.Client{
+	Transport: tracing.Transport(&http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          200,
+		MaxIdleConnsPerHost:   50,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// 保留上游的压缩格式, 由转换流程自行解压
+		DisableCompression: true,
+	}),
+	// 重定向交给客户端自行处理
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// hopHeaders 逐跳头, 不能在代理两端之间转发
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ResponseTransform 响应转换配置, 根据上游响应的类型选择对应的转换方式,
+// 未配置对应转换方式的响应原样流式透传
+type ResponseTransform struct {
+	// Body 转换完整的 JSON 响应体, 仅处理 2xx 响应
+	Body func(body []byte) ([]byte, error)
+	// SSE 转换 text/event-stream 中每个非空 data 字段的内容(包括 [DONE]), 返回 nil 表示丢弃该行
+	SSE func(data []byte) ([]byte, error)
+	// JSONLine 转换分块 JSON (application/x-ndjson 等) 中的每一行, 返回 nil 表示丢弃该行
+	JSONLine func(line []byte) ([]byte, error)
+	// MaxBodySize Body 转换允许读取的最大字节数, 超出时解压后原样透传
+	MaxBodySize int64
+}
+
+// StreamStop SSE 或 JSONLine 转换返回该错误时, 写入 Tail 后结束响应, 不再读取上游剩余的数据
+type StreamStop struct {
+	Tail []byte
+}
+
+func (e *StreamStop) Error() string {
+	return "stream stopped by transform"
+}
+
+// setResponseTransform 为当前请求设置响应转换, 非空的字段覆盖代理处理函数创建时的配置,
+// 供需要按请求保存状态的中间件(例如回复审查)使用
+func setResponseTransform(c *gin.Context, transform *ResponseTransform) {
+	c.Set(responseTransformKey, transform)
+}
+
+// requestTransform 合并代理处理函数的配置与当前请求设置的响应转换
+func requestTransform(c *gin.Context, transform ResponseTransform) ResponseTransform {
+	value, ok := c.Get(responseTransformKey)
+	if !ok {
+		return transform
+	}
+	override, ok := value.(*ResponseTransform)
+	if !ok {
+		return transform
+	}
+	if override.Body != nil {
+		transform.Body = override.Body
+	}
+	if override.SSE != nil {
+		transform.SSE = override.SSE
+	}
+	if override.JSONLine != nil {
+		transform.JSONLine = override.JSONLine
+	}
+	if override.MaxBodySize > 0 {
+		transform.MaxBodySize = override.MaxBodySize
+	}
+	return transform
+}
+
+// CreateProxyHandler 创建代理处理函数, product 用于区分监控指标
 func CreateProxyHandler(
+	logger *log.Logger,
+	product string,
 	upstreamSite string,
 	processResponseBody func([]byte) ([]byte, error),
 ) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 构建上游服务器的 URL
-		upstreamURL := upstreamSite + c.Request.URL.Path
+	return CreateTransformProxyHandler(logger, product, upstreamSite, ResponseTransform{Body: processResponseBody})
+}
 
-		// 读取客户端请求的 Body
-		reqBody, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			fmt.Printf("Failed to read request body, %v", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
-		err = c.Request.Body.Close()
-		if err != nil {
-			fmt.Printf("Failed to close request body, %v", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+// CreateTransformProxyHandler 创建支持流式改写响应的代理处理函数, product 用于区分监控指标
+func CreateTransformProxyHandler(logger *log.Logger, product string, upstreamSite string, transform ResponseTransform) gin.HandlerFunc {
+	target, err := url.Parse(upstreamSite)
+	if err != nil {
+		panic(fmt.Sprintf("invalid upstream site %s: %v", upstreamSite, err))
+	}
+	if transform.MaxBodySize <= 0 {
+		transform.MaxBodySize = defaultMaxTransformBodySize
+	}
+
+	return func(c *gin.Context) {
+		transform := requestTransform(c, transform)
 
 		// 创建新的请求发送到上游服务器
-		req, err := http.NewRequest(c.Request.Method, upstreamURL, bytes.NewReader(reqBody))
+		req, err := newUpstreamRequest(c, target)
 		if err != nil {
-			fmt.Printf("Failed to create request, %v", err)
+			logger.WithContext(c).Error(fmt.Sprintf("proxy %s create request error: %v", c.Request.URL.Path, err))
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
 
-		// 复制请求头
-		req.Header = c.Request.Header.Clone()
-
-		// 创建 HTTP 客户端并发送请求
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := proxyClient.Do(req)
 		if err != nil {
-			fmt.Printf("Failed to send request, %v", err)
+			metrics.ObserveUpstreamError(product)
+			logger.WithContext(c).Error(fmt.Sprintf("proxy %s error: %v", c.Request.URL.Path, err))
 			c.AbortWithStatus(http.StatusBadGateway)
 			return
 		}
+		metrics.ObserveUpstream(product, resp)
 		defer func(Body io.ReadCloser) {
 			err := Body.Close()
 			if err != nil {
-				fmt.Printf("Failed to close response body, %v", err)
-				return
+				logger.WithContext(c).Warn(fmt.Sprintf("proxy %s close response body error: %v", c.Request.URL.Path, err))
 			}
 		}(resp.Body)
 
-		// 读取并解压缩响应体
-		respBody, contentEncoding, err := readResponseBody(resp)
+		// 复制上游响应的头信息到客户端响应
+		copyHeader(c.Writer.Header(), resp.Header)
+		announceTrailers(c.Writer.Header(), resp.Trailer)
+
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		switch {
+		case transform.SSE != nil && mediaType == "text/event-stream":
+			err = streamLines(c, logger, resp, func(line []byte) ([]byte, error) {
+				return transformSSELine(line, transform.SSE)
+			})
+		case transform.JSONLine != nil && isJSONLinesMediaType(mediaType):
+			err = streamLines(c, logger, resp, func(line []byte) ([]byte, error) {
+				return transformJSONLine(line, transform.JSONLine)
+			})
+		case transform.Body != nil && isJSONMediaType(mediaType) && resp.StatusCode >= 200 && resp.StatusCode < 300:
+			err = transformBody(c, logger, resp, transform.Body, transform.MaxBodySize)
+		default:
+			c.Status(resp.StatusCode)
+			err = copyWithFlush(c.Writer, resp.Body)
+		}
 		if err != nil {
-			fmt.Printf("Failed to read response body, %v", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
+			// 响应头可能已经发出, 只能记录错误并中断连接
+			logger.WithContext(c).Error(fmt.Sprintf("proxy %s write response error: %v", c.Request.URL.Path, err))
+			if !c.Writer.Written() {
+				c.AbortWithStatus(http.StatusInternalServerError)
+			} else {
+				c.Abort()
+			}
 			return
 		}
 
-		// 处理响应体
-		modifiedBody, err := processResponseBody(respBody)
+		// 转发上游的 Trailer
+		for key, values := range resp.Trailer {
+			c.Writer.Header()[http.TrailerPrefix+key] = values
+		}
+	}
+}
+
+// newUpstreamRequest 根据客户端请求构建上游请求, 请求体以流的方式转发
+func newUpstreamRequest(c *gin.Context, target *url.URL) (*http.Request, error) {
+	upstreamURL := *target
+	upstreamURL.Path = strings.TrimSuffix(target.Path, "/") + c.Request.URL.Path
+	upstreamURL.RawPath = ""
+	upstreamURL.RawQuery = c.Request.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, upstreamURL.String(), c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = c.Request.ContentLength
+
+	// 复制请求头
+	req.Header = c.Request.Header.Clone()
+	removeHopHeaders(req.Header)
+	// 保持原始的Host头
+	req.Host = target.Host
+
+	if clientIP, _, err := net.SplitHostPort(c.Request.RemoteAddr); err == nil {
+		if prior, ok := req.Header["X-Forwarded-For"]; ok {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		req.Header.Set("X-Forwarded-For", clientIP)
+	}
+	return req, nil
+}
+
+// removeHopHeaders 移除逐跳头以及 Connection 中声明的头
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				header.Del(key)
+			}
+		}
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// copyHeader 复制响应头, 跳过逐跳头
+func copyHeader(dst http.Header, src http.Header) {
+	for key, values := range src {
+		dst[key] = append([]string(nil), values...)
+	}
+	removeHopHeaders(dst)
+}
+
+// announceTrailers 在写出响应头之前声明上游的 Trailer
+func announceTrailers(header http.Header, trailer http.Header) {
+	if len(trailer) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	header.Set("Trailer", strings.Join(keys, ", "))
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isJSONLinesMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/json-seq", "application/stream+json":
+		return true
+	}
+	return false
+}
+
+// transformBody 读取并解压完整的响应体, 转换后按原压缩方式重新压缩返回
+func transformBody(c *gin.Context, logger *log.Logger, resp *http.Response, process func([]byte) ([]byte, error), maxBodySize int64) error {
+	contentEncoding := resp.Header.Get("Content-Encoding")
+
+	// 已知长度超出限制时直接透传
+	if resp.ContentLength > maxBodySize {
+		c.Status(resp.StatusCode)
+		return copyWithFlush(c.Writer, resp.Body)
+	}
+
+	reader, err := newDecodeReader(contentEncoding, resp.Body)
+	if err != nil {
+		return err
+	}
+	defer func(reader io.ReadCloser) {
+		err := reader.Close()
 		if err != nil {
-			fmt.Printf("Failed to process response body, %v", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
+			logger.WithContext(c).Warn(fmt.Sprintf("close %s reader error: %v", contentEncoding, err))
+		}
+	}(reader)
+
+	respBody, err := io.ReadAll(io.LimitReader(reader, maxBodySize+1))
+	if err != nil {
+		return fmt.Errorf("read response body failed: %v", err)
+	}
+
+	// 解压后超出限制, 放弃转换并以未压缩的方式透传
+	if int64(len(respBody)) > maxBodySize {
+		c.Writer.Header().Del("Content-Encoding")
+		c.Writer.Header().Del("Content-Length")
+		c.Status(resp.StatusCode)
+		if _, err := c.Writer.Write(respBody); err != nil {
+			return fmt.Errorf("write response body failed: %v", err)
 		}
+		return copyWithFlush(c.Writer, reader)
+	}
+
+	// 处理响应体
+	modifiedBody, err := process(respBody)
+	if err != nil {
+		return fmt.Errorf("process response body failed: %v", err)
+	}
 
-		// 将响应返回给客户端
-		err = writeResponse(c, resp, modifiedBody, contentEncoding)
+	// 如果需要，重新压缩响应体
+	if isSupportedEncoding(contentEncoding) {
+		var buf bytes.Buffer
+		writer, err := newEncodeWriter(contentEncoding, &buf)
 		if err != nil {
-			fmt.Printf("Failed to write response, %v", err)
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
+			return err
 		}
+		if _, err = writer.Write(modifiedBody); err != nil {
+			_ = writer.Close()
+			return fmt.Errorf("write %s data failed: %v", contentEncoding, err)
+		}
+		if err = writer.Close(); err != nil {
+			return fmt.Errorf("close %s writer failed: %v", contentEncoding, err)
+		}
+		modifiedBody = buf.Bytes()
+	}
+
+	// 设置新的 Content-Length
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(modifiedBody)))
+	c.Status(resp.StatusCode)
+
+	// 将修改后的响应体返回给客户端
+	if _, err := c.Writer.Write(modifiedBody); err != nil {
+		return fmt.Errorf("write response body failed: %v", err)
 	}
+	return nil
 }
 
-// 读取响应体并解压缩
-func readResponseBody(resp *http.Response) ([]byte, string, error) {
+// streamLines 逐行转换流式响应, 每批数据处理完毕后立即刷新给客户端;
+// 转换后的内容不再压缩, 以保证每行都能及时送达
+func streamLines(c *gin.Context, logger *log.Logger, resp *http.Response, process func(line []byte) ([]byte, error)) error {
 	contentEncoding := resp.Header.Get("Content-Encoding")
-	var reader io.Reader
-	var err error
+	reader, err := newDecodeReader(contentEncoding, resp.Body)
+	if err != nil {
+		return err
+	}
+	defer func(reader io.ReadCloser) {
+		err := reader.Close()
+		if err != nil {
+			logger.WithContext(c).Warn(fmt.Sprintf("close %s reader error: %v", contentEncoding, err))
+		}
+	}(reader)
 
+	c.Writer.Header().Del("Content-Encoding")
+	c.Writer.Header().Del("Content-Length")
+	c.Status(resp.StatusCode)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	buffered := bufio.NewReader(reader)
+	for {
+		line, readErr := buffered.ReadBytes('\n')
+		if len(line) > 0 {
+			out, err := process(line)
+			var stop *StreamStop
+			if errors.As(err, &stop) {
+				if _, err := c.Writer.Write(stop.Tail); err != nil {
+					return fmt.Errorf("write response body failed: %v", err)
+				}
+				c.Writer.Flush()
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if len(out) > 0 {
+				if _, err := c.Writer.Write(out); err != nil {
+					return fmt.Errorf("write response body failed: %v", err)
+				}
+			}
+			// 当前批次已处理完毕, 刷新输出
+			if buffered.Buffered() == 0 {
+				c.Writer.Flush()
+			}
+		}
+		if readErr != nil {
+			c.Writer.Flush()
+			if readErr == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read response body failed: %v", readErr)
+		}
+	}
+}
+
+// transformSSELine 转换 SSE 中的一行, 仅处理 data 字段, 其余字段原样保留
+func transformSSELine(line []byte, process func([]byte) ([]byte, error)) ([]byte, error) {
+	content, ending := splitLineEnding(line)
+	if !bytes.HasPrefix(content, []byte("data:")) {
+		return line, nil
+	}
+	data := bytes.TrimPrefix(bytes.TrimPrefix(content, []byte("data:")), []byte(" "))
+	if len(data) == 0 {
+		return line, nil
+	}
+	out, err := process(data)
+	if err != nil {
+		return nil, fmt.Errorf("process sse data failed: %w", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+	result := make([]byte, 0, len(out)+len(ending)+6)
+	result = append(result, "data: "...)
+	result = append(result, out...)
+	return append(result, ending...), nil
+}
+
+// transformJSONLine 转换分块 JSON 中的一行, 空行原样保留
+func transformJSONLine(line []byte, process func([]byte) ([]byte, error)) ([]byte, error) {
+	content, ending := splitLineEnding(line)
+	if len(bytes.TrimSpace(content)) == 0 {
+		return line, nil
+	}
+	out, err := process(content)
+	if err != nil {
+		return nil, fmt.Errorf("process json line failed: %w", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+	return append(append([]byte(nil), out...), ending...), nil
+}
+
+// splitLineEnding 拆分行内容与行尾换行符
+func splitLineEnding(line []byte) ([]byte, []byte) {
+	content := bytes.TrimRight(line, "\r\n")
+	return content, line[len(content):]
+}
+
+// copyWithFlush 流式复制响应体, 每次读取后立即刷新, 保证 SSE 等流式响应不被缓冲
+func copyWithFlush(w gin.ResponseWriter, src io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("write response body failed: %v", err)
+			}
+			w.Flush()
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read response body failed: %v", readErr)
+		}
+	}
+}
+
+// isSupportedEncoding 是否为可以解压与重新压缩的编码
+func isSupportedEncoding(contentEncoding string) bool {
+	switch contentEncoding {
+	case "gzip", "zstd", "br", "brotli", "deflate", "zlib", "lz4", "snappy", "lzw", "xz", "s2":
+		return true
+	}
+	return false
+}
+
+// newDecodeReader 根据 Content-Encoding 创建流式解压读取器, 未压缩或未知压缩方式时直接读取
+func newDecodeReader(contentEncoding string, body io.Reader) (io.ReadCloser, error) {
 	switch contentEncoding {
 	case "gzip":
 		// 处理 gzip 压缩
-		gzReader, err := gzip.NewReader(resp.Body)
+		gzReader, err := gzip.NewReader(body)
 		if err != nil {
-			return nil, "", fmt.Errorf("create gzip reader failed: %v", err)
+			return nil, fmt.Errorf("create gzip reader failed: %v", err)
 		}
-		defer func() {
-			if err := gzReader.Close(); err != nil {
-				fmt.Printf("close gzip reader failed: %v", err)
-			}
-		}()
-		reader = gzReader
+		return gzReader, nil
 
 	case "zstd":
 		// 处理 zstd 压缩
-		zReader, err := zstd.NewReader(resp.Body)
+		zReader, err := zstd.NewReader(body)
 		if err != nil {
-			return nil, "", fmt.Errorf("create zstd reader failed: %v", err)
+			return nil, fmt.Errorf("create zstd reader failed: %v", err)
 		}
-		defer zReader.Close()
-		reader = zReader
+		return zReader.IOReadCloser(), nil
 
 	case "br", "brotli":
 		// 处理 brotli 压缩
-		reader = brotli.NewReader(resp.Body)
+		return io.NopCloser(brotli.NewReader(body)), nil
 
 	case "deflate":
 		// 处理 deflate 压缩
-		reader = flate.NewReader(resp.Body)
-		defer func(closer io.Closer) {
-			err := closer.Close()
-			if err != nil {
-				fmt.Printf("close deflate reader failed: %v", err)
-			}
-		}(reader.(io.Closer))
+		return flate.NewReader(body), nil
 
 	case "zlib":
 		// 处理 zlib 压缩
-		zReader, err := zlib.NewReader(resp.Body)
+		zReader, err := zlib.NewReader(body)
 		if err != nil {
-			return nil, "", fmt.Errorf("create zlib reader failed: %v", err)
+			return nil, fmt.Errorf("create zlib reader failed: %v", err)
 		}
-		defer func(zReader io.ReadCloser) {
-			err := zReader.Close()
-			if err != nil {
-				fmt.Printf("close zlib reader failed: %v", err)
-			}
-		}(zReader)
-		reader = zReader
+		return zReader, nil
 
 	case "lz4":
 		// 处理 LZ4 压缩
-		reader = lz4.NewReader(resp.Body)
+		return io.NopCloser(lz4.NewReader(body)), nil
 
 	case "snappy":
 		// 处理 Snappy 压缩
-		reader = snappy.NewReader(resp.Body)
+		return io.NopCloser(snappy.NewReader(body)), nil
 
 	case "lzw":
 		// 处理 LZW 压缩
-		reader = lzw.NewReader(resp.Body, lzw.MSB, 8)
-		defer func(closer io.Closer) {
-			err := closer.Close()
-			if err != nil {
-				fmt.Printf("close lzw reader failed: %v", err)
-			}
-		}(reader.(io.Closer))
+		return lzw.NewReader(body, lzw.MSB, 8), nil
 
 	case "xz":
 		// 处理 XZ 压缩
-		xzReader, err := xz.NewReader(resp.Body)
+		xzReader, err := xz.NewReader(body)
 		if err != nil {
-			return nil, "", fmt.Errorf("create xz reader failed: %v", err)
+			return nil, fmt.Errorf("create xz reader failed: %v", err)
 		}
-		reader = xzReader
+		return io.NopCloser(xzReader), nil
 
 	case "s2":
 		// 处理 S2 压缩
-		reader = s2.NewReader(resp.Body)
+		return io.NopCloser(s2.NewReader(body)), nil
 
 	default:
 		// 未压缩或未知压缩方式，直接读取
-		reader = resp.Body
-		contentEncoding = ""
+		return io.NopCloser(body), nil
 	}
-
-	// 读取响应体
-	respBody, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, "", fmt.Errorf("read response body failed: %v", err)
-	}
-
-	return respBody, contentEncoding, nil
 }
 
-// 将修改后的响应体返回给客户端
-func writeResponse(
-	c *gin.Context,
-	resp *http.Response,
-	modifiedBody []byte,
-	contentEncoding string,
-) error {
-	// 如果需要，重新压缩响应体
-	if contentEncoding != "" {
-		var buf bytes.Buffer
-		var err error
-
-		switch contentEncoding {
-		case "gzip":
-			writer := gzip.NewWriter(&buf)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				return fmt.Errorf("write gzip data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close gzip writer failed: %v", err)
-			}
-
-		case "zstd":
-			writer, err := zstd.NewWriter(&buf)
-			if err != nil {
-				return fmt.Errorf("create zstd encoder failed: %v", err)
-			}
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write zstd data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close zstd writer failed: %v", err)
-			}
-
-		case "br", "brotli":
-			writer := brotli.NewWriter(&buf)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write brotli data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close brotli writer failed: %v", err)
-			}
-
-		case "deflate":
-			writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
-			if err != nil {
-				return fmt.Errorf("create deflate writer failed: %v", err)
-			}
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write deflate data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close deflate writer failed: %v", err)
-			}
+// newEncodeWriter 根据 Content-Encoding 创建压缩写入器
+func newEncodeWriter(contentEncoding string, w io.Writer) (io.WriteCloser, error) {
+	switch contentEncoding {
+	case "gzip":
+		return gzip.NewWriter(w), nil
 
-		case "zlib":
-			writer := zlib.NewWriter(&buf)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write zlib data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close zlib writer failed: %v", err)
-			}
+	case "zstd":
+		writer, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd encoder failed: %v", err)
+		}
+		return writer, nil
 
-		case "lz4":
-			writer := lz4.NewWriter(&buf)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write lz4 data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close lz4 writer failed: %v", err)
-			}
+	case "br", "brotli":
+		return brotli.NewWriter(w), nil
 
-		case "snappy":
-			writer := snappy.NewBufferedWriter(&buf)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write snappy data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close snappy writer failed: %v", err)
-			}
+	case "deflate":
+		writer, err := flate.NewWriter(w, flate.DefaultCompression)
+		if err != nil {
+			return nil, fmt.Errorf("create deflate writer failed: %v", err)
+		}
+		return writer, nil
 
-		case "lzw":
-			writer := lzw.NewWriter(&buf, lzw.MSB, 8)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write lzw data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close lzw writer failed: %v", err)
-			}
+	case "zlib":
+		return zlib.NewWriter(w), nil
 
-		case "xz":
-			writer, err := xz.NewWriter(&buf)
-			if err != nil {
-				return fmt.Errorf("create xz writer failed: %v", err)
-			}
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write xz data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close xz writer failed: %v", err)
-			}
+	case "lz4":
+		return lz4.NewWriter(w), nil
 
-		case "s2":
-			writer := s2.NewWriter(&buf)
-			if _, err = writer.Write(modifiedBody); err != nil {
-				err := writer.Close()
-				if err != nil {
-					return err
-				}
-				return fmt.Errorf("write s2 data failed: %v", err)
-			}
-			if err = writer.Close(); err != nil {
-				return fmt.Errorf("close s2 writer failed: %v", err)
-			}
-		}
+	case "snappy":
+		return snappy.NewBufferedWriter(w), nil
 
-		modifiedBody = buf.Bytes()
-	}
+	case "lzw":
+		return lzw.NewWriter(w, lzw.MSB, 8), nil
 
-	// 复制上游响应的头信息到客户端响应
-	for key, values := range resp.Header {
-		if !strings.EqualFold(key, "Content-Length") {
-			c.Writer.Header()[key] = values
+	case "xz":
+		writer, err := xz.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("create xz writer failed: %v", err)
 		}
-	}
+		return writer, nil
 
-	// 设置新的 Content-Length
-	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(modifiedBody)))
-
-	// 设置响应状态码
-	c.Status(resp.StatusCode)
+	case "s2":
+		return s2.NewWriter(w), nil
 
-	// 将修改后的响应体返回给客户端
-	_, err := c.Writer.Write(modifiedBody)
-	if err != nil {
-		return fmt.Errorf("write response body failed: %v", err)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", contentEncoding)
 	}
-
-	return nil
 }
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// proxyResponse 通过代理请求 upstream, 返回未解压的响应与响应体
+func proxyResponse(t *testing.T, upstream http.HandlerFunc, transform ResponseTransform) (*http.Response, []byte) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	backend := httptest.NewServer(upstream)
+	t.Cleanup(backend.Close)
+
+	r := gin.New()
+	r.NoRoute(CreateTransformProxyHandler(&log.Logger{Logger: zap.NewNop()}, "test", backend.URL, transform))
+	proxy := httptest.NewServer(r)
+	t.Cleanup(proxy.Close)
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Get(proxy.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+// writeBody 以指定的类型与压缩方式返回响应体
+func writeBody(contentType string, encoding string, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		data := []byte(body)
+		if encoding != "" {
+			data = encode(encoding, data)
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		_, _ = w.Write(data)
+	}
+}
+
+func encode(encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	writer, err := newEncodeWriter(encoding, &buf)
+	if err != nil {
+		panic(err)
+	}
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+	reader, err := newDecodeReader(encoding, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestProxySSE(t *testing.T) {
+	// upper 将 data 转为大写, 内容为 drop 时丢弃该行, 内容为 stop 时结束响应
+	upper := func(data []byte) ([]byte, error) {
+		switch string(data) {
+		case "drop":
+			return nil, nil
+		case "stop":
+			return nil, &StreamStop{Tail: []byte("data: stopped\n\n")}
+		}
+		return bytes.ToUpper(data), nil
+	}
+	tests := []struct {
+		name     string
+		encoding string
+		body     string
+		want     string
+	}{
+		{name: "rewrite data", body: "event: message\ndata: hello\n\ndata:world\n\n", want: "event: message\ndata: HELLO\n\ndata: WORLD\n\n"},
+		{name: "drop data", body: "data: hello\ndata: drop\n\n", want: "data: HELLO\n\n"},
+		{name: "done passed to transform", body: "data: [DONE]\n\n", want: "data: [DONE]\n\n"},
+		{name: "comment and crlf kept", body: ": ping\r\ndata: a\r\n\r\n", want: ": ping\r\ndata: A\r\n\r\n"},
+		{name: "last line without newline", body: "data: tail", want: "data: TAIL"},
+		{name: "stop stream", body: "data: a\n\ndata: stop\n\ndata: b\n\n", want: "data: A\n\ndata: stopped\n\n"},
+		{name: "gzip decoded", encoding: "gzip", body: "data: zipped\n\n", want: "data: ZIPPED\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := proxyResponse(t, writeBody("text/event-stream; charset=utf-8", tt.encoding, tt.body), ResponseTransform{SSE: upper})
+			if got := string(body); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+		})
+	}
+}
+
+func TestProxyJSONLines(t *testing.T) {
+	transform := ResponseTransform{JSONLine: func(line []byte) ([]byte, error) {
+		if bytes.Contains(line, []byte(`"secret"`)) {
+			return nil, nil
+		}
+		return bytes.ReplaceAll(line, []byte("gpt-4"), []byte("hidden")), nil
+	}}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "rewrite lines", contentType: "application/x-ndjson",
+			body: "{\"model\":\"gpt-4\"}\n\n{\"model\":\"gpt-4o\"}\n", want: "{\"model\":\"hidden\"}\n\n{\"model\":\"hiddeno\"}\n"},
+		{name: "drop line", contentType: "application/jsonl",
+			body: "{\"type\":\"secret\"}\n{\"type\":\"public\"}\n", want: "{\"type\":\"public\"}\n"},
+		{name: "other type passes through", contentType: "text/plain",
+			body: "{\"model\":\"gpt-4\"}\n", want: "{\"model\":\"gpt-4\"}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, body := proxyResponse(t, writeBody(tt.contentType, "", tt.body), transform)
+			if got := string(body); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyBody(t *testing.T) {
+	process := func(body []byte) ([]byte, error) {
+		return bytes.ReplaceAll(body, []byte("real@example.com"), []byte("hidden@example.com")), nil
+	}
+	large := `{"email":"real@example.com","padding":"` + strings.Repeat("x", 1000) + `"}`
+	tests := []struct {
+		name        string
+		upstream    http.HandlerFunc
+		maxBodySize int64
+		// wantEncoding 客户端收到的压缩方式, want 解压后的响应体
+		wantEncoding string
+		want         string
+	}{
+		{name: "plain", upstream: writeBody("application/json", "", `{"email":"real@example.com"}`),
+			want: `{"email":"hidden@example.com"}`},
+		{name: "gzip round trip", upstream: writeBody("application/json", "gzip", `{"email":"real@example.com"}`),
+			wantEncoding: "gzip", want: `{"email":"hidden@example.com"}`},
+		{name: "brotli round trip", upstream: writeBody("application/json", "br", `{"email":"real@example.com"}`),
+			wantEncoding: "br", want: `{"email":"hidden@example.com"}`},
+		{name: "zstd round trip", upstream: writeBody("application/json", "zstd", `{"email":"real@example.com"}`),
+			wantEncoding: "zstd", want: `{"email":"hidden@example.com"}`},
+		{name: "known length over limit passes through", upstream: writeBody("application/json", "", large),
+			maxBodySize: 200, want: large},
+		{name: "compressed length over limit passes through", upstream: writeBody("application/json", "gzip", large),
+			maxBodySize: 32, wantEncoding: "gzip", want: large},
+		// 压缩后未超出限制, 解压后超出时以未压缩的方式透传
+		{name: "decoded size over limit passes through decoded", upstream: writeBody("application/json", "gzip", large),
+			maxBodySize: 200, want: large},
+		{name: "error status not transformed", upstream: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"email":"real@example.com"}`))
+		}, want: `{"email":"real@example.com"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := proxyResponse(t, tt.upstream, ResponseTransform{Body: process, MaxBodySize: tt.maxBodySize})
+			encoding := resp.Header.Get("Content-Encoding")
+			if encoding != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+			if got := decode(t, encoding, body); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyTrailers(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		transform   ResponseTransform
+	}{
+		{name: "pass through", contentType: "application/octet-stream"},
+		{name: "sse", contentType: "text/event-stream", transform: ResponseTransform{SSE: func(data []byte) ([]byte, error) {
+			return data, nil
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Trailer", "X-Checksum")
+				_, _ = w.Write([]byte("data: a\n\n"))
+				w.Header().Set("X-Checksum", "abc")
+			}
+			resp, body := proxyResponse(t, upstream, tt.transform)
+			if string(body) != "data: a\n\n" {
+				t.Errorf("body = %q", body)
+			}
+			if got := resp.Trailer.Get("X-Checksum"); got != "abc" {
+				t.Errorf("trailer X-Checksum = %q, want abc", got)
+			}
+		})
+	}
+}
+
+func TestSetResponseTransform(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend := httptest.NewServer(writeBody("text/event-stream", "", "data: a\n\n"))
+	defer backend.Close()
+
+	// 中间件设置的转换覆盖代理处理函数创建时的配置
+	r := gin.New()
+	r.GET("/stream", func(c *gin.Context) {
+		setResponseTransform(c, &ResponseTransform{SSE: func(data []byte) ([]byte, error) {
+			return []byte("request"), nil
+		}})
+	}, CreateTransformProxyHandler(&log.Logger{Logger: zap.NewNop()}, "test", backend.URL, ResponseTransform{SSE: func(data []byte) ([]byte, error) {
+		return []byte("handler"), nil
+	}}))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if got := rec.Body.String(); got != "data: request\n\n" {
+		t.Errorf("body = %q, want data: request", got)
+	}
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+)
+
+// Migrations 所有数据库迁移, 新增迁移时追加到末尾并使用更大的版本号
+//
+// 版本 1 沿用之前启动时 AutoMigrate 的全部表, 已有数据库执行时只会补齐缺少的列与索引。
+// 迁移使用 schema_v*.go 中当时的表结构快照而不是 model 中的结构体, 之后修改模型不会改变已发布迁移的行为,
+// 新的结构变化需要新增版本与对应的快照
+var Migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(
+				v1OpenaiAccount{},
+				v1OpenaiToken{},
+				v1User{},
+				v1ClaudeToken{},
+				v1ClaudeAccount{},
+				v1ModerationRule{},
+				v1ModerationEvent{},
+				v1StrikePolicy{},
+				v1UserSuspension{},
+				v1JobConfig{},
+				v1JobRun{},
+				v1JobRunItem{},
+				v1JobLock{},
+				v1Setting{},
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_conversation",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(v2Conversation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(v2Conversation{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_share_token_drift",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(v3ShareTokenDrift{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(v3ShareTokenDrift{})
+		},
+	},
+}
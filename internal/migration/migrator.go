@@ -0,0 +1,191 @@
+package migration
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrSchemaNewer 数据库已执行过当前版本不认识的迁移, 通常是降级了程序版本
+var ErrSchemaNewer = errors.New("database schema is newer than this version of the program")
+
+// ErrIrreversible 迁移没有回滚步骤
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// Migration 一个版本的数据库迁移
+//
+// 迁移一经发布不能修改, 结构变化或数据修复需要新增版本; Up 与 Down 在事务中执行,
+// 但 mysql 的 DDL 会隐式提交, 因此步骤需要能够重复执行
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// Down 为空时不能回滚
+	Down func(tx *gorm.DB) error
+}
+
+// Status 迁移的执行状态
+type Status struct {
+	Version int64
+	Name    string
+	// Applied 是否已执行
+	Applied     bool
+	AppliedTime time.Time
+	// Unknown 数据库中存在但当前程序没有的迁移
+	Unknown bool
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	logger     *log.Logger
+	migrations []*Migration
+}
+
+func NewMigrator(db *gorm.DB, logger *log.Logger) *Migrator {
+	migrations := append([]*Migration(nil), Migrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return &Migrator{
+		db:         db,
+		logger:     logger,
+		migrations: migrations,
+	}
+}
+
+// applied 返回已执行的迁移, 不存在迁移表时创建
+func (m *Migrator) applied(ctx context.Context) (map[int64]*model.SchemaMigration, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&model.SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []*model.SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]*model.SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Status 返回所有迁移的状态, 包括数据库中存在但当前程序不认识的迁移
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*Status, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		status := &Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedTime = row.AppliedTime
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range applied {
+		if !known[version] {
+			statuses = append(statuses, &Status{Version: version, Name: row.Name, Applied: true, AppliedTime: row.AppliedTime, Unknown: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Check 检查数据库结构, 存在当前程序不认识的迁移时返回 ErrSchemaNewer, 否则返回待执行的迁移数
+func (m *Migrator) Check(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.Unknown {
+			return 0, fmt.Errorf("%w: migration %d %s is unknown", ErrSchemaNewer, status.Version, status.Name)
+		}
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up 按版本顺序执行未执行的迁移, target 大于 0 时只执行到该版本
+func (m *Migrator) Up(ctx context.Context, target int64) error {
+	if _, err := m.Check(ctx); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&model.SchemaMigration{
+				Version:     migration.Version,
+				Name:        migration.Name,
+				AppliedTime: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		m.logger.Info("migration applied", zap.Int64("version", migration.Version), zap.String("name", migration.Name), zap.Duration("duration", time.Since(start)))
+	}
+	return nil
+}
+
+// Down 按版本倒序回滚最近执行的 steps 个迁移
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if _, err := m.Check(ctx); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&model.SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("rollback migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		m.logger.Info("migration rolled back", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+		steps--
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package migration
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewMigrator(db, &log.Logger{Logger: zap.NewNop()}), db
+}
+
+// appliedVersions 返回已执行的迁移版本
+func appliedVersions(t *testing.T, m *Migrator) []int64 {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	var versions []int64
+	for _, status := range statuses {
+		if status.Applied {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func equalVersions(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, m *Migrator) error
+		// wantApplied 执行后已执行的版本, wantPending 执行后 Check 返回的待执行数
+		wantApplied []int64
+		wantPending int
+		wantErr     error
+	}{
+		{
+			name:        "up all",
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx, 0) },
+			wantApplied: []int64{1, 2, 3},
+		},
+		{
+			name:        "up to target",
+			run:         func(ctx context.Context, m *Migrator) error { return m.Up(ctx, 1) },
+			wantApplied: []int64{1},
+			wantPending: 2,
+		},
+		{
+			name: "up twice",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx, 0); err != nil {
+					return err
+				}
+				return m.Up(ctx, 0)
+			},
+			wantApplied: []int64{1, 2, 3},
+		},
+		{
+			name: "down one",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx, 0); err != nil {
+					return err
+				}
+				return m.Down(ctx, 1)
+			},
+			wantApplied: []int64{1, 2},
+			wantPending: 1,
+		},
+		{
+			name: "down past baseline",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx, 0); err != nil {
+					return err
+				}
+				return m.Down(ctx, 3)
+			},
+			wantApplied: []int64{1},
+			wantPending: 2,
+			wantErr:     ErrIrreversible,
+		},
+		{
+			name: "down then up",
+			run: func(ctx context.Context, m *Migrator) error {
+				if err := m.Up(ctx, 0); err != nil {
+					return err
+				}
+				if err := m.Down(ctx, 2); err != nil {
+					return err
+				}
+				return m.Up(ctx, 0)
+			},
+			wantApplied: []int64{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, _ := newTestMigrator(t)
+			if err := tt.run(ctx, m); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := appliedVersions(t, m); !equalVersions(got, tt.wantApplied) {
+				t.Errorf("applied = %v, want %v", got, tt.wantApplied)
+			}
+			pending, err := m.Check(ctx)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if pending != tt.wantPending {
+				t.Errorf("Check() pending = %d, want %d", pending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestMigratorDownDropsTable(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t)
+	if err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if !db.Migrator().HasTable(&model.ShareTokenDrift{}) {
+		t.Fatal("table tb_share_token_drift not created")
+	}
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if db.Migrator().HasTable(&model.ShareTokenDrift{}) {
+		t.Error("table tb_share_token_drift not dropped")
+	}
+}
+
+func TestMigratorUnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t)
+	if err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	// 新版本程序执行过的迁移
+	err := db.Create(&model.SchemaMigration{Version: 999, Name: "future", AppliedTime: time.Now()}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Check(ctx); !errors.Is(err, ErrSchemaNewer) {
+		t.Errorf("Check() error = %v, want ErrSchemaNewer", err)
+	}
+	if err := m.Up(ctx, 0); !errors.Is(err, ErrSchemaNewer) {
+		t.Errorf("Up() error = %v, want ErrSchemaNewer", err)
+	}
+	if err := m.Down(ctx, 1); !errors.Is(err, ErrSchemaNewer) {
+		t.Errorf("Down() error = %v, want ErrSchemaNewer", err)
+	}
+}
+
+// TestMigrationsMatchModels 模型新增的列必须有对应的迁移, 否则新建的数据库缺少该列
+func TestMigrationsMatchModels(t *testing.T) {
+	m, db := newTestMigrator(t)
+	if err := m.Up(context.Background(), 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	models := []interface{}{
+		&model.OpenaiAccount{}, &model.OpenaiToken{}, &model.User{}, &model.ClaudeToken{}, &model.ClaudeAccount{},
+		&model.ModerationRule{}, &model.ModerationEvent{}, &model.StrikePolicy{}, &model.UserSuspension{},
+		&model.JobConfig{}, &model.JobRun{}, &model.JobRunItem{}, &model.JobLock{}, &model.Setting{},
+		&model.Conversation{}, &model.ShareTokenDrift{},
+	}
+	for _, value := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(value); err != nil {
+			t.Fatal(err)
+		}
+		if !db.Migrator().HasTable(value) {
+			t.Errorf("table %s not created by migrations", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(value, field.DBName) {
+				t.Errorf("column %s.%s not created by migrations", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
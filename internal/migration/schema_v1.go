@@ -0,0 +1,243 @@
+package migration
+
+import (
+	"time"
+)
+
+// 版本 1 的表结构快照, 迁移执行时的结构不随之后模型的修改而变化
+
+type v1OpenaiAccount struct {
+	ID                int64  `gorm:"primaryKey;autoIncrement"`
+	UserId            int64  `gorm:"not null"`
+	TokenID           int64  `gorm:"not null"`
+	Account           string `gorm:"not null;unique"`
+	ExpirationTime    time.Time
+	Status            int       `gorm:"not null;default:1"`
+	Gpt35Limit        int       `gorm:"default:-1"`
+	Gpt4Limit         int       `gorm:"default:-1"`
+	Gpt4oLimit        int       `gorm:"default:-1"`
+	Gpt4oMiniLimit    int       `gorm:"default:-1"`
+	O1Limit           int       `gorm:"default:-1"`
+	O1MiniLimit       int       `gorm:"default:-1"`
+	ShowConversations int       `gorm:"default:0"`
+	TemporaryChat     int       `gorm:"default:0"`
+	ShareToken        string    `gorm:"not null"`
+	ShareTokenEncrypt string    `gorm:"not null;default:0"`
+	ExpireAt          time.Time `gorm:"not null"`
+	CreateTime        time.Time `gorm:"not null"`
+	UpdateTime        time.Time `gorm:"not null"`
+}
+
+func (v1OpenaiAccount) TableName() string {
+	return "tb_openai_account"
+}
+
+type v1OpenaiToken struct {
+	ID               int64     `gorm:"primaryKey;autoIncrement"`
+	TokenName        string    `gorm:"not null"`
+	PlusSubscription int       `gorm:"default:0"`
+	RefreshToken     string    `gorm:"not null;unique"`
+	AccessToken      string    `gorm:"not null"`
+	ExpireAt         time.Time `gorm:"not null"`
+	CreateTime       time.Time `gorm:"not null"`
+	UpdateTime       time.Time `gorm:"not null"`
+}
+
+func (v1OpenaiToken) TableName() string {
+	return "tb_openai_token"
+}
+
+type v1User struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`
+	UniqueName     string    `gorm:"not null;unique"`
+	Password       string    `gorm:"not null;unique"`
+	Enable         int       `gorm:"default:1"`
+	Openai         int       `gorm:"default:0"`
+	OpenaiToken    int64     `gorm:"default:0"`
+	Claude         int       `gorm:"default:0"`
+	ClaudeToken    int64     `gorm:"default:0"`
+	BlockUpload    int       `gorm:"default:0"`
+	BlockImage     int       `gorm:"default:0"`
+	ExpirationTime time.Time `gorm:"not null"`
+	CreateTime     time.Time `gorm:"not null"`
+	UpdateTime     time.Time `gorm:"not null"`
+}
+
+func (v1User) TableName() string {
+	return "tb_user"
+}
+
+type v1ClaudeToken struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement"`
+	TokenName    string    `gorm:"not null"`
+	SessionToken string    `gorm:"not null"`
+	CreateTime   time.Time `gorm:"not null"`
+	UpdateTime   time.Time `gorm:"not null"`
+}
+
+func (v1ClaudeToken) TableName() string {
+	return "tb_claude_token"
+}
+
+type v1ClaudeAccount struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`
+	UserId     int64     `gorm:"not null"`
+	TokenID    int64     `gorm:"not null"`
+	Account    string    `gorm:"not null;unique"`
+	Status     int       `gorm:"not null;default:1"`
+	CreateTime time.Time `gorm:"not null"`
+	UpdateTime time.Time `gorm:"not null"`
+}
+
+func (v1ClaudeAccount) TableName() string {
+	return "tb_claude_account"
+}
+
+type v1ModerationRule struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`
+	Name       string    `gorm:"not null"`
+	Type       string    `gorm:"not null;default:keyword"`
+	Pattern    string    `gorm:"type:text;not null"`
+	Product    string    `gorm:"not null;default:all"`
+	Category   string    `gorm:"default:''"`
+	Enable     int       `gorm:"default:1"`
+	CreateTime time.Time `gorm:"not null"`
+	UpdateTime time.Time `gorm:"not null"`
+}
+
+func (v1ModerationRule) TableName() string {
+	return "tb_moderation_rule"
+}
+
+type v1ModerationEvent struct {
+	ID             int64  `gorm:"primaryKey;autoIncrement"`
+	Product        string `gorm:"not null;index"`
+	UserId         int64  `gorm:"default:0;index"`
+	UserName       string `gorm:"default:''"`
+	AccountId      int64  `gorm:"default:0"`
+	Account        string `gorm:"default:''"`
+	UpstreamUser   string `gorm:"default:''"`
+	ShareTokenHash string `gorm:"default:''"`
+	Direction      string `gorm:"not null;default:input;index"`
+	Provider       string `gorm:"default:''"`
+	Categories     string `gorm:"default:''"`
+	Scores         string `gorm:"type:text"`
+	Reason         string `gorm:"default:''"`
+	Message        string `gorm:"type:text"`
+	Action         string `gorm:"not null;default:block"`
+	Status         int    `gorm:"not null;default:0;index"`
+	Strike         int    `gorm:"not null;default:1"`
+	ReviewNote     string `gorm:"default:''"`
+	ReviewTime     time.Time
+	CreateTime     time.Time `gorm:"not null;index"`
+}
+
+func (v1ModerationEvent) TableName() string {
+	return "tb_moderation_event"
+}
+
+type v1StrikePolicy struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`
+	Name           string    `gorm:"not null"`
+	Product        string    `gorm:"not null;default:all"`
+	Threshold      int       `gorm:"not null"`
+	WindowMinutes  int       `gorm:"not null;default:0"`
+	Action         string    `gorm:"not null;default:suspend"`
+	SuspendMinutes int       `gorm:"not null;default:0"`
+	Enable         int       `gorm:"default:1"`
+	CreateTime     time.Time `gorm:"not null"`
+	UpdateTime     time.Time `gorm:"not null"`
+}
+
+func (v1StrikePolicy) TableName() string {
+	return "tb_strike_policy"
+}
+
+type v1UserSuspension struct {
+	ID           int64  `gorm:"primaryKey;autoIncrement"`
+	UserId       int64  `gorm:"not null;index"`
+	PolicyId     int64  `gorm:"default:0"`
+	Action       string `gorm:"not null"`
+	Reason       string `gorm:"default:''"`
+	Strikes      int64  `gorm:"default:0"`
+	SuspendUntil time.Time
+	Status       int `gorm:"not null;default:1;index"`
+	LiftTime     time.Time
+	CreateTime   time.Time `gorm:"not null"`
+}
+
+func (v1UserSuspension) TableName() string {
+	return "tb_user_suspension"
+}
+
+type v1JobConfig struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`
+	Name       string    `gorm:"not null;unique"`
+	Cron       string    `gorm:"not null"`
+	Timezone   string    `gorm:"not null"`
+	Enable     int       `gorm:"not null"`
+	UpdateTime time.Time `gorm:"not null"`
+}
+
+func (v1JobConfig) TableName() string {
+	return "tb_job_config"
+}
+
+type v1JobRun struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement"`
+	Job       string    `gorm:"not null;index"`
+	Trigger   string    `gorm:"column:trigger_type;not null"`
+	Instance  string    `gorm:"default:''"`
+	Status    string    `gorm:"not null;index"`
+	Total     int       `gorm:"not null"`
+	Success   int       `gorm:"not null"`
+	Failure   int       `gorm:"not null"`
+	Skipped   int       `gorm:"not null"`
+	Error     string    `gorm:"type:text"`
+	StartTime time.Time `gorm:"not null;index"`
+	EndTime   time.Time
+}
+
+func (v1JobRun) TableName() string {
+	return "tb_job_run"
+}
+
+type v1JobRunItem struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`
+	RunId      int64     `gorm:"not null;index"`
+	Job        string    `gorm:"not null;index:idx_job_run_item_target"`
+	ItemType   string    `gorm:"not null;index:idx_job_run_item_target"`
+	ItemId     int64     `gorm:"not null;index:idx_job_run_item_target"`
+	ItemName   string    `gorm:"default:''"`
+	Status     string    `gorm:"not null"`
+	Message    string    `gorm:"type:text"`
+	CreateTime time.Time `gorm:"not null;index"`
+}
+
+func (v1JobRunItem) TableName() string {
+	return "tb_job_run_item"
+}
+
+type v1JobLock struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`
+	Name       string    `gorm:"not null;unique"`
+	Owner      string    `gorm:"not null"`
+	RunKey     string    `gorm:"not null"`
+	ExpireTime time.Time `gorm:"not null"`
+	UpdateTime time.Time `gorm:"not null"`
+}
+
+func (v1JobLock) TableName() string {
+	return "tb_job_lock"
+}
+
+type v1Setting struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`
+	Name       string    `gorm:"not null;unique"`
+	Value      string    `gorm:"type:text"`
+	UpdateTime time.Time `gorm:"not null"`
+}
+
+func (v1Setting) TableName() string {
+	return "tb_setting"
+}
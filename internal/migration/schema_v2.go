@@ -0,0 +1,22 @@
+package migration
+
+import (
+	"time"
+)
+
+// 版本 2 新增的表结构快照
+
+type v2Conversation struct {
+	ID               uint   `gorm:"primaryKey"`
+	UserMessage      string `gorm:"type:text"`
+	AssistantMessage string `gorm:"type:text"`
+	Product          string `gorm:"type:text"`
+	Model            string `gorm:"type:text"`
+	Timestamp        time.Time
+	ConversationID   string
+	UserID           string
+}
+
+func (v2Conversation) TableName() string {
+	return "tb_conversation"
+}
@@ -0,0 +1,24 @@
+package migration
+
+import (
+	"time"
+)
+
+// 版本 3 新增的表结构快照
+
+type v3ShareTokenDrift struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement"`
+	AccountId   int64     `gorm:"not null;index"`
+	Account     string    `gorm:"not null"`
+	TokenId     int64     `gorm:"not null"`
+	Type        string    `gorm:"not null"`
+	Detail      string    `gorm:"type:text"`
+	Status      int       `gorm:"not null"`
+	HealMessage string    `gorm:"type:text"`
+	DetectTime  time.Time `gorm:"not null"`
+	HealTime    time.Time
+}
+
+func (v3ShareTokenDrift) TableName() string {
+	return "tb_share_token_drift"
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"time"
+)
+
+// JobConfig 定时任务在后台修改过的配置, 优先于环境变量与默认值
+type JobConfig struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Name       string    `json:"name" gorm:"not null;unique" comment:"任务名称" column:"name"`
+	Cron       string    `json:"cron" gorm:"not null" comment:"cron表达式" column:"cron"`
+	Timezone   string    `json:"timezone" gorm:"not null" comment:"时区, 例如 Asia/Shanghai" column:"timezone"`
+	Enable     int       `json:"enable" gorm:"not null" comment:"是否启用, 0:暂停, 1:启用" column:"enable"`
+	UpdateTime time.Time `json:"updateTime" gorm:"not null" comment:"更新时间" column:"update_time"`
+}
+
+func (m *JobConfig) TableName() string {
+	return "tb_job_config"
+}
+
+// 任务执行的触发方式
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+	// JobTriggerCli 通过命令行执行
+	JobTriggerCli = "cli"
+)
+
+// 任务执行与执行明细的状态
+const (
+	JobStatusRunning = "running"
+	JobStatusSuccess = "success"
+	// JobStatusPartial 任务执行完成, 但部分明细失败
+	JobStatusPartial = "partial"
+	JobStatusFailure = "failure"
+	JobStatusSkipped = "skipped"
+)
+
+// 任务执行明细的对象类型
+const (
+	JobItemOpenaiToken   = "openai_token"
+	JobItemOpenaiAccount = "openai_account"
+	JobItemClaudeAccount = "claude_account"
+	JobItemUser          = "user"
+	JobItemSuspension    = "suspension"
+	JobItemBackup        = "backup"
+)
+
+// JobRun 定时任务的一次执行
+type JobRun struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Job       string    `json:"job" gorm:"not null;index" comment:"任务名称" column:"job"`
+	Trigger   string    `json:"trigger" gorm:"column:trigger_type;not null" comment:"触发方式, schedule:定时, manual:手动" column:"trigger_type"`
+	Instance  string    `json:"instance" gorm:"default:''" comment:"执行任务的副本" column:"instance"`
+	Status    string    `json:"status" gorm:"not null;index" comment:"状态, running, success, partial, failure" column:"status"`
+	Total     int       `json:"total" gorm:"not null" comment:"处理的明细数" column:"total"`
+	Success   int       `json:"success" gorm:"not null" comment:"成功的明细数" column:"success"`
+	Failure   int       `json:"failure" gorm:"not null" comment:"失败的明细数" column:"failure"`
+	Skipped   int       `json:"skipped" gorm:"not null" comment:"跳过的明细数" column:"skipped"`
+	Error     string    `json:"error" gorm:"type:text" comment:"任务失败的原因" column:"error"`
+	StartTime time.Time `json:"startTime" gorm:"not null;index" comment:"开始时间" column:"start_time"`
+	EndTime   time.Time `json:"endTime" comment:"结束时间" column:"end_time"`
+}
+
+func (m *JobRun) TableName() string {
+	return "tb_job_run"
+}
+
+// JobRunItem 任务执行中单个对象的处理结果, 例如一个 token 的刷新结果, 跳过的对象只计数不保存
+type JobRunItem struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	RunId      int64     `json:"runId" gorm:"not null;index" comment:"任务执行ID" column:"run_id"`
+	Job        string    `json:"job" gorm:"not null;index:idx_job_run_item_target" comment:"任务名称" column:"job"`
+	ItemType   string    `json:"itemType" gorm:"not null;index:idx_job_run_item_target" comment:"对象类型, 例如 openai_token, openai_account, user" column:"item_type"`
+	ItemId     int64     `json:"itemId" gorm:"not null;index:idx_job_run_item_target" comment:"对象ID" column:"item_id"`
+	ItemName   string    `json:"itemName" gorm:"default:''" comment:"对象名称" column:"item_name"`
+	Status     string    `json:"status" gorm:"not null" comment:"状态, success, failure" column:"status"`
+	Message    string    `json:"message" gorm:"type:text" comment:"处理结果或失败原因" column:"message"`
+	CreateTime time.Time `json:"createTime" gorm:"not null;index" comment:"创建时间" column:"create_time"`
+}
+
+func (m *JobRunItem) TableName() string {
+	return "tb_job_run_item"
+}
+
+// JobLock 定时任务的租约, 多副本部署时持有未过期租约的副本才能执行任务
+type JobLock struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Name       string    `json:"name" gorm:"not null;unique" comment:"任务名称" column:"name"`
+	Owner      string    `json:"owner" gorm:"not null" comment:"持有租约的副本" column:"owner"`
+	RunKey     string    `json:"runKey" gorm:"not null" comment:"最近一次执行的标识, 同一计划时间只执行一次" column:"run_key"`
+	ExpireTime time.Time `json:"expireTime" gorm:"not null" comment:"租约过期时间" column:"expire_time"`
+	UpdateTime time.Time `json:"updateTime" gorm:"not null" comment:"更新时间" column:"update_time"`
+}
+
+func (m *JobLock) TableName() string {
+	return "tb_job_lock"
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// SchemaMigration 已执行的数据库迁移
+type SchemaMigration struct {
+	Version     int64     `json:"version" gorm:"primaryKey;autoIncrement:false" comment:"迁移版本" column:"version"`
+	Name        string    `json:"name" gorm:"not null" comment:"迁移名称" column:"name"`
+	AppliedTime time.Time `json:"appliedTime" gorm:"not null" comment:"执行时间" column:"applied_time"`
+}
+
+func (m *SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+)
+
+// 审查事件的处理动作
+const (
+	ModerationActionBlock = "block"
+	ModerationActionLog   = "log"
+)
+
+// 审查事件的方向
+const (
+	ModerationDirectionInput  = "input"
+	ModerationDirectionOutput = "output"
+)
+
+// 审查事件的审核状态
+const (
+	ModerationEventPending  = 0
+	ModerationEventReviewed = 1
+)
+
+type ModerationEvent struct {
+	ID             int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Product        string    `json:"product" gorm:"not null;index" comment:"产品, openai, claude" column:"product"`
+	UserId         int64     `json:"userId" gorm:"default:0;index" comment:"用户ID, 无法识别时为0" column:"user_id"`
+	UserName       string    `json:"userName" gorm:"default:''" comment:"用户唯一名称" column:"user_name"`
+	AccountId      int64     `json:"accountId" gorm:"default:0" comment:"账号ID, 无法识别时为0" column:"account_id"`
+	Account        string    `json:"account" gorm:"default:''" comment:"账号名称" column:"account"`
+	UpstreamUser   string    `json:"upstreamUser" gorm:"default:''" comment:"上游会话中的用户标识" column:"upstream_user"`
+	ShareTokenHash string    `json:"shareTokenHash" gorm:"default:''" comment:"共享token的sha1, 不保存原始token" column:"share_token_hash"`
+	Direction      string    `json:"direction" gorm:"not null;default:input;index" comment:"审查方向, input:用户消息, output:助手回复" column:"direction"`
+	Provider       string    `json:"provider" gorm:"default:''" comment:"命中的审查方式" column:"provider"`
+	Categories     string    `json:"categories" gorm:"default:''" comment:"命中的分类, 逗号分隔" column:"categories"`
+	Scores         string    `json:"scores" gorm:"type:text" comment:"各分类得分, JSON" column:"scores"`
+	Reason         string    `json:"reason" gorm:"default:''" comment:"命中原因, 例如本地规则名称" column:"reason"`
+	Message        string    `json:"message" gorm:"type:text" comment:"被审查的消息" column:"message"`
+	Action         string    `json:"action" gorm:"not null;default:block" comment:"处理动作, block:拦截, log:仅记录" column:"action"`
+	Status         int       `json:"status" gorm:"not null;default:0;index" comment:"审核状态, 0:待审核, 1:已审核" column:"status"`
+	Strike         int       `json:"strike" gorm:"not null" comment:"是否计入违规次数, 1:计入, 0:仅记录或管理员已重置" column:"strike"`
+	ReviewNote     string    `json:"reviewNote" gorm:"default:''" comment:"审核备注" column:"review_note"`
+	ReviewTime     time.Time `json:"reviewTime" comment:"审核时间" column:"review_time"`
+	CreateTime     time.Time `json:"createTime" gorm:"not null;index" comment:"创建时间" column:"create_time"`
+}
+
+func (m *ModerationEvent) TableName() string {
+	return "tb_moderation_event"
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+)
+
+// 审查规则类型
+const (
+	ModerationRuleKeyword   = "keyword"
+	ModerationRuleRegex     = "regex"
+	ModerationRuleBlocklist = "blocklist"
+	ModerationRuleImageHash = "image_hash"
+)
+
+// 审查规则适用的产品
+const (
+	ModerationProductAll    = "all"
+	ModerationProductOpenai = "openai"
+	ModerationProductClaude = "claude"
+)
+
+type ModerationRule struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Name       string    `json:"name" gorm:"not null" comment:"规则名称" column:"name"`
+	Type       string    `json:"type" gorm:"not null;default:keyword" comment:"规则类型, keyword:关键词, regex:正则, blocklist:屏蔽词列表(每行一个), image_hash:图片sha256列表(每行一个)" column:"type"`
+	Pattern    string    `json:"pattern" gorm:"type:text;not null" comment:"关键词、正则表达式、屏蔽词列表或图片哈希列表" column:"pattern"`
+	Product    string    `json:"product" gorm:"not null;default:all" comment:"适用产品, all:全部, openai, claude" column:"product"`
+	Category   string    `json:"category" gorm:"default:''" comment:"命中后上报的分类" column:"category"`
+	Enable     int       `json:"enable" gorm:"default:1" comment:"是否启用, 0:禁用, 1:启用" column:"enable"`
+	CreateTime time.Time `json:"createTime" gorm:"not null" comment:"创建时间" column:"create_time"`
+	UpdateTime time.Time `json:"updateTime" gorm:"not null" comment:"更新时间" column:"update_time"`
+}
+
+func (m *ModerationRule) TableName() string {
+	return "tb_moderation_rule"
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+)
+
+// 运行时设置的值类型
+const (
+	SettingTypeString = "string"
+	SettingTypeInt    = "int"
+	SettingTypeBool   = "bool"
+)
+
+// 只属于当前部署的设置, 不在后台展示, 备份时不导出, 恢复备份时保持不变,
+// 避免恢复旧备份撤销管理员密码的重置
+const (
+	// SettingAdminPassword 通过命令行重置的管理员密码, 保存 bcrypt 哈希
+	SettingAdminPassword = "adminPassword"
+	// SettingAdminTokenGeneration 管理员令牌的代数, 重置管理员密码时递增, 之前签发的令牌随之失效
+	SettingAdminTokenGeneration = "adminTokenGeneration"
+)
+
+// Setting 在后台修改过的运行时设置, 未修改的设置使用配置文件、环境变量或默认值
+type Setting struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Name       string    `json:"name" gorm:"not null;unique" comment:"设置名称" column:"name"`
+	Value      string    `json:"value" gorm:"type:text" comment:"设置的值, 按设置类型解析" column:"value"`
+	UpdateTime time.Time `json:"updateTime" gorm:"not null" comment:"更新时间" column:"update_time"`
+}
+
+func (m *Setting) TableName() string {
+	return "tb_setting"
+}
+
+// Local 是否为只属于当前部署的设置
+func (m *Setting) Local() bool {
+	return m.Name == SettingAdminPassword || m.Name == SettingAdminTokenGeneration
+}
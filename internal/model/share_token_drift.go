@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+)
+
+// 账号本地状态与上游共享令牌的差异类型
+const (
+	// DriftRevoked 上游共享令牌已失效, 本地账号仍为启用
+	DriftRevoked = "revoked"
+	// DriftExpired 上游共享令牌已过期, 本地账号仍为启用
+	DriftExpired = "expired"
+	// DriftLimitMismatch 上游的使用次数限制与本地不一致
+	DriftLimitMismatch = "limit_mismatch"
+	// DriftActiveDisabled 本地账号已禁用, 上游共享令牌仍然有效
+	DriftActiveDisabled = "active_disabled"
+)
+
+// 差异的处理状态
+const (
+	DriftOpen   = 0
+	DriftHealed = 1
+)
+
+// ShareTokenDrift 对账任务发现的账号差异, 每次对账后替换为最新的结果
+type ShareTokenDrift struct {
+	ID          int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	AccountId   int64     `json:"accountId" gorm:"not null;index" comment:"OpenAI账号ID" column:"account_id"`
+	Account     string    `json:"account" gorm:"not null" comment:"账号名称" column:"account"`
+	TokenId     int64     `json:"tokenId" gorm:"not null" comment:"账号所属的Token ID" column:"token_id"`
+	Type        string    `json:"type" gorm:"not null" comment:"差异类型, revoked, expired, limit_mismatch, active_disabled" column:"type"`
+	Detail      string    `json:"detail" gorm:"type:text" comment:"本地与上游的差异" column:"detail"`
+	Status      int       `json:"status" gorm:"not null" comment:"状态, 0:未处理, 1:已修复" column:"status"`
+	HealMessage string    `json:"healMessage" gorm:"type:text" comment:"修复结果" column:"heal_message"`
+	DetectTime  time.Time `json:"detectTime" gorm:"not null" comment:"发现时间" column:"detect_time"`
+	HealTime    time.Time `json:"healTime" comment:"修复时间" column:"heal_time"`
+}
+
+func (m *ShareTokenDrift) TableName() string {
+	return "tb_share_token_drift"
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+)
+
+// 违规策略触发后的处理动作
+const (
+	StrikeActionSuspend = "suspend"
+	StrikeActionDisable = "disable"
+)
+
+// 暂停记录状态
+const (
+	SuspensionLifted = 0
+	SuspensionActive = 1
+)
+
+type StrikePolicy struct {
+	ID             int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	Name           string    `json:"name" gorm:"not null" comment:"策略名称" column:"name"`
+	Product        string    `json:"product" gorm:"not null;default:all" comment:"统计的产品, all:全部, openai, claude" column:"product"`
+	Threshold      int       `json:"threshold" gorm:"not null" comment:"触发所需的违规次数" column:"threshold"`
+	WindowMinutes  int       `json:"windowMinutes" gorm:"not null;default:0" comment:"统计窗口(分钟), 0:不限" column:"window_minutes"`
+	Action         string    `json:"action" gorm:"not null;default:suspend" comment:"处理动作, suspend:暂停账号, disable:禁用用户" column:"action"`
+	SuspendMinutes int       `json:"suspendMinutes" gorm:"not null;default:0" comment:"暂停时长(分钟), 仅 suspend 有效" column:"suspend_minutes"`
+	Enable         int       `json:"enable" gorm:"default:1" comment:"是否启用, 0:禁用, 1:启用" column:"enable"`
+	CreateTime     time.Time `json:"createTime" gorm:"not null" comment:"创建时间" column:"create_time"`
+	UpdateTime     time.Time `json:"updateTime" gorm:"not null" comment:"更新时间" column:"update_time"`
+}
+
+func (m *StrikePolicy) TableName() string {
+	return "tb_strike_policy"
+}
+
+type UserSuspension struct {
+	ID           int64     `json:"id" gorm:"primaryKey;autoIncrement" comment:"主键" column:"id"`
+	UserId       int64     `json:"userId" gorm:"not null;index" comment:"用户ID" column:"user_id"`
+	PolicyId     int64     `json:"policyId" gorm:"default:0" comment:"触发的策略ID" column:"policy_id"`
+	Action       string    `json:"action" gorm:"not null" comment:"处理动作, suspend:暂停账号, disable:禁用用户" column:"action"`
+	Reason       string    `json:"reason" gorm:"default:''" comment:"触发原因" column:"reason"`
+	Strikes      int64     `json:"strikes" gorm:"default:0" comment:"触发时的违规次数" column:"strikes"`
+	SuspendUntil time.Time `json:"suspendUntil" comment:"暂停截止时间, disable 时为空" column:"suspend_until"`
+	Status       int       `json:"status" gorm:"not null;default:1;index" comment:"状态, 1:生效中, 0:已解除" column:"status"`
+	LiftTime     time.Time `json:"liftTime" comment:"解除时间" column:"lift_time"`
+	CreateTime   time.Time `json:"createTime" gorm:"not null" comment:"创建时间" column:"create_time"`
+}
+
+func (m *UserSuspension) TableName() string {
+	return "tb_user_suspension"
+}
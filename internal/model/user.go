@@ -13,6 +13,8 @@ type User struct {
 	OpenaiToken    int64     `json:"openaiToken" gorm:"default:0" comment:"OpenaiToken ID" column:"openai_token"`
 	Claude         int       `json:"claude" gorm:"default:0" comment:"是否开启claude, 0:禁用, 1:启用" column:"claude"`
 	ClaudeToken    int64     `json:"claudeToken" gorm:"default:0" comment:"ClaudeToken ID" column:"claude_token"`
+	BlockUpload    int       `json:"blockUpload" gorm:"default:0" comment:"是否禁止上传文件, 0:允许, 1:禁止" column:"block_upload"`
+	BlockImage     int       `json:"blockImage" gorm:"default:0" comment:"是否禁止图片输入, 0:允许, 1:禁止" column:"block_image"`
 	ExpirationTime time.Time `json:"expirationTime" gorm:"not null" comment:"过期时间" column:"expiration_time"`
 	CreateTime     time.Time `json:"createTime" gorm:"not null" comment:"创建时间" column:"create_time"`
 	UpdateTime     time.Time `json:"updateTime" gorm:"not null" comment:"更新时间" column:"update_time"`
@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries 缓存条数上限, 超出时先清理过期条目, 仍超出则清空
+const maxCacheEntries = 10000
+
+// resultCache 按消息内容哈希缓存审查结果, 相同内容重复发送时不再请求审查接口
+type resultCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	result    *Result
+	expiresAt time.Time
+}
+
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func cacheKey(product string, texts []string) string {
+	hash := sha256.Sum256([]byte(product + "\x00" + strings.Join(texts, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *resultCache) get(key string) (*Result, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.result, true
+}
+
+func (c *resultCache) set(key string, result *Result) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = make(map[string]*cacheEntry)
+		}
+	}
+	c.entries[key] = &cacheEntry{result: result, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *resultCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]*cacheEntry)
+	c.mu.Unlock()
+}
@@ -0,0 +1,114 @@
+package moderation
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestResultCache(t *testing.T) {
+	result := &Result{Action: ActionAllow}
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// expire 写入后将条目的过期时间改为已过期
+		expire bool
+		want   bool
+	}{
+		{name: "hit", ttl: time.Minute, want: true},
+		{name: "expired", ttl: time.Minute, expire: true},
+		{name: "disabled", ttl: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newResultCache(tt.ttl)
+			key := cacheKey("openai", []string{"hello"})
+			cache.set(key, result)
+			if entry, ok := cache.entries[key]; ok && tt.expire {
+				entry.expiresAt = time.Now().Add(-time.Second)
+			}
+			got, ok := cache.get(key)
+			if ok != tt.want || (ok && got != result) {
+				t.Errorf("get() = %v, %v, want hit %v", got, ok, tt.want)
+			}
+			if _, ok := cache.get(cacheKey("claude", []string{"hello"})); ok {
+				t.Error("get() hit for another product")
+			}
+		})
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	tests := []struct {
+		name string
+		// expired 填满缓存的条目中已过期的数量
+		expired int
+		// wantEntries 写入新条目后的条数
+		wantEntries int
+	}{
+		{name: "expired entries removed", expired: 10, wantEntries: maxCacheEntries - 10 + 1},
+		{name: "cleared when all valid", expired: 0, wantEntries: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newResultCache(time.Minute)
+			now := time.Now()
+			for i := 0; i < maxCacheEntries; i++ {
+				expiresAt := now.Add(time.Minute)
+				if i < tt.expired {
+					expiresAt = now.Add(-time.Second)
+				}
+				cache.entries[fmt.Sprint(i)] = &cacheEntry{result: &Result{}, expiresAt: expiresAt}
+			}
+			cache.set("new", &Result{})
+			if len(cache.entries) != tt.wantEntries {
+				t.Errorf("entries = %d, want %d", len(cache.entries), tt.wantEntries)
+			}
+			if _, ok := cache.get("new"); !ok {
+				t.Error("new entry not cached")
+			}
+		})
+	}
+}
+
+func TestRunCache(t *testing.T) {
+	errProvider := errors.New("provider unavailable")
+	tests := []struct {
+		name string
+		err  error
+		// wantCalls 相同内容审查两次时调用审查方式的次数
+		wantCalls int
+	}{
+		{name: "cached", wantCalls: 1},
+		// 出错的审查方式被跳过时不缓存放行结果, 接口恢复后重新审查
+		{name: "not cached when provider skipped", err: errProvider, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{logger: &log.Logger{Logger: zap.NewNop()}}
+			current := &settings{policies: Policies{defaultCategory: {Action: ActionDeny}}, cache: newResultCache(time.Minute), failOpen: true}
+			calls := 0
+			providers := []providerCall{{name: "webhook", moderate: func(ctx context.Context) (*Result, error) {
+				calls++
+				return &Result{}, tt.err
+			}}}
+			for i := 0; i < 2; i++ {
+				result, err := m.run(context.Background(), current, "openai", "key", providers)
+				if err != nil {
+					t.Fatalf("run() error = %v", err)
+				}
+				if result.Flagged {
+					t.Errorf("run() flagged = true, want allow")
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("provider calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package moderation
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ruleCheckInterval 检查数据库中规则是否变化的间隔, 多实例部署时其他实例修改的规则在此间隔内生效
+const ruleCheckInterval = 30 * time.Second
+
+// KeywordModerator 本地关键词、正则、屏蔽词列表与图片哈希审查, 规则保存在数据库中
+type KeywordModerator struct {
+	logger     *log.Logger
+	repository repository.ModerationRuleRepository
+
+	mu         sync.RWMutex
+	rules      []*compiledRule
+	loaded     bool
+	lastUpdate time.Time
+	count      int64
+	checkedAt  time.Time
+}
+
+type compiledRule struct {
+	rule     *model.ModerationRule
+	keywords []string
+	regex    *regexp.Regexp
+	hashes   map[string]bool
+}
+
+func NewKeywordModerator(logger *log.Logger, repository repository.ModerationRuleRepository) *KeywordModerator {
+	return &KeywordModerator{
+		logger:     logger,
+		repository: repository,
+	}
+}
+
+func (m *KeywordModerator) Name() string {
+	return "keyword"
+}
+
+func (m *KeywordModerator) Moderate(ctx context.Context, product string, texts []string) (*Result, error) {
+	m.refresh(ctx)
+
+	m.mu.RLock()
+	rules := m.rules
+	m.mu.RUnlock()
+
+	lowerTexts := make([]string, len(texts))
+	for i, text := range texts {
+		lowerTexts[i] = strings.ToLower(text)
+	}
+	for _, rule := range rules {
+		if rule.rule.Product != model.ModerationProductAll && rule.rule.Product != product {
+			continue
+		}
+		for i := range texts {
+			if rule.match(texts[i], lowerTexts[i]) {
+				category := rule.rule.Category
+				if category == "" {
+					category = rule.rule.Type
+				}
+				return &Result{
+					Flagged:    true,
+					Categories: []string{category},
+					Reason:     rule.rule.Name,
+				}, nil
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// ModerateImages 按图片哈希规则审查图片
+func (m *KeywordModerator) ModerateImages(ctx context.Context, product string, images []*Image) (*Result, error) {
+	m.refresh(ctx)
+
+	m.mu.RLock()
+	rules := m.rules
+	m.mu.RUnlock()
+
+	for _, image := range images {
+		hash := image.Hash()
+		for _, rule := range rules {
+			if rule.rule.Product != model.ModerationProductAll && rule.rule.Product != product {
+				continue
+			}
+			if rule.hashes[hash] {
+				category := rule.rule.Category
+				if category == "" {
+					category = rule.rule.Type
+				}
+				return &Result{
+					Flagged:    true,
+					Categories: []string{category},
+					Reason:     rule.rule.Name,
+				}, nil
+			}
+		}
+	}
+	return &Result{}, nil
+}
+
+// Reload 从数据库重新加载规则, 管理后台修改规则后调用
+func (m *KeywordModerator) Reload(ctx context.Context) error {
+	lastUpdate, count, err := m.repository.GetLastUpdateTime(ctx)
+	if err != nil {
+		return err
+	}
+	rules, err := m.repository.GetEnableRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			// 规则在保存时已校验, 这里只跳过异常数据
+			m.logger.WithContext(ctx).Error(fmt.Sprintf("compile moderation rule %d error: %v", rule.ID, err))
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+
+	m.mu.Lock()
+	m.rules = compiled
+	m.loaded = true
+	m.lastUpdate = lastUpdate
+	m.count = count
+	m.checkedAt = time.Now()
+	m.mu.Unlock()
+	m.logger.WithContext(ctx).Info(fmt.Sprintf("moderation rules loaded: %d", len(compiled)))
+	return nil
+}
+
+// refresh 首次使用时加载规则, 之后定期检查规则是否被其他实例修改
+func (m *KeywordModerator) refresh(ctx context.Context) {
+	m.mu.Lock()
+	if m.loaded && time.Since(m.checkedAt) < ruleCheckInterval {
+		m.mu.Unlock()
+		return
+	}
+	loaded, lastUpdate, count := m.loaded, m.lastUpdate, m.count
+	// 先更新检查时间, 避免并发请求同时查询数据库
+	m.checkedAt = time.Now()
+	m.mu.Unlock()
+
+	if loaded {
+		currentUpdate, currentCount, err := m.repository.GetLastUpdateTime(ctx)
+		if err != nil {
+			m.logger.WithContext(ctx).Error(fmt.Sprintf("check moderation rules error: %v", err))
+			return
+		}
+		if currentUpdate.Equal(lastUpdate) && currentCount == count {
+			return
+		}
+	}
+	if err := m.Reload(ctx); err != nil {
+		m.logger.WithContext(ctx).Error(fmt.Sprintf("reload moderation rules error: %v", err))
+	}
+}
+
+func (r *compiledRule) match(text string, lowerText string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(text)
+	}
+	for _, keyword := range r.keywords {
+		if strings.Contains(lowerText, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRule 校验规则类型、适用产品与正则表达式
+func ValidateRule(rule *model.ModerationRule) error {
+	switch rule.Product {
+	case model.ModerationProductAll, model.ModerationProductOpenai, model.ModerationProductClaude:
+	default:
+		return fmt.Errorf("unsupported product: %s", rule.Product)
+	}
+	_, err := compileRule(rule)
+	return err
+}
+
+func compileRule(rule *model.ModerationRule) (*compiledRule, error) {
+	c := &compiledRule{rule: rule}
+	switch rule.Type {
+	case model.ModerationRuleKeyword:
+		keyword := strings.ToLower(strings.TrimSpace(rule.Pattern))
+		if keyword == "" {
+			return nil, errors.New("keyword is empty")
+		}
+		c.keywords = []string{keyword}
+	case model.ModerationRuleBlocklist:
+		for _, line := range strings.Split(rule.Pattern, "\n") {
+			if keyword := strings.ToLower(strings.TrimSpace(line)); keyword != "" {
+				c.keywords = append(c.keywords, keyword)
+			}
+		}
+		if len(c.keywords) == 0 {
+			return nil, errors.New("blocklist is empty")
+		}
+	case model.ModerationRuleImageHash:
+		c.hashes = make(map[string]bool)
+		for _, line := range strings.Split(rule.Pattern, "\n") {
+			hash := strings.ToLower(strings.TrimSpace(line))
+			if hash == "" {
+				continue
+			}
+			if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+				return nil, fmt.Errorf("invalid sha256: %s", hash)
+			}
+			c.hashes[hash] = true
+		}
+		if len(c.hashes) == 0 {
+			return nil, errors.New("image hash list is empty")
+		}
+	case model.ModerationRuleRegex:
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		c.regex = re
+	default:
+		return nil, fmt.Errorf("unsupported rule type: %s", rule.Type)
+	}
+	return c, nil
+}
@@ -0,0 +1,270 @@
+package moderation
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 审查接口出错时的处理方式
+const (
+	FailOpen   = "open"
+	FailClosed = "closed"
+)
+
+// Manager 按产品组合审查方式, 并按分类策略判定结果
+type Manager struct {
+	logger   *log.Logger
+	keyword  *KeywordModerator
+	settings atomic.Pointer[settings]
+}
+
+// settings 由配置生成的审查设置, 配置热更新时整体替换
+type settings struct {
+	chains   map[string]Chain
+	images   []ImageModerator
+	policies Policies
+	cache    *resultCache
+	failOpen bool
+	// timeout 每个审查方式单次调用的超时时间, 为 0 时不限制
+	timeout time.Duration
+}
+
+func NewManager(logger *log.Logger, ruleRepository repository.ModerationRuleRepository) *Manager {
+	m := &Manager{
+		logger:  logger,
+		keyword: NewKeywordModerator(logger, ruleRepository),
+	}
+	if err := m.configure(commonConfig.GetConfig()); err != nil {
+		logger.Sugar().Fatalf("moderation config error: %v", err)
+	}
+	commonConfig.OnReload(func(config *commonConfig.Config) {
+		if err := m.configure(config); err != nil {
+			logger.Error("moderation config reload error, keeping current settings", zap.Error(err))
+		}
+	})
+	return m
+}
+
+// configure 按配置重建审查设置, 出错时保留当前设置
+func (m *Manager) configure(config *commonConfig.Config) error {
+	policies, err := ParsePolicies(config.ModerationCategories)
+	if err != nil {
+		return fmt.Errorf("MODERATION_CATEGORIES: %w", err)
+	}
+	failPolicy := strings.ToLower(config.ModerationFailPolicy)
+	if failPolicy != FailOpen && failPolicy != FailClosed {
+		return fmt.Errorf("MODERATION_FAIL_POLICY must be %s or %s", FailOpen, FailClosed)
+	}
+
+	providers := map[string]Moderator{
+		m.keyword.Name(): m.keyword,
+	}
+	if config.ModerationEnable() {
+		openai := NewOpenAIModerator(m.logger, config.ModerationEndpoint, config.ModerationApiKey, config.ModerationImageModel)
+		providers[openai.Name()] = openai
+	}
+	if config.ModerationWebhookUrl != "" {
+		webhook := NewWebhookModerator(config.ModerationWebhookUrl, config.ModerationWebhookToken)
+		providers[webhook.Name()] = webhook
+	}
+
+	openaiChain, err := buildChain(config.ModerationProvidersChatGPT, providers)
+	if err != nil {
+		return err
+	}
+	claudeChain, err := buildChain(config.ModerationProvidersClaude, providers)
+	if err != nil {
+		return err
+	}
+	images, err := buildImageChain(config.ModerationImageProviders, providers)
+	if err != nil {
+		return err
+	}
+	m.settings.Store(&settings{
+		chains: map[string]Chain{
+			model.ModerationProductOpenai: openaiChain,
+			model.ModerationProductClaude: claudeChain,
+		},
+		images:   images,
+		policies: policies,
+		cache:    newResultCache(time.Duration(config.ModerationCacheTtl) * time.Second),
+		failOpen: failPolicy == FailOpen,
+		timeout:  time.Duration(config.ModerationTimeout) * time.Second,
+	})
+	return nil
+}
+
+// buildChain 解析逗号分隔的审查方式, 未配置时沿用旧行为: 配置了 OpenAI 审查接口则使用 openai
+func buildChain(names string, providers map[string]Moderator) (Chain, error) {
+	if strings.TrimSpace(names) == "" {
+		if openai, ok := providers["openai"]; ok {
+			return Chain{openai}, nil
+		}
+		return nil, nil
+	}
+
+	var chain Chain
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		provider, ok := providers[name]
+		if !ok {
+			return nil, fmt.Errorf("moderation provider %s is unknown or not configured", name)
+		}
+		chain = append(chain, provider)
+	}
+	return chain, nil
+}
+
+// buildImageChain 解析逗号分隔的图片审查方式, 未配置时不审查图片
+func buildImageChain(names string, providers map[string]Moderator) ([]ImageModerator, error) {
+	var chain []ImageModerator
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		provider, ok := providers[name].(ImageModerator)
+		if !ok {
+			return nil, fmt.Errorf("image moderation provider %s is unknown or not configured", name)
+		}
+		chain = append(chain, provider)
+	}
+	return chain, nil
+}
+
+// Enabled 产品是否开启了内容审查
+func (m *Manager) Enabled(product string) bool {
+	return len(m.settings.Load().chains[product]) > 0 || m.ImageEnabled()
+}
+
+// ImageEnabled 是否开启了图片审查
+func (m *Manager) ImageEnabled() bool {
+	return len(m.settings.Load().images) > 0
+}
+
+// FailOpen 审查出错时是否放行, 审查前的准备工作 (例如下载图片) 失败时也按此处理
+func (m *Manager) FailOpen() bool {
+	return m.settings.Load().failOpen
+}
+
+// Providers 返回产品使用的审查方式名称
+func (m *Manager) Providers(product string) []string {
+	var names []string
+	for _, moderator := range m.settings.Load().chains[product] {
+		names = append(names, moderator.Name())
+	}
+	return names
+}
+
+// Moderate 按产品配置的顺序审查内容, 命中 deny 分类时立即返回, 只命中 log 分类时继续执行后续审查方式
+//
+// 审查方式出错或超时时, fail-open 跳过该审查方式, fail-closed 返回错误
+func (m *Manager) Moderate(ctx context.Context, product string, texts []string) (*Result, error) {
+	current := m.settings.Load()
+	chain, ok := current.chains[product]
+	if !ok {
+		return nil, fmt.Errorf("unknown product: %s", product)
+	}
+	providers := make([]providerCall, 0, len(chain))
+	for _, moderator := range chain {
+		moderator := moderator
+		providers = append(providers, providerCall{moderator.Name(), func(ctx context.Context) (*Result, error) {
+			return moderator.Moderate(ctx, product, texts)
+		}})
+	}
+	return m.run(ctx, current, product, cacheKey(product, texts), providers)
+}
+
+// ModerateImages 按配置的顺序审查图片, 判定方式与 Moderate 相同
+func (m *Manager) ModerateImages(ctx context.Context, product string, images []*Image) (*Result, error) {
+	hashes := make([]string, 0, len(images)+1)
+	hashes = append(hashes, "image")
+	for _, image := range images {
+		hashes = append(hashes, image.Hash())
+	}
+	current := m.settings.Load()
+	providers := make([]providerCall, 0, len(current.images))
+	for _, moderator := range current.images {
+		moderator := moderator
+		providers = append(providers, providerCall{moderator.Name(), func(ctx context.Context) (*Result, error) {
+			return moderator.ModerateImages(ctx, product, images)
+		}})
+	}
+	return m.run(ctx, current, product, cacheKey(product, hashes), providers)
+}
+
+// providerCall 调用一个审查方式, name 为审查方式名称
+type providerCall struct {
+	name     string
+	moderate func(ctx context.Context) (*Result, error)
+}
+
+// call 调用审查方式, timeout 大于 0 时单独限制本次调用, 前面的审查方式耗时较长不会挤占后面的审查方式的时间
+func (p providerCall) call(ctx context.Context, timeout time.Duration) (*Result, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return p.moderate(ctx)
+}
+
+func (m *Manager) run(ctx context.Context, current *settings, product string, key string, providers []providerCall) (*Result, error) {
+	if result, ok := current.cache.get(key); ok {
+		return result, nil
+	}
+
+	final := &Result{Action: ActionAllow}
+	failed := false
+	for _, provider := range providers {
+		result, err := provider.call(ctx, current.timeout)
+		if err != nil {
+			metrics.ObserveModerationError(product, provider.name)
+			if !current.failOpen {
+				return nil, fmt.Errorf("%s moderation error: %w", provider.name, err)
+			}
+			m.logger.WithContext(ctx).Warn("moderation provider failed, skipped", zap.String("provider", provider.name), zap.Error(err))
+			failed = true
+			continue
+		}
+		result = current.policies.Evaluate(result)
+		if !result.Flagged {
+			continue
+		}
+		if result.Provider == "" {
+			result.Provider = provider.name
+		}
+		if result.Action == ActionDeny {
+			final = result
+			break
+		}
+		if final.Action == ActionAllow {
+			final = result
+		}
+	}
+
+	// 跳过了出错的审查方式时不缓存, 避免放行结果在接口恢复后继续生效
+	if !failed {
+		current.cache.set(key, final)
+	}
+	return final, nil
+}
+
+// ReloadRules 重新加载本地审查规则, 并清空结果缓存
+func (m *Manager) ReloadRules(ctx context.Context) error {
+	m.settings.Load().cache.clear()
+	return m.keyword.Reload(ctx)
+}
@@ -0,0 +1,43 @@
+package moderation
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRunTimeoutPerProvider(t *testing.T) {
+	m := &Manager{logger: &log.Logger{Logger: zap.NewNop()}}
+	current := &settings{policies: Policies{defaultCategory: {Action: ActionDeny}}, cache: newResultCache(0), timeout: 100 * time.Millisecond}
+
+	// 每个审查方式各自耗时 60ms, 合计超过超时时间, 但都不超过单次调用的超时时间
+	slow := func(name string) providerCall {
+		return providerCall{name: name, moderate: func(ctx context.Context) (*Result, error) {
+			select {
+			case <-time.After(60 * time.Millisecond):
+				return &Result{Flagged: name == "webhook"}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}}
+	}
+	result, err := m.run(context.Background(), current, "openai", "key", []providerCall{slow("keyword"), slow("webhook")})
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !result.Flagged || result.Provider != "webhook" {
+		t.Errorf("run() = %+v, want flagged by webhook", result)
+	}
+
+	// 单次调用超时时按出错处理
+	hang := providerCall{name: "openai", moderate: func(ctx context.Context) (*Result, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	if _, err := m.run(context.Background(), current, "openai", "key", []providerCall{hang}); err == nil {
+		t.Error("run() error = nil, want timeout")
+	}
+}
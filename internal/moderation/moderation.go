@@ -0,0 +1,78 @@
+package moderation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// Result 审查结果
+type Result struct {
+	// Flagged 是否命中
+	Flagged bool
+	// Provider 命中的审查方式
+	Provider string
+	// Categories 命中的分类
+	Categories []string
+	// Scores 各分类得分, 只有返回得分的审查方式才有
+	Scores map[string]float64
+	// Reason 命中原因, 例如本地规则名称
+	Reason string
+	// Action 按分类策略判定后的处理动作: allow、deny 或 log
+	Action string
+}
+
+// Moderator 内容审查接口, product 为 openai 或 claude
+type Moderator interface {
+	Name() string
+	Moderate(ctx context.Context, product string, texts []string) (*Result, error)
+}
+
+// Image 待审查的图片
+type Image struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Hash 图片内容的 sha256
+func (i *Image) Hash() string {
+	hash := sha256.Sum256(i.Data)
+	return hex.EncodeToString(hash[:])
+}
+
+// DataUrl 图片的 data URL, 用于提交给支持图片输入的审查接口
+func (i *Image) DataUrl() string {
+	return fmt.Sprintf("data:%s;base64,%s", i.ContentType, base64.StdEncoding.EncodeToString(i.Data))
+}
+
+// ImageModerator 图片审查接口
+type ImageModerator interface {
+	Name() string
+	ModerateImages(ctx context.Context, product string, images []*Image) (*Result, error)
+}
+
+// Chain 按顺序执行多个审查方式, 任一命中即返回
+type Chain []Moderator
+
+func (c Chain) Name() string {
+	return "chain"
+}
+
+func (c Chain) Moderate(ctx context.Context, product string, texts []string) (*Result, error) {
+	for _, moderator := range c {
+		result, err := moderator.Moderate(ctx, product, texts)
+		if err != nil {
+			return nil, fmt.Errorf("%s moderation error: %w", moderator.Name(), err)
+		}
+		if result != nil && result.Flagged {
+			if result.Provider == "" {
+				result.Provider = moderator.Name()
+			}
+			return result, nil
+		}
+	}
+	return &Result{}, nil
+}
@@ -0,0 +1,116 @@
+package moderation
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIModerator 调用 OpenAI /v1/moderations 接口审查
+type OpenAIModerator struct {
+	logger     *log.Logger
+	endpoint   string
+	apiKey     string
+	imageModel string
+	client     *resty.Client
+}
+
+func NewOpenAIModerator(logger *log.Logger, endpoint string, apiKey string, imageModel string) *OpenAIModerator {
+	return &OpenAIModerator{
+		logger:     logger,
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		apiKey:     apiKey,
+		imageModel: imageModel,
+		client:     resty.New().SetTransport(tracing.Transport(nil)).SetTimeout(time.Second * 10),
+	}
+}
+
+func (m *OpenAIModerator) Name() string {
+	return "openai"
+}
+
+func (m *OpenAIModerator) Moderate(ctx context.Context, product string, texts []string) (*Result, error) {
+	userMessage := strings.Join(texts, " ")
+	if len(userMessage) == 0 {
+		return &Result{}, nil
+	}
+	return m.moderate(ctx, map[string]interface{}{
+		"input": userMessage,
+	})
+}
+
+// ModerateImages 使用支持图片输入的审查模型审查图片
+func (m *OpenAIModerator) ModerateImages(ctx context.Context, product string, images []*Image) (*Result, error) {
+	if len(images) == 0 {
+		return &Result{}, nil
+	}
+	input := make([]map[string]interface{}, 0, len(images))
+	for _, image := range images {
+		input = append(input, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]string{"url": image.DataUrl()},
+		})
+	}
+	return m.moderate(ctx, map[string]interface{}{
+		"model": m.imageModel,
+		"input": input,
+	})
+}
+
+func (m *OpenAIModerator) moderate(ctx context.Context, body map[string]interface{}) (*Result, error) {
+	resp, err := m.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Authorization", fmt.Sprintf("Bearer %s", m.apiKey)).
+		SetBody(body).
+		Post(fmt.Sprintf("%s/v1/moderations", m.endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		m.logger.WithContext(ctx).Error("Moderation API returned an error", zap.ByteString("body", resp.Body()))
+		return nil, fmt.Errorf("moderation API returned an error: %d", resp.StatusCode())
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged        bool               `json:"flagged"`
+			Categories     map[string]bool    `json:"categories"`
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		m.logger.WithContext(ctx).Error("Failed to unmarshal moderation response", zap.Error(err))
+		return nil, err
+	}
+	if len(result.Results) == 0 {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+
+	// 返回所有结果中命中的分类与最高得分, 是否拦截由分类策略决定
+	moderation := &Result{Scores: make(map[string]float64)}
+	seen := make(map[string]bool)
+	for _, r := range result.Results {
+		moderation.Flagged = moderation.Flagged || r.Flagged
+		for category, flagged := range r.Categories {
+			if flagged && !seen[category] {
+				seen[category] = true
+				moderation.Categories = append(moderation.Categories, category)
+			}
+		}
+		for category, score := range r.CategoryScores {
+			if score > moderation.Scores[category] {
+				moderation.Scores[category] = score
+			}
+		}
+	}
+	return moderation, nil
+}
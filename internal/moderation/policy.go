@@ -0,0 +1,126 @@
+package moderation
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 分类命中后的处理动作
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+	ActionLog   = "log"
+)
+
+// defaultCategory 未单独配置的分类使用的策略
+const defaultCategory = "*"
+
+// CategoryPolicy 分类的得分阈值与处理动作, Threshold 为 0 时沿用审查方式自身的判定
+type CategoryPolicy struct {
+	Threshold float64
+	Action    string
+}
+
+// Policies 按分类名称配置的策略
+type Policies map[string]CategoryPolicy
+
+// ParsePolicies 解析 "分类:阈值:动作" 格式的配置, 多个用逗号分隔, 分类 * 表示默认策略
+//
+// 例如 "hate:0.4:deny,violence:0.8:log,harassment::allow,*::deny"
+func ParsePolicies(value string) (Policies, error) {
+	policies := Policies{defaultCategory: {Action: ActionDeny}}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid moderation category policy: %s", item)
+		}
+		category := strings.ToLower(strings.TrimSpace(parts[0]))
+		policy := CategoryPolicy{Action: strings.ToLower(strings.TrimSpace(parts[2]))}
+		if threshold := strings.TrimSpace(parts[1]); threshold != "" {
+			t, err := strconv.ParseFloat(threshold, 64)
+			if err != nil || t < 0 || t > 1 {
+				return nil, fmt.Errorf("invalid moderation category threshold: %s", item)
+			}
+			policy.Threshold = t
+		}
+		switch policy.Action {
+		case ActionAllow, ActionDeny, ActionLog:
+		default:
+			return nil, fmt.Errorf("invalid moderation category action: %s", item)
+		}
+		policies[category] = policy
+	}
+	return policies, nil
+}
+
+func (p Policies) get(category string) CategoryPolicy {
+	if policy, ok := p[strings.ToLower(category)]; ok {
+		return policy
+	}
+	return p[defaultCategory]
+}
+
+// Evaluate 按分类策略重新判定审查结果, 命中 deny 的分类时拦截, 只命中 log 的分类时仅记录
+func (p Policies) Evaluate(result *Result) *Result {
+	if result == nil {
+		return &Result{}
+	}
+	flagged := make(map[string]bool, len(result.Categories))
+	categories := make([]string, 0, len(result.Categories)+len(result.Scores))
+	for _, category := range result.Categories {
+		if !flagged[category] {
+			flagged[category] = true
+			categories = append(categories, category)
+		}
+	}
+	scored := make([]string, 0, len(result.Scores))
+	for category := range result.Scores {
+		if !flagged[category] {
+			scored = append(scored, category)
+		}
+	}
+	sort.Strings(scored)
+	categories = append(categories, scored...)
+
+	evaluated := *result
+	// 命中但没有返回分类时按默认策略处理
+	if result.Flagged && len(categories) == 0 {
+		evaluated.Action = p.get(defaultCategory).Action
+		evaluated.Flagged = evaluated.Action != ActionAllow
+		return &evaluated
+	}
+
+	var deny, log []string
+	for _, category := range categories {
+		policy := p.get(category)
+		hit := flagged[category]
+		if score, ok := result.Scores[category]; ok && policy.Threshold > 0 {
+			hit = score >= policy.Threshold
+		}
+		if !hit {
+			continue
+		}
+		switch policy.Action {
+		case ActionDeny:
+			deny = append(deny, category)
+		case ActionLog:
+			log = append(log, category)
+		}
+	}
+
+	switch {
+	case len(deny) > 0:
+		evaluated.Flagged, evaluated.Action, evaluated.Categories = true, ActionDeny, deny
+	case len(log) > 0:
+		evaluated.Flagged, evaluated.Action, evaluated.Categories = true, ActionLog, log
+	default:
+		evaluated.Flagged, evaluated.Action, evaluated.Categories = false, ActionAllow, nil
+	}
+	return &evaluated
+}
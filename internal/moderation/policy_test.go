@@ -0,0 +1,99 @@
+package moderation
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Policies
+		wantErr bool
+	}{
+		{name: "empty uses default deny", value: "", want: Policies{defaultCategory: {Action: ActionDeny}}},
+		{name: "categories", value: "hate:0.4:deny, violence::log,*::allow",
+			want: Policies{"hate": {Threshold: 0.4, Action: ActionDeny}, "violence": {Action: ActionLog}, defaultCategory: {Action: ActionAllow}}},
+		{name: "case insensitive", value: "HATE:1:DENY",
+			want: Policies{"hate": {Threshold: 1, Action: ActionDeny}, defaultCategory: {Action: ActionDeny}}},
+		{name: "missing field", value: "hate:deny", wantErr: true},
+		{name: "threshold not a number", value: "hate:high:deny", wantErr: true},
+		{name: "threshold over 1", value: "hate:1.5:deny", wantErr: true},
+		{name: "negative threshold", value: "hate:-0.1:deny", wantErr: true},
+		{name: "unknown action", value: "hate:0.4:block", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicies(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePolicies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	policies, err := ParsePolicies("hate:0.4:deny,violence::log,sexual::allow,harassment:0.8:log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowDefault, err := ParsePolicies("*::allow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		policies       Policies
+		result         *Result
+		wantFlagged    bool
+		wantAction     string
+		wantCategories []string
+	}{
+		{name: "nil result", policies: policies, result: nil},
+		{name: "not flagged", policies: policies, result: &Result{},
+			wantAction: ActionAllow},
+		{name: "deny category", policies: policies, result: &Result{Flagged: true, Categories: []string{"hate"}},
+			wantFlagged: true, wantAction: ActionDeny, wantCategories: []string{"hate"}},
+		{name: "log category", policies: policies, result: &Result{Flagged: true, Categories: []string{"violence"}},
+			wantFlagged: true, wantAction: ActionLog, wantCategories: []string{"violence"}},
+		{name: "allow category", policies: policies, result: &Result{Flagged: true, Categories: []string{"sexual"}},
+			wantAction: ActionAllow},
+		{name: "deny wins over log", policies: policies, result: &Result{Flagged: true, Categories: []string{"violence", "hate"}},
+			wantFlagged: true, wantAction: ActionDeny, wantCategories: []string{"hate"}},
+		{name: "unknown category uses default", policies: policies, result: &Result{Flagged: true, Categories: []string{"self-harm"}},
+			wantFlagged: true, wantAction: ActionDeny, wantCategories: []string{"self-harm"}},
+		// 配置了阈值的分类以得分为准, 不论审查方式是否判定命中
+		{name: "score below threshold overrides flagged", policies: policies,
+			result:     &Result{Flagged: true, Categories: []string{"hate"}, Scores: map[string]float64{"hate": 0.3}},
+			wantAction: ActionAllow},
+		{name: "score over threshold without flag", policies: policies,
+			result:      &Result{Scores: map[string]float64{"hate": 0.5, "harassment": 0.9}},
+			wantFlagged: true, wantAction: ActionDeny, wantCategories: []string{"hate"}},
+		{name: "score over threshold log only", policies: policies,
+			result:      &Result{Scores: map[string]float64{"hate": 0.1, "harassment": 0.9}},
+			wantFlagged: true, wantAction: ActionLog, wantCategories: []string{"harassment"}},
+		// 没有配置阈值的分类沿用审查方式的判定, 得分不影响结果
+		{name: "score ignored without threshold", policies: policies,
+			result:     &Result{Scores: map[string]float64{"violence": 0.99}},
+			wantAction: ActionAllow},
+		{name: "flagged without categories uses default", policies: policies, result: &Result{Flagged: true},
+			wantFlagged: true, wantAction: ActionDeny},
+		{name: "flagged without categories default allow", policies: allowDefault, result: &Result{Flagged: true},
+			wantAction: ActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policies.Evaluate(tt.result)
+			if got.Flagged != tt.wantFlagged || got.Action != tt.wantAction {
+				t.Errorf("Evaluate() flagged, action = %v, %q, want %v, %q", got.Flagged, got.Action, tt.wantFlagged, tt.wantAction)
+			}
+			if !reflect.DeepEqual(got.Categories, tt.wantCategories) {
+				t.Errorf("Evaluate() categories = %v, want %v", got.Categories, tt.wantCategories)
+			}
+		})
+	}
+}
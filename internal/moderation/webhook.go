@@ -0,0 +1,88 @@
+package moderation
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"time"
+)
+
+// WebhookModerator 将待审查内容 POST 到自定义地址
+//
+// 请求体: {"product": "openai", "input": ["..."]}
+// 图片请求体: {"product": "openai", "images": [{"name": "...", "contentType": "image/png", "sha256": "...", "data": "base64"}]}
+// 响应体: {"flagged": true, "categories": ["..."], "scores": {"...": 0.9}, "reason": "..."}
+type WebhookModerator struct {
+	url    string
+	token  string
+	client *resty.Client
+}
+
+func NewWebhookModerator(url string, token string) *WebhookModerator {
+	return &WebhookModerator{
+		url:    url,
+		token:  token,
+		client: resty.New().SetTransport(tracing.Transport(nil)).SetTimeout(time.Second * 10),
+	}
+}
+
+func (m *WebhookModerator) Name() string {
+	return "webhook"
+}
+
+func (m *WebhookModerator) Moderate(ctx context.Context, product string, texts []string) (*Result, error) {
+	if len(texts) == 0 {
+		return &Result{}, nil
+	}
+	return m.moderate(ctx, map[string]interface{}{
+		"product": product,
+		"input":   texts,
+	})
+}
+
+func (m *WebhookModerator) ModerateImages(ctx context.Context, product string, images []*Image) (*Result, error) {
+	if len(images) == 0 {
+		return &Result{}, nil
+	}
+	items := make([]map[string]string, 0, len(images))
+	for _, image := range images {
+		items = append(items, map[string]string{
+			"name":        image.Name,
+			"contentType": image.ContentType,
+			"sha256":      image.Hash(),
+			"data":        base64.StdEncoding.EncodeToString(image.Data),
+		})
+	}
+	return m.moderate(ctx, map[string]interface{}{
+		"product": product,
+		"images":  items,
+	})
+}
+
+func (m *WebhookModerator) moderate(ctx context.Context, body map[string]interface{}) (*Result, error) {
+	var resp struct {
+		Flagged    bool               `json:"flagged"`
+		Categories []string           `json:"categories"`
+		Scores     map[string]float64 `json:"scores"`
+		Reason     string             `json:"reason"`
+	}
+	request := m.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		SetResult(&resp).
+		ForceContentType("application/json")
+	if m.token != "" {
+		request.SetHeader("Authorization", fmt.Sprintf("Bearer %s", m.token))
+	}
+	response, err := request.Post(m.url)
+	if err != nil {
+		return nil, err
+	}
+	if !response.IsSuccess() {
+		return nil, fmt.Errorf("moderation webhook returned an error: %d", response.StatusCode())
+	}
+	return &Result{Flagged: resp.Flagged, Categories: resp.Categories, Scores: resp.Scores, Reason: resp.Reason}, nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+type BackupRepository interface {
+	// Snapshot 在只读事务中执行 fn, fn 中的查询看到同一时刻的数据
+	Snapshot(ctx context.Context, fn func(ctx context.Context) error) error
+	// SchemaVersion 返回数据库已执行的最新迁移版本
+	SchemaVersion(ctx context.Context) (int64, error)
+	CountTable(ctx context.Context, table interface{}) (int64, error)
+	ExportTable(ctx context.Context, table interface{}, batch int, fn func(rows interface{}) error) error
+	ClearTable(ctx context.Context, table interface{}) error
+	ImportRows(ctx context.Context, rows interface{}) error
+	ResetSequence(ctx context.Context, table interface{}) error
+}
+
+func NewBackupRepository(
+	repository *Repository,
+) BackupRepository {
+	return &backupRepository{
+		Repository: repository,
+	}
+}
+
+type backupRepository struct {
+	*Repository
+}
+
+func (r *backupRepository) Snapshot(ctx context.Context, fn func(ctx context.Context) error) error {
+	var opts *sql.TxOptions
+	if r.db.Dialector.Name() != "sqlite" {
+		// sqlite 的读事务本身即为快照, 且驱动不支持指定隔离级别
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ctx = context.WithValue(ctx, ctxTxKey, tx)
+		return fn(ctx)
+	}, opts)
+}
+
+func (r *backupRepository) SchemaVersion(ctx context.Context) (int64, error) {
+	var version sql.NullInt64
+	err := r.DB(ctx).Model(&model.SchemaMigration{}).Select("max(version)").Scan(&version).Error
+	if err != nil {
+		return 0, err
+	}
+	return version.Int64, nil
+}
+
+func (r *backupRepository) CountTable(ctx context.Context, table interface{}) (int64, error) {
+	var count int64
+	if err := r.DB(ctx).Model(table).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ExportTable 按主键顺序分批读取整张表, fn 的参数为指向模型切片的指针
+func (r *backupRepository) ExportTable(ctx context.Context, table interface{}, batch int, fn func(rows interface{}) error) error {
+	rows := reflect.New(reflect.SliceOf(reflect.TypeOf(table))).Interface()
+	return r.DB(ctx).Model(table).FindInBatches(rows, batch, func(tx *gorm.DB, _ int) error {
+		return fn(rows)
+	}).Error
+}
+
+func (r *backupRepository) ClearTable(ctx context.Context, table interface{}) error {
+	return r.DB(ctx).Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(table).Error
+}
+
+// ImportRows 按原样写入一批数据, rows 为模型切片
+//
+// 通过字段映射写入而不是直接创建模型, 否则值为零的字段会被 default 标签替换
+func (r *backupRepository) ImportRows(ctx context.Context, rows interface{}) error {
+	db := r.DB(ctx)
+	v := reflect.Indirect(reflect.ValueOf(rows))
+	if v.Len() == 0 {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(v.Index(0).Interface()); err != nil {
+		return err
+	}
+	values := make([]map[string]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		value := make(map[string]interface{}, len(stmt.Schema.Fields))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			fieldValue, _ := field.ValueOf(ctx, row)
+			value[field.DBName] = fieldValue
+		}
+		values = append(values, value)
+	}
+	return db.Table(stmt.Schema.Table).Create(values).Error
+}
+
+// ResetSequence 写入指定主键后重置 postgres 的自增序列, 其它数据库自动处理
+func (r *backupRepository) ResetSequence(ctx context.Context, table interface{}) error {
+	db := r.DB(ctx)
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(table); err != nil {
+		return err
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil || !field.AutoIncrement {
+		return nil
+	}
+	sql := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+		stmt.Schema.Table, field.DBName, field.DBName, stmt.Schema.Table)
+	return db.Exec(sql).Error
+}
@@ -4,6 +4,7 @@ import (
 	"PandoraFuclaudePlusHelper/internal/model"
 	"context"
 	"errors"
+	"time"
 )
 
 type ClaudeAccountRepository interface {
@@ -15,6 +16,7 @@ type ClaudeAccountRepository interface {
 	DeleteAccount(ctx context.Context, id int64) error
 	GetAccountByPassword(ctx context.Context, password string) (model.ClaudeAccount, error)
 	GetAccountById(ctx context.Context, id int64) (model.ClaudeAccount, error)
+	CountExpiring(ctx context.Context, from time.Time, to time.Time) (int64, error)
 }
 
 func NewClaudeAccountRepository(
@@ -96,3 +98,15 @@ func (r *claudeAccountRepository) GetAccountById(ctx context.Context, id int64)
 	}
 	return account, nil
 }
+
+// CountExpiring 统计在 [from, to) 内到期的正常账号数量, Claude 账号的有效期跟随所属用户
+func (r *claudeAccountRepository) CountExpiring(ctx context.Context, from time.Time, to time.Time) (int64, error) {
+	var count int64
+	if err := r.DB(ctx).Model(&model.ClaudeAccount{}).
+		Joins("join tb_user on tb_user.id = tb_claude_account.user_id").
+		Where("tb_claude_account.status = 1 and tb_user.expiration_time >= ? and tb_user.expiration_time < ?", from, to).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -13,6 +13,7 @@ type ClaudeTokenRepository interface {
 	SearchToken(ctx context.Context, keyword string) ([]*model.ClaudeToken, error)
 	DeleteToken(ctx context.Context, id int64) error
 	GetAllToken(ctx context.Context) ([]*model.ClaudeToken, error)
+	Count(ctx context.Context) (int64, error)
 }
 
 func NewClaudeTokenRepository(
@@ -30,7 +31,7 @@ type claudeTokenRepository struct {
 
 func (r *claudeTokenRepository) SearchToken(ctx context.Context, keyword string) ([]*model.ClaudeToken, error) {
 	var tokens []*model.ClaudeToken
-	if err := r.DB(ctx).Where("token_name like ?", "%"+keyword+"%").Find(&tokens).Error; err != nil {
+	if err := r.DB(ctx).Where("lower(token_name) like lower(?)", "%"+keyword+"%").Find(&tokens).Error; err != nil {
 		return nil, err
 	}
 	return tokens, nil
@@ -76,3 +77,11 @@ func (r *claudeTokenRepository) GetAllToken(ctx context.Context) ([]*model.Claud
 	}
 	return tokens, nil
 }
+
+func (r *claudeTokenRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	if err := r.DB(ctx).Model(&model.ClaudeToken{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// JobRunFilter 任务执行查询条件, 零值表示不过滤
+type JobRunFilter struct {
+	Job    string
+	Status string
+	Offset int
+	Limit  int
+}
+
+// JobRunItemFilter 任务执行明细查询条件, 零值表示不过滤
+type JobRunItemFilter struct {
+	RunId    int64
+	Job      string
+	ItemType string
+	ItemId   int64
+	Status   string
+	Offset   int
+	Limit    int
+}
+
+// JobFailingItem 自最后一次成功后持续失败的对象
+type JobFailingItem struct {
+	Job          string    `json:"job"`
+	ItemType     string    `json:"itemType"`
+	ItemId       int64     `json:"itemId"`
+	ItemName     string    `json:"itemName"`
+	Failures     int64     `json:"failures"`
+	FailingSince time.Time `json:"failingSince"`
+	LastFailure  time.Time `json:"lastFailure"`
+	LastMessage  string    `json:"lastMessage"`
+}
+
+type JobRepository interface {
+	GetConfigs(ctx context.Context) ([]*model.JobConfig, error)
+	SaveConfig(ctx context.Context, config *model.JobConfig) error
+
+	CreateRun(ctx context.Context, run *model.JobRun) error
+	UpdateRun(ctx context.Context, run *model.JobRun) error
+	GetLastRun(ctx context.Context, job string) (*model.JobRun, error)
+	SearchRun(ctx context.Context, filter *JobRunFilter) ([]*model.JobRun, int64, error)
+	CreateItems(ctx context.Context, items []*model.JobRunItem) error
+	SearchItem(ctx context.Context, filter *JobRunItemFilter) ([]*model.JobRunItem, int64, error)
+	FailingItems(ctx context.Context, job string) ([]*JobFailingItem, error)
+	InterruptRuns(ctx context.Context, job string, endTime time.Time) error
+	DeleteRunsBefore(ctx context.Context, before time.Time) error
+
+	AcquireLock(ctx context.Context, name string, owner string, runKey string, now time.Time, expireTime time.Time) (bool, error)
+	RenewLock(ctx context.Context, name string, owner string, expireTime time.Time) (bool, error)
+	ReleaseLock(ctx context.Context, name string, owner string, now time.Time) error
+	GetLocks(ctx context.Context) ([]*model.JobLock, error)
+}
+
+func NewJobRepository(
+	repository *Repository,
+) JobRepository {
+	return &jobRepository{
+		Repository: repository,
+	}
+}
+
+type jobRepository struct {
+	*Repository
+}
+
+func (r *jobRepository) GetConfigs(ctx context.Context) ([]*model.JobConfig, error) {
+	var configs []*model.JobConfig
+	if err := r.DB(ctx).Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// SaveConfig 按任务名称新增或更新配置
+func (r *jobRepository) SaveConfig(ctx context.Context, config *model.JobConfig) error {
+	var old model.JobConfig
+	err := r.DB(ctx).Where("name = ?", config.Name).Limit(1).Find(&old).Error
+	if err != nil {
+		return err
+	}
+	config.ID = old.ID
+	return r.DB(ctx).Save(config).Error
+}
+
+func (r *jobRepository) CreateRun(ctx context.Context, run *model.JobRun) error {
+	return r.DB(ctx).Create(run).Error
+}
+
+func (r *jobRepository) UpdateRun(ctx context.Context, run *model.JobRun) error {
+	return r.DB(ctx).Save(run).Error
+}
+
+// GetLastRun 查询任务最近一次执行, 没有执行记录时返回 nil
+func (r *jobRepository) GetLastRun(ctx context.Context, job string) (*model.JobRun, error) {
+	var runs []*model.JobRun
+	if err := r.DB(ctx).Where("job = ?", job).Order("id desc").Limit(1).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	return runs[0], nil
+}
+
+func (r *jobRepository) SearchRun(ctx context.Context, filter *JobRunFilter) ([]*model.JobRun, int64, error) {
+	query := r.DB(ctx).Model(&model.JobRun{})
+	if filter.Job != "" {
+		query = query.Where("job = ?", filter.Job)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []*model.JobRun
+	query = query.Order("id desc").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+func (r *jobRepository) CreateItems(ctx context.Context, items []*model.JobRunItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return r.DB(ctx).CreateInBatches(items, 100).Error
+}
+
+func (r *jobRepository) SearchItem(ctx context.Context, filter *JobRunItemFilter) ([]*model.JobRunItem, int64, error) {
+	query := r.DB(ctx).Model(&model.JobRunItem{})
+	if filter.RunId != 0 {
+		query = query.Where("run_id = ?", filter.RunId)
+	}
+	if filter.Job != "" {
+		query = query.Where("job = ?", filter.Job)
+	}
+	if filter.ItemType != "" {
+		query = query.Where("item_type = ?", filter.ItemType)
+	}
+	if filter.ItemId != 0 {
+		query = query.Where("item_id = ?", filter.ItemId)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []*model.JobRunItem
+	query = query.Order("id desc").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// FailingItems 查询自最后一次成功后持续失败的对象, 按开始失败的时间排序, job 为空时查询全部任务
+func (r *jobRepository) FailingItems(ctx context.Context, job string) ([]*JobFailingItem, error) {
+	// 聚合时间在 sqlite 中返回字符串, 这里只聚合ID, 时间与原因从明细中读取
+	var groups []struct {
+		Job      string
+		ItemType string
+		ItemId   int64
+		Failures int64
+		FirstId  int64
+		LastId   int64
+	}
+	query := r.DB(ctx).Table("tb_job_run_item as i").
+		Select("i.job, i.item_type, i.item_id, count(*) as failures, min(i.id) as first_id, max(i.id) as last_id").
+		Where("i.status = ?", model.JobStatusFailure).
+		Where("not exists (select 1 from tb_job_run_item s where s.job = i.job and s.item_type = i.item_type "+
+			"and s.item_id = i.item_id and s.status = ? and s.id > i.id)", model.JobStatusSuccess)
+	if job != "" {
+		query = query.Where("i.job = ?", job)
+	}
+	if err := query.Group("i.job, i.item_type, i.item_id").Order("first_id").Scan(&groups).Error; err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return []*JobFailingItem{}, nil
+	}
+
+	ids := make([]int64, 0, len(groups)*2)
+	for _, group := range groups {
+		ids = append(ids, group.FirstId, group.LastId)
+	}
+	var items []*model.JobRunItem
+	if err := r.DB(ctx).Where("id in ?", ids).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	byId := make(map[int64]*model.JobRunItem, len(items))
+	for _, item := range items {
+		byId[item.ID] = item
+	}
+
+	failing := make([]*JobFailingItem, 0, len(groups))
+	for _, group := range groups {
+		first, last := byId[group.FirstId], byId[group.LastId]
+		if first == nil || last == nil {
+			continue
+		}
+		failing = append(failing, &JobFailingItem{
+			Job:          group.Job,
+			ItemType:     group.ItemType,
+			ItemId:       group.ItemId,
+			ItemName:     last.ItemName,
+			Failures:     group.Failures,
+			FailingSince: first.CreateTime,
+			LastFailure:  last.CreateTime,
+			LastMessage:  last.Message,
+		})
+	}
+	return failing, nil
+}
+
+// InterruptRuns 将任务之前未结束的执行标记为失败, 例如执行中进程退出或副本宕机
+func (r *jobRepository) InterruptRuns(ctx context.Context, job string, endTime time.Time) error {
+	return r.DB(ctx).Model(&model.JobRun{}).
+		Where("job = ? and status = ?", job, model.JobStatusRunning).
+		Updates(map[string]interface{}{
+			"status":   model.JobStatusFailure,
+			"error":    "interrupted",
+			"end_time": endTime,
+		}).Error
+}
+
+// DeleteRunsBefore 删除 before 之前开始的执行及其明细
+func (r *jobRepository) DeleteRunsBefore(ctx context.Context, before time.Time) error {
+	if err := r.DB(ctx).Where("create_time < ?", before).Delete(&model.JobRunItem{}).Error; err != nil {
+		return err
+	}
+	return r.DB(ctx).Where("start_time < ? and status <> ?", before, model.JobStatusRunning).Delete(&model.JobRun{}).Error
+}
+
+// AcquireLock 获取任务租约, 租约已过期或由 owner 持有, 且 runKey 未执行过时才能获取
+func (r *jobRepository) AcquireLock(ctx context.Context, name string, owner string, runKey string, now time.Time, expireTime time.Time) (bool, error) {
+	// 先保证租约记录存在, 并发插入时由唯一索引保证只有一条
+	err := r.DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model.JobLock{
+		Name:       name,
+		Owner:      "",
+		RunKey:     "",
+		ExpireTime: time.Unix(0, 0),
+		UpdateTime: now,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	result := r.DB(ctx).Model(&model.JobLock{}).
+		Where("name = ? and run_key <> ? and (owner = ? or expire_time < ?)", name, runKey, owner, now).
+		Updates(map[string]interface{}{
+			"owner":       owner,
+			"run_key":     runKey,
+			"expire_time": expireTime,
+			"update_time": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RenewLock 续约, 租约已被其他副本获取时返回 false
+func (r *jobRepository) RenewLock(ctx context.Context, name string, owner string, expireTime time.Time) (bool, error) {
+	result := r.DB(ctx).Model(&model.JobLock{}).
+		Where("name = ? and owner = ?", name, owner).
+		Updates(map[string]interface{}{
+			"expire_time": expireTime,
+			"update_time": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseLock 释放租约, 保留 run_key 防止其他副本重复执行同一计划时间
+func (r *jobRepository) ReleaseLock(ctx context.Context, name string, owner string, now time.Time) error {
+	return r.DB(ctx).Model(&model.JobLock{}).
+		Where("name = ? and owner = ?", name, owner).
+		Updates(map[string]interface{}{
+			"expire_time": now,
+			"update_time": now,
+		}).Error
+}
+
+func (r *jobRepository) GetLocks(ctx context.Context) ([]*model.JobLock, error) {
+	var locks []*model.JobLock
+	if err := r.DB(ctx).Find(&locks).Error; err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
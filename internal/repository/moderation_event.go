@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ModerationEventFilter 审查事件查询条件, 零值表示不过滤
+type ModerationEventFilter struct {
+	Keyword   string
+	Product   string
+	Direction string
+	Status    *int
+	UserId    int64
+	StartTime time.Time
+	EndTime   time.Time
+	Offset    int
+	Limit     int
+}
+
+type ModerationEventRepository interface {
+	Create(ctx context.Context, event *model.ModerationEvent) error
+	SearchEvent(ctx context.Context, filter *ModerationEventFilter) ([]*model.ModerationEvent, int64, error)
+	ReviewEvent(ctx context.Context, ids []int64, note string, reviewTime time.Time) error
+	CountStrike(ctx context.Context, userId int64, product string, since time.Time) (int64, error)
+	ResetStrike(ctx context.Context, userId int64) error
+	StrikeSummary(ctx context.Context, userIds []int64) ([]*StrikeSummary, error)
+}
+
+// StrikeSummary 用户计入违规次数的事件统计
+type StrikeSummary struct {
+	UserId  int64 `json:"userId"`
+	Strikes int64 `json:"strikes"`
+}
+
+func NewModerationEventRepository(
+	repository *Repository,
+) ModerationEventRepository {
+	return &moderationEventRepository{
+		Repository: repository,
+	}
+}
+
+type moderationEventRepository struct {
+	*Repository
+}
+
+// Create 保存审查事件, strike 字段没有 default 标签, 仅记录的事件按 0 写入, 不会被替换为计入违规次数
+func (r *moderationEventRepository) Create(ctx context.Context, event *model.ModerationEvent) error {
+	if err := r.DB(ctx).Create(event).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *moderationEventRepository) SearchEvent(ctx context.Context, filter *ModerationEventFilter) ([]*model.ModerationEvent, int64, error) {
+	query := r.DB(ctx).Model(&model.ModerationEvent{})
+	query = r.applyFilter(query, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []*model.ModerationEvent
+	query = query.Order("id desc").Offset(filter.Offset)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (r *moderationEventRepository) ReviewEvent(ctx context.Context, ids []int64, note string, reviewTime time.Time) error {
+	return r.DB(ctx).Model(&model.ModerationEvent{}).
+		Where("id in ?", ids).
+		Updates(map[string]interface{}{
+			"status":      model.ModerationEventReviewed,
+			"review_note": note,
+			"review_time": reviewTime,
+		}).Error
+}
+
+// CountStrike 统计用户自 since 起计入违规次数的事件, product 为 all 时统计全部产品
+func (r *moderationEventRepository) CountStrike(ctx context.Context, userId int64, product string, since time.Time) (int64, error) {
+	query := r.DB(ctx).Model(&model.ModerationEvent{}).Where("user_id = ? and strike = 1 and create_time >= ?", userId, since)
+	if product != "" && product != model.ModerationProductAll {
+		query = query.Where("product = ?", product)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ResetStrike 将用户的事件标记为不计入违规次数
+func (r *moderationEventRepository) ResetStrike(ctx context.Context, userId int64) error {
+	return r.DB(ctx).Model(&model.ModerationEvent{}).
+		Where("user_id = ? and strike = 1", userId).
+		Update("strike", 0).Error
+}
+
+// StrikeSummary 按用户汇总违规次数, userIds 为空时汇总全部用户
+func (r *moderationEventRepository) StrikeSummary(ctx context.Context, userIds []int64) ([]*StrikeSummary, error) {
+	var summaries []*StrikeSummary
+	query := r.DB(ctx).Model(&model.ModerationEvent{}).
+		Select("user_id, count(*) as strikes").
+		Where("user_id > 0 and strike = 1")
+	if len(userIds) > 0 {
+		query = query.Where("user_id in ?", userIds)
+	}
+	if err := query.Group("user_id").Order("strikes desc").Scan(&summaries).Error; err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (r *moderationEventRepository) applyFilter(query *gorm.DB, filter *ModerationEventFilter) *gorm.DB {
+	if filter.Keyword != "" {
+		keyword := "%" + filter.Keyword + "%"
+		query = query.Where("lower(message) like lower(?) or lower(user_name) like lower(?) or lower(account) like lower(?) or lower(reason) like lower(?)", keyword, keyword, keyword, keyword)
+	}
+	if filter.Product != "" {
+		query = query.Where("product = ?", filter.Product)
+	}
+	if filter.Direction != "" {
+		query = query.Where("direction = ?", filter.Direction)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.UserId != 0 {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+	if !filter.StartTime.IsZero() {
+		query = query.Where("create_time >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		query = query.Where("create_time < ?", filter.EndTime)
+	}
+	return query
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCreateEventStrike(t *testing.T) {
+	tests := []struct {
+		name   string
+		strike int
+		// wantCount 创建后统计的违规次数
+		wantCount int64
+	}{
+		{name: "blocked counts", strike: 1, wantCount: 1},
+		// 仅记录的事件在插入时即为 0, 不会被短暂计入违规次数
+		{name: "logged not counted", strike: 0, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachDB(t, func(t *testing.T, r *Repository) {
+				ctx := context.Background()
+				events := NewModerationEventRepository(r)
+				now := time.Now()
+				event := &model.ModerationEvent{Product: model.ModerationProductOpenai, UserId: 1, Strike: tt.strike, CreateTime: now}
+				if err := events.Create(ctx, event); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+				var stored model.ModerationEvent
+				if err := r.DB(ctx).First(&stored, event.ID).Error; err != nil {
+					t.Fatal(err)
+				}
+				if stored.Strike != tt.strike || event.Strike != tt.strike {
+					t.Errorf("strike = %d (stored %d), want %d", event.Strike, stored.Strike, tt.strike)
+				}
+				count, err := events.CountStrike(ctx, 1, model.ModerationProductAll, now.Add(-time.Minute))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != tt.wantCount {
+					t.Errorf("CountStrike() = %d, want %d", count, tt.wantCount)
+				}
+			})
+		})
+	}
+}
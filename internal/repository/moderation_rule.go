@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"time"
+)
+
+type ModerationRuleRepository interface {
+	GetRule(ctx context.Context, id int64) (*model.ModerationRule, error)
+	Update(ctx context.Context, rule *model.ModerationRule) error
+	Create(ctx context.Context, rule *model.ModerationRule) error
+	SearchRule(ctx context.Context, keyword string, product string) ([]*model.ModerationRule, error)
+	DeleteRule(ctx context.Context, id int64) error
+	GetEnableRules(ctx context.Context) ([]*model.ModerationRule, error)
+	GetLastUpdateTime(ctx context.Context) (time.Time, int64, error)
+}
+
+func NewModerationRuleRepository(
+	repository *Repository,
+) ModerationRuleRepository {
+	return &moderationRuleRepository{
+		Repository: repository,
+	}
+}
+
+type moderationRuleRepository struct {
+	*Repository
+}
+
+func (r *moderationRuleRepository) GetRule(ctx context.Context, id int64) (*model.ModerationRule, error) {
+	var rule model.ModerationRule
+	if err := r.DB(ctx).Where("id = ?", id).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *moderationRuleRepository) Update(ctx context.Context, rule *model.ModerationRule) error {
+	if err := r.DB(ctx).Save(rule).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *moderationRuleRepository) Create(ctx context.Context, rule *model.ModerationRule) error {
+	if err := r.DB(ctx).Create(rule).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *moderationRuleRepository) SearchRule(ctx context.Context, keyword string, product string) ([]*model.ModerationRule, error) {
+	var rules []*model.ModerationRule
+	query := r.DB(ctx).Where("lower(name) like lower(?) or lower(pattern) like lower(?)", "%"+keyword+"%", "%"+keyword+"%")
+	if product != "" {
+		query = query.Where("product = ?", product)
+	}
+	if err := query.Order("id desc").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *moderationRuleRepository) DeleteRule(ctx context.Context, id int64) error {
+	return r.DB(ctx).Delete(&model.ModerationRule{}, id).Error
+}
+
+func (r *moderationRuleRepository) GetEnableRules(ctx context.Context) ([]*model.ModerationRule, error) {
+	var rules []*model.ModerationRule
+	if err := r.DB(ctx).Where("enable = 1").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetLastUpdateTime 返回规则的最后更新时间与数量, 用于判断其他实例是否修改过规则
+func (r *moderationRuleRepository) GetLastUpdateTime(ctx context.Context) (time.Time, int64, error) {
+	var rules []*model.ModerationRule
+	if err := r.DB(ctx).Select("update_time").Order("update_time desc").Limit(1).Find(&rules).Error; err != nil {
+		return time.Time{}, 0, err
+	}
+	var count int64
+	if err := r.DB(ctx).Model(&model.ModerationRule{}).Count(&count).Error; err != nil {
+		return time.Time{}, 0, err
+	}
+	if len(rules) == 0 {
+		return time.Time{}, count, nil
+	}
+	return rules[0].UpdateTime, count, nil
+}
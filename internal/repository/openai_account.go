@@ -4,6 +4,7 @@ import (
 	"PandoraFuclaudePlusHelper/internal/model"
 	"context"
 	"errors"
+	"time"
 )
 
 type OpenaiAccountRepository interface {
@@ -15,6 +16,10 @@ type OpenaiAccountRepository interface {
 	DeleteAccount(ctx context.Context, id int64) error
 	GetAccountByPassword(ctx context.Context, password string) (model.OpenaiAccount, error)
 	GetAccountById(ctx context.Context, id int64) (model.OpenaiAccount, error)
+	GetAccountByShareToken(ctx context.Context, shareToken string) (*model.OpenaiAccount, error)
+	CountExpiring(ctx context.Context, from time.Time, to time.Time) (int64, error)
+	// ExistsAccount 账号名称是否已被使用
+	ExistsAccount(ctx context.Context, account string) (bool, error)
 }
 
 func NewOpenaiAccountRepository(
@@ -60,6 +65,14 @@ func (r *openaiAccountRepository) SearchAccount(ctx context.Context, tokenId int
 	return accounts, nil
 }
 
+func (r *openaiAccountRepository) ExistsAccount(ctx context.Context, account string) (bool, error) {
+	var count int64
+	if err := r.DB(ctx).Model(&model.OpenaiAccount{}).Where("account = ?", account).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (r *openaiAccountRepository) DeleteAccount(ctx context.Context, id int64) error {
 	r.DB(ctx).Delete(&model.OpenaiAccount{}, id)
 	return nil
@@ -96,3 +109,23 @@ func (r *openaiAccountRepository) GetAccountById(ctx context.Context, id int64)
 	}
 	return account, nil
 }
+
+// GetAccountByShareToken 根据共享token或其sha1查询账号
+func (r *openaiAccountRepository) GetAccountByShareToken(ctx context.Context, shareToken string) (*model.OpenaiAccount, error) {
+	var account model.OpenaiAccount
+	if err := r.DB(ctx).Where("share_token = ? or share_token_encrypt = ?", shareToken, shareToken).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CountExpiring 统计在 [from, to) 内到期的正常账号数量
+func (r *openaiAccountRepository) CountExpiring(ctx context.Context, from time.Time, to time.Time) (int64, error) {
+	var count int64
+	if err := r.DB(ctx).Model(&model.OpenaiAccount{}).
+		Where("status = 1 and expiration_time >= ? and expiration_time < ?", from, to).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -12,6 +12,7 @@ type OpenaiTokenRepository interface {
 	SearchToken(ctx context.Context, keyword string) ([]*model.OpenaiToken, error)
 	DeleteToken(ctx context.Context, id int64) error
 	GetAllToken(ctx context.Context) ([]*model.OpenaiToken, error)
+	CountBySubscription(ctx context.Context) (map[int]int64, error)
 }
 
 func NewOpenaiTokenRepository(
@@ -29,7 +30,7 @@ type openaiTokenRepository struct {
 
 func (r *openaiTokenRepository) SearchToken(ctx context.Context, keyword string) ([]*model.OpenaiToken, error) {
 	var tokens []*model.OpenaiToken
-	if err := r.DB(ctx).Where("token_name like ?", "%"+keyword+"%").Find(&tokens).Error; err != nil {
+	if err := r.DB(ctx).Where("lower(token_name) like lower(?)", "%"+keyword+"%").Find(&tokens).Error; err != nil {
 		return nil, err
 	}
 	return tokens, nil
@@ -69,3 +70,21 @@ func (r *openaiTokenRepository) GetAllToken(ctx context.Context) ([]*model.Opena
 	}
 	return tokens, nil
 }
+
+func (r *openaiTokenRepository) CountBySubscription(ctx context.Context) (map[int]int64, error) {
+	var rows []struct {
+		PlusSubscription int
+		Count            int64
+	}
+	if err := r.DB(ctx).Model(&model.OpenaiToken{}).
+		Select("plus_subscription, count(*) as count").
+		Group("plus_subscription").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.PlusSubscription] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type ReconcileRepository interface {
+	// ReplaceDrifts 用本次对账的结果替换之前的差异记录
+	ReplaceDrifts(ctx context.Context, drifts []*model.ShareTokenDrift) error
+	SearchDrift(ctx context.Context) ([]*model.ShareTokenDrift, error)
+	GetDrift(ctx context.Context, id int64) (*model.ShareTokenDrift, error)
+	UpdateDrift(ctx context.Context, drift *model.ShareTokenDrift) error
+}
+
+func NewReconcileRepository(
+	repository *Repository,
+) ReconcileRepository {
+	return &reconcileRepository{
+		Repository: repository,
+	}
+}
+
+type reconcileRepository struct {
+	*Repository
+}
+
+func (r *reconcileRepository) ReplaceDrifts(ctx context.Context, drifts []*model.ShareTokenDrift) error {
+	return r.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.ShareTokenDrift{}).Error; err != nil {
+			return err
+		}
+		if len(drifts) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(drifts, 100).Error
+	})
+}
+
+func (r *reconcileRepository) SearchDrift(ctx context.Context) ([]*model.ShareTokenDrift, error) {
+	var drifts []*model.ShareTokenDrift
+	if err := r.DB(ctx).Order("status, account_id, id").Find(&drifts).Error; err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+func (r *reconcileRepository) GetDrift(ctx context.Context, id int64) (*model.ShareTokenDrift, error) {
+	var drift model.ShareTokenDrift
+	if err := r.DB(ctx).Where("id = ?", id).First(&drift).Error; err != nil {
+		return nil, err
+	}
+	return &drift, nil
+}
+
+func (r *reconcileRepository) UpdateDrift(ctx context.Context, drift *model.ShareTokenDrift) error {
+	return r.DB(ctx).Save(drift).Error
+}
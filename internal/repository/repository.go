@@ -5,11 +5,13 @@ import (
 	"PandoraFuclaudePlusHelper/pkg/log"
 	"PandoraFuclaudePlusHelper/pkg/zapgorm2"
 	"context"
+	"fmt"
 	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -53,62 +55,76 @@ func (r *Repository) DB(ctx context.Context) *gorm.DB {
 	return r.db.WithContext(ctx)
 }
 
+// Transaction 在事务中执行 fn, ctx 中已有事务时加入该事务(通过保存点嵌套), 不另开一个独立的事务
 func (r *Repository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
-	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	return r.DB(ctx).Transaction(func(tx *gorm.DB) error {
 		ctx = context.WithValue(ctx, ctxTxKey, tx)
 		return fn(ctx)
 	})
 }
 
 func NewDB(l *log.Logger) *gorm.DB {
-	var (
-		db  *gorm.DB
-		err error
-	)
+	config := commonConfig.GetConfig()
+	db, err := OpenDB(l, config.DatabaseDriver, config.DatabaseDsn)
+	if err != nil {
+		panic(err)
+	}
+	// db = db.Debug()
 
-	logger := zapgorm2.New(l.Logger)
-	driver := commonConfig.GetConfig().DatabaseDriver
-	dsn := commonConfig.GetConfig().DatabaseDsn
+	// Connection Pool config
+	sqlDB, err := db.DB()
+	if err != nil {
+		panic(err)
+	}
+	sqlDB.SetMaxIdleConns(config.DatabaseMaxIdleConns)
+	sqlDB.SetMaxOpenConns(config.DatabaseMaxOpenConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(config.DatabaseConnMaxLifetime) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(config.DatabaseConnMaxIdleTime) * time.Second)
+	return db
+}
 
+// OpenDB 按指定的驱动与连接串打开数据库, sqlite 文件不存在时创建
+func OpenDB(l *log.Logger, driver string, dsn string) (*gorm.DB, error) {
 	// GORM doc: https://gorm.io/docs/connecting_to_the_database.html
+	var dialector gorm.Dialector
 	switch driver {
 	case "mysql":
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-			Logger: logger,
-		})
+		dialector = mysql.Open(dsn)
 	case "postgres":
-		db, err = gorm.Open(postgres.New(postgres.Config{
+		dialector = postgres.New(postgres.Config{
 			DSN:                  dsn,
 			PreferSimpleProtocol: true, // disables implicit prepared statement usage
-		}), &gorm.Config{})
+		})
 	case "sqlite":
-		_, err := os.Stat(dsn)
+		path, _, _ := strings.Cut(dsn, "?")
+		_, err := os.Stat(path)
 		if err != nil {
-			if os.IsNotExist(err) {
-				_, err := os.Create(dsn)
-				if err != nil {
-					return nil
-				}
-			} else {
-				panic(err)
+			if !os.IsNotExist(err) {
+				return nil, err
 			}
+			f, err := os.Create(path)
+			if err != nil {
+				return nil, err
+			}
+			f.Close()
 		}
-		db, err = gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		dialector = sqlite.Open(sqliteDsn(dsn))
 	default:
-		panic("unknown db driver")
-	}
-	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("unknown db driver: %s", driver)
 	}
-	// db = db.Debug()
+	return gorm.Open(dialector, &gorm.Config{
+		Logger: zapgorm2.New(l.Logger),
+	})
+}
 
-	// Connection Pool config
-	sqlDB, err := db.DB()
-	if err != nil {
-		panic(err)
+// sqliteDsn 未指定时设置 sqlite 的锁等待时间, 并发写入时等待其它短事务提交而不是立即失败
+func sqliteDsn(dsn string) string {
+	if strings.Contains(dsn, "busy_timeout") {
+		return dsn
 	}
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-	return db
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=busy_timeout(5000)"
 }
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/migration"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// postgresDsnEnv 设置后测试同时在 postgres 上执行, 应指向专用于测试的空库, 测试结束时删除创建的表
+const postgresDsnEnv = "TEST_POSTGRES_DSN"
+
+// forEachDB 在 sqlite 与(设置了 TEST_POSTGRES_DSN 时) postgres 上分别执行 fn, 每次都是执行完迁移的空库
+func forEachDB(t *testing.T, fn func(t *testing.T, r *Repository)) {
+	t.Helper()
+	drivers := []struct {
+		name string
+		dsn  func(t *testing.T) string
+	}{
+		{name: "sqlite", dsn: func(t *testing.T) string { return filepath.Join(t.TempDir(), "test.db") }},
+		{name: "postgres", dsn: func(t *testing.T) string {
+			dsn := os.Getenv(postgresDsnEnv)
+			if dsn == "" {
+				t.Skipf("%s not set", postgresDsnEnv)
+			}
+			return dsn
+		}},
+	}
+	for _, driver := range drivers {
+		t.Run(driver.name, func(t *testing.T) {
+			logger := &log.Logger{Logger: zap.NewNop()}
+			db, err := OpenDB(logger, driver.name, driver.dsn(t))
+			if err != nil {
+				t.Fatalf("OpenDB() error = %v", err)
+			}
+			t.Cleanup(func() {
+				// sqlite 的数据库文件随临时目录删除
+				if driver.name == "postgres" {
+					tables, err := db.Migrator().GetTables()
+					if err != nil {
+						t.Errorf("GetTables() error = %v", err)
+					}
+					for _, table := range tables {
+						if err := db.Migrator().DropTable(table); err != nil {
+							t.Errorf("DropTable(%s) error = %v", table, err)
+						}
+					}
+				}
+				if sqlDB, err := db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			})
+			if err := migration.NewMigrator(db, logger).Up(context.Background(), 0); err != nil {
+				t.Fatalf("migrate error = %v", err)
+			}
+			fn(t, NewRepository(logger, db))
+		})
+	}
+}
+
+func TestSearchIgnoreCase(t *testing.T) {
+	forEachDB(t, func(t *testing.T, r *Repository) {
+		ctx := context.Background()
+		now := time.Now()
+		seeds := []interface{}{
+			&model.User{UniqueName: "Alice", Password: "p1", ExpirationTime: now, CreateTime: now, UpdateTime: now},
+			&model.OpenaiToken{TokenName: "Team-Plus", RefreshToken: "r1", CreateTime: now, UpdateTime: now},
+			&model.ClaudeToken{TokenName: "Claude-Pro", CreateTime: now, UpdateTime: now},
+			&model.StrikePolicy{Name: "Spam Policy", Threshold: 3, CreateTime: now, UpdateTime: now},
+			&model.ModerationRule{Name: "Bad Words", Pattern: "Forbidden", CreateTime: now, UpdateTime: now},
+			&model.ModerationEvent{Product: model.ModerationProductOpenai, Message: "Hello World", CreateTime: now},
+		}
+		for _, seed := range seeds {
+			if err := r.DB(ctx).Create(seed).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name    string
+			keyword string
+			search  func(keyword string) (int, error)
+			want    int
+		}{
+			{name: "user", keyword: "ALI", search: func(keyword string) (int, error) {
+				users, err := NewUserRepository(r).SearchUser(ctx, keyword)
+				return len(users), err
+			}, want: 1},
+			{name: "user miss", keyword: "bob", search: func(keyword string) (int, error) {
+				users, err := NewUserRepository(r).SearchUser(ctx, keyword)
+				return len(users), err
+			}},
+			{name: "openai token", keyword: "team-PLUS", search: func(keyword string) (int, error) {
+				tokens, err := NewOpenaiTokenRepository(r).SearchToken(ctx, keyword)
+				return len(tokens), err
+			}, want: 1},
+			{name: "claude token", keyword: "pro", search: func(keyword string) (int, error) {
+				tokens, err := NewClaudeTokenRepository(r).SearchToken(ctx, keyword)
+				return len(tokens), err
+			}, want: 1},
+			{name: "strike policy", keyword: "spam", search: func(keyword string) (int, error) {
+				policies, err := NewStrikeRepository(r).SearchPolicy(ctx, keyword)
+				return len(policies), err
+			}, want: 1},
+			{name: "moderation rule pattern", keyword: "FORBID", search: func(keyword string) (int, error) {
+				rules, err := NewModerationRuleRepository(r).SearchRule(ctx, keyword, "")
+				return len(rules), err
+			}, want: 1},
+			{name: "moderation event", keyword: "world", search: func(keyword string) (int, error) {
+				events, total, err := NewModerationEventRepository(r).SearchEvent(ctx, &ModerationEventFilter{Keyword: keyword})
+				if int64(len(events)) != total {
+					t.Errorf("SearchEvent() total = %d, rows = %d", total, len(events))
+				}
+				return len(events), err
+			}, want: 1},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := tt.search(tt.keyword)
+				if err != nil {
+					t.Fatalf("search error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("search(%q) = %d rows, want %d", tt.keyword, got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestTransactionJoinsOuter(t *testing.T) {
+	errInner := errors.New("inner failed")
+	errOuter := errors.New("outer failed")
+	tests := []struct {
+		name     string
+		innerErr error
+		outerErr error
+		// wantUsers 外层事务结束后保存的用户
+		wantUsers int64
+	}{
+		{name: "both commit", wantUsers: 2},
+		{name: "inner rollback keeps outer", innerErr: errInner, wantUsers: 1},
+		{name: "outer rollback discards inner", outerErr: errOuter, wantUsers: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachDB(t, func(t *testing.T, r *Repository) {
+				ctx := context.Background()
+				users := NewUserRepository(r)
+				err := r.Transaction(ctx, func(ctx context.Context) error {
+					if err := users.Create(ctx, &model.User{UniqueName: "outer", Password: "p1"}); err != nil {
+						return err
+					}
+					err := r.Transaction(ctx, func(ctx context.Context) error {
+						if err := users.Create(ctx, &model.User{UniqueName: "inner", Password: "p2"}); err != nil {
+							return err
+						}
+						return tt.innerErr
+					})
+					if !errors.Is(err, tt.innerErr) {
+						t.Errorf("inner Transaction() error = %v, want %v", err, tt.innerErr)
+					}
+					return tt.outerErr
+				})
+				if !errors.Is(err, tt.outerErr) {
+					t.Fatalf("Transaction() error = %v, want %v", err, tt.outerErr)
+				}
+				var count int64
+				if err := r.DB(ctx).Model(&model.User{}).Count(&count).Error; err != nil {
+					t.Fatal(err)
+				}
+				if count != tt.wantUsers {
+					t.Errorf("users = %d, want %d", count, tt.wantUsers)
+				}
+			})
+		})
+	}
+}
+
+func TestImportRowsResetSequence(t *testing.T) {
+	forEachDB(t, func(t *testing.T, r *Repository) {
+		ctx := context.Background()
+		backups := NewBackupRepository(r)
+		rows := []*model.User{
+			{ID: 5, UniqueName: "alice", Password: "p1", Enable: 0},
+			{ID: 9, UniqueName: "bob", Password: "p2", Enable: 1},
+		}
+		if err := backups.ImportRows(ctx, &rows); err != nil {
+			t.Fatalf("ImportRows() error = %v", err)
+		}
+		if err := backups.ResetSequence(ctx, &model.User{}); err != nil {
+			t.Fatalf("ResetSequence() error = %v", err)
+		}
+
+		// 零值字段按原样写入, 不被 default 标签替换
+		imported, err := NewUserRepository(r).GetUser(ctx, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported.Enable != 0 {
+			t.Errorf("imported enable = %d, want 0", imported.Enable)
+		}
+
+		// 新建的记录不与导入的主键冲突
+		user := &model.User{UniqueName: "carol", Password: "p3"}
+		if err := NewUserRepository(r).Create(ctx, user); err != nil {
+			t.Fatalf("Create() after import error = %v", err)
+		}
+		if user.ID <= 9 {
+			t.Errorf("new user id = %d, want > 9", user.ID)
+		}
+	})
+}
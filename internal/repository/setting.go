@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+)
+
+type SettingRepository interface {
+	GetSettings(ctx context.Context) ([]*model.Setting, error)
+	SaveSetting(ctx context.Context, setting *model.Setting) error
+	DeleteSetting(ctx context.Context, name string) error
+}
+
+func NewSettingRepository(
+	repository *Repository,
+) SettingRepository {
+	return &settingRepository{
+		Repository: repository,
+	}
+}
+
+type settingRepository struct {
+	*Repository
+}
+
+func (r *settingRepository) GetSettings(ctx context.Context) ([]*model.Setting, error) {
+	var settings []*model.Setting
+	if err := r.DB(ctx).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SaveSetting 按设置名称新增或更新设置
+func (r *settingRepository) SaveSetting(ctx context.Context, setting *model.Setting) error {
+	var old model.Setting
+	err := r.DB(ctx).Where("name = ?", setting.Name).Limit(1).Find(&old).Error
+	if err != nil {
+		return err
+	}
+	setting.ID = old.ID
+	return r.DB(ctx).Save(setting).Error
+}
+
+func (r *settingRepository) DeleteSetting(ctx context.Context, name string) error {
+	return r.DB(ctx).Where("name = ?", name).Delete(&model.Setting{}).Error
+}
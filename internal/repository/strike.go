@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StrikeRepository interface {
+	GetPolicy(ctx context.Context, id int64) (*model.StrikePolicy, error)
+	CreatePolicy(ctx context.Context, policy *model.StrikePolicy) error
+	UpdatePolicy(ctx context.Context, policy *model.StrikePolicy) error
+	DeletePolicy(ctx context.Context, id int64) error
+	SearchPolicy(ctx context.Context, keyword string) ([]*model.StrikePolicy, error)
+	GetEnablePolicies(ctx context.Context) ([]*model.StrikePolicy, error)
+
+	GetSuspension(ctx context.Context, id int64) (*model.UserSuspension, error)
+	CreateSuspension(ctx context.Context, suspension *model.UserSuspension) (*model.UserSuspension, error)
+	UpdateSuspension(ctx context.Context, suspension *model.UserSuspension) error
+	GetActiveSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error)
+	GetLatestSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error)
+	GetExpiredSuspensions(ctx context.Context, now time.Time) ([]*model.UserSuspension, error)
+	LiftSuspensions(ctx context.Context, userId int64, action string, liftTime time.Time) (int64, error)
+	SearchSuspension(ctx context.Context, userId int64, status *int) ([]*model.UserSuspension, error)
+}
+
+func NewStrikeRepository(
+	repository *Repository,
+) StrikeRepository {
+	return &strikeRepository{
+		Repository: repository,
+	}
+}
+
+type strikeRepository struct {
+	*Repository
+}
+
+func (r *strikeRepository) GetPolicy(ctx context.Context, id int64) (*model.StrikePolicy, error) {
+	var policy model.StrikePolicy
+	if err := r.DB(ctx).Where("id = ?", id).First(&policy).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *strikeRepository) CreatePolicy(ctx context.Context, policy *model.StrikePolicy) error {
+	// enable 带有默认值, 创建时零值会被替换为默认值, 停用的策略需要在同一事务中单独更新, 避免短暂生效
+	enable := policy.Enable
+	return r.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(policy).Error; err != nil {
+			return err
+		}
+		if enable == 0 {
+			policy.Enable = 0
+			return tx.Model(policy).Update("enable", 0).Error
+		}
+		return nil
+	})
+}
+
+func (r *strikeRepository) UpdatePolicy(ctx context.Context, policy *model.StrikePolicy) error {
+	if err := r.DB(ctx).Save(policy).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *strikeRepository) DeletePolicy(ctx context.Context, id int64) error {
+	return r.DB(ctx).Delete(&model.StrikePolicy{}, id).Error
+}
+
+func (r *strikeRepository) SearchPolicy(ctx context.Context, keyword string) ([]*model.StrikePolicy, error) {
+	var policies []*model.StrikePolicy
+	if err := r.DB(ctx).Where("lower(name) like lower(?)", "%"+keyword+"%").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (r *strikeRepository) GetEnablePolicies(ctx context.Context) ([]*model.StrikePolicy, error) {
+	var policies []*model.StrikePolicy
+	if err := r.DB(ctx).Where("enable = 1").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (r *strikeRepository) GetSuspension(ctx context.Context, id int64) (*model.UserSuspension, error) {
+	var suspension model.UserSuspension
+	if err := r.DB(ctx).Where("id = ?", id).First(&suspension).Error; err != nil {
+		return nil, err
+	}
+	return &suspension, nil
+}
+
+// CreateSuspension 用户没有生效中的暂停记录时创建 suspension 并返回 nil, 已有时不创建并返回已有的记录
+//
+// 查询与插入在同一事务中执行并锁定用户记录, 多个实例同时处理同一用户时只会创建一条生效中的记录(sqlite 的写入本身串行)
+func (r *strikeRepository) CreateSuspension(ctx context.Context, suspension *model.UserSuspension) (*model.UserSuspension, error) {
+	var active *model.UserSuspension
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		var users []*model.User
+		if err := r.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", suspension.UserId).Find(&users).Error; err != nil {
+			return err
+		}
+		var err error
+		if active, err = r.GetActiveSuspension(ctx, suspension.UserId); err != nil || active != nil {
+			return err
+		}
+		return r.DB(ctx).Create(suspension).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return active, nil
+}
+
+func (r *strikeRepository) UpdateSuspension(ctx context.Context, suspension *model.UserSuspension) error {
+	if err := r.DB(ctx).Save(suspension).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetActiveSuspension 查询用户生效中的暂停记录, 不存在时返回 nil
+func (r *strikeRepository) GetActiveSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error) {
+	var suspensions []*model.UserSuspension
+	if err := r.DB(ctx).Where("user_id = ? and status = ?", userId, model.SuspensionActive).
+		Order("id desc").Limit(1).Find(&suspensions).Error; err != nil {
+		return nil, err
+	}
+	if len(suspensions) == 0 {
+		return nil, nil
+	}
+	return suspensions[0], nil
+}
+
+// GetLatestSuspension 查询用户最近一次暂停记录, 不存在时返回 nil
+func (r *strikeRepository) GetLatestSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error) {
+	var suspensions []*model.UserSuspension
+	if err := r.DB(ctx).Where("user_id = ?", userId).Order("id desc").Limit(1).Find(&suspensions).Error; err != nil {
+		return nil, err
+	}
+	if len(suspensions) == 0 {
+		return nil, nil
+	}
+	return suspensions[0], nil
+}
+
+// GetExpiredSuspensions 查询已到期但仍生效中的暂停记录
+func (r *strikeRepository) GetExpiredSuspensions(ctx context.Context, now time.Time) ([]*model.UserSuspension, error) {
+	var suspensions []*model.UserSuspension
+	if err := r.DB(ctx).Where("status = ? and action = ? and suspend_until <= ?", model.SuspensionActive, model.StrikeActionSuspend, now).
+		Find(&suspensions).Error; err != nil {
+		return nil, err
+	}
+	return suspensions, nil
+}
+
+// LiftSuspensions 解除用户指定动作的全部生效中记录, 返回解除的数量
+func (r *strikeRepository) LiftSuspensions(ctx context.Context, userId int64, action string, liftTime time.Time) (int64, error) {
+	result := r.DB(ctx).Model(&model.UserSuspension{}).
+		Where("user_id = ? and action = ? and status = ?", userId, action, model.SuspensionActive).
+		Updates(map[string]interface{}{"status": model.SuspensionLifted, "lift_time": liftTime})
+	return result.RowsAffected, result.Error
+}
+
+func (r *strikeRepository) SearchSuspension(ctx context.Context, userId int64, status *int) ([]*model.UserSuspension, error) {
+	var suspensions []*model.UserSuspension
+	query := r.DB(ctx)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	if err := query.Order("id desc").Find(&suspensions).Error; err != nil {
+		return nil, err
+	}
+	return suspensions, nil
+}
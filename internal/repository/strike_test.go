@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCreatePolicyEnable(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable int
+	}{
+		{name: "enabled", enable: 1},
+		// enable 带有默认值 1, 停用的策略不能被替换为启用
+		{name: "disabled", enable: 0},
+	}
+	forEachDB(t, func(t *testing.T, r *Repository) {
+		ctx := context.Background()
+		strikes := NewStrikeRepository(r)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				policy := &model.StrikePolicy{Name: tt.name, Threshold: 3, Action: model.StrikeActionDisable, Enable: tt.enable}
+				if err := strikes.CreatePolicy(ctx, policy); err != nil {
+					t.Fatalf("CreatePolicy() error = %v", err)
+				}
+				got, err := strikes.GetPolicy(ctx, policy.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Enable != tt.enable || policy.Enable != tt.enable {
+					t.Errorf("enable = %d (stored %d), want %d", policy.Enable, got.Enable, tt.enable)
+				}
+				enabled, err := strikes.GetEnablePolicies(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := false
+				for _, p := range enabled {
+					found = found || p.ID == policy.ID
+				}
+				if found != (tt.enable == 1) {
+					t.Errorf("policy in GetEnablePolicies() = %v, want %v", found, tt.enable == 1)
+				}
+			})
+		}
+	})
+}
+
+func TestLiftSuspensions(t *testing.T) {
+	tests := []struct {
+		name   string
+		userId int64
+		action string
+		// wantLifted 解除的数量, wantActive 解除后仍生效的记录
+		wantLifted int64
+		wantActive []int64
+	}{
+		{name: "disable", userId: 1, action: model.StrikeActionDisable, wantLifted: 2, wantActive: []int64{2, 5}},
+		{name: "suspend", userId: 1, action: model.StrikeActionSuspend, wantLifted: 1, wantActive: []int64{1, 3, 5}},
+		{name: "other user untouched", userId: 3, action: model.StrikeActionDisable, wantActive: []int64{1, 2, 3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachDB(t, func(t *testing.T, r *Repository) {
+				ctx := context.Background()
+				strikes := NewStrikeRepository(r)
+				now := time.Now()
+				suspensions := []*model.UserSuspension{
+					{UserId: 1, Action: model.StrikeActionDisable, CreateTime: now},
+					{UserId: 1, Action: model.StrikeActionSuspend, SuspendUntil: now.Add(time.Hour), CreateTime: now},
+					{UserId: 1, Action: model.StrikeActionDisable, CreateTime: now},
+					{UserId: 1, Action: model.StrikeActionDisable, CreateTime: now},
+					{UserId: 2, Action: model.StrikeActionDisable, CreateTime: now},
+				}
+				// 直接写入, CreateSuspension 不允许同一用户有多条生效中的记录
+				for _, suspension := range suspensions {
+					if err := r.DB(ctx).Create(suspension).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+				// 已解除的记录不重复解除
+				suspensions[3].Status = model.SuspensionLifted
+				if err := strikes.UpdateSuspension(ctx, suspensions[3]); err != nil {
+					t.Fatal(err)
+				}
+
+				lifted, err := strikes.LiftSuspensions(ctx, tt.userId, tt.action, now)
+				if err != nil {
+					t.Fatalf("LiftSuspensions() error = %v", err)
+				}
+				if lifted != tt.wantLifted {
+					t.Errorf("LiftSuspensions() = %d, want %d", lifted, tt.wantLifted)
+				}
+				status := model.SuspensionActive
+				active, err := strikes.SearchSuspension(ctx, 0, &status)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []int64
+				for i := len(active) - 1; i >= 0; i-- {
+					got = append(got, active[i].ID)
+				}
+				if len(got) != len(tt.wantActive) {
+					t.Fatalf("active = %v, want %v", got, tt.wantActive)
+				}
+				for i := range got {
+					if got[i] != tt.wantActive[i] {
+						t.Fatalf("active = %v, want %v", got, tt.wantActive)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestCreateSuspensionOnlyOneActive(t *testing.T) {
+	forEachDB(t, func(t *testing.T, r *Repository) {
+		ctx := context.Background()
+		strikes := NewStrikeRepository(r)
+		now := time.Now()
+		first := &model.UserSuspension{UserId: 1, Action: model.StrikeActionSuspend, SuspendUntil: now.Add(time.Hour), CreateTime: now}
+		if active, err := strikes.CreateSuspension(ctx, first); err != nil || active != nil {
+			t.Fatalf("CreateSuspension() = %v, %v, want nil, nil", active, err)
+		}
+
+		// 已有生效中的记录时不创建, 返回已有的记录
+		second := &model.UserSuspension{UserId: 1, Action: model.StrikeActionDisable, CreateTime: now}
+		active, err := strikes.CreateSuspension(ctx, second)
+		if err != nil {
+			t.Fatalf("CreateSuspension() error = %v", err)
+		}
+		if active == nil || active.ID != first.ID || second.ID != 0 {
+			t.Errorf("CreateSuspension() = %v, second id = %d, want existing %d", active, second.ID, first.ID)
+		}
+
+		// 解除后可以再次创建
+		if _, err := strikes.LiftSuspensions(ctx, 1, model.StrikeActionSuspend, now); err != nil {
+			t.Fatal(err)
+		}
+		if active, err := strikes.CreateSuspension(ctx, second); err != nil || active != nil || second.ID == 0 {
+			t.Errorf("CreateSuspension() after lift = %v, %v, id = %d", active, err, second.ID)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"PandoraFuclaudePlusHelper/internal/model"
 	"context"
+	"time"
 )
 
 type UserRepository interface {
@@ -13,6 +14,9 @@ type UserRepository interface {
 	DeleteUser(ctx context.Context, id int64) error
 	GetAllUser(ctx context.Context) ([]*model.User, error)
 	GetUserByPassword(ctx context.Context, password string) (model.User, error)
+	// ExistsUser 用户名或密码是否已被其他用户使用
+	ExistsUser(ctx context.Context, uniqueName string, password string) (bool, error)
+	CountActiveUser(ctx context.Context, now time.Time) (int64, error)
 }
 
 func NewUserRepository(
@@ -30,7 +34,8 @@ type userRepository struct {
 
 func (r *userRepository) SearchUser(ctx context.Context, keyword string) ([]*model.User, error) {
 	var users []*model.User
-	if err := r.DB(ctx).Where("unique_name like ?", "%"+keyword+"%").Find(&users).Error; err != nil {
+	// postgres 的 like 区分大小写, 统一转为小写后比较, 与 sqlite、mysql 的行为一致
+	if err := r.DB(ctx).Where("lower(unique_name) like lower(?)", "%"+keyword+"%").Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
@@ -78,3 +83,20 @@ func (r *userRepository) GetUserByPassword(ctx context.Context, password string)
 	}
 	return user, nil
 }
+
+func (r *userRepository) ExistsUser(ctx context.Context, uniqueName string, password string) (bool, error) {
+	var count int64
+	err := r.DB(ctx).Model(&model.User{}).Where("unique_name = ? or password = ?", uniqueName, password).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *userRepository) CountActiveUser(ctx context.Context, now time.Time) (int64, error) {
+	var count int64
+	if err := r.DB(ctx).Model(&model.User{}).Where("enable = 1 and expiration_time > ?", now).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errLeaseHeld = fmt.Errorf("%w: lease held by another instance", ErrJobRunning)
+	errLeaseLost = errors.New("job lease lost, another instance may have taken over")
+)
+
+// lease 任务租约, 未开启 JOB_LOCK 时不访问数据库
+type lease struct {
+	scheduler *Scheduler
+	name      string
+	locked    bool
+	lost      atomic.Bool
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func lockTtl() time.Duration {
+	ttl := commonConfig.GetConfig().JobLockTtl
+	if ttl < 3 {
+		ttl = 60
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// instanceName 当前副本的标识, 默认为 主机名-进程号
+func instanceName() string {
+	if instance := commonConfig.GetConfig().JobInstance; instance != "" {
+		return instance
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// runKey 定时触发时以 cron 计划的执行时间作为标识, 各副本的同一次计划只有一个能执行, 与实际触发的快慢无关;
+// 手动触发时 at 为触发时间, 每次都不同
+func runKey(trigger string, at time.Time) string {
+	if trigger == model.JobTriggerSchedule {
+		return "schedule:" + at.UTC().Truncate(time.Second).Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s:%d", trigger, at.UnixNano())
+}
+
+// acquire 获取任务租约, 已被其他副本持有或本计划时间已执行时返回 errLeaseHeld, at 为计划执行时间或触发时间
+func (s *Scheduler) acquire(ctx context.Context, name string, trigger string, at time.Time) (*lease, error) {
+	l := &lease{scheduler: s, name: name}
+	if !commonConfig.GetConfig().JobLock {
+		return l, nil
+	}
+	now := time.Now()
+	ok, err := s.repository.AcquireLock(ctx, name, s.instance, runKey(trigger, at), now, now.Add(lockTtl()))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errLeaseHeld
+	}
+	l.locked = true
+	return l, nil
+}
+
+// keep 在任务执行期间定时续约, 租约被其他副本获取或长时间续约失败时取消任务
+func (l *lease) keep(ctx context.Context, cancel context.CancelFunc) {
+	if !l.locked {
+		return
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	s := l.scheduler
+	go func() {
+		defer close(l.done)
+		ttl := lockTtl()
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		renewTime := time.Now()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+			}
+			ok, err := s.repository.RenewLock(ctx, l.name, s.instance, time.Now().Add(ttl))
+			if err != nil {
+				s.logger.Warn(fmt.Sprintf("job %s renew lease error: %v", l.name, err))
+				if time.Since(renewTime) < ttl {
+					continue
+				}
+			} else if ok {
+				renewTime = time.Now()
+				continue
+			}
+			s.logger.Error(fmt.Sprintf("job %s lease lost, cancel running job", l.name))
+			l.lost.Store(true)
+			cancel()
+			return
+		}
+	}()
+}
+
+// release 停止续约并释放租约
+func (l *lease) release(ctx context.Context) {
+	if !l.locked {
+		return
+	}
+	close(l.stop)
+	<-l.done
+	s := l.scheduler
+	if err := s.repository.ReleaseLock(ctx, l.name, s.instance, time.Now()); err != nil {
+		s.logger.Error(fmt.Sprintf("job %s release lease error: %v", l.name, err))
+	}
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"context"
+	"sync"
+	"time"
+)
+
+type recorderKey struct{}
+
+// recorder 收集一次任务执行中各个对象的处理结果
+type recorder struct {
+	mu      sync.Mutex
+	job     string
+	runId   int64
+	items   []*model.JobRunItem
+	success int
+	failure int
+	skipped int
+}
+
+func recorderFrom(ctx context.Context) *recorder {
+	r, _ := ctx.Value(recorderKey{}).(*recorder)
+	return r
+}
+
+func (r *recorder) add(itemType string, itemId int64, itemName string, status string, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status == model.JobStatusSuccess {
+		r.success++
+	} else {
+		r.failure++
+	}
+	r.items = append(r.items, &model.JobRunItem{
+		RunId:      r.runId,
+		Job:        r.job,
+		ItemType:   itemType,
+		ItemId:     itemId,
+		ItemName:   itemName,
+		Status:     status,
+		Message:    message,
+		CreateTime: time.Now(),
+	})
+}
+
+// finish 汇总明细数量并设置执行状态
+func (r *recorder) finish(run *model.JobRun, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run.EndTime = time.Now()
+	run.Success, run.Failure, run.Skipped = r.success, r.failure, r.skipped
+	run.Total = r.success + r.failure + r.skipped
+	switch {
+	case err != nil:
+		run.Status = model.JobStatusFailure
+		run.Error = err.Error()
+	case r.failure > 0:
+		run.Status = model.JobStatusPartial
+	default:
+		run.Status = model.JobStatusSuccess
+	}
+}
+
+// RecordSuccess 记录任务中一个对象处理成功, 不在任务执行中调用时忽略
+func RecordSuccess(ctx context.Context, itemType string, itemId int64, itemName string, message string) {
+	if r := recorderFrom(ctx); r != nil {
+		r.add(itemType, itemId, itemName, model.JobStatusSuccess, message)
+	}
+}
+
+// RecordFailure 记录任务中一个对象处理失败及原因
+func RecordFailure(ctx context.Context, itemType string, itemId int64, itemName string, err error) {
+	if r := recorderFrom(ctx); r != nil {
+		r.add(itemType, itemId, itemName, model.JobStatusFailure, err.Error())
+	}
+}
+
+// RecordSkipped 记录任务中一个对象无需处理, 只计数不保存明细
+func RecordSkipped(ctx context.Context) {
+	if r := recorderFrom(ctx); r != nil {
+		r.mu.Lock()
+		r.skipped++
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,486 @@
+package scheduler
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobRunning      = errors.New("job is running")
+	ErrInvalidSchedule = errors.New("invalid job schedule")
+)
+
+// cleanInterval 清理过期执行记录的间隔
+const cleanInterval = time.Hour
+
+// Definition 定时任务定义, Cron 为默认的 cron 表达式
+type Definition struct {
+	Name        string
+	Description string
+	Cron        string
+	Run         func(ctx context.Context) error
+}
+
+// Status 任务当前的配置与状态
+type Status struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Cron        string `json:"cron"`
+	Timezone    string `json:"timezone"`
+	Enable      bool   `json:"enable"`
+	Running     bool   `json:"running"`
+	// Owner 持有未过期租约的副本, 即正在执行任务的副本
+	Owner   string        `json:"owner"`
+	NextRun *time.Time    `json:"nextRun"`
+	LastRun *model.JobRun `json:"lastRun"`
+}
+
+type job struct {
+	definition *Definition
+	cron       string
+	timezone   string
+	enable     bool
+	entry      *gocron.Job
+	running    bool
+}
+
+// Scheduler 管理定时任务, 每个任务的 cron 表达式、时区与是否启用按 后台配置 > 环境变量 > 默认值 的顺序生效
+type Scheduler struct {
+	logger     *log.Logger
+	repository repository.JobRepository
+
+	mu        sync.Mutex
+	scheduler *gocron.Scheduler
+	jobs      map[string]*job
+	names     []string
+	loaded    bool
+	started   bool
+	ctx       context.Context
+	// instance 当前副本的标识, 用于持有任务租约
+	instance string
+	// cleanTime 上次清理过期执行记录的时间
+	cleanTime time.Time
+}
+
+func NewScheduler(logger *log.Logger, jobRepository repository.JobRepository) *Scheduler {
+	gocron.SetPanicHandler(func(jobName string, recoverData interface{}) {
+		logger.Error(fmt.Sprintf("Task Panic job: %s, %v", jobName, recoverData))
+	})
+	return &Scheduler{
+		logger:     logger,
+		repository: jobRepository,
+		scheduler:  gocron.NewScheduler(time.UTC),
+		jobs:       make(map[string]*job),
+		ctx:        context.Background(),
+		instance:   instanceName(),
+	}
+}
+
+// Register 注册任务, 需要在 Start 之前调用
+func (s *Scheduler) Register(definition *Definition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[definition.Name] = &job{definition: definition}
+	s.names = append(s.names, definition.Name)
+}
+
+// Start 加载配置并按计划执行任务
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load(ctx)
+	s.ctx = context.WithoutCancel(ctx)
+	for _, name := range s.names {
+		if err := s.schedule(s.jobs[name]); err != nil {
+			s.logger.Error(fmt.Sprintf("%s Task Start Error: %v", name, err))
+		}
+	}
+	if commonConfig.GetConfig().JobLock {
+		// 多副本部署时其他副本在后台修改的配置需要定时同步
+		if _, err := s.scheduler.Every(1).Minute().Tag("sync").Do(s.sync); err != nil {
+			s.logger.Error(fmt.Sprintf("job config sync Start Error: %v", err))
+		}
+	} else {
+		// 单副本部署时启动前未结束的执行都已随进程中断
+		for _, name := range s.names {
+			s.interrupt(name)
+		}
+	}
+	s.started = true
+	s.scheduler.StartAsync()
+}
+
+// interrupt 将任务未结束的执行记录标记为已中断
+func (s *Scheduler) interrupt(name string) {
+	if err := s.repository.InterruptRuns(s.ctx, name, time.Now()); err != nil {
+		s.logger.Error(fmt.Sprintf("job %s InterruptRuns error: %v", name, err))
+	}
+}
+
+func (s *Scheduler) Stop() {
+	s.scheduler.Stop()
+}
+
+// List 返回所有任务的配置、下次执行时间与最后一次执行结果
+func (s *Scheduler) List(ctx context.Context) []*Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load(ctx)
+	owners := make(map[string]string)
+	if commonConfig.GetConfig().JobLock {
+		locks, err := s.repository.GetLocks(ctx)
+		if err != nil {
+			s.logger.WithContext(ctx).Error(fmt.Sprintf("GetLocks error: %v", err))
+		}
+		for _, lock := range locks {
+			if lock.ExpireTime.After(time.Now()) {
+				owners[lock.Name] = lock.Owner
+			}
+		}
+	}
+	list := make([]*Status, 0, len(s.names))
+	for _, name := range s.names {
+		j := s.jobs[name]
+		status := &Status{
+			Name:        name,
+			Description: j.definition.Description,
+			Cron:        j.cron,
+			Timezone:    j.timezone,
+			Enable:      j.enable,
+			Running:     j.running,
+			Owner:       owners[name],
+		}
+		if j.entry != nil && s.started {
+			nextRun := j.entry.NextRun()
+			status.NextRun = &nextRun
+		}
+		lastRun, err := s.repository.GetLastRun(ctx, name)
+		if err != nil {
+			s.logger.WithContext(ctx).Error(fmt.Sprintf("GetLastRun %s error: %v", name, err))
+		}
+		status.LastRun = lastRun
+		list = append(list, status)
+	}
+	return list
+}
+
+// Trigger 立即异步执行一次任务, 任务正在本副本或其他副本执行时返回 ErrJobRunning
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	if _, ok := s.jobs[name]; !ok {
+		return ErrJobNotFound
+	}
+	lease, err := s.begin(ctx, name, model.JobTriggerManual, time.Now())
+	if err != nil {
+		return err
+	}
+	go s.execute(name, model.JobTriggerManual, lease)
+	return nil
+}
+
+// Run 立即同步执行一次任务并返回执行记录, 用于命令行; 任务暂停时同样执行
+func (s *Scheduler) Run(ctx context.Context, name string) (*model.JobRun, error) {
+	if _, ok := s.jobs[name]; !ok {
+		return nil, ErrJobNotFound
+	}
+	lease, err := s.begin(ctx, name, model.JobTriggerCli, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.execute(name, model.JobTriggerCli, lease), nil
+}
+
+// Pause 暂停任务, 正在执行的不受影响
+func (s *Scheduler) Pause(ctx context.Context, name string) error {
+	return s.update(ctx, name, func(j *job) { j.enable = false })
+}
+
+// Resume 恢复任务
+func (s *Scheduler) Resume(ctx context.Context, name string) error {
+	return s.update(ctx, name, func(j *job) { j.enable = true })
+}
+
+// Reschedule 修改任务的 cron 表达式与时区, 为空时使用环境变量或默认值
+func (s *Scheduler) Reschedule(ctx context.Context, name string, cron string, timezone string) error {
+	j, ok := s.jobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	envCron, envTimezone, _ := commonConfig.GetJobEnv(envName(name))
+	cron = firstNonEmpty(strings.TrimSpace(cron), envCron, j.definition.Cron)
+	timezone = firstNonEmpty(strings.TrimSpace(timezone), envTimezone, commonConfig.GetConfig().JobTimezone)
+	if err := ValidateSchedule(cron, timezone); err != nil {
+		return err
+	}
+	return s.update(ctx, name, func(j *job) {
+		j.cron = cron
+		j.timezone = timezone
+	})
+}
+
+// update 修改任务配置, 保存到数据库后重新调度
+func (s *Scheduler) update(ctx context.Context, name string, change func(j *job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load(ctx)
+	j, ok := s.jobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	change(j)
+	config := &model.JobConfig{
+		Name:       name,
+		Cron:       j.cron,
+		Timezone:   j.timezone,
+		Enable:     0,
+		UpdateTime: time.Now(),
+	}
+	if j.enable {
+		config.Enable = 1
+	}
+	if err := s.repository.SaveConfig(ctx, config); err != nil {
+		return err
+	}
+	if !s.started {
+		return nil
+	}
+	return s.schedule(j)
+}
+
+// schedule 按当前配置重新加入调度, 暂停的任务只移除
+func (s *Scheduler) schedule(j *job) error {
+	if j.entry != nil {
+		s.scheduler.RemoveByReference(j.entry)
+		j.entry = nil
+	}
+	if !j.enable {
+		return nil
+	}
+	name := j.definition.Name
+	entry, err := s.scheduler.Cron(cronWithTimezone(j.cron, j.timezone)).Tag(name).DoWithJobDetails(s.run, name, model.JobTriggerSchedule)
+	if err != nil {
+		return err
+	}
+	j.entry = entry
+	return nil
+}
+
+// load 首次使用时按 后台配置 > 环境变量 > 默认值 的顺序加载任务配置
+func (s *Scheduler) load(ctx context.Context) {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+
+	configs, err := s.configs(ctx)
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("load job configs error, use env and defaults: %v", err))
+	}
+	for _, name := range s.names {
+		s.resolve(s.jobs[name], configs[name])
+	}
+}
+
+// sync 同步其他副本在后台修改的配置, 有变化的任务重新调度
+func (s *Scheduler) sync() {
+	configs, err := s.configs(s.ctx)
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("sync job configs error: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.names {
+		j := s.jobs[name]
+		cron, timezone, enable := j.cron, j.timezone, j.enable
+		s.resolve(j, configs[name])
+		if j.cron == cron && j.timezone == timezone && j.enable == enable {
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("job %s config changed: cron %q, timezone %s, enable %v", name, j.cron, j.timezone, j.enable))
+		if err := s.schedule(j); err != nil {
+			s.logger.Error(fmt.Sprintf("%s Task Reschedule Error: %v", name, err))
+		}
+	}
+}
+
+func (s *Scheduler) configs(ctx context.Context) (map[string]*model.JobConfig, error) {
+	configs := make(map[string]*model.JobConfig)
+	list, err := s.repository.GetConfigs(ctx)
+	if err != nil {
+		return configs, err
+	}
+	for _, config := range list {
+		configs[config.Name] = config
+	}
+	return configs, nil
+}
+
+// resolve 按 后台配置 > 环境变量 > 默认值 的顺序设置任务配置, config 为 nil 表示后台未修改
+func (s *Scheduler) resolve(j *job, config *model.JobConfig) {
+	name := j.definition.Name
+	envCron, envTimezone, envEnable := commonConfig.GetJobEnv(envName(name))
+	j.cron = firstNonEmpty(envCron, j.definition.Cron)
+	j.timezone = firstNonEmpty(envTimezone, commonConfig.GetConfig().JobTimezone)
+	j.enable = true
+	if enable, err := strconv.ParseBool(envEnable); err == nil {
+		j.enable = enable
+	}
+	if config != nil {
+		j.cron = firstNonEmpty(config.Cron, j.cron)
+		j.timezone = firstNonEmpty(config.Timezone, j.timezone)
+		j.enable = config.Enable == 1
+	}
+	if err := ValidateSchedule(j.cron, j.timezone); err != nil {
+		s.logger.Error(fmt.Sprintf("job %s has invalid schedule %q (%s), use default: %v", name, j.cron, j.timezone, err))
+		j.cron, j.timezone = j.definition.Cron, "UTC"
+	}
+}
+
+// run 定时触发任务, 任务正在执行或已由其他副本执行时跳过; entry.LastRun 为本次 cron 计划的执行时间
+func (s *Scheduler) run(name string, trigger string, entry gocron.Job) {
+	scheduled := entry.LastRun()
+	if scheduled.IsZero() {
+		scheduled = time.Now()
+	}
+	lease, err := s.begin(s.ctx, name, trigger, scheduled)
+	if err != nil {
+		s.logger.Info(fmt.Sprintf("job %s skipped: %v", name, err))
+		return
+	}
+	s.execute(name, trigger, lease)
+}
+
+// begin 标记任务开始并获取租约, 同一任务不会并发执行
+func (s *Scheduler) begin(ctx context.Context, name string, trigger string, at time.Time) (*lease, error) {
+	s.mu.Lock()
+	j := s.jobs[name]
+	if j.running {
+		s.mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	j.running = true
+	s.mu.Unlock()
+
+	lease, err := s.acquire(ctx, name, trigger, at)
+	if err != nil {
+		s.mu.Lock()
+		j.running = false
+		s.mu.Unlock()
+		return nil, err
+	}
+	return lease, nil
+}
+
+// execute 持有租约执行任务并保存执行记录与明细, 返回本次执行记录
+func (s *Scheduler) execute(name string, trigger string, lease *lease) *model.JobRun {
+	j := s.jobs[name]
+	defer func() {
+		s.mu.Lock()
+		j.running = false
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	lease.keep(s.ctx, cancel)
+	defer lease.release(s.ctx)
+
+	// 持有租约时没有其他副本在执行, 之前未结束的执行已经中断; 未开启 JOB_LOCK 时由 Start 处理
+	if lease.locked {
+		s.interrupt(name)
+	}
+	run := &model.JobRun{Job: name, Trigger: trigger, Instance: s.instance, Status: model.JobStatusRunning, StartTime: time.Now()}
+	if err := s.repository.CreateRun(s.ctx, run); err != nil {
+		s.logger.Error(fmt.Sprintf("job %s CreateRun error: %v", name, err))
+	}
+	recorder := &recorder{job: name, runId: run.ID}
+
+	var err error
+	metrics.TimeJob(name, tracing.Job(name, s.logger, func(ctx context.Context) {
+		err = j.definition.Run(context.WithValue(ctx, recorderKey{}, recorder))
+	}))(ctx)
+	if lease.lost.Load() && err == nil {
+		err = errLeaseLost
+	}
+
+	recorder.finish(run, err)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("job %s failed: %v", name, err))
+	}
+	if run.ID == 0 {
+		return run
+	}
+	if err := s.repository.CreateItems(s.ctx, recorder.items); err != nil {
+		s.logger.Error(fmt.Sprintf("job %s CreateItems error: %v", name, err))
+	}
+	if err := s.repository.UpdateRun(s.ctx, run); err != nil {
+		s.logger.Error(fmt.Sprintf("job %s UpdateRun error: %v", name, err))
+	}
+	s.clean(s.ctx)
+	return run
+}
+
+// clean 每隔 cleanInterval 删除超过保留天数的执行记录
+func (s *Scheduler) clean(ctx context.Context) {
+	retention := commonConfig.GetConfig().JobRunRetention
+	if retention <= 0 {
+		return
+	}
+	s.mu.Lock()
+	if time.Since(s.cleanTime) < cleanInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.cleanTime = time.Now()
+	s.mu.Unlock()
+
+	if err := s.repository.DeleteRunsBefore(ctx, time.Now().AddDate(0, 0, -retention)); err != nil {
+		s.logger.Error(fmt.Sprintf("delete expired job runs error: %v", err))
+	}
+}
+
+// ValidateSchedule 校验 cron 表达式与时区
+func ValidateSchedule(cron string, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if _, err := gocron.NewScheduler(time.UTC).Cron(cronWithTimezone(cron, timezone)).Do(func() {}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	return nil
+}
+
+func cronWithTimezone(cron string, timezone string) string {
+	return fmt.Sprintf("CRON_TZ=%s %s", timezone, cron)
+}
+
+var upperCase = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// envName 任务名称转为环境变量中使用的名称, 例如 RefreshAllToken 转为 REFRESH_ALL_TOKEN
+func envName(name string) string {
+	return strings.ToUpper(upperCase.ReplaceAllString(name, "${1}_${2}"))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"PandoraFuclaudePlusHelper/internal/scheduler"
+	"PandoraFuclaudePlusHelper/internal/service"
+)
+
+// Admin 命令行管理使用的服务, 与接口共用同一套业务逻辑
+type Admin struct {
+	Migrate            *Migrate
+	LoginService       service.LoginService
+	UserService        service.UserService
+	OpenaiTokenService service.OpenaiTokenService
+	ClaudeTokenService service.ClaudeTokenService
+	Scheduler          *scheduler.Scheduler
+}
+
+// NewAdmin 依赖 Task 以便在调度器中注册全部任务
+func NewAdmin(migrate *Migrate, loginService service.LoginService, userService service.UserService,
+	openaiTokenService service.OpenaiTokenService, claudeTokenService service.ClaudeTokenService,
+	scheduler *scheduler.Scheduler, task *Task,
+) *Admin {
+	return &Admin{
+		Migrate:            migrate,
+		LoginService:       loginService,
+		UserService:        userService,
+		OpenaiTokenService: openaiTokenService,
+		ClaudeTokenService: claudeTokenService,
+		Scheduler:          scheduler,
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/pkg/certs"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/server/dispatch"
+	"PandoraFuclaudePlusHelper/pkg/server/http"
+	"PandoraFuclaudePlusHelper/pkg/server/reverse/claude"
+	"PandoraFuclaudePlusHelper/pkg/server/reverse/openai"
+	"bufio"
+	"net"
+	httpcore "net/http"
+	"strings"
+)
+
+// NewDispatchServer 创建单端口分发服务器, 按 Host 头或路径前缀将请求分发到管理后台、ChatGPT 反代或 Claude 反代
+func NewDispatchServer(
+	logger *log.Logger,
+	reloader *certs.Reloader,
+	httpServer *http.Server,
+	openaiServer *openai.Server,
+	claudeServer *claude.Server,
+) *dispatch.Server {
+	config := commonConfig.GetConfig()
+	router := &hostRouter{
+		apiHosts:     splitHostnames(config.ApiHostname),
+		openaiHosts:  splitHostnames(config.OpenAiHostname),
+		claudeHosts:  splitHostnames(config.ClaudeHostname),
+		openaiPrefix: normalizePathPrefix(config.OpenAiPathPrefix),
+		claudePrefix: normalizePathPrefix(config.ClaudePathPrefix),
+		api:          httpServer,
+		openai:       openaiServer,
+		claude:       claudeServer,
+	}
+
+	return dispatch.NewServer(
+		router,
+		logger,
+		dispatch.WithServerHost(config.HttpHost),
+		dispatch.WithServerPort(config.ApiPort),
+		dispatch.WithTLSConfig(reloader.TLSConfig()),
+	)
+}
+
+// hostRouter 按 Host 头优先、路径前缀其次的顺序选择处理器, 都未命中时交给管理后台
+//
+// 路径前缀只作用于请求路径与上游重定向的 Location, 不改写上游返回的页面与脚本:
+// 网页中的绝对路径(/_next/..., /backend-api/..., /api/...)不带前缀, 会落到管理后台, 且 /api 与管理后台的接口冲突,
+// 无法按路径可靠地区分。因此路径前缀只适用于直接调用接口的客户端, 浏览器访问反代的网页需要使用域名分发
+type hostRouter struct {
+	apiHosts     []string
+	openaiHosts  []string
+	claudeHosts  []string
+	openaiPrefix string
+	claudePrefix string
+	api          httpcore.Handler
+	openai       httpcore.Handler
+	claude       httpcore.Handler
+}
+
+func (r *hostRouter) ServeHTTP(w httpcore.ResponseWriter, req *httpcore.Request) {
+	host := requestHostname(req)
+	switch {
+	case matchHostname(r.openaiHosts, host):
+		r.openai.ServeHTTP(w, req)
+	case matchHostname(r.claudeHosts, host):
+		r.claude.ServeHTTP(w, req)
+	case matchHostname(r.apiHosts, host):
+		r.api.ServeHTTP(w, req)
+	case r.openaiPrefix != "" && hasPathPrefix(req.URL.Path, r.openaiPrefix):
+		r.openai.ServeHTTP(&prefixLocationWriter{ResponseWriter: w, prefix: r.openaiPrefix}, stripPathPrefix(req, r.openaiPrefix))
+	case r.claudePrefix != "" && hasPathPrefix(req.URL.Path, r.claudePrefix):
+		r.claude.ServeHTTP(&prefixLocationWriter{ResponseWriter: w, prefix: r.claudePrefix}, stripPathPrefix(req, r.claudePrefix))
+	default:
+		r.api.ServeHTTP(w, req)
+	}
+}
+
+// requestHostname 返回去掉端口后的小写 Host
+func requestHostname(req *httpcore.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// matchHostname 判断 Host 是否在配置的域名列表中, 支持 *.example.com 形式的通配
+func matchHostname(hostnames []string, host string) bool {
+	for _, hostname := range hostnames {
+		if hostname == host {
+			return true
+		}
+		if strings.HasPrefix(hostname, "*.") && strings.HasSuffix(host, hostname[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitHostnames 解析逗号分隔的域名列表
+func splitHostnames(value string) []string {
+	var hostnames []string
+	for _, hostname := range strings.Split(value, ",") {
+		hostname = strings.ToLower(strings.TrimSpace(hostname))
+		if hostname != "" {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	return hostnames
+}
+
+// normalizePathPrefix 规范化路径前缀为 /prefix 的形式
+func normalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+func hasPathPrefix(path string, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// stripPathPrefix 去掉路径前缀后再交给反向代理, 使上游看到原始路径
+func stripPathPrefix(req *httpcore.Request, prefix string) *httpcore.Request {
+	r := req.Clone(req.Context())
+	r.URL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+	if r.URL.Path == "" {
+		r.URL.Path = "/"
+	}
+	if req.URL.RawPath != "" {
+		r.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefix)
+	}
+	r.RequestURI = r.URL.RequestURI()
+	return r
+}
+
+// prefixLocationWriter 上游重定向到本站的绝对路径时补上路径前缀, 否则重定向后的请求会落到管理后台
+type prefixLocationWriter struct {
+	httpcore.ResponseWriter
+	prefix      string
+	wroteHeader bool
+}
+
+func (w *prefixLocationWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if location := w.Header().Get("Location"); strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+			w.Header().Set("Location", w.prefix+location)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *prefixLocationWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(httpcore.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 流式响应需要逐块发送
+func (w *prefixLocationWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(httpcore.StatusOK)
+	}
+	_ = httpcore.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack WebSocket 等协议升级需要接管连接
+func (w *prefixLocationWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return httpcore.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *prefixLocationWriter) Unwrap() httpcore.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	httpcore "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// namedHandler 返回处理器名称与收到的路径, 路径为 /redirect 时重定向到 /login
+func namedHandler(name string) httpcore.Handler {
+	return httpcore.HandlerFunc(func(w httpcore.ResponseWriter, r *httpcore.Request) {
+		w.Header().Set("X-Handler", name)
+		w.Header().Set("X-Path", r.URL.Path)
+		if r.URL.Path == "/redirect" {
+			httpcore.Redirect(w, r, "/login?next=%2F", httpcore.StatusFound)
+			return
+		}
+		w.WriteHeader(httpcore.StatusOK)
+	})
+}
+
+func TestHostRouter(t *testing.T) {
+	router := &hostRouter{
+		apiHosts:     splitHostnames("admin.example.com"),
+		openaiHosts:  splitHostnames("chat.example.com"),
+		claudeHosts:  splitHostnames("*.claude.example.com"),
+		openaiPrefix: normalizePathPrefix("openai/"),
+		claudePrefix: normalizePathPrefix("/claude"),
+		api:          namedHandler("api"),
+		openai:       namedHandler("openai"),
+		claude:       namedHandler("claude"),
+	}
+	tests := []struct {
+		name         string
+		host         string
+		path         string
+		wantHandler  string
+		wantPath     string
+		wantLocation string
+	}{
+		{name: "openai host", host: "chat.example.com:8181", path: "/backend-api/me", wantHandler: "openai", wantPath: "/backend-api/me"},
+		{name: "claude wildcard host", host: "a.claude.example.com", path: "/api/bootstrap", wantHandler: "claude", wantPath: "/api/bootstrap"},
+		{name: "admin host ignores prefix", host: "admin.example.com", path: "/openai/x", wantHandler: "api", wantPath: "/openai/x"},
+		{name: "openai prefix stripped", host: "example.com", path: "/openai/backend-api/me", wantHandler: "openai", wantPath: "/backend-api/me"},
+		{name: "prefix root", host: "example.com", path: "/claude", wantHandler: "claude", wantPath: "/"},
+		{name: "prefix needs separator", host: "example.com", path: "/openaix", wantHandler: "api", wantPath: "/openaix"},
+		{name: "unprefixed path goes to admin", host: "example.com", path: "/_next/static/app.js", wantHandler: "api", wantPath: "/_next/static/app.js"},
+		{name: "redirect gets prefix", host: "example.com", path: "/claude/redirect", wantHandler: "claude", wantPath: "/redirect", wantLocation: "/claude/login?next=%2F"},
+		{name: "redirect without prefix on host", host: "chat.example.com", path: "/redirect", wantHandler: "openai", wantPath: "/redirect", wantLocation: "/login?next=%2F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(httpcore.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if got := rec.Header().Get("X-Handler"); got != tt.wantHandler {
+				t.Errorf("handler = %s, want %s", got, tt.wantHandler)
+			}
+			if got := rec.Header().Get("X-Path"); got != tt.wantPath {
+				t.Errorf("path = %s, want %s", got, tt.wantPath)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("location = %s, want %s", got, tt.wantLocation)
+			}
+		})
+	}
+}
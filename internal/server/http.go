@@ -4,10 +4,14 @@ import (
 	"PandoraFuclaudePlusHelper"
 	commonConfig "PandoraFuclaudePlusHelper/config"
 	"PandoraFuclaudePlusHelper/internal/handler"
+	"PandoraFuclaudePlusHelper/internal/metrics"
 	"PandoraFuclaudePlusHelper/internal/middleware"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"PandoraFuclaudePlusHelper/pkg/certs"
 	"PandoraFuclaudePlusHelper/pkg/jwt"
 	"PandoraFuclaudePlusHelper/pkg/log"
 	"PandoraFuclaudePlusHelper/pkg/server/http"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"github.com/gin-contrib/static"
 	"github.com/gin-gonic/gin"
 	httpcore "net/http"
@@ -17,12 +21,22 @@ import (
 func NewHTTPServer(
 	logger *log.Logger,
 	jwt *jwt.JWT,
+	settings *service.Settings,
+	reloader *certs.Reloader,
 	loginHandler *handler.LoginHandler,
 	openaiAccountHandler *handler.OpenaiAccountHandler,
 	openaiTokenHandler *handler.OpenaiTokenHandler,
 	userHandler *handler.UserHandler,
 	claudeTokenHandler *handler.ClaudeTokenHandler,
 	claudeAccountHandler *handler.ClaudeAccountHandler,
+	moderationRuleHandler *handler.ModerationRuleHandler,
+	moderationEventHandler *handler.ModerationEventHandler,
+	strikeHandler *handler.StrikeHandler,
+	jobHandler *handler.JobHandler,
+	settingHandler *handler.SettingHandler,
+	backupHandler *handler.BackupHandler,
+	reconcileHandler *handler.ReconcileHandler,
+	metricsCollector *MetricsCollector,
 ) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
 	s := http.NewServer(
@@ -30,8 +44,16 @@ func NewHTTPServer(
 		logger,
 		http.WithServerHost(commonConfig.GetConfig().HttpHost),
 		http.WithServerPort(commonConfig.GetConfig().ApiPort),
+		http.WithTLSConfig(reloader.TLSConfig()),
 	)
 
+	// 让 service 通过 gin.Context 读取到请求上下文中的 span 与日志
+	s.ContextWithFallback = true
+	s.Use(tracing.Middleware(logger, commonConfig.GetConfig().OtelServiceName, false)...)
+	s.Use(metrics.Middleware(metrics.ProductApi))
+	// 数据库统计指标由 metricsCollector 在抓取时生成
+	s.GET("/metrics", metrics.Handler(commonConfig.GetConfig().MetricsToken))
+
 	s.Use(static.Serve("/", static.EmbedFolder(PandoraFuclaudePlusHelper.EmbedFrontendFS, "frontend/dist")))
 
 	v1 := s.Group("/api")
@@ -53,7 +75,7 @@ func NewHTTPServer(
 			})
 		}
 
-		userAuthRouter := v1.Group("/user").Use(middleware.StrictAuth(jwt, logger))
+		userAuthRouter := v1.Group("/user").Use(middleware.StrictAuth(jwt, settings, logger))
 		{
 			userAuthRouter.POST("/add", userHandler.CreateUser)
 			// userAuthRouter.POST("/refresh", openaiTokenHandler.RefreshToken)
@@ -62,7 +84,7 @@ func NewHTTPServer(
 			userAuthRouter.POST("/update", userHandler.UpdateUser)
 		}
 
-		tokenAuthRouter := v1.Group("/openai-token").Use(middleware.StrictAuth(jwt, logger))
+		tokenAuthRouter := v1.Group("/openai-token").Use(middleware.StrictAuth(jwt, settings, logger))
 		{
 			tokenAuthRouter.POST("/add", openaiTokenHandler.CreateToken)
 			tokenAuthRouter.POST("/refresh", openaiTokenHandler.RefreshToken)
@@ -71,7 +93,7 @@ func NewHTTPServer(
 			tokenAuthRouter.POST("/update", openaiTokenHandler.UpdateToken)
 		}
 
-		accountAuthRouter := v1.Group("/openai-account").Use(middleware.StrictAuth(jwt, logger))
+		accountAuthRouter := v1.Group("/openai-account").Use(middleware.StrictAuth(jwt, settings, logger))
 		{
 			accountAuthRouter.POST("/add", openaiAccountHandler.CreateAccount)
 			accountAuthRouter.POST("/update", openaiAccountHandler.UpdateAccount)
@@ -82,7 +104,7 @@ func NewHTTPServer(
 			accountAuthRouter.POST("/enable", openaiAccountHandler.EnableAccount)
 		}
 
-		claudeTokenAuthRouter := v1.Group("/claude-token").Use(middleware.StrictAuth(jwt, logger))
+		claudeTokenAuthRouter := v1.Group("/claude-token").Use(middleware.StrictAuth(jwt, settings, logger))
 		{
 			claudeTokenAuthRouter.POST("/add", claudeTokenHandler.CreateToken)
 			// claudeTokenAuthRouter.POST("/refresh", claudeTokenHandler.RefreshToken)
@@ -91,7 +113,7 @@ func NewHTTPServer(
 			claudeTokenAuthRouter.POST("/update", claudeTokenHandler.UpdateToken)
 		}
 
-		claudeAccountAuthRouter := v1.Group("/claude-account").Use(middleware.StrictAuth(jwt, logger))
+		claudeAccountAuthRouter := v1.Group("/claude-account").Use(middleware.StrictAuth(jwt, settings, logger))
 		{
 			claudeAccountAuthRouter.POST("/add", claudeAccountHandler.CreateAccount)
 			claudeAccountAuthRouter.POST("/update", claudeAccountHandler.UpdateAccount)
@@ -101,6 +123,71 @@ func NewHTTPServer(
 			claudeAccountAuthRouter.POST("/disable", claudeAccountHandler.DisableAccount)
 			claudeAccountAuthRouter.POST("/enable", claudeAccountHandler.EnableAccount)
 		}
+
+		moderationRuleAuthRouter := v1.Group("/moderation-rule").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			moderationRuleAuthRouter.POST("/add", moderationRuleHandler.CreateRule)
+			moderationRuleAuthRouter.POST("/update", moderationRuleHandler.UpdateRule)
+			moderationRuleAuthRouter.POST("/delete", moderationRuleHandler.DeleteRule)
+			moderationRuleAuthRouter.POST("/search", moderationRuleHandler.SearchRule)
+		}
+
+		moderationEventAuthRouter := v1.Group("/moderation-event").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			moderationEventAuthRouter.POST("/search", moderationEventHandler.SearchEvent)
+			moderationEventAuthRouter.POST("/review", moderationEventHandler.ReviewEvent)
+			moderationEventAuthRouter.POST("/export", moderationEventHandler.ExportEvent)
+		}
+
+		strikePolicyAuthRouter := v1.Group("/strike-policy").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			strikePolicyAuthRouter.POST("/add", strikeHandler.CreatePolicy)
+			strikePolicyAuthRouter.POST("/update", strikeHandler.UpdatePolicy)
+			strikePolicyAuthRouter.POST("/delete", strikeHandler.DeletePolicy)
+			strikePolicyAuthRouter.POST("/search", strikeHandler.SearchPolicy)
+		}
+
+		strikeAuthRouter := v1.Group("/strike").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			strikeAuthRouter.POST("/search", strikeHandler.SearchStrike)
+			strikeAuthRouter.POST("/reset", strikeHandler.ResetStrike)
+			strikeAuthRouter.POST("/suspension", strikeHandler.SearchSuspension)
+			strikeAuthRouter.POST("/lift", strikeHandler.LiftSuspension)
+		}
+
+		jobAuthRouter := v1.Group("/job").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			jobAuthRouter.POST("/search", jobHandler.SearchJob)
+			jobAuthRouter.POST("/trigger", jobHandler.TriggerJob)
+			jobAuthRouter.POST("/pause", jobHandler.PauseJob)
+			jobAuthRouter.POST("/resume", jobHandler.ResumeJob)
+			jobAuthRouter.POST("/update", jobHandler.UpdateJob)
+			jobAuthRouter.POST("/runs", jobHandler.SearchRun)
+			jobAuthRouter.POST("/items", jobHandler.SearchItem)
+			jobAuthRouter.POST("/failing", jobHandler.SearchFailing)
+		}
+
+		settingAuthRouter := v1.Group("/setting").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			settingAuthRouter.POST("/search", settingHandler.SearchSetting)
+			settingAuthRouter.POST("/update", settingHandler.UpdateSetting)
+			settingAuthRouter.POST("/reset", settingHandler.ResetSetting)
+		}
+
+		backupAuthRouter := v1.Group("/backup").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			backupAuthRouter.POST("/search", backupHandler.SearchBackup)
+			backupAuthRouter.POST("/create", backupHandler.CreateBackup)
+			backupAuthRouter.POST("/download", backupHandler.DownloadBackup)
+			backupAuthRouter.POST("/delete", backupHandler.DeleteBackup)
+			backupAuthRouter.POST("/restore", backupHandler.RestoreBackup)
+		}
+
+		reconcileAuthRouter := v1.Group("/reconcile").Use(middleware.StrictAuth(jwt, settings, logger))
+		{
+			reconcileAuthRouter.POST("/search", reconcileHandler.SearchDrift)
+			reconcileAuthRouter.POST("/heal", reconcileHandler.HealDrift)
+		}
 	}
 
 	return s
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// subscriptionNames 订阅状态对应的标签, 与 OpenaiToken.PlusSubscription 一致
+var subscriptionNames = map[int]string{
+	0: "unknown",
+	1: "free",
+	2: "plus",
+}
+
+// MetricsCollector 在抓取 /metrics 时从数据库统计用户、Token 与账号的数量
+type MetricsCollector struct {
+	log                     *log.Logger
+	userRepository          repository.UserRepository
+	openaiTokenRepository   repository.OpenaiTokenRepository
+	openaiAccountRepository repository.OpenaiAccountRepository
+	claudeTokenRepository   repository.ClaudeTokenRepository
+	claudeAccountRepository repository.ClaudeAccountRepository
+
+	activeUsers      *prometheus.Desc
+	tokens           *prometheus.Desc
+	expiringAccounts *prometheus.Desc
+}
+
+func NewMetricsCollector(log *log.Logger,
+	userRepository repository.UserRepository,
+	openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
+	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository,
+) *MetricsCollector {
+	c := &MetricsCollector{
+		log:                     log,
+		userRepository:          userRepository,
+		openaiTokenRepository:   openaiTokenRepository,
+		openaiAccountRepository: openaiAccountRepository,
+		claudeTokenRepository:   claudeTokenRepository,
+		claudeAccountRepository: claudeAccountRepository,
+		activeUsers: prometheus.NewDesc("helper_active_users",
+			"启用且未过期的用户数", nil, nil),
+		tokens: prometheus.NewDesc("helper_tokens",
+			"Token 数量, 按产品与订阅状态统计", []string{"product", "subscription"}, nil),
+		expiringAccounts: prometheus.NewDesc("helper_accounts_expiring_7d",
+			"未来 7 天内到期的正常账号数", []string{"product"}, nil),
+	}
+	prometheus.MustRegister(c)
+	return c
+}
+
+func (c *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeUsers
+	ch <- c.tokens
+	ch <- c.expiringAccounts
+}
+
+func (c *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	now := time.Now()
+
+	if count, err := c.userRepository.CountActiveUser(ctx, now); err != nil {
+		c.log.Error(fmt.Sprintf("MetricsCollector CountActiveUser error: %v", err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.activeUsers, prometheus.GaugeValue, float64(count))
+	}
+
+	if counts, err := c.openaiTokenRepository.CountBySubscription(ctx); err != nil {
+		c.log.Error(fmt.Sprintf("MetricsCollector CountBySubscription error: %v", err))
+	} else {
+		for subscription, name := range subscriptionNames {
+			ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, float64(counts[subscription]), "openai", name)
+		}
+		for subscription, count := range counts {
+			if _, ok := subscriptionNames[subscription]; !ok {
+				ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, float64(count), "openai", strconv.Itoa(subscription))
+			}
+		}
+	}
+
+	if count, err := c.claudeTokenRepository.Count(ctx); err != nil {
+		c.log.Error(fmt.Sprintf("MetricsCollector Count ClaudeToken error: %v", err))
+	} else {
+		// Claude Token 没有订阅状态
+		ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, float64(count), "claude", "unknown")
+	}
+
+	later := now.Add(time.Hour * 24 * 7)
+	if count, err := c.openaiAccountRepository.CountExpiring(ctx, now, later); err != nil {
+		c.log.Error(fmt.Sprintf("MetricsCollector CountExpiring OpenaiAccount error: %v", err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.expiringAccounts, prometheus.GaugeValue, float64(count), "openai")
+	}
+	if count, err := c.claudeAccountRepository.CountExpiring(ctx, now, later); err != nil {
+		c.log.Error(fmt.Sprintf("MetricsCollector CountExpiring ClaudeAccount error: %v", err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.expiringAccounts, prometheus.GaugeValue, float64(count), "claude")
+	}
+}
@@ -1,39 +1,48 @@
 package server
 
 import (
-	"PandoraFuclaudePlusHelper/internal/model"
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/migration"
 	"PandoraFuclaudePlusHelper/pkg/log"
 	"context"
+	"fmt"
+
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
+// Migrate 启动服务前检查并执行数据库迁移
 type Migrate struct {
-	db  *gorm.DB
-	log *log.Logger
+	migrator *migration.Migrator
+	log      *log.Logger
 }
 
-func NewMigrate(db *gorm.DB, log *log.Logger) *Migrate {
+func NewMigrate(migrator *migration.Migrator, log *log.Logger) *Migrate {
 	return &Migrate{
-		db:  db,
-		log: log,
+		migrator: migrator,
+		log:      log,
 	}
 }
-func (m *Migrate) Start(ctx context.Context) error {
-	if err := m.db.AutoMigrate(
-		model.OpenaiAccount{},
-		model.OpenaiToken{},
-		model.User{},
-		model.ClaudeToken{},
-		model.ClaudeAccount{},
-	); err != nil {
-		m.log.Error("user migrate error", zap.Error(err))
+
+// Run 数据库结构比程序新时拒绝启动; 关闭自动迁移时, 存在未执行的迁移也拒绝启动
+func (m *Migrate) Run(ctx context.Context) error {
+	pending, err := m.migrator.Check(ctx)
+	if err != nil {
+		m.log.Error("migration check error", zap.Error(err))
 		return err
 	}
-	m.log.Info("AutoMigrate success")
-	return nil
-}
-func (m *Migrate) Stop(ctx context.Context) error {
-	m.log.Info("AutoMigrate stop")
+	if pending == 0 {
+		m.log.Info("database schema is up to date")
+		return nil
+	}
+	if !commonConfig.GetConfig().DatabaseAutoMigrate {
+		err := fmt.Errorf("%d pending migrations, run the migrate up command first", pending)
+		m.log.Error("migration check error", zap.Error(err))
+		return err
+	}
+	if err := m.migrator.Up(ctx, 0); err != nil {
+		m.log.Error("migrate error", zap.Error(err))
+		return err
+	}
+	m.log.Info("migrate success", zap.Int("applied", pending))
 	return nil
 }
@@ -2,10 +2,16 @@ package server
 
 import (
 	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
 	"PandoraFuclaudePlusHelper/internal/middleware"
+	"PandoraFuclaudePlusHelper/internal/service"
+	"PandoraFuclaudePlusHelper/pkg/certs"
+	"PandoraFuclaudePlusHelper/pkg/jwt"
 	"PandoraFuclaudePlusHelper/pkg/log"
 	"PandoraFuclaudePlusHelper/pkg/server/reverse/claude"
 	"PandoraFuclaudePlusHelper/pkg/server/reverse/openai"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/http/httputil"
@@ -15,26 +21,27 @@ import (
 // NewChatGPTReverseProxyServer 创建 ChatGPT 反向代理服务器
 func NewChatGPTReverseProxyServer(
 	logger *log.Logger,
+	reloader *certs.Reloader,
 	conversationLoggerMiddleware *middleware.ConversationLoggerMiddleware,
+	moderationMiddleware *middleware.ModerationMiddleware,
+	settings *service.Settings,
 ) *openai.Server {
 	r := gin.Default()
+	r.Use(tracing.Middleware(logger, commonConfig.GetConfig().OtelServiceName+"-openai", true)...)
+	r.Use(metrics.Middleware(metrics.ProductOpenai))
 
 	// 创建反向代理处理函数
-	proxyHandler := reverseProxy(commonConfig.GetConfig().OpenAiSite)
+	proxyHandler := reverseProxy(logger, metrics.ProductOpenai, commonConfig.GetConfig().OpenAiSite)
+	// 会话接口的回复可能被逐行改写(例如回复审查), 使用支持流式转换的代理
+	conversationHandler := middleware.CreateTransformProxyHandler(logger, metrics.ProductOpenai, commonConfig.GetConfig().OpenAiSite, middleware.ResponseTransform{})
+	// 按用户策略拦截文件上传与图片输入
+	r.Use(moderationMiddleware.OpenAiAttachmentPolicy())
 
-	if commonConfig.GetConfig().ModerationEnable() {
-		r.POST("/backend-api/conversation", middleware.OpenAiContentModerationMiddleware(logger), proxyHandler)
-	} else {
-		r.POST("/backend-api/conversation", proxyHandler)
-	}
+	// 未开启审查时审查中间件直接放行, 配置热更新后无需重启
+	r.POST("/backend-api/conversation", moderationMiddleware.OpenAiContentModeration(), conversationHandler)
 
-	if commonConfig.GetConfig().HiddenUserInfo {
-		// 为 /backend-api/me 设置处理器
-		r.GET("/backend-api/me", middleware.CreateProxyHandler(commonConfig.GetConfig().OpenAiSite, middleware.ProcessBackendApiMeResponse))
-	} else {
-		// 对于 /backend-api/me 的请求，直接使用反向代理
-		r.GET("/backend-api/me", proxyHandler)
-	}
+	// 开启隐藏用户信息时 /backend-api/me 替换用户信息，否则直接使用反向代理
+	r.GET("/backend-api/me", hiddenUserInfo(settings, middleware.CreateProxyHandler(logger, metrics.ProductOpenai, commonConfig.GetConfig().OpenAiSite, middleware.ProcessBackendApiMeResponse), proxyHandler))
 
 	// 处理所有请求
 	r.Use(func(c *gin.Context) {
@@ -58,6 +65,7 @@ func NewChatGPTReverseProxyServer(
 		logger,
 		openai.WithServerHost(commonConfig.GetConfig().HttpHost),
 		openai.WithServerPort(commonConfig.GetConfig().OpenAiPort),
+		openai.WithTLSConfig(reloader.TLSConfig()),
 	)
 
 	return s
@@ -66,17 +74,31 @@ func NewChatGPTReverseProxyServer(
 // NewClaudeReverseProxyServer 创建 Claude 反向代理服务器
 func NewClaudeReverseProxyServer(
 	logger *log.Logger,
+	reloader *certs.Reloader,
 	conversationLoggerMiddleware *middleware.ConversationLoggerMiddleware,
+	moderationMiddleware *middleware.ModerationMiddleware,
+	settings *service.Settings,
+	jwt *jwt.JWT,
 ) *claude.Server {
 	r := gin.Default()
+	r.Use(tracing.Middleware(logger, commonConfig.GetConfig().OtelServiceName+"-claude", true)...)
+	r.Use(metrics.Middleware(metrics.ProductClaude))
+	// 登录链接中的账号标识转为 cookie, 供审查记录识别用户
+	r.Use(middleware.ClaudeIdentity(jwt))
 
 	// 创建反向代理处理函数
-	proxyHandler := reverseProxy(commonConfig.GetConfig().ClaudeSite)
-
-	if commonConfig.GetConfig().ModerationEnable() {
-		r.POST("/api/organizations/:id1/chat_conversations/:id2/completion", middleware.ClaudeContentModerationMiddleware(logger), proxyHandler)
-	} else {
-		r.POST("/api/organizations/:id1/chat_conversations/:id2/completion", proxyHandler)
+	proxyHandler := reverseProxy(logger, metrics.ProductClaude, commonConfig.GetConfig().ClaudeSite)
+	// 对话接口的回复可能被逐行改写(例如回复审查), 使用支持流式转换的代理
+	completionHandler := middleware.CreateTransformProxyHandler(logger, metrics.ProductClaude, commonConfig.GetConfig().ClaudeSite, middleware.ResponseTransform{})
+	// 按用户策略拦截文件上传与图片输入, 并在上传时审查图片
+	r.Use(moderationMiddleware.ClaudeAttachmentPolicy())
+
+	r.POST("/api/organizations/:id1/chat_conversations/:id2/completion", moderationMiddleware.ClaudeContentModeration(), completionHandler)
+
+	// 为返回账号身份信息的接口设置处理器
+	hiddenHandler := hiddenUserInfo(settings, middleware.CreateProxyHandler(logger, metrics.ProductClaude, commonConfig.GetConfig().ClaudeSite, middleware.ProcessClaudeAccountResponse), proxyHandler)
+	for _, path := range middleware.ClaudeAccountPaths {
+		r.GET(path, hiddenHandler)
 	}
 
 	// 处理所有请求
@@ -87,15 +109,28 @@ func NewClaudeReverseProxyServer(
 		logger,
 		claude.WithServerHost(commonConfig.GetConfig().HttpHost),
 		claude.WithServerPort(commonConfig.GetConfig().ClaudePort),
+		claude.WithTLSConfig(reloader.TLSConfig()),
 	)
 
 	return s
 }
 
-// 创建反向代理处理函数
-func reverseProxy(target string) gin.HandlerFunc {
+// hiddenUserInfo 按隐藏用户信息的设置选择处理函数, 该设置可以在后台修改
+func hiddenUserInfo(settings *service.Settings, hidden gin.HandlerFunc, proxy gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if settings.HiddenUserInfo(c) {
+			hidden(c)
+		} else {
+			proxy(c)
+		}
+	}
+}
+
+// 创建反向代理处理函数, product 用于区分监控指标
+func reverseProxy(logger *log.Logger, product string, target string) gin.HandlerFunc {
 	parse, _ := url.Parse(target)
 	proxy := httputil.NewSingleHostReverseProxy(parse)
+	proxy.Transport = tracing.Transport(nil)
 
 	// 修改默认的Director函数
 	originalDirector := proxy.Director
@@ -104,6 +139,15 @@ func reverseProxy(target string) gin.HandlerFunc {
 		// 保持原始的Host头
 		req.Host = parse.Host
 	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		metrics.ObserveUpstream(product, resp)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		metrics.ObserveUpstreamError(product)
+		logger.WithContext(req.Context()).Error(fmt.Sprintf("reverse proxy %s error: %v", req.URL.Path, err))
+		w.WriteHeader(http.StatusBadGateway)
+	}
 
 	return func(c *gin.Context) {
 		proxy.ServeHTTP(c.Writer, c.Request)
@@ -1,20 +1,25 @@
 package server
 
 import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/metrics"
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/scheduler"
 	"PandoraFuclaudePlusHelper/internal/service"
 	"PandoraFuclaudePlusHelper/internal/util"
 	"PandoraFuclaudePlusHelper/pkg/log"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/go-co-op/gocron"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Task struct {
 	log                     *log.Logger
-	scheduler               *gocron.Scheduler
+	scheduler               *scheduler.Scheduler
 	openaiTokenRepository   repository.OpenaiTokenRepository
 	openaiAccountRepository repository.OpenaiAccountRepository
 	claudeTokenRepository   repository.ClaudeTokenRepository
@@ -22,16 +27,21 @@ type Task struct {
 	userRepository          repository.UserRepository
 	openaiAccountService    service.OpenaiAccountService
 	claudeAccountService    service.ClaudeAccountService
+	strikeService           service.StrikeService
+	backupService           service.BackupService
+	reconcileService        service.ReconcileService
 }
 
-func NewTask(log *log.Logger,
+func NewTask(log *log.Logger, scheduler *scheduler.Scheduler,
 	openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
 	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository,
 	userRepository repository.UserRepository,
 	openaiAccountService service.OpenaiAccountService, claudeAccountService service.ClaudeAccountService,
+	strikeService service.StrikeService, backupService service.BackupService, reconcileService service.ReconcileService,
 ) *Task {
-	return &Task{
+	t := &Task{
 		log:                     log,
+		scheduler:               scheduler,
 		openaiTokenRepository:   openaiTokenRepository,
 		openaiAccountRepository: openaiAccountRepository,
 		claudeTokenRepository:   claudeTokenRepository,
@@ -39,172 +49,286 @@ func NewTask(log *log.Logger,
 		userRepository:          userRepository,
 		openaiAccountService:    openaiAccountService,
 		claudeAccountService:    claudeAccountService,
+		strikeService:           strikeService,
+		backupService:           backupService,
+		reconcileService:        reconcileService,
 	}
+	t.register()
+	return t
 }
 
-func (t *Task) RefreshAllToken(ctx context.Context) {
-	t.log.Info("RefreshAllToken Start")
+// register 注册所有定时任务及其默认执行计划
+func (t *Task) register() {
+	t.scheduler.Register(&scheduler.Definition{
+		Name:        "RefreshAllToken",
+		Description: "刷新 OpenAI 的 Access Token 与 Share Token",
+		Cron:        "5 * * * *",
+		Run:         t.RefreshAllToken,
+	})
+	t.scheduler.Register(&scheduler.Definition{
+		Name:        "ResetLimit",
+		Description: "重置 Share Token 的使用次数限制",
+		Cron:        "15 0 * * *",
+		Run:         t.ResetLimit,
+	})
+	t.scheduler.Register(&scheduler.Definition{
+		Name:        "DisableUser",
+		Description: "禁用已过期的用户",
+		Cron:        "2-59/5 * * * *",
+		Run:         t.DisableUser,
+	})
+	t.scheduler.Register(&scheduler.Definition{
+		Name:        "LiftSuspension",
+		Description: "解除已到期的暂停",
+		Cron:        "* * * * *",
+		Run:         t.strikeService.LiftExpired,
+	})
+	t.scheduler.Register(&scheduler.Definition{
+		Name:        "Backup",
+		Description: "备份数据到 DATA_DIR/backups 并删除多余的旧备份",
+		Cron:        "30 3 * * *",
+		Run:         t.Backup,
+	})
+	t.scheduler.Register(&scheduler.Definition{
+		Name:        "Reconcile",
+		Description: "核对 OpenAI 账号与上游的共享令牌, 记录差异并按配置自动修复",
+		Cron:        "40 * * * *",
+		Run:         t.reconcileService.Reconcile,
+	})
+}
+
+func (t *Task) Backup(ctx context.Context) error {
+	file, err := t.backupService.CreateBackup(ctx)
+	if err != nil {
+		return err
+	}
+	scheduler.RecordSuccess(ctx, model.JobItemBackup, 0, file.Name, fmt.Sprintf("%d bytes", file.Size))
+	return t.backupService.CleanBackups(ctx)
+}
+
+func (t *Task) RefreshAllToken(ctx context.Context) error {
+	t.log.WithContext(ctx).Info("RefreshAllToken Start")
 	tokens, err := t.openaiTokenRepository.GetAllToken(ctx)
 	if err != nil {
-		t.log.Error(fmt.Sprintf("RefreshAllToken GetAllToken error: %v", err))
+		t.log.WithContext(ctx).Error(fmt.Sprintf("RefreshAllToken GetAllToken error: %v", err))
+		return err
 	}
 	if len(tokens) == 0 {
-		t.log.Info("RefreshAllToken No token to refresh")
-		return
+		t.log.WithContext(ctx).Info("RefreshAllToken No token to refresh")
+		return nil
 	}
-	t.log.Info(fmt.Sprintf("RefreshAllToken Token: %v", tokens))
-	for _, token := range tokens {
-		t.refreshAccessToken(ctx, token)
-		t.refreshShareToken(ctx, token, false)
-	}
-	t.log.Info("RefreshAllToken Finish")
+	t.log.WithContext(ctx).Info(fmt.Sprintf("RefreshAllToken Token count: %d", len(tokens)))
+	// 先并行刷新所有的 Access Token, 再用新的 Access Token 并行刷新各账号的 Share Token
+	util.Parallel(ctx, commonConfig.GetConfig().RefreshWorkers, refreshTimeout(), tokens, t.refreshAccessToken)
+	t.refreshShareTokens(ctx, tokens, false)
+	t.log.WithContext(ctx).Info("RefreshAllToken Finish")
+	return nil
+}
+
+// refreshTimeout 单个 token 或账号的刷新超时时间
+func refreshTimeout() time.Duration {
+	return time.Duration(commonConfig.GetConfig().RefreshTimeout) * time.Second
 }
 
 func (t *Task) refreshAccessToken(ctx context.Context, token *model.OpenaiToken) {
-	t.log.Info(fmt.Sprintf("Refresh Token: %s", token.TokenName))
+	t.log.WithContext(ctx).Info(fmt.Sprintf("Refresh Token: %s", token.TokenName))
 	// 刷新订阅状态
-	plusSubscription := util.CheckSubscriptionStatus(token.AccessToken, t.log)
+	plusSubscription := util.CheckSubscriptionStatus(ctx, token.AccessToken, t.log)
 	token.PlusSubscription = plusSubscription
 
 	now := time.Now()
 	expireAt := token.ExpireAt
 	later := now.Add(time.Hour * 1)
+	var refreshErr error
 	if expireAt.After(later) {
-		t.log.Info(fmt.Sprintf("Token not expired: %s", token.TokenName))
+		metrics.ObserveTokenRefresh("access", metrics.ResultSkipped)
+		scheduler.RecordSkipped(ctx)
+		t.log.WithContext(ctx).Info(fmt.Sprintf("Token not expired: %s", token.TokenName))
 	} else {
 		// 如果Token过期时间在1小时之内，刷新Token
-		accessToken, expire, err := util.GenAccessToken(token.RefreshToken, t.log)
+		accessToken, expire, err := util.GenAccessToken(ctx, token.RefreshToken, t.log)
 		if err != nil {
-			t.log.Error(fmt.Sprintf("GenAccessToken error: %v", err))
+			// 刷新失败时保留原来的Token, 等待下次重试
+			metrics.ObserveTokenRefresh("access", metrics.ResultFailure)
+			t.log.WithContext(ctx).Error(fmt.Sprintf("GenAccessToken error: %v", err))
+			refreshErr = err
+		} else {
+			metrics.ObserveTokenRefresh("access", metrics.ResultSuccess)
+			token.AccessToken = accessToken
+			token.ExpireAt = now.Add(time.Second * time.Duration(expire))
 		}
-		token.AccessToken = accessToken
-		token.ExpireAt = now.Add(time.Second * time.Duration(expire))
 	}
 
 	token.UpdateTime = now
 	err := t.openaiTokenRepository.Update(ctx, token)
 	if err != nil {
-		t.log.Error(fmt.Sprintf("Update Token error: %v", err))
+		t.log.WithContext(ctx).Error(fmt.Sprintf("Update Token error: %v", err))
+		if refreshErr == nil {
+			refreshErr = err
+		}
+	}
+	switch {
+	case refreshErr != nil:
+		scheduler.RecordFailure(ctx, model.JobItemOpenaiToken, token.ID, token.TokenName, refreshErr)
+	case !expireAt.After(later):
+		scheduler.RecordSuccess(ctx, model.JobItemOpenaiToken, token.ID, token.TokenName,
+			fmt.Sprintf("expire at %s", token.ExpireAt.Format(time.DateTime)))
 	}
 }
 
-func (t *Task) refreshShareToken(ctx context.Context, token *model.OpenaiToken, resetLimit bool) {
-	accounts, err := t.openaiAccountRepository.SearchAccount(ctx, token.ID)
-	if err != nil {
-		t.log.Error(fmt.Sprintf("refreshShareToken SearchAccount error: %v", err))
-	}
-	if len(accounts) == 0 {
-		t.log.Info(fmt.Sprintf("No account to refresh: %s", token.TokenName))
-		return
+// refreshShareTokens 并行刷新 tokens 下所有账号的 Share Token
+func (t *Task) refreshShareTokens(ctx context.Context, tokens []*model.OpenaiToken, resetLimit bool) {
+	type accountTask struct {
+		token   *model.OpenaiToken
+		account *model.OpenaiAccount
 	}
-	for _, account := range accounts {
-		if account.Status == 0 {
-			t.log.Info(fmt.Sprintf("Account is disabled: %s", account.Account))
+	var tasks []accountTask
+	for _, token := range tokens {
+		accounts, err := t.openaiAccountRepository.SearchAccount(ctx, token.ID)
+		if err != nil {
+			t.log.WithContext(ctx).Error(fmt.Sprintf("refreshShareToken SearchAccount error: %v", err))
+		}
+		if len(accounts) == 0 {
+			t.log.WithContext(ctx).Info(fmt.Sprintf("No account to refresh: %s", token.TokenName))
 			continue
 		}
-		expireAt := account.ExpireAt
-		later := time.Now().Add(time.Hour * 1)
-		if expireAt.After(later) {
-			t.log.Info(fmt.Sprintf("ShareToken not expired: %s", account.Account))
-		} else {
-			// 如果Token过期时间在1小时之内，刷新Token
-			shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(token.AccessToken,
-				account.Account,
-				0,
-				account.Gpt35Limit,
-				account.Gpt4Limit,
-				account.Gpt4oLimit,
-				account.Gpt4oMiniLimit,
-				account.O1Limit,
-				account.O1MiniLimit,
-				account.ShowConversations == 1,
-				false,
-				resetLimit,
-				account.TemporaryChat == 1,
-				t.log)
-			if err != nil {
-				t.log.Error(fmt.Sprintf("refreshShareToken GenerateShareToken error: %v", err))
-				continue
-			}
-			account.ShareToken = shareToken
-			account.ShareTokenEncrypt = shareTokenEncrypt
-			account.ExpireAt = time.Unix(expireIn, 0)
+		for _, account := range accounts {
+			tasks = append(tasks, accountTask{token: token, account: account})
 		}
-		now := time.Now()
-		account.UpdateTime = now
-		err = t.openaiAccountRepository.Update(ctx, account)
+	}
+	util.Parallel(ctx, commonConfig.GetConfig().RefreshWorkers, refreshTimeout(), tasks, func(ctx context.Context, task accountTask) {
+		t.refreshShareToken(ctx, task.token, task.account, resetLimit)
+	})
+}
+
+func (t *Task) refreshShareToken(ctx context.Context, token *model.OpenaiToken, account *model.OpenaiAccount, resetLimit bool) {
+	if account.Status == 0 {
+		scheduler.RecordSkipped(ctx)
+		t.log.WithContext(ctx).Info(fmt.Sprintf("Account is disabled: %s", account.Account))
+		return
+	}
+	expireAt := account.ExpireAt
+	later := time.Now().Add(time.Hour * 1)
+	if expireAt.After(later) {
+		metrics.ObserveTokenRefresh("share", metrics.ResultSkipped)
+		scheduler.RecordSkipped(ctx)
+		t.log.WithContext(ctx).Info(fmt.Sprintf("ShareToken not expired: %s", account.Account))
+	} else {
+		// 如果Token过期时间在1小时之内，刷新Token
+		shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(ctx, token.AccessToken,
+			account.Account,
+			0,
+			account.Gpt35Limit,
+			account.Gpt4Limit,
+			account.Gpt4oLimit,
+			account.Gpt4oMiniLimit,
+			account.O1Limit,
+			account.O1MiniLimit,
+			account.ShowConversations == 1,
+			false,
+			resetLimit,
+			account.TemporaryChat == 1,
+			t.log)
 		if err != nil {
-			t.log.Error(fmt.Sprintf("refreshShareToken Update error: %v", err))
+			metrics.ObserveTokenRefresh("share", metrics.ResultFailure)
+			scheduler.RecordFailure(ctx, model.JobItemOpenaiAccount, account.ID, account.Account, err)
+			t.log.WithContext(ctx).Error(fmt.Sprintf("refreshShareToken GenerateShareToken error: %v", err))
+			return
 		}
+		metrics.ObserveTokenRefresh("share", metrics.ResultSuccess)
+		account.ShareToken = shareToken
+		account.ShareTokenEncrypt = shareTokenEncrypt
+		account.ExpireAt = time.Unix(expireIn, 0)
+	}
+	now := time.Now()
+	account.UpdateTime = now
+	err := t.openaiAccountRepository.Update(ctx, account)
+	if err != nil {
+		scheduler.RecordFailure(ctx, model.JobItemOpenaiAccount, account.ID, account.Account, err)
+		t.log.WithContext(ctx).Error(fmt.Sprintf("refreshShareToken Update error: %v", err))
+		return
+	}
+	if !expireAt.After(later) {
+		scheduler.RecordSuccess(ctx, model.JobItemOpenaiAccount, account.ID, account.Account,
+			fmt.Sprintf("expire at %s", account.ExpireAt.Format(time.DateTime)))
 	}
 }
 
-func (t *Task) ResetLimit(ctx context.Context) {
-	t.log.Info("ResetLimit Start")
+func (t *Task) ResetLimit(ctx context.Context) error {
+	t.log.WithContext(ctx).Info("ResetLimit Start")
 	tokens, err := t.openaiTokenRepository.GetAllToken(ctx)
 	if err != nil {
-		t.log.Error(fmt.Sprintf("ResetLimit GetAllToken error: %v", err))
+		t.log.WithContext(ctx).Error(fmt.Sprintf("ResetLimit GetAllToken error: %v", err))
+		return err
 	}
 	if len(tokens) == 0 {
-		t.log.Info("ResetLimit No token to reset")
-		return
+		t.log.WithContext(ctx).Info("ResetLimit No token to reset")
+		return nil
 	}
-	t.log.Info(fmt.Sprintf("ResetLimit Token count: %d", len(tokens)))
-	for _, token := range tokens {
-		t.refreshShareToken(ctx, token, true)
-	}
-	t.log.Info("ResetLimit Finish")
+	t.log.WithContext(ctx).Info(fmt.Sprintf("ResetLimit Token count: %d", len(tokens)))
+	t.refreshShareTokens(ctx, tokens, true)
+	t.log.WithContext(ctx).Info("ResetLimit Finish")
+	return nil
 }
 
-func (t *Task) DisableUser(ctx context.Context) {
-	t.log.Info("DisableUser Start")
+func (t *Task) DisableUser(ctx context.Context) error {
+	t.log.WithContext(ctx).Info("DisableUser Start")
 	users, err := t.userRepository.GetAllUser(ctx)
 	if err != nil {
-		t.log.Error(fmt.Sprintf("GetAllUser error: %v", err))
-		return
+		t.log.WithContext(ctx).Error(fmt.Sprintf("GetAllUser error: %v", err))
+		return err
 	}
 	if len(users) == 0 {
-		t.log.Info("No user to disable")
-		return
+		t.log.WithContext(ctx).Info("No user to disable")
+		return nil
 	}
-	t.log.Info(fmt.Sprintf("DisableUser Users count: %d", len(users)))
+	t.log.WithContext(ctx).Info(fmt.Sprintf("DisableUser Users count: %d", len(users)))
 
 	now := time.Now()
 
 	for _, user := range users {
 		if user.Enable == 0 {
-			t.log.Info(fmt.Sprintf("User already disabled: %s", user.UniqueName))
+			scheduler.RecordSkipped(ctx)
+			t.log.WithContext(ctx).Info(fmt.Sprintf("User already disabled: %s", user.UniqueName))
 			continue
 		}
 		// 判断是否超过了有效期
 		if user.ExpirationTime.After(now) {
-			t.log.Info(fmt.Sprintf("User not yet expired: %s", user.UniqueName))
+			scheduler.RecordSkipped(ctx)
+			t.log.WithContext(ctx).Info(fmt.Sprintf("User not yet expired: %s", user.UniqueName))
 			continue
 		}
-		// 查询这个用户关联的openai账户
+		// 用户可能只开通了其中一种账号, 未开通的账号不存在;
+		// 账号禁用失败时不禁用用户, 下次执行时重试
 		openaiAccount, err := t.openaiAccountRepository.GetAccountByUserId(ctx, user.ID)
-		if err != nil {
-			t.log.Error(fmt.Sprintf("DisableUser GetAccountByUserId error: %v", err))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			scheduler.RecordFailure(ctx, model.JobItemUser, user.ID, user.UniqueName, err)
+			t.log.WithContext(ctx).Error(fmt.Sprintf("DisableUser GetAccountByUserId error: %v", err))
 			continue
 		}
-		if openaiAccount != nil && openaiAccount.Status == 1 {
+		if err == nil && openaiAccount.Status == 1 {
 			// 禁用掉这个账户
 			err = t.openaiAccountService.DisableAccount(ctx, openaiAccount.ID)
 			if err != nil {
-				t.log.Error(fmt.Sprintf("DisableOpenaiAccount error: %v", err))
+				scheduler.RecordFailure(ctx, model.JobItemOpenaiAccount, openaiAccount.ID, openaiAccount.Account, err)
+				t.log.WithContext(ctx).Error(fmt.Sprintf("DisableOpenaiAccount error: %v", err))
+				continue
 			}
 		}
 		// 查询这个用户的 claude 账户
 		claudeAccount, err := t.claudeAccountRepository.GetAccountByUserId(ctx, user.ID)
-		if err != nil {
-			t.log.Error(fmt.Sprintf("DisableUser GetAccountByUserId error: %v", err))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			scheduler.RecordFailure(ctx, model.JobItemUser, user.ID, user.UniqueName, err)
+			t.log.WithContext(ctx).Error(fmt.Sprintf("DisableUser GetAccountByUserId error: %v", err))
 			continue
 		}
-		if claudeAccount != nil && claudeAccount.Status == 1 {
+		if err == nil && claudeAccount.Status == 1 {
 			// 禁用掉这个账户
 			err = t.claudeAccountService.DisableAccount(ctx, claudeAccount.ID)
 			if err != nil {
-				t.log.Error(fmt.Sprintf("DisableClaudeAccount error: %v", err))
+				scheduler.RecordFailure(ctx, model.JobItemClaudeAccount, claudeAccount.ID, claudeAccount.Account, err)
+				t.log.WithContext(ctx).Error(fmt.Sprintf("DisableClaudeAccount error: %v", err))
+				continue
 			}
 		}
 		user.Enable = 0
@@ -213,60 +337,21 @@ func (t *Task) DisableUser(ctx context.Context) {
 		user.UpdateTime = now
 		err = t.userRepository.Update(ctx, user)
 		if err != nil {
-			t.log.Error(fmt.Sprintf("DisableUser Update error: %v", err))
+			scheduler.RecordFailure(ctx, model.JobItemUser, user.ID, user.UniqueName, err)
+			t.log.WithContext(ctx).Error(fmt.Sprintf("DisableUser Update error: %v", err))
+			continue
 		}
+		scheduler.RecordSuccess(ctx, model.JobItemUser, user.ID, user.UniqueName,
+			fmt.Sprintf("expired at %s", user.ExpirationTime.Format(time.DateTime)))
 	}
 
-	t.log.Info("DisableUser Finish")
-}
-
-func (t *Task) disableAndLogAccount(ctx context.Context, token *model.OpenaiToken, account *model.OpenaiAccount, now time.Time) error {
-	_, _, _, err := util.GenShareToken(token.AccessToken,
-		account.Account,
-		-1,
-		account.Gpt35Limit,
-		account.Gpt4Limit,
-		account.Gpt4oLimit,
-		account.Gpt4oMiniLimit,
-		account.O1Limit,
-		account.O1MiniLimit,
-		account.ShowConversations == 1,
-		false,
-		false,
-		account.TemporaryChat == 1,
-		t.log)
-	if err != nil {
-		return err
-	}
-	account.Status = 0
-	account.ExpireAt = now
-	account.UpdateTime = now
-	return t.openaiAccountRepository.Update(ctx, account)
+	t.log.WithContext(ctx).Info("DisableUser Finish")
+	return nil
 }
 
 func (t *Task) Start(ctx context.Context) error {
-	gocron.SetPanicHandler(func(jobName string, recoverData interface{}) {
-		t.log.Error(fmt.Sprintf("Task Panic job: %s, %v", jobName, recoverData))
-	})
-
-	t.scheduler = gocron.NewScheduler(time.UTC)
-
-	_, err := t.scheduler.Cron("5 * * * *").Do(t.RefreshAllToken, ctx)
-	if err != nil {
-		t.log.Error(fmt.Sprintf("RefreshAllToken Task Start Error: %v", err))
-	}
-
-	_, err = t.scheduler.Cron("15 0 * * *").Do(t.ResetLimit, ctx)
-	if err != nil {
-		t.log.Error(fmt.Sprintf("ResetLimit Task Start Error: %v", err))
-	}
-
-	_, err = t.scheduler.Cron("2-59/5 * * * *").Do(t.DisableUser, ctx)
-	if err != nil {
-		t.log.Error(fmt.Sprintf("DisableUser Task Start Error: %v", err))
-	}
-
-	t.scheduler.StartBlocking()
+	t.scheduler.Start(ctx)
+	<-ctx.Done()
 	return nil
 }
 
@@ -0,0 +1,133 @@
+package server
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/pkg/certs"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewCertReloader 根据配置创建证书热加载器, 未配置证书时返回 nil, 各服务保持 HTTP 监听
+func NewCertReloader(logger *log.Logger) *certs.Reloader {
+	config := commonConfig.GetConfig()
+	if !config.TlsEnable() {
+		return nil
+	}
+
+	opts := []certs.Option{
+		certs.WithInterval(time.Duration(config.TlsReloadInterval) * time.Second),
+	}
+	if config.TlsCertFile != "" && config.TlsKeyFile != "" {
+		opts = append(opts, certs.WithDefaultCertificate(config.TlsCertFile, config.TlsKeyFile))
+	}
+	items, err := parseTlsCerts(config.TlsCerts)
+	if err != nil {
+		logger.Sugar().Fatal(err)
+	}
+	for _, item := range items {
+		opts = append(opts, certs.WithCertificate(item.host, item.certFile, item.keyFile))
+	}
+
+	reloader, err := certs.NewReloader(logger, opts...)
+	if err != nil {
+		logger.Sugar().Fatalf("load certificate error: %v", err)
+	}
+	return reloader
+}
+
+type tlsCertItem struct {
+	host     string
+	certFile string
+	keyFile  string
+}
+
+// parseTlsCerts 解析 TLS_CERTS, 格式: 域名|证书路径|私钥路径, 多个之间用逗号分隔
+//
+// 路径中可能包含冒号(例如 Windows 的盘符), 因此用 | 分隔; 不含 | 时兼容旧的冒号格式, 此时路径中不能包含冒号
+func parseTlsCerts(value string) ([]tlsCertItem, error) {
+	var items []tlsCertItem
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		separator := "|"
+		if !strings.Contains(item, separator) {
+			separator = ":"
+		}
+		parts := strings.Split(item, separator)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid TLS_CERTS item: %s", item)
+		}
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+			if parts[i] == "" {
+				return nil, fmt.Errorf("invalid TLS_CERTS item: %s", item)
+			}
+		}
+		items = append(items, tlsCertItem{host: parts[0], certFile: parts[1], keyFile: parts[2]})
+	}
+	return items, nil
+}
+
+// HttpsRedirect 将 HTTP 请求重定向到 HTTPS
+type HttpsRedirect struct {
+	log     *log.Logger
+	httpSrv *http.Server
+}
+
+func NewHttpsRedirect(log *log.Logger) *HttpsRedirect {
+	return &HttpsRedirect{
+		log: log,
+	}
+}
+
+func (r *HttpsRedirect) Start(ctx context.Context) error {
+	config := commonConfig.GetConfig()
+	r.httpSrv = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", config.HttpHost, config.TlsRedirectPort),
+		Handler: http.HandlerFunc(r.redirect),
+	}
+	if err := r.httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		r.log.Sugar().Fatalf("listen: %s\n", err)
+	}
+	return nil
+}
+
+func (r *HttpsRedirect) Stop(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.httpSrv.Shutdown(ctx); err != nil {
+		r.log.Error(fmt.Sprintf("HttpsRedirect shutdown error: %v", err))
+	}
+	r.log.Info("HttpsRedirect stop")
+	return nil
+}
+
+// redirect 重定向到 HTTPS, 多端口模式下按配置的域名选择对应服务的端口
+func (r *HttpsRedirect) redirect(w http.ResponseWriter, req *http.Request) {
+	config := commonConfig.GetConfig()
+	host := requestHostname(req)
+
+	port := config.ApiPort
+	if !config.SinglePort {
+		switch {
+		case matchHostname(splitHostnames(config.OpenAiHostname), host):
+			port = config.OpenAiPort
+		case matchHostname(splitHostnames(config.ClaudeHostname), host):
+			port = config.ClaudePort
+		}
+	}
+	if port != 443 {
+		host = net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	}
+
+	target := "https://" + host + req.URL.RequestURI()
+	http.Redirect(w, req, target, http.StatusPermanentRedirect)
+}
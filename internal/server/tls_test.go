@@ -0,0 +1,42 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTlsCerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []tlsCertItem
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "pipe", value: "chat.example.com|/data/chat.pem|/data/chat.key",
+			want: []tlsCertItem{{host: "chat.example.com", certFile: "/data/chat.pem", keyFile: "/data/chat.key"}}},
+		{name: "windows paths", value: `chat.example.com|C:\certs\chat.pem|C:\certs\chat.key`,
+			want: []tlsCertItem{{host: "chat.example.com", certFile: `C:\certs\chat.pem`, keyFile: `C:\certs\chat.key`}}},
+		{name: "legacy colon", value: "chat.example.com:/data/chat.pem:/data/chat.key",
+			want: []tlsCertItem{{host: "chat.example.com", certFile: "/data/chat.pem", keyFile: "/data/chat.key"}}},
+		{name: "multiple with spaces", value: " a.example.com|/a.pem|/a.key , ,*.b.example.com | /b.pem | /b.key",
+			want: []tlsCertItem{
+				{host: "a.example.com", certFile: "/a.pem", keyFile: "/a.key"},
+				{host: "*.b.example.com", certFile: "/b.pem", keyFile: "/b.key"},
+			}},
+		{name: "colon in legacy path", value: `chat.example.com:C:\chat.pem:C:\chat.key`, wantErr: true},
+		{name: "missing key", value: "chat.example.com|/data/chat.pem", wantErr: true},
+		{name: "empty field", value: "chat.example.com||/data/chat.key", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTlsCerts(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTlsCerts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTlsCerts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -13,14 +13,15 @@ type Coordinator struct {
 
 func NewServiceCoordinator(service *Service,
 	openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
-	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository) *Coordinator {
+	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository,
+	strikeRepository repository.StrikeRepository) *Coordinator {
 	coordinator := &Coordinator{}
 
 	openaiTokenSvc := NewOpenaiTokenService(service, openaiTokenRepository, openaiAccountRepository, coordinator)
-	openaiAccountSvc := NewOpenaiAccountService(service, openaiTokenRepository, openaiAccountRepository, coordinator)
+	openaiAccountSvc := NewOpenaiAccountService(service, openaiTokenRepository, openaiAccountRepository, strikeRepository, coordinator)
 
 	claudeTokenSvc := NewClaudeTokenService(service, claudeTokenRepository, claudeAccountRepository, coordinator)
-	claudeAccountSvc := NewClaudeAccountService(service, claudeTokenRepository, claudeAccountRepository, coordinator)
+	claudeAccountSvc := NewClaudeAccountService(service, claudeTokenRepository, claudeAccountRepository, strikeRepository, coordinator)
 
 	coordinator.OpenaiTokenSvc = openaiTokenSvc
 	coordinator.OpenaiAccountSvc = openaiAccountSvc
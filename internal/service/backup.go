@@ -0,0 +1,322 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/backup"
+	"PandoraFuclaudePlusHelper/internal/moderation"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// backupBatch 导出与恢复时每批处理的行数
+const backupBatch = 200
+
+var backupNamePattern = regexp.MustCompile(`^backup-\d{8}-\d{6}(-[a-z0-9-]+)?\.zip$`)
+
+type BackupService interface {
+	SearchBackup(ctx context.Context) ([]*v1.BackupFile, error)
+	CreateBackup(ctx context.Context) (*v1.BackupFile, error)
+	// BackupPath 返回备份文件的路径, 名称不合法或文件不存在时返回 ErrNotFound
+	BackupPath(ctx context.Context, name string) (string, error)
+	DeleteBackup(ctx context.Context, name string) error
+	// RestoreBackup 校验备份文件后覆盖当前数据, 覆盖前自动备份当前数据
+	RestoreBackup(ctx context.Context, path string) error
+	// CleanBackups 按 BACKUP_KEEP 删除多余的旧备份
+	CleanBackups(ctx context.Context) error
+}
+
+func NewBackupService(service *Service, backupRepository repository.BackupRepository,
+	settingRepository repository.SettingRepository, manager *moderation.Manager) BackupService {
+	return &backupService{
+		Service:           service,
+		backupRepository:  backupRepository,
+		settingRepository: settingRepository,
+		manager:           manager,
+	}
+}
+
+type backupService struct {
+	*Service
+	backupRepository  repository.BackupRepository
+	settingRepository repository.SettingRepository
+	manager           *moderation.Manager
+	// mu 备份与恢复同一时间只执行一个
+	mu sync.Mutex
+}
+
+func backupDir() string {
+	return filepath.Join(commonConfig.GetConfig().DataDir, "backups")
+}
+
+func (s *backupService) SearchBackup(ctx context.Context) ([]*v1.BackupFile, error) {
+	ctx, span := tracing.Start(ctx, "BackupService.SearchBackup")
+	defer span.End()
+
+	files, err := listBackups()
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchBackup error", zap.Any("err", err))
+		return nil, v1.ErrInternalServerError
+	}
+	return files, nil
+}
+
+// listBackups 按创建时间倒序列出备份文件
+func listBackups() ([]*v1.BackupFile, error) {
+	entries, err := os.ReadDir(backupDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*v1.BackupFile{}, nil
+		}
+		return nil, err
+	}
+	files := make([]*v1.BackupFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, &v1.BackupFile{
+			Name:       entry.Name(),
+			Size:       info.Size(),
+			CreateTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreateTime.After(files[j].CreateTime)
+	})
+	return files, nil
+}
+
+func (s *backupService) CreateBackup(ctx context.Context) (*v1.BackupFile, error) {
+	ctx, span := tracing.Start(ctx, "BackupService.CreateBackup")
+	defer span.End()
+
+	if !s.mu.TryLock() {
+		return nil, v1.ErrBackupRunning
+	}
+	defer s.mu.Unlock()
+	file, err := s.createBackup(ctx, "")
+	if err != nil {
+		s.logger.WithContext(ctx).Error("CreateBackup error", zap.Any("err", err))
+		return nil, v1.ErrInternalServerError
+	}
+	return file, nil
+}
+
+// createBackup 在只读事务中导出所有数据表, 先写入临时文件, 完成后再改名, 避免留下不完整的备份
+func (s *backupService) createBackup(ctx context.Context, suffix string) (*v1.BackupFile, error) {
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	config := commonConfig.GetConfig()
+	now := time.Now()
+	err = s.backupRepository.Snapshot(ctx, func(ctx context.Context) error {
+		schemaVersion, err := s.backupRepository.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		w := backup.NewWriter(tmp, &backup.Manifest{
+			AppVersion:    config.Version,
+			SchemaVersion: schemaVersion,
+			Driver:        config.DatabaseDriver,
+			CreateTime:    now,
+		})
+		for _, table := range backup.Tables {
+			tw, err := w.Table(table.TableName())
+			if err != nil {
+				return err
+			}
+			if err := s.backupRepository.ExportTable(ctx, table, backupBatch, tw.Write); err != nil {
+				return fmt.Errorf("export %s: %w", table.TableName(), err)
+			}
+		}
+		return w.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	base := "backup-" + now.Format("20060102-150405")
+	if suffix != "" {
+		base += "-" + suffix
+	}
+	name := base + ".zip"
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			break
+		}
+		name = fmt.Sprintf("%s-%d.zip", base, i)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.WithContext(ctx).Info("backup created", zap.String("name", name), zap.Int64("size", info.Size()))
+	return &v1.BackupFile{Name: name, Size: info.Size(), CreateTime: info.ModTime()}, nil
+}
+
+func (s *backupService) BackupPath(ctx context.Context, name string) (string, error) {
+	if !backupNamePattern.MatchString(name) {
+		return "", v1.ErrNotFound
+	}
+	path := filepath.Join(backupDir(), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", v1.ErrNotFound
+	}
+	return path, nil
+}
+
+func (s *backupService) DeleteBackup(ctx context.Context, name string) error {
+	ctx, span := tracing.Start(ctx, "BackupService.DeleteBackup")
+	defer span.End()
+
+	path, err := s.BackupPath(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		s.logger.WithContext(ctx).Error("DeleteBackup error", zap.Any("err", err))
+		return v1.ErrInternalServerError
+	}
+	return nil
+}
+
+func (s *backupService) RestoreBackup(ctx context.Context, path string) error {
+	ctx, span := tracing.Start(ctx, "BackupService.RestoreBackup")
+	defer span.End()
+
+	if !s.mu.TryLock() {
+		return v1.ErrBackupRunning
+	}
+	defer s.mu.Unlock()
+
+	r, err := backup.Open(path)
+	if err != nil {
+		s.logger.WithContext(ctx).Warn("invalid backup", zap.Error(err))
+		return v1.ErrInvalidBackup
+	}
+	defer r.Close()
+	schemaVersion, err := s.backupRepository.SchemaVersion(ctx)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SchemaVersion error", zap.Any("err", err))
+		return v1.ErrInternalServerError
+	}
+	if err := r.Validate(schemaVersion); err != nil {
+		s.logger.WithContext(ctx).Warn("invalid backup", zap.Error(err))
+		return v1.ErrInvalidBackup
+	}
+
+	// 恢复前备份当前数据, 恢复结果不符合预期时可以再恢复回来
+	previous, err := s.createBackup(ctx, "pre-restore")
+	if err != nil {
+		s.logger.WithContext(ctx).Error("RestoreBackup createBackup error", zap.Any("err", err))
+		return v1.ErrInternalServerError
+	}
+
+	// 只覆盖备份中包含的数据表, 旧版本备份中没有的表保持不变
+	err = s.tm.Transaction(ctx, func(ctx context.Context) error {
+		// 只属于当前部署的设置不随备份恢复, 清空前取出, 导入后写回
+		settings, err := s.settingRepository.GetSettings(ctx)
+		if err != nil {
+			return err
+		}
+		for _, info := range r.Manifest.Tables {
+			table := backup.GetTable(info.Name)
+			if err := s.backupRepository.ClearTable(ctx, table); err != nil {
+				return fmt.Errorf("clear %s: %w", info.Name, err)
+			}
+			err := r.Rows(info, backupBatch, func(rows interface{}) error {
+				return s.backupRepository.ImportRows(ctx, rows)
+			})
+			if err != nil {
+				return fmt.Errorf("import %s: %w", info.Name, err)
+			}
+			if err := s.backupRepository.ResetSequence(ctx, table); err != nil {
+				return fmt.Errorf("reset sequence %s: %w", info.Name, err)
+			}
+		}
+		for _, setting := range settings {
+			if !setting.Local() {
+				continue
+			}
+			setting.ID = 0
+			if err := s.settingRepository.SaveSetting(ctx, setting); err != nil {
+				return fmt.Errorf("keep setting %s: %w", setting.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.WithContext(ctx).Error("RestoreBackup error", zap.Any("err", err))
+		if errors.Is(err, backup.ErrInvalidArchive) {
+			return v1.ErrInvalidBackup
+		}
+		return v1.ErrInternalServerError
+	}
+	s.logger.WithContext(ctx).Info("backup restored",
+		zap.String("path", path),
+		zap.Time("createTime", r.Manifest.CreateTime),
+		zap.String("previous", previous.Name),
+	)
+
+	// 刷新缓存的数据, 任务配置由调度器定期同步
+	s.settings.Invalidate()
+	if err := s.manager.ReloadRules(ctx); err != nil {
+		s.logger.WithContext(ctx).Error("ReloadRules error", zap.Any("err", err))
+	}
+	return nil
+}
+
+func (s *backupService) CleanBackups(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "BackupService.CleanBackups")
+	defer span.End()
+
+	keep := commonConfig.GetConfig().BackupKeep
+	if keep <= 0 {
+		return nil
+	}
+	files, err := listBackups()
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(files); i++ {
+		if err := os.Remove(filepath.Join(backupDir(), files[i].Name)); err != nil {
+			return err
+		}
+		s.logger.WithContext(ctx).Info("backup removed", zap.String("name", files[i].Name))
+	}
+	return nil
+}
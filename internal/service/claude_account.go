@@ -4,6 +4,7 @@ import (
 	v1 "PandoraFuclaudePlusHelper/api/v1"
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"fmt"
 	"go.uber.org/zap"
@@ -21,11 +22,13 @@ type ClaudeAccountService interface {
 	EnableAccount(ctx context.Context, id int64) error
 }
 
-func NewClaudeAccountService(service *Service, claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository, coordinator *Coordinator) ClaudeAccountService {
+func NewClaudeAccountService(service *Service, claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository,
+	strikeRepository repository.StrikeRepository, coordinator *Coordinator) ClaudeAccountService {
 	return &claudeAccountService{
 		Service:                 service,
 		claudeTokenRepository:   claudeTokenRepository,
 		claudeAccountRepository: claudeAccountRepository,
+		strikeRepository:        strikeRepository,
 		claudeAccountService:    coordinator.ClaudeAccountSvc,
 	}
 }
@@ -34,17 +37,21 @@ type claudeAccountService struct {
 	*Service
 	claudeTokenRepository   repository.ClaudeTokenRepository
 	claudeAccountRepository repository.ClaudeAccountRepository
+	strikeRepository        repository.StrikeRepository
 	claudeAccountService    ClaudeAccountService
 }
 
 func (s *claudeAccountService) Update(ctx context.Context, account *model.ClaudeAccount) error {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.Update")
+	defer span.End()
+
 	his, err := s.GetAccount(ctx, account.ID)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetAccount error", zap.Any("err", err))
 		return err
 	}
 	if his == nil {
-		s.logger.Error("account not found")
+		s.logger.WithContext(ctx).Error("account not found")
 		return fmt.Errorf("account not found")
 	}
 	// 查询token是否存在
@@ -53,33 +60,44 @@ func (s *claudeAccountService) Update(ctx context.Context, account *model.Claude
 		return err
 	}
 	if token == nil {
-		s.logger.Error("token not found")
+		s.logger.WithContext(ctx).Error("token not found")
 		return fmt.Errorf("token not found")
 	}
 
 	now := time.Now()
+	enabled := his.Status == 1
 	his.UserId = account.UserId
 	his.TokenID = account.TokenID
 	his.Account = account.Account
 	his.Status = account.Status
 	his.UpdateTime = now
 
-	err = s.claudeAccountRepository.Update(ctx, his)
-	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
-		return err
-	}
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.claudeAccountRepository.Update(ctx, his); err != nil {
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+			return err
+		}
+		if !enabled && his.Status == 1 {
+			if err := liftDisabled(ctx, s.strikeRepository, his.UserId); err != nil {
+				s.logger.WithContext(ctx).Error("LiftSuspensions error", zap.Any("err", err))
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (s *claudeAccountService) Create(ctx context.Context, account *model.ClaudeAccount) error {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.Create")
+	defer span.End()
+
 	// 查询token是否存在
 	token, err := s.claudeTokenRepository.GetToken(ctx, account.TokenID)
 	if err != nil {
 		return err
 	}
 	if token == nil {
-		s.logger.Error("token not found")
+		s.logger.WithContext(ctx).Error("token not found")
 		return fmt.Errorf("token not found")
 	}
 
@@ -87,70 +105,100 @@ func (s *claudeAccountService) Create(ctx context.Context, account *model.Claude
 
 	account.CreateTime = now
 	account.UpdateTime = now
-	err = s.claudeAccountRepository.Create(ctx, account)
-	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
-		return err
-	}
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.claudeAccountRepository.Create(ctx, account); err != nil {
+			s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
+			return err
+		}
+		return nil
+	})
 }
 
 func (s *claudeAccountService) SearchAccount(ctx context.Context, tokenId int64) ([]*model.ClaudeAccount, error) {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.SearchAccount")
+	defer span.End()
+
 	return s.claudeAccountRepository.SearchAccount(ctx, tokenId)
 }
 
 func (s *claudeAccountService) DeleteAccount(ctx context.Context, id int64) error {
-	return s.claudeAccountRepository.DeleteAccount(ctx, id)
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.DeleteAccount")
+	defer span.End()
+
+	return write(ctx, func(ctx context.Context) error {
+		return s.claudeAccountRepository.DeleteAccount(ctx, id)
+	})
 }
 
 func (s *claudeAccountService) GetAccount(ctx context.Context, id int64) (*model.ClaudeAccount, error) {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.GetAccount")
+	defer span.End()
+
 	return s.claudeAccountRepository.GetAccount(ctx, id)
 }
 
 func (s *claudeAccountService) StatisticAccount(ctx context.Context, id int64) (v1.StatisticOpenaiAccountResponseData, error) {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.StatisticAccount")
+	defer span.End()
+
 	return v1.StatisticOpenaiAccountResponseData{}, nil
 }
 
 func (s *claudeAccountService) DisableAccount(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.DisableAccount")
+	defer span.End()
+
 	account, err := s.GetAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetAccount error", zap.Any("err", err))
 		return err
 	}
 	if account == nil {
-		s.logger.Error("account not found")
+		s.logger.WithContext(ctx).Error("account not found")
 		return fmt.Errorf("account not found")
 	}
 
 	now := time.Now()
 	account.Status = 0
 	account.UpdateTime = now
-	err = s.claudeAccountRepository.Update(ctx, account)
-	if err != nil {
-		s.logger.Error("Update error", zap.Any("err", err))
-		return err
-	}
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.claudeAccountRepository.Update(ctx, account); err != nil {
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+			return err
+		}
+		return nil
+	})
 }
 
 func (s *claudeAccountService) EnableAccount(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ClaudeAccountService.EnableAccount")
+	defer span.End()
+
 	account, err := s.GetAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetAccount error", zap.Any("err", err))
 		return err
 	}
 	if account == nil {
-		s.logger.Error("account not found")
+		s.logger.WithContext(ctx).Error("account not found")
 		return fmt.Errorf("account not found")
 	}
 	now := time.Now()
+	enabled := account.Status == 1
 	account.Status = 1
 	// 有效期一个月
 	account.UpdateTime = now
-	err = s.claudeAccountRepository.Update(ctx, account)
-	if err != nil {
-		s.logger.Error("Update error", zap.Any("err", err))
-		return err
-	}
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.claudeAccountRepository.Update(ctx, account); err != nil {
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+			return err
+		}
+		if !enabled {
+			if err := liftDisabled(ctx, s.strikeRepository, account.UserId); err != nil {
+				s.logger.WithContext(ctx).Error("LiftSuspensions error", zap.Any("err", err))
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -4,6 +4,7 @@ import (
 	v1 "PandoraFuclaudePlusHelper/api/v1"
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"go.uber.org/zap"
 	"time"
@@ -37,43 +38,58 @@ type claudeTokenService struct {
 }
 
 func (s *claudeTokenService) RefreshToken(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.RefreshToken")
+	defer span.End()
+
 	token, err := s.claudeTokenRepository.GetToken(ctx, id)
 	if err != nil {
-		s.logger.Error("GetToken error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetToken error", zap.Any("err", err))
 		return err
 	}
 	return s.RefreshByToken(ctx, token)
 }
 
 func (s *claudeTokenService) Update(ctx context.Context, token *model.ClaudeToken) error {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.Update")
+	defer span.End()
+
 	err := s.claudeTokenRepository.Update(ctx, token)
 	if err != nil {
-		s.logger.Error("Update error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
 		return err
 	}
 	return nil
 }
 
 func (s *claudeTokenService) Create(ctx context.Context, token *model.ClaudeToken) error {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.Create")
+	defer span.End()
+
 	now := time.Now()
 	token.CreateTime = now
 	token.UpdateTime = now
 	err := s.claudeTokenRepository.Create(ctx, token)
 	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
 		return err
 	}
 	return nil
 }
 
 func (s *claudeTokenService) SearchToken(ctx context.Context, keyword string) ([]*model.ClaudeToken, error) {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.SearchToken")
+	defer span.End()
+
 	return s.claudeTokenRepository.SearchToken(ctx, keyword)
 }
 
 func (s *claudeTokenService) DeleteToken(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.DeleteToken")
+	defer span.End()
+
 	accounts, err := s.claudeAccountService.SearchAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("SearchAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("SearchAccount error", zap.Any("err", err))
 		return err
 	}
 	if len(accounts) > 0 {
@@ -83,14 +99,23 @@ func (s *claudeTokenService) DeleteToken(ctx context.Context, id int64) error {
 }
 
 func (s *claudeTokenService) GetToken(ctx context.Context, id int64) (*model.ClaudeToken, error) {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.GetToken")
+	defer span.End()
+
 	token, err := s.claudeTokenRepository.GetToken(ctx, id)
 	return token, err
 }
 
 func (s *claudeTokenService) GetAllToken(ctx context.Context) ([]*model.ClaudeToken, error) {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.GetAllToken")
+	defer span.End()
+
 	return s.claudeTokenRepository.GetAllToken(ctx)
 }
 
 func (s *claudeTokenService) RefreshByToken(ctx context.Context, token *model.ClaudeToken) error {
+	ctx, span := tracing.Start(ctx, "ClaudeTokenService.RefreshByToken")
+	defer span.End()
+
 	return nil
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type unitOfWorkKey struct{}
+
+// unitOfWork 一组需要一起成功或失败的上游调用与本地写入
+//
+// 上游调用(例如生成共享令牌)耗时且无法随本地事务回滚, 放在事务中会长时间占用数据库的写锁(sqlite 整个库只有一把写锁),
+// 因此上游调用在事务外直接执行, 成功后登记补偿动作; 本地写入先登记, 所有上游调用完成后在一个短事务中按登记顺序执行。
+// 任一步骤失败或事务提交失败时, 按相反顺序执行补偿动作
+type unitOfWork struct {
+	mu            sync.Mutex
+	writes        []func(ctx context.Context) error
+	compensations []compensationAction
+}
+
+type compensationAction struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// compensate 登记一个补偿动作, 不在 transaction 中调用时忽略
+func compensate(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	u, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	if !ok {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.compensations = append(u.compensations, compensationAction{name: name, fn: fn})
+}
+
+// write 在 transaction 中调用时登记本地写入, 在 transaction 结束时的事务中执行; 否则直接执行
+//
+// 登记的写入晚于调用时执行, fn 中读取的字段(例如新建用户的 ID)以执行时为准, 写入失败的日志也应在 fn 中记录
+func write(ctx context.Context, fn func(ctx context.Context) error) error {
+	u, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork)
+	if !ok {
+		return fn(ctx)
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.writes = append(u.writes, fn)
+	return nil
+}
+
+// transaction 执行 fn, fn 中的上游调用立即执行, 通过 write 登记的本地写入在 fn 成功后于一个事务中执行;
+// fn 失败、写入失败或事务提交失败时执行 fn 中登记的补偿动作
+//
+// fn 中的查询不在事务中, 看不到 fn 中登记但尚未执行的写入。嵌套调用时加入最外层, 由最外层统一写入与补偿
+func (s *Service) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(unitOfWorkKey{}).(*unitOfWork); ok {
+		return fn(ctx)
+	}
+	u := new(unitOfWork)
+	err := fn(context.WithValue(ctx, unitOfWorkKey{}, u))
+	if err == nil {
+		err = s.tm.Transaction(ctx, func(ctx context.Context) error {
+			for _, w := range u.writes {
+				if err := w(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		s.runCompensations(ctx, u)
+	}
+	return err
+}
+
+// runCompensations 按登记的相反顺序执行补偿动作, 单个动作失败时记录日志并继续执行其余动作
+func (s *Service) runCompensations(ctx context.Context, u *unitOfWork) {
+	// 请求已取消时也需要撤销上游的修改
+	ctx = context.WithoutCancel(ctx)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := len(u.compensations) - 1; i >= 0; i-- {
+		action := u.compensations[i]
+		if err := action.fn(ctx); err != nil {
+			s.logger.WithContext(ctx).Error("compensation error", zap.String("action", action.name), zap.Any("err", err))
+			continue
+		}
+		s.logger.WithContext(ctx).Info("compensation done", zap.String("action", action.name))
+	}
+}
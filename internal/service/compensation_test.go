@@ -0,0 +1,144 @@
+package service
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+type txKey struct{}
+
+// fakeTransaction 记录事务的次数, 事务中的 ctx 带有标记, commitErr 模拟提交失败
+type fakeTransaction struct {
+	count     int
+	commitErr error
+}
+
+func (t *fakeTransaction) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.count++
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		return err
+	}
+	return t.commitErr
+}
+
+func TestTransaction(t *testing.T) {
+	errUpstream := errors.New("upstream failed")
+	errWrite := errors.New("write failed")
+	errCommit := errors.New("commit failed")
+
+	tests := []struct {
+		name      string
+		fail      error
+		writeErr  error
+		commitErr error
+		nested    bool
+		// wantWrites 在事务中执行的写入, wantCompensations 执行的补偿动作
+		wantWrites        []string
+		wantCompensations []string
+		wantErr           error
+	}{
+		{name: "success", wantWrites: []string{"user", "account"}},
+		{name: "nested joins outer", nested: true, wantWrites: []string{"user", "account"}},
+		{name: "upstream failure", fail: errUpstream, wantCompensations: []string{"token"}, wantErr: errUpstream},
+		{name: "write failure", writeErr: errWrite, wantWrites: []string{"user"}, wantCompensations: []string{"token"}, wantErr: errWrite},
+		{name: "commit failure", commitErr: errCommit, wantWrites: []string{"user", "account"}, wantCompensations: []string{"token"}, wantErr: errCommit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := &fakeTransaction{commitErr: tt.commitErr}
+			s := &Service{tm: tm, logger: &log.Logger{Logger: zap.NewNop()}}
+			var writes, compensations []string
+			record := func(name string, err error) func(ctx context.Context) error {
+				return func(ctx context.Context) error {
+					if ctx.Value(txKey{}) == nil {
+						t.Errorf("write %s executed outside the transaction", name)
+					}
+					writes = append(writes, name)
+					return err
+				}
+			}
+
+			body := func(ctx context.Context) error {
+				if err := write(ctx, record("user", tt.writeErr)); err != nil {
+					return err
+				}
+				compensate(ctx, "token", func(ctx context.Context) error {
+					compensations = append(compensations, "token")
+					return nil
+				})
+				if len(writes) != 0 {
+					t.Error("write executed before the upstream calls finished")
+				}
+				if tt.fail != nil {
+					return tt.fail
+				}
+				return write(ctx, record("account", nil))
+			}
+			fn := body
+			if tt.nested {
+				fn = func(ctx context.Context) error {
+					return s.transaction(ctx, body)
+				}
+			}
+
+			err := s.transaction(context.Background(), fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("transaction() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			if !reflect.DeepEqual(compensations, tt.wantCompensations) {
+				t.Errorf("compensations = %v, want %v", compensations, tt.wantCompensations)
+			}
+			wantCount := 1
+			if tt.fail != nil {
+				wantCount = 0
+			}
+			if tm.count != wantCount {
+				t.Errorf("transactions = %d, want %d", tm.count, wantCount)
+			}
+		})
+	}
+}
+
+func TestCompensationsRunInReverse(t *testing.T) {
+	s := &Service{tm: &fakeTransaction{}, logger: &log.Logger{Logger: zap.NewNop()}}
+	var got []string
+	err := s.transaction(context.Background(), func(ctx context.Context) error {
+		for _, name := range []string{"first", "second", "third"} {
+			name := name
+			compensate(ctx, name, func(ctx context.Context) error {
+				got = append(got, name)
+				if name == "second" {
+					return errors.New("compensation failed")
+				}
+				return nil
+			})
+		}
+		return errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("transaction() error = nil")
+	}
+	// 单个补偿失败时继续执行其余补偿
+	if want := []string{"third", "second", "first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("compensations = %v, want %v", got, want)
+	}
+}
+
+func TestWriteOutsideTransaction(t *testing.T) {
+	executed := false
+	err := write(context.Background(), func(ctx context.Context) error {
+		executed = true
+		return nil
+	})
+	if err != nil || !executed {
+		t.Errorf("write() executed = %v, error = %v, want executed immediately", executed, err)
+	}
+}
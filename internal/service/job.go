@@ -0,0 +1,162 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/scheduler"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+)
+
+type JobService interface {
+	SearchJob(ctx context.Context) []*scheduler.Status
+	TriggerJob(ctx context.Context, name string) error
+	PauseJob(ctx context.Context, name string) error
+	ResumeJob(ctx context.Context, name string) error
+	UpdateJob(ctx context.Context, req *v1.UpdateJobRequest) error
+	SearchRun(ctx context.Context, req *v1.SearchJobRunRequest) (*v1.SearchJobRunResponseData, error)
+	SearchItem(ctx context.Context, req *v1.SearchJobRunItemRequest) (*v1.SearchJobRunItemResponseData, error)
+	SearchFailing(ctx context.Context, name string) ([]*repository.JobFailingItem, error)
+}
+
+func NewJobService(service *Service, scheduler *scheduler.Scheduler, jobRepository repository.JobRepository) JobService {
+	return &jobService{
+		Service:       service,
+		scheduler:     scheduler,
+		jobRepository: jobRepository,
+	}
+}
+
+type jobService struct {
+	*Service
+	scheduler     *scheduler.Scheduler
+	jobRepository repository.JobRepository
+}
+
+func (s *jobService) SearchJob(ctx context.Context) []*scheduler.Status {
+	ctx, span := tracing.Start(ctx, "JobService.SearchJob")
+	defer span.End()
+
+	return s.scheduler.List(ctx)
+}
+
+func (s *jobService) TriggerJob(ctx context.Context, name string) error {
+	ctx, span := tracing.Start(ctx, "JobService.TriggerJob")
+	defer span.End()
+
+	if err := s.scheduler.Trigger(ctx, name); err != nil {
+		s.logger.WithContext(ctx).Error("TriggerJob error", zap.Any("err", err))
+		return jobError(err)
+	}
+	return nil
+}
+
+func (s *jobService) PauseJob(ctx context.Context, name string) error {
+	ctx, span := tracing.Start(ctx, "JobService.PauseJob")
+	defer span.End()
+
+	if err := s.scheduler.Pause(ctx, name); err != nil {
+		s.logger.WithContext(ctx).Error("PauseJob error", zap.Any("err", err))
+		return jobError(err)
+	}
+	return nil
+}
+
+func (s *jobService) ResumeJob(ctx context.Context, name string) error {
+	ctx, span := tracing.Start(ctx, "JobService.ResumeJob")
+	defer span.End()
+
+	if err := s.scheduler.Resume(ctx, name); err != nil {
+		s.logger.WithContext(ctx).Error("ResumeJob error", zap.Any("err", err))
+		return jobError(err)
+	}
+	return nil
+}
+
+func (s *jobService) UpdateJob(ctx context.Context, req *v1.UpdateJobRequest) error {
+	ctx, span := tracing.Start(ctx, "JobService.UpdateJob")
+	defer span.End()
+
+	if err := s.scheduler.Reschedule(ctx, req.Name, req.Cron, req.Timezone); err != nil {
+		s.logger.WithContext(ctx).Error("UpdateJob error", zap.Any("err", err))
+		return jobError(err)
+	}
+	return nil
+}
+
+func (s *jobService) SearchRun(ctx context.Context, req *v1.SearchJobRunRequest) (*v1.SearchJobRunResponseData, error) {
+	ctx, span := tracing.Start(ctx, "JobService.SearchRun")
+	defer span.End()
+
+	offset, limit := jobPage(req.Page, req.PageSize)
+	runs, total, err := s.jobRepository.SearchRun(ctx, &repository.JobRunFilter{
+		Job:    req.Name,
+		Status: req.Status,
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchRun error", zap.Any("err", err))
+		return nil, err
+	}
+	return &v1.SearchJobRunResponseData{Total: total, List: runs}, nil
+}
+
+func (s *jobService) SearchItem(ctx context.Context, req *v1.SearchJobRunItemRequest) (*v1.SearchJobRunItemResponseData, error) {
+	ctx, span := tracing.Start(ctx, "JobService.SearchItem")
+	defer span.End()
+
+	offset, limit := jobPage(req.Page, req.PageSize)
+	items, total, err := s.jobRepository.SearchItem(ctx, &repository.JobRunItemFilter{
+		RunId:    req.RunId,
+		Job:      req.Name,
+		ItemType: req.ItemType,
+		ItemId:   req.ItemId,
+		Status:   req.Status,
+		Offset:   offset,
+		Limit:    limit,
+	})
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchItem error", zap.Any("err", err))
+		return nil, err
+	}
+	return &v1.SearchJobRunItemResponseData{Total: total, List: items}, nil
+}
+
+// SearchFailing 查询自最后一次成功后持续失败的对象, 例如连续多次刷新失败的 token
+func (s *jobService) SearchFailing(ctx context.Context, name string) ([]*repository.JobFailingItem, error) {
+	ctx, span := tracing.Start(ctx, "JobService.SearchFailing")
+	defer span.End()
+
+	items, err := s.jobRepository.FailingItems(ctx, name)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("FailingItems error", zap.Any("err", err))
+		return nil, err
+	}
+	return items, nil
+}
+
+func jobPage(page int, pageSize int) (int, int) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	return (page - 1) * pageSize, pageSize
+}
+
+// jobError 将调度器的错误转换为接口错误
+func jobError(err error) error {
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		return v1.ErrNotFound
+	case errors.Is(err, scheduler.ErrJobRunning):
+		return v1.ErrJobRunning
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		return v1.ErrInvalidJobSchedule
+	}
+	return err
+}
@@ -6,19 +6,26 @@ import (
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
 	"PandoraFuclaudePlusHelper/internal/util"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type LoginService interface {
 	Login(ctx context.Context, req *v1.LoginRequest) (int, string, map[string]interface{}, string, error)
+	SetAdminPassword(ctx context.Context, password string) error
 }
 
 func NewLoginService(service *Service, userRepository repository.UserRepository,
 	openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
-	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository) LoginService {
+	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository,
+	strikeRepository repository.StrikeRepository, settingRepository repository.SettingRepository) LoginService {
 	return &loginService{
 		Service:                 service,
 		userRepository:          userRepository,
@@ -26,6 +33,8 @@ func NewLoginService(service *Service, userRepository repository.UserRepository,
 		openaiAccountRepository: openaiAccountRepository,
 		claudeTokenRepository:   claudeTokenRepository,
 		claudeAccountRepository: claudeAccountRepository,
+		strikeRepository:        strikeRepository,
+		settingRepository:       settingRepository,
 	}
 }
 
@@ -36,9 +45,14 @@ type loginService struct {
 	openaiAccountRepository repository.OpenaiAccountRepository
 	claudeTokenRepository   repository.ClaudeTokenRepository
 	claudeAccountRepository repository.ClaudeAccountRepository
+	strikeRepository        repository.StrikeRepository
+	settingRepository       repository.SettingRepository
 }
 
 func (s *loginService) Login(ctx context.Context, req *v1.LoginRequest) (int, string, map[string]interface{}, string, error) {
+	ctx, span := tracing.Start(ctx, "LoginService.Login")
+	defer span.End()
+
 	// 登录类型
 	loginType := req.Type
 	// tokenId或者accountId，用于后台快捷登录
@@ -54,8 +68,7 @@ func (s *loginService) Login(ctx context.Context, req *v1.LoginRequest) (int, st
 	switch loginType {
 	case 9999:
 		// 管理员登录
-		adminPassword := commonConfig.GetConfig().AdminPassword
-		if password == adminPassword {
+		if s.checkAdminPassword(ctx, password) {
 			login := map[string]interface{}{
 				"id":          1,
 				"loginname":   "admin",
@@ -64,7 +77,7 @@ func (s *loginService) Login(ctx context.Context, req *v1.LoginRequest) (int, st
 				"status":      1,
 				"permissions": model.PERMISSION_LIST,
 			}
-			token, err := s.jwt.GenToken("1", time.Now().Add(time.Hour*24*90))
+			token, err := s.jwt.GenAdminToken(s.settings.AdminTokenGeneration(ctx), time.Now().Add(time.Hour*24*90))
 			if err != nil {
 				return -1, "", nil, "", err
 			}
@@ -75,57 +88,63 @@ func (s *loginService) Login(ctx context.Context, req *v1.LoginRequest) (int, st
 		// 普通用户openai登录
 		user, err := s.userRepository.GetUserByPassword(ctx, password)
 		if err != nil {
-			s.logger.Info(fmt.Sprintf("user %s login failed", password))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s login failed", password))
 			return -1, "", nil, "", v1.ErrLoginFailed
 		}
 		// 用户表被禁用
 		if user.Enable != 1 {
-			s.logger.Info(fmt.Sprintf("user %s is not enable", user.UniqueName))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s is not enable", user.UniqueName))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
+		if err := s.checkSuspension(ctx, &user); err != nil {
+			return -1, "", nil, "", err
+		}
 		account, err := s.openaiAccountRepository.GetAccountByUserId(ctx, user.ID)
 		if err != nil {
-			s.logger.Info(fmt.Sprintf("user %s has no account", user.UniqueName))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s has no account", user.UniqueName))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
 		// 账号被禁用
 		if account.Status != 1 {
-			s.logger.Info(fmt.Sprintf("account %d is not enable", account.ID))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("account %d is not enable", account.ID))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
-		return gptLogin(account.ShareToken, s, loginType)
+		return gptLogin(ctx, account.ShareToken, s, loginType)
 	case 2:
 		// 管理员 openai快捷登录
 		account, err := s.openaiAccountRepository.GetAccountById(ctx, accountId)
 		if err != nil {
 			return -1, "", nil, "", errors.New("账号不存在")
 		}
-		return gptLogin(account.ShareToken, s, loginType)
+		return gptLogin(ctx, account.ShareToken, s, loginType)
 	case 3:
 		// 普通用户claude登录
 		user, err := s.userRepository.GetUserByPassword(ctx, password)
 		if err != nil {
-			s.logger.Info(fmt.Sprintf("user %s login failed", password))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s login failed", password))
 			return -1, "", nil, "", v1.ErrLoginFailed
 		}
 		// 用户表被禁用
 		if user.Enable != 1 {
-			s.logger.Info(fmt.Sprintf("user %s is not enable", user.UniqueName))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s is not enable", user.UniqueName))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
+		if err := s.checkSuspension(ctx, &user); err != nil {
+			return -1, "", nil, "", err
+		}
 		account, err := s.claudeAccountRepository.GetAccountByUserId(ctx, user.ID)
 		if err != nil {
-			s.logger.Info(fmt.Sprintf("user %s has no account", user.UniqueName))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s has no account", user.UniqueName))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
 		// 账号被禁用
 		if account.Status != 1 {
-			s.logger.Info(fmt.Sprintf("account %d is not enable", account.ID))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("account %d is not enable", account.ID))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
 		token, err := s.claudeTokenRepository.GetToken(ctx, user.ClaudeToken)
 		if err != nil {
-			s.logger.Info(fmt.Sprintf("user %s has no token", user.UniqueName))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s has no token", user.UniqueName))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
 		expireAt := user.ExpirationTime
@@ -133,11 +152,11 @@ func (s *loginService) Login(ctx context.Context, req *v1.LoginRequest) (int, st
 		// 计算剩余秒数
 		seconds := int(expireAt.Sub(now).Seconds())
 		if seconds < 0 {
-			s.logger.Info(fmt.Sprintf("user %s token expired", user.UniqueName))
+			s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s token expired", user.UniqueName))
 			return -1, "", nil, "", errors.New("登录失败")
 		}
 
-		return claudeLogin(token.SessionToken, user.UniqueName, s, 3, seconds)
+		return claudeLogin(ctx, token.SessionToken, user.UniqueName, account.ID, s, 3, seconds)
 	case 4:
 		// 管理员 claud account 快捷登录
 		account, err := s.claudeAccountRepository.GetAccountById(ctx, accountId)
@@ -148,36 +167,132 @@ func (s *loginService) Login(ctx context.Context, req *v1.LoginRequest) (int, st
 		if err != nil {
 			return -1, "", nil, "", errors.New("账号不存在")
 		}
-		return claudeLogin(token.SessionToken, account.Account, s, 4, -1)
+		return claudeLogin(ctx, token.SessionToken, account.Account, account.ID, s, 4, -1)
 	case 5:
 		// 管理员 claud token 快捷登录
 		token, err := s.claudeTokenRepository.GetToken(ctx, accountId)
 		if err != nil {
 			return -1, "", nil, "", errors.New("账号不存在")
 		}
-		return claudeLogin(token.SessionToken, "", s, 5, -1)
+		return claudeLogin(ctx, token.SessionToken, "", 0, s, 5, -1)
 	default:
 		// 不支持的登录类型
 		return -1, "", nil, "", v1.ErrLoginFailed
 	}
 }
 
-func gptLogin(shareToken string, s *loginService, loginType int) (int, string, map[string]interface{}, string, error) {
-	loginUrl, err := util.ExecuteShareAuth(shareToken, s.logger)
+// checkAdminPassword 命令行重置过管理员密码时校验重置后的密码, 否则校验 ADMIN_PASSWORD
+func (s *loginService) checkAdminPassword(ctx context.Context, password string) bool {
+	if hash := s.settings.AdminPasswordHash(ctx); hash != "" {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	return password == commonConfig.GetConfig().AdminPassword
+}
+
+// SetAdminPassword 重置管理员密码, 密码为空时删除重置的密码, 恢复使用 ADMIN_PASSWORD
+//
+// 同时递增管理员令牌的代数, 之前签发的管理员令牌全部失效
+func (s *loginService) SetAdminPassword(ctx context.Context, password string) error {
+	ctx, span := tracing.Start(ctx, "LoginService.SetAdminPassword")
+	defer span.End()
+
+	var hash []byte
+	if password != "" {
+		if len(password) < 8 {
+			return errors.New("admin password length must be at least 8")
+		}
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+	}
+	err := s.tm.Transaction(ctx, func(ctx context.Context) error {
+		if hash == nil {
+			if err := s.settingRepository.DeleteSetting(ctx, model.SettingAdminPassword); err != nil {
+				return err
+			}
+		} else {
+			err := s.settingRepository.SaveSetting(ctx, &model.Setting{
+				Name:       model.SettingAdminPassword,
+				Value:      string(hash),
+				UpdateTime: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return s.bumpAdminTokenGeneration(ctx)
+	})
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SetAdminPassword error", zap.Any("err", err))
+		return err
+	}
+	s.settings.Invalidate()
+	return nil
+}
+
+// bumpAdminTokenGeneration 递增管理员令牌的代数, 基于数据库中的值而不是缓存的值
+func (s *loginService) bumpAdminTokenGeneration(ctx context.Context) error {
+	settings, err := s.settingRepository.GetSettings(ctx)
+	if err != nil {
+		return err
+	}
+	var generation int64
+	for _, setting := range settings {
+		if setting.Name == model.SettingAdminTokenGeneration {
+			generation, _ = strconv.ParseInt(setting.Value, 10, 64)
+		}
+	}
+	return s.settingRepository.SaveSetting(ctx, &model.Setting{
+		Name:       model.SettingAdminTokenGeneration,
+		Value:      strconv.FormatInt(generation+1, 10),
+		UpdateTime: time.Now(),
+	})
+}
+
+// checkSuspension 用户因违规被暂停时拒绝登录
+func (s *loginService) checkSuspension(ctx context.Context, user *model.User) error {
+	suspension, err := s.strikeRepository.GetActiveSuspension(ctx, user.ID)
+	if err != nil {
+		s.logger.WithContext(ctx).Error(fmt.Sprintf("GetActiveSuspension error: %v", err))
+		return nil
+	}
+	if suspension != nil {
+		s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s is suspended", user.UniqueName))
+		return v1.ErrUserSuspended
+	}
+	return nil
+}
+
+func gptLogin(ctx context.Context, shareToken string, s *loginService, loginType int) (int, string, map[string]interface{}, string, error) {
+	loginUrl, err := util.ExecuteShareAuth(ctx, shareToken, s.logger)
 	if err != nil {
 		return -1, "", nil, "", v1.ErrLoginFailed
 	}
 	return loginType, "", nil, loginUrl, nil
 }
 
-func claudeLogin(sessionToken string, account string, s *loginService, loginType int, seconds int) (int, string, map[string]interface{}, string, error) {
+func claudeLogin(ctx context.Context, sessionToken string, account string, accountId int64, s *loginService, loginType int, seconds int) (int, string, map[string]interface{}, string, error) {
 	if (loginType == 3 && account == "") || (loginType == 4 && account == "") {
 		// 通过 account登录时，account不能为空
 		return -1, "", nil, "", v1.ErrLoginFailed
 	}
-	loginUrl, err := util.ExecuteClaudeAuth(sessionToken, account, seconds, s.logger)
+	loginUrl, err := util.ExecuteClaudeAuth(ctx, sessionToken, account, seconds, s.logger)
 	if err != nil {
 		return -1, "", nil, "", v1.ErrLoginFailed
 	}
+	if accountId > 0 {
+		// 附加账号标识, 用于审查记录识别 Claude 用户
+		expiresAt := time.Now().Add(time.Hour * 24 * 90)
+		if seconds > 0 {
+			expiresAt = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		loginUrl, err = util.ClaudeIdentityLoginUrl(s.jwt, loginUrl, accountId, expiresAt)
+		if err != nil {
+			s.logger.WithContext(ctx).Error(fmt.Sprintf("ClaudeIdentityLoginUrl error: %v", err))
+			return -1, "", nil, "", v1.ErrLoginFailed
+		}
+	}
 	return loginType, "", nil, loginUrl, nil
 }
@@ -0,0 +1,159 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+// 导出审查事件的最大条数
+const moderationEventExportLimit = 10000
+
+type ModerationEventService interface {
+	RecordEvent(ctx context.Context, event *model.ModerationEvent) error
+	SearchEvent(ctx context.Context, req *v1.SearchModerationEventRequest) (*v1.SearchModerationEventResponseData, error)
+	ReviewEvent(ctx context.Context, ids []int64, note string) error
+	ExportEvent(ctx context.Context, req *v1.SearchModerationEventRequest, w io.Writer) error
+}
+
+func NewModerationEventService(service *Service, moderationEventRepository repository.ModerationEventRepository) ModerationEventService {
+	return &moderationEventService{
+		Service:                   service,
+		moderationEventRepository: moderationEventRepository,
+	}
+}
+
+type moderationEventService struct {
+	*Service
+	moderationEventRepository repository.ModerationEventRepository
+}
+
+func (s *moderationEventService) RecordEvent(ctx context.Context, event *model.ModerationEvent) error {
+	ctx, span := tracing.Start(ctx, "ModerationEventService.RecordEvent")
+	defer span.End()
+
+	event.CreateTime = time.Now()
+	if err := s.moderationEventRepository.Create(ctx, event); err != nil {
+		s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
+		return err
+	}
+	return nil
+}
+
+func (s *moderationEventService) SearchEvent(ctx context.Context, req *v1.SearchModerationEventRequest) (*v1.SearchModerationEventResponseData, error) {
+	ctx, span := tracing.Start(ctx, "ModerationEventService.SearchEvent")
+	defer span.End()
+
+	filter, err := moderationEventFilter(req)
+	if err != nil {
+		return nil, v1.ErrBadRequest
+	}
+	page, pageSize := req.Page, req.PageSize
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	filter.Offset = (page - 1) * pageSize
+	filter.Limit = pageSize
+
+	events, total, err := s.moderationEventRepository.SearchEvent(ctx, filter)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchEvent error", zap.Any("err", err))
+		return nil, err
+	}
+	return &v1.SearchModerationEventResponseData{Total: total, List: events}, nil
+}
+
+func (s *moderationEventService) ReviewEvent(ctx context.Context, ids []int64, note string) error {
+	ctx, span := tracing.Start(ctx, "ModerationEventService.ReviewEvent")
+	defer span.End()
+
+	if len(ids) == 0 {
+		return v1.ErrBadRequest
+	}
+	if err := s.moderationEventRepository.ReviewEvent(ctx, ids, note, time.Now()); err != nil {
+		s.logger.WithContext(ctx).Error("ReviewEvent error", zap.Any("err", err))
+		return err
+	}
+	return nil
+}
+
+// ExportEvent 按查询条件导出 CSV, 最多导出 moderationEventExportLimit 条
+func (s *moderationEventService) ExportEvent(ctx context.Context, req *v1.SearchModerationEventRequest, w io.Writer) error {
+	ctx, span := tracing.Start(ctx, "ModerationEventService.ExportEvent")
+	defer span.End()
+
+	filter, err := moderationEventFilter(req)
+	if err != nil {
+		return v1.ErrBadRequest
+	}
+	filter.Limit = moderationEventExportLimit
+	events, _, err := s.moderationEventRepository.SearchEvent(ctx, filter)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchEvent error", zap.Any("err", err))
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"id", "createTime", "product", "direction", "userId", "userName", "accountId", "account",
+		"provider", "categories", "scores", "reason", "action", "status", "reviewNote", "reviewTime", "message"})
+	for _, event := range events {
+		reviewTime := ""
+		if !event.ReviewTime.IsZero() {
+			reviewTime = event.ReviewTime.Format(time.DateTime)
+		}
+		_ = writer.Write([]string{
+			fmt.Sprintf("%d", event.ID),
+			event.CreateTime.Format(time.DateTime),
+			event.Product,
+			event.Direction,
+			fmt.Sprintf("%d", event.UserId),
+			event.UserName,
+			fmt.Sprintf("%d", event.AccountId),
+			event.Account,
+			event.Provider,
+			event.Categories,
+			event.Scores,
+			event.Reason,
+			event.Action,
+			fmt.Sprintf("%d", event.Status),
+			event.ReviewNote,
+			reviewTime,
+			event.Message,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// moderationEventFilter 将请求转换为查询条件, 时间按本地时区解析
+func moderationEventFilter(req *v1.SearchModerationEventRequest) (*repository.ModerationEventFilter, error) {
+	filter := &repository.ModerationEventFilter{
+		Keyword:   req.Keyword,
+		Product:   req.Product,
+		Direction: req.Direction,
+		Status:    req.Status,
+		UserId:    req.UserId,
+	}
+	var err error
+	if req.StartTime != "" {
+		if filter.StartTime, err = time.ParseInLocation(time.DateTime, req.StartTime, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	if req.EndTime != "" {
+		if filter.EndTime, err = time.ParseInLocation(time.DateTime, req.EndTime, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/moderation"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+type ModerationRuleService interface {
+	Create(ctx context.Context, rule *model.ModerationRule) error
+	Update(ctx context.Context, rule *model.ModerationRule) error
+	SearchRule(ctx context.Context, keyword string, product string) ([]*model.ModerationRule, error)
+	DeleteRule(ctx context.Context, id int64) error
+}
+
+func NewModerationRuleService(service *Service, moderationRuleRepository repository.ModerationRuleRepository, manager *moderation.Manager) ModerationRuleService {
+	return &moderationRuleService{
+		Service:                  service,
+		moderationRuleRepository: moderationRuleRepository,
+		manager:                  manager,
+	}
+}
+
+type moderationRuleService struct {
+	*Service
+	moderationRuleRepository repository.ModerationRuleRepository
+	manager                  *moderation.Manager
+}
+
+func (s *moderationRuleService) Create(ctx context.Context, rule *model.ModerationRule) error {
+	ctx, span := tracing.Start(ctx, "ModerationRuleService.Create")
+	defer span.End()
+
+	if err := s.validate(ctx, rule); err != nil {
+		return err
+	}
+	now := time.Now()
+	rule.ID = 0
+	rule.CreateTime = now
+	rule.UpdateTime = now
+	if err := s.moderationRuleRepository.Create(ctx, rule); err != nil {
+		s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
+		return err
+	}
+	return s.reload(ctx)
+}
+
+func (s *moderationRuleService) Update(ctx context.Context, rule *model.ModerationRule) error {
+	ctx, span := tracing.Start(ctx, "ModerationRuleService.Update")
+	defer span.End()
+
+	if err := s.validate(ctx, rule); err != nil {
+		return err
+	}
+	oldRule, err := s.moderationRuleRepository.GetRule(ctx, rule.ID)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetRule error", zap.Any("err", err))
+		return err
+	}
+	rule.CreateTime = oldRule.CreateTime
+	rule.UpdateTime = time.Now()
+	if err := s.moderationRuleRepository.Update(ctx, rule); err != nil {
+		s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+		return err
+	}
+	return s.reload(ctx)
+}
+
+func (s *moderationRuleService) SearchRule(ctx context.Context, keyword string, product string) ([]*model.ModerationRule, error) {
+	ctx, span := tracing.Start(ctx, "ModerationRuleService.SearchRule")
+	defer span.End()
+
+	return s.moderationRuleRepository.SearchRule(ctx, keyword, product)
+}
+
+func (s *moderationRuleService) DeleteRule(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ModerationRuleService.DeleteRule")
+	defer span.End()
+
+	if err := s.moderationRuleRepository.DeleteRule(ctx, id); err != nil {
+		s.logger.WithContext(ctx).Error("DeleteRule error", zap.Any("err", err))
+		return err
+	}
+	return s.reload(ctx)
+}
+
+// validate 补全默认值并校验规则, 无法编译的规则不允许保存
+func (s *moderationRuleService) validate(ctx context.Context, rule *model.ModerationRule) error {
+	if rule.Type == "" {
+		rule.Type = model.ModerationRuleKeyword
+	}
+	if rule.Product == "" {
+		rule.Product = model.ModerationProductAll
+	}
+	if err := moderation.ValidateRule(rule); err != nil {
+		s.logger.WithContext(ctx).Warn("invalid moderation rule", zap.String("name", rule.Name), zap.Error(err))
+		return v1.ErrInvalidModerationRule
+	}
+	return nil
+}
+
+// reload 规则变更后立即刷新本地审查引擎, 不必等待定时检查
+func (s *moderationRuleService) reload(ctx context.Context) error {
+	if err := s.manager.ReloadRules(ctx); err != nil {
+		s.logger.WithContext(ctx).Error("ReloadRules error", zap.Any("err", err))
+		return err
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
 	"PandoraFuclaudePlusHelper/internal/util"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"fmt"
 	"go.uber.org/zap"
@@ -20,13 +21,18 @@ type OpenaiAccountService interface {
 	StatisticAccount(ctx context.Context, id int64) (v1.StatisticOpenaiAccountResponseData, error)
 	DisableAccount(ctx context.Context, id int64) error
 	EnableAccount(ctx context.Context, id int64) error
+	SuspendAccount(ctx context.Context, id int64) error
+	RestoreAccount(ctx context.Context, id int64) error
+	RevokeShareToken(ctx context.Context, id int64) error
 }
 
-func NewOpenaiAccountService(service *Service, openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository, coordinator *Coordinator) OpenaiAccountService {
+func NewOpenaiAccountService(service *Service, openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
+	strikeRepository repository.StrikeRepository, coordinator *Coordinator) OpenaiAccountService {
 	return &openaiAccountService{
 		Service:                 service,
 		openaiTokenRepository:   openaiTokenRepository,
 		openaiAccountRepository: openaiAccountRepository,
+		strikeRepository:        strikeRepository,
 		openaiAccountService:    coordinator.OpenaiAccountSvc,
 	}
 }
@@ -35,17 +41,21 @@ type openaiAccountService struct {
 	*Service
 	openaiTokenRepository   repository.OpenaiTokenRepository
 	openaiAccountRepository repository.OpenaiAccountRepository
+	strikeRepository        repository.StrikeRepository
 	openaiAccountService    OpenaiAccountService
 }
 
 func (s *openaiAccountService) Update(ctx context.Context, account *model.OpenaiAccount) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.Update")
+	defer span.End()
+
 	his, err := s.GetAccount(ctx, account.ID)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetAccount error", zap.Any("err", err))
 		return err
 	}
 	if his == nil {
-		s.logger.Error("account not found")
+		s.logger.WithContext(ctx).Error("account not found")
 		return fmt.Errorf("account not found")
 	}
 	// 查询token是否存在
@@ -54,10 +64,12 @@ func (s *openaiAccountService) Update(ctx context.Context, account *model.Openai
 		return err
 	}
 	if token == nil {
-		s.logger.Error("token not found")
+		s.logger.WithContext(ctx).Error("token not found")
 		return fmt.Errorf("token not found")
 	}
 
+	previous := *his
+	enabled := his.Status == 1
 	now := time.Now()
 	his.ExpirationTime = account.ExpirationTime
 	his.Gpt35Limit = account.Gpt35Limit
@@ -74,7 +86,7 @@ func (s *openaiAccountService) Update(ctx context.Context, account *model.Openai
 	his.Status = account.Status
 
 	// 生成共享token
-	shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(token.AccessToken,
+	shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(ctx, token.AccessToken,
 		account.Account,
 		0,
 		account.Gpt35Limit,
@@ -89,38 +101,62 @@ func (s *openaiAccountService) Update(ctx context.Context, account *model.Openai
 		account.TemporaryChat == 1,
 		s.logger)
 	if err != nil {
-		s.logger.Error("GenerateShareToken error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GenerateShareToken error", zap.Any("err", err))
 		return err
 	}
+	if previous.TokenID != account.TokenID {
+		// 更换了 token, 新 token 下原来没有该账号的共享令牌
+		previous = model.OpenaiAccount{Account: account.Account}
+	}
+	s.compensateShareToken(ctx, token.AccessToken, previous)
 	his.TokenID = account.TokenID
 	his.ShareToken = shareToken
 	his.ShareTokenEncrypt = shareTokenEncrypt
 	his.ExpireAt = time.Unix(expireIn, 0)
 
-	err = s.openaiAccountRepository.Update(ctx, his)
-	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
-		return err
-	}
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.openaiAccountRepository.Update(ctx, his); err != nil {
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+			return err
+		}
+		if !enabled && his.Status == 1 {
+			if err := liftDisabled(ctx, s.strikeRepository, his.UserId); err != nil {
+				s.logger.WithContext(ctx).Error("LiftSuspensions error", zap.Any("err", err))
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (s *openaiAccountService) Create(ctx context.Context, account *model.OpenaiAccount) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.Create")
+	defer span.End()
+
 	// 查询token是否存在
 	token, err := s.openaiTokenRepository.GetToken(ctx, account.TokenID)
 	if err != nil {
 		return err
 	}
 	if token == nil {
-		s.logger.Error("token not found")
+		s.logger.WithContext(ctx).Error("token not found")
 		return fmt.Errorf("token not found")
 	}
+	// 名称重复时写入会失败, 先检查, 避免覆盖并在补偿时撤销同名账号在上游的共享令牌
+	exists, err := s.openaiAccountRepository.ExistsAccount(ctx, account.Account)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("ExistsAccount error", zap.Any("err", err))
+		return err
+	}
+	if exists {
+		return v1.ErrAccountAlreadyExists
+	}
 
 	now := time.Now()
 	account.ShareToken = token.AccessToken
 	account.ExpireAt = now.Add(time.Hour * 24 * 365)
 	// 生成共享token
-	shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(token.AccessToken,
+	shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(ctx, token.AccessToken,
 		account.Account,
 		0,
 		account.Gpt35Limit,
@@ -135,35 +171,42 @@ func (s *openaiAccountService) Create(ctx context.Context, account *model.Openai
 		account.TemporaryChat == 1,
 		s.logger)
 	if err != nil {
-		s.logger.Error("GenerateShareToken error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GenerateShareToken error", zap.Any("err", err))
 		return err
 	}
+	s.compensateShareToken(ctx, token.AccessToken, model.OpenaiAccount{Account: account.Account})
 	account.ShareToken = shareToken
 	account.ShareTokenEncrypt = shareTokenEncrypt
 	account.ExpireAt = time.Unix(expireIn, 0)
 	account.CreateTime = now
 	account.UpdateTime = now
-	err = s.openaiAccountRepository.Create(ctx, account)
-
-	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
-		return err
-	}
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.openaiAccountRepository.Create(ctx, account); err != nil {
+			s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
+			return err
+		}
+		return nil
+	})
 }
 
 func (s *openaiAccountService) SearchAccount(ctx context.Context, tokenId int64) ([]*model.OpenaiAccount, error) {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.SearchAccount")
+	defer span.End()
+
 	return s.openaiAccountRepository.SearchAccount(ctx, tokenId)
 }
 
 func (s *openaiAccountService) DeleteAccount(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.DeleteAccount")
+	defer span.End()
+
 	account, err := s.GetAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetAccount error", zap.Any("err", err))
 		return err
 	}
 	if account == nil {
-		s.logger.Error("account not found")
+		s.logger.WithContext(ctx).Error("account not found")
 		return fmt.Errorf("account not found")
 	}
 
@@ -173,11 +216,11 @@ func (s *openaiAccountService) DeleteAccount(ctx context.Context, id int64) erro
 		return err
 	}
 	if token == nil {
-		s.logger.Error("token not found")
+		s.logger.WithContext(ctx).Error("token not found")
 		return fmt.Errorf("token not found")
 	}
 
-	shareToken, _, expireIn, err := util.GenShareToken(token.AccessToken,
+	shareToken, _, expireIn, err := util.GenShareToken(ctx, token.AccessToken,
 		account.Account,
 		-1,
 		0,
@@ -191,18 +234,27 @@ func (s *openaiAccountService) DeleteAccount(ctx context.Context, id int64) erro
 		false,
 		account.TemporaryChat == 1,
 		s.logger)
-	s.logger.Info("DeleteAccount", zap.Any("shareToken", shareToken), zap.Any("expireIn", expireIn))
+	s.logger.WithContext(ctx).Info("DeleteAccount", zap.Any("shareToken", shareToken), zap.Any("expireIn", expireIn))
 	if err != nil {
 		return err
 	}
-	return s.openaiAccountRepository.DeleteAccount(ctx, id)
+	s.compensateShareToken(ctx, token.AccessToken, *account)
+	return write(ctx, func(ctx context.Context) error {
+		return s.openaiAccountRepository.DeleteAccount(ctx, id)
+	})
 }
 
 func (s *openaiAccountService) GetAccount(ctx context.Context, id int64) (*model.OpenaiAccount, error) {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.GetAccount")
+	defer span.End()
+
 	return s.openaiAccountRepository.GetAccount(ctx, id)
 }
 
 func (s *openaiAccountService) StatisticAccount(ctx context.Context, id int64) (v1.StatisticOpenaiAccountResponseData, error) {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.StatisticAccount")
+	defer span.End()
+
 	token, err := s.openaiTokenRepository.GetToken(ctx, id)
 	if err != nil {
 		return v1.StatisticOpenaiAccountResponseData{}, err
@@ -229,9 +281,9 @@ func (s *openaiAccountService) StatisticAccount(ctx context.Context, id int64) (
 
 	for i, account := range accounts {
 		uniqueNames[i] = account.Account
-		info, err := util.GetShareTokenInfo(account.ShareToken, token.AccessToken, s.logger)
+		info, err := util.GetShareTokenInfo(ctx, account.ShareToken, token.AccessToken, s.logger)
 		if err != nil {
-			s.logger.Error("GetShareTokenInfo error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("GetShareTokenInfo error", zap.Any("err", err))
 			continue
 		}
 		infoList[account.Account] = info
@@ -239,7 +291,7 @@ func (s *openaiAccountService) StatisticAccount(ctx context.Context, id int64) (
 
 	for _, info := range infoList {
 		if info.Usage == nil {
-			s.logger.Error("获取分享用户信息失败, 请检查access_token是否有效")
+			s.logger.WithContext(ctx).Error("获取分享用户信息失败, 请检查access_token是否有效")
 			continue
 		}
 		if _, ok := info.Usage["range"]; ok {
@@ -287,29 +339,91 @@ func contains(slice []string, item string) bool {
 }
 
 func (s *openaiAccountService) DisableAccount(ctx context.Context, id int64) error {
-	account, err := s.GetAccount(ctx, id)
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.DisableAccount")
+	defer span.End()
+
+	return s.deactivate(ctx, id, true)
+}
+
+func (s *openaiAccountService) EnableAccount(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.EnableAccount")
+	defer span.End()
+
+	return s.activate(ctx, id, true)
+}
+
+// SuspendAccount 违规暂停账号: 撤销共享令牌并停用, 保留到期时间, 解除暂停时由 RestoreAccount 恢复
+func (s *openaiAccountService) SuspendAccount(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.SuspendAccount")
+	defer span.End()
+
+	return s.deactivate(ctx, id, false)
+}
+
+// RestoreAccount 解除暂停: 重新生成共享令牌并启用, 不修改到期时间
+func (s *openaiAccountService) RestoreAccount(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.RestoreAccount")
+	defer span.End()
+
+	return s.activate(ctx, id, false)
+}
+
+// RevokeShareToken 只撤销上游的共享令牌, 不修改本地的账号状态与到期时间, 用于本地已停用但上游仍有效的账号
+func (s *openaiAccountService) RevokeShareToken(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiAccountService.RevokeShareToken")
+	defer span.End()
+
+	account, token, err := s.accountWithToken(ctx, id)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
 		return err
 	}
-	if account == nil {
-		s.logger.Error("account not found")
-		return fmt.Errorf("account not found")
+	if err := s.revokeShareToken(ctx, token.AccessToken, account); err != nil {
+		s.logger.WithContext(ctx).Error("RevokeShareToken error", zap.Any("err", err))
+		return err
 	}
+	return nil
+}
 
-	// 查询token是否存在
-	token, err := s.openaiTokenRepository.GetToken(ctx, account.TokenID)
+// deactivate 撤销共享令牌并停用账号, expire 为 true 时到期时间改为当前时间
+func (s *openaiAccountService) deactivate(ctx context.Context, id int64, expire bool) error {
+	account, token, err := s.accountWithToken(ctx, id)
 	if err != nil {
 		return err
 	}
-	if token == nil {
-		s.logger.Error("token not found")
-		return fmt.Errorf("token not found")
+
+	if err := s.revokeShareToken(ctx, token.AccessToken, account); err != nil {
+		return err
+	}
+	s.compensateShareToken(ctx, token.AccessToken, *account)
+	now := time.Now()
+
+	account.Status = 0
+	if expire {
+		account.ExpirationTime = now
 	}
+	account.ExpireAt = now
+	account.UpdateTime = time.Now()
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.openaiAccountRepository.Update(ctx, account); err != nil {
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+			return err
+		}
+		return nil
+	})
+}
 
-	_, _, _, err = util.GenShareToken(token.AccessToken,
+// activate 重新生成共享令牌并启用账号, renew 为 true 时按设置延长有效期
+func (s *openaiAccountService) activate(ctx context.Context, id int64, renew bool) error {
+	account, token, err := s.accountWithToken(ctx, id)
+	if err != nil {
+		return err
+	}
+	enabled := account.Status == 1
+
+	// 生成共享token
+	shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(ctx, token.AccessToken,
 		account.Account,
-		-1,
+		0,
 		account.Gpt35Limit,
 		account.Gpt4Limit,
 		account.Gpt4oLimit,
@@ -322,47 +436,65 @@ func (s *openaiAccountService) DisableAccount(ctx context.Context, id int64) err
 		account.TemporaryChat == 1,
 		s.logger)
 	if err != nil {
+		s.logger.WithContext(ctx).Error("GenerateShareToken error", zap.Any("err", err))
 		return err
 	}
+	s.compensateShareToken(ctx, token.AccessToken, *account)
 	now := time.Now()
-
-	account.Status = 0
-	account.ExpirationTime = now
-	account.ExpireAt = now
-	account.UpdateTime = time.Now()
-	err = s.openaiAccountRepository.Update(ctx, account)
-	if err != nil {
-		s.logger.Error("Update error", zap.Any("err", err))
-		return err
+	account.ShareToken = shareToken
+	account.ShareTokenEncrypt = shareTokenEncrypt
+	account.ExpireAt = time.Unix(expireIn, 0)
+	account.Status = 1
+	if renew {
+		// 按设置延长有效期, 默认一个月
+		account.ExpirationTime = now.Add(s.settings.AccountRenewal(ctx))
 	}
-	return nil
+	account.UpdateTime = now
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.openaiAccountRepository.Update(ctx, account); err != nil {
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
+			return err
+		}
+		// 解除暂停时恢复账号不影响禁用记录, 管理员启用账号时才解除
+		if renew && !enabled {
+			if err := liftDisabled(ctx, s.strikeRepository, account.UserId); err != nil {
+				s.logger.WithContext(ctx).Error("LiftSuspensions error", zap.Any("err", err))
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (s *openaiAccountService) EnableAccount(ctx context.Context, id int64) error {
+// accountWithToken 查询账号及其使用的 token
+func (s *openaiAccountService) accountWithToken(ctx context.Context, id int64) (*model.OpenaiAccount, *model.OpenaiToken, error) {
 	account, err := s.GetAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("GetAccount error", zap.Any("err", err))
-		return err
+		s.logger.WithContext(ctx).Error("GetAccount error", zap.Any("err", err))
+		return nil, nil, err
 	}
 	if account == nil {
-		s.logger.Error("account not found")
-		return fmt.Errorf("account not found")
+		s.logger.WithContext(ctx).Error("account not found")
+		return nil, nil, fmt.Errorf("account not found")
 	}
 
 	// 查询token是否存在
 	token, err := s.openaiTokenRepository.GetToken(ctx, account.TokenID)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	if token == nil {
-		s.logger.Error("token not found")
-		return fmt.Errorf("token not found")
+		s.logger.WithContext(ctx).Error("token not found")
+		return nil, nil, fmt.Errorf("token not found")
 	}
+	return account, token, nil
+}
 
-	// 生成共享token
-	shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(token.AccessToken,
+// revokeShareToken 撤销账号在上游的共享令牌
+func (s *openaiAccountService) revokeShareToken(ctx context.Context, accessToken string, account *model.OpenaiAccount) error {
+	_, _, _, err := util.GenShareToken(ctx, accessToken,
 		account.Account,
-		0,
+		-1,
 		account.Gpt35Limit,
 		account.Gpt4Limit,
 		account.Gpt4oLimit,
@@ -374,22 +506,31 @@ func (s *openaiAccountService) EnableAccount(ctx context.Context, id int64) erro
 		false,
 		account.TemporaryChat == 1,
 		s.logger)
-	if err != nil {
-		s.logger.Error("GenerateShareToken error", zap.Any("err", err))
-		return err
-	}
-	now := time.Now()
-	account.ShareToken = shareToken
-	account.ShareTokenEncrypt = shareTokenEncrypt
-	account.ExpireAt = time.Unix(expireIn, 0)
-	account.Status = 1
-	// 有效期一个月
-	account.ExpirationTime = now.Add(time.Hour * 24 * 30)
-	account.UpdateTime = now
-	err = s.openaiAccountRepository.Update(ctx, account)
-	if err != nil {
-		s.logger.Error("Update error", zap.Any("err", err))
+	return err
+}
+
+// compensateShareToken 生成或撤销共享令牌后登记补偿动作, 事务回滚时按 previous 恢复该账号在上游的共享令牌:
+// previous 为启用状态时按原来的限制重新生成, 否则撤销
+func (s *openaiAccountService) compensateShareToken(ctx context.Context, accessToken string, previous model.OpenaiAccount) {
+	compensate(ctx, "restore share token "+previous.Account, func(ctx context.Context) error {
+		expiresIn := -1
+		if previous.Status == 1 {
+			expiresIn = 0
+		}
+		_, _, _, err := util.GenShareToken(ctx, accessToken,
+			previous.Account,
+			expiresIn,
+			previous.Gpt35Limit,
+			previous.Gpt4Limit,
+			previous.Gpt4oLimit,
+			previous.Gpt4oMiniLimit,
+			previous.O1Limit,
+			previous.O1MiniLimit,
+			previous.ShowConversations == 1,
+			false,
+			false,
+			previous.TemporaryChat == 1,
+			s.logger)
 		return err
-	}
-	return nil
+	})
 }
@@ -5,6 +5,7 @@ import (
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
 	"PandoraFuclaudePlusHelper/internal/util"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"errors"
 	"go.uber.org/zap"
@@ -39,30 +40,39 @@ type openaiTokenService struct {
 }
 
 func (s *openaiTokenService) RefreshToken(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.RefreshToken")
+	defer span.End()
+
 	token, err := s.openaiTokenRepository.GetToken(ctx, id)
 	if err != nil {
-		s.logger.Error("GetToken error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetToken error", zap.Any("err", err))
 		return err
 	}
 	return s.RefreshByToken(ctx, token)
 }
 
 func (s *openaiTokenService) Update(ctx context.Context, token *model.OpenaiToken) error {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.Update")
+	defer span.End()
+
 	return s.RefreshByToken(ctx, token)
 }
 
 func (s *openaiTokenService) Create(ctx context.Context, token *model.OpenaiToken) error {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.Create")
+	defer span.End()
+
 	now := time.Now()
 	// 默认的类型处理
 	token.AccessToken = token.RefreshToken
 	token.PlusSubscription = 0
 	// 使用RefreshToken生成AccessToken
-	accessToken, expiresIn, err := util.GenAccessToken(token.RefreshToken, s.logger)
+	accessToken, expiresIn, err := util.GenAccessToken(ctx, token.RefreshToken, s.logger)
 	if err != nil {
 		return err
 	}
 	// 判断订阅状态
-	plusSubscription := util.CheckSubscriptionStatus(accessToken, s.logger)
+	plusSubscription := util.CheckSubscriptionStatus(ctx, accessToken, s.logger)
 	token.AccessToken = accessToken
 	token.PlusSubscription = plusSubscription
 	token.ExpireAt = now.Add(time.Second * time.Duration(expiresIn))
@@ -71,20 +81,26 @@ func (s *openaiTokenService) Create(ctx context.Context, token *model.OpenaiToke
 
 	err = s.openaiTokenRepository.Create(ctx, token)
 	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
 		return err
 	}
 	return nil
 }
 
 func (s *openaiTokenService) SearchToken(ctx context.Context, keyword string) ([]*model.OpenaiToken, error) {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.SearchToken")
+	defer span.End()
+
 	return s.openaiTokenRepository.SearchToken(ctx, keyword)
 }
 
 func (s *openaiTokenService) DeleteToken(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.DeleteToken")
+	defer span.End()
+
 	accounts, err := s.openaiAccountService.SearchAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("SearchAccount error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("SearchAccount error", zap.Any("err", err))
 		return err
 	}
 	if len(accounts) > 0 {
@@ -94,15 +110,24 @@ func (s *openaiTokenService) DeleteToken(ctx context.Context, id int64) error {
 }
 
 func (s *openaiTokenService) GetToken(ctx context.Context, id int64) (*model.OpenaiToken, error) {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.GetToken")
+	defer span.End()
+
 	token, err := s.openaiTokenRepository.GetToken(ctx, id)
 	return token, err
 }
 
 func (s *openaiTokenService) GetAllToken(ctx context.Context) ([]*model.OpenaiToken, error) {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.GetAllToken")
+	defer span.End()
+
 	return s.openaiTokenRepository.GetAllToken(ctx)
 }
 
 func (s *openaiTokenService) RefreshByToken(ctx context.Context, token *model.OpenaiToken) error {
+	ctx, span := tracing.Start(ctx, "OpenaiTokenService.RefreshByToken")
+	defer span.End()
+
 	//  token是否存在
 	if token.ID == 0 {
 		return errors.New("token not found")
@@ -125,13 +150,13 @@ func (s *openaiTokenService) RefreshByToken(ctx context.Context, token *model.Op
 	his.AccessToken = token.RefreshToken
 	his.RefreshToken = token.RefreshToken
 	// 使用RefreshToken生成AccessToken
-	accessToken, expiresIn, err := util.GenAccessToken(token.RefreshToken, s.logger)
+	accessToken, expiresIn, err := util.GenAccessToken(ctx, token.RefreshToken, s.logger)
 	if err != nil {
-		s.logger.Error("GetAccessTokenByRefreshToken error", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("GetAccessTokenByRefreshToken error", zap.Any("err", err))
 		return err
 	}
 	// 判断订阅状态
-	plusSubscription := util.CheckSubscriptionStatus(accessToken, s.logger)
+	plusSubscription := util.CheckSubscriptionStatus(ctx, accessToken, s.logger)
 	his.PlusSubscription = plusSubscription
 	his.AccessToken = accessToken
 	his.ExpireAt = now.Add(time.Second * time.Duration(expiresIn))
@@ -149,13 +174,13 @@ func (s *openaiTokenService) RefreshByToken(ctx context.Context, token *model.Op
 	}
 	for _, account := range accounts {
 		if account.Status == 0 {
-			s.logger.Info("OpenaiAccount is disabled", zap.Any("account", account))
+			s.logger.WithContext(ctx).Info("OpenaiAccount is disabled", zap.Any("account", account))
 			continue
 		}
 		now := time.Now()
 		// 默认设置为AccessToken
 		account.ShareToken = his.AccessToken
-		shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(his.AccessToken,
+		shareToken, shareTokenEncrypt, expireIn, err := util.GenShareToken(ctx, his.AccessToken,
 			account.Account,
 			0,
 			account.Gpt35Limit,
@@ -170,7 +195,7 @@ func (s *openaiTokenService) RefreshByToken(ctx context.Context, token *model.Op
 			account.TemporaryChat == 1,
 			s.logger)
 		if err != nil {
-			s.logger.Error("GenerateShareToken error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("GenerateShareToken error", zap.Any("err", err))
 			continue
 		}
 		account.ShareToken = shareToken
@@ -179,7 +204,7 @@ func (s *openaiTokenService) RefreshByToken(ctx context.Context, token *model.Op
 		account.UpdateTime = now
 		err = s.openaiAccountRepository.Update(ctx, account)
 		if err != nil {
-			s.logger.Error("Update error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("Update error", zap.Any("err", err))
 		}
 	}
 	return nil
@@ -0,0 +1,257 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/scheduler"
+	"PandoraFuclaudePlusHelper/internal/util"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ReconcileService interface {
+	// Reconcile 逐个核对 OpenAI 账号与上游的共享令牌, 记录差异, 开启自动修复时同时修复
+	Reconcile(ctx context.Context) error
+	SearchDrift(ctx context.Context) ([]*model.ShareTokenDrift, error)
+	// HealDrift 修复一条差异: 本地启用的账号重新生成共享令牌, 本地禁用的账号撤销共享令牌
+	HealDrift(ctx context.Context, id int64) error
+}
+
+func NewReconcileService(service *Service, reconcileRepository repository.ReconcileRepository,
+	openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
+	coordinator *Coordinator) ReconcileService {
+	return &reconcileService{
+		Service:                 service,
+		reconcileRepository:     reconcileRepository,
+		openaiTokenRepository:   openaiTokenRepository,
+		openaiAccountRepository: openaiAccountRepository,
+		openaiAccountService:    coordinator.OpenaiAccountSvc,
+		shareTokenInfo:          util.GetShareTokenInfo,
+	}
+}
+
+type reconcileService struct {
+	*Service
+	reconcileRepository     repository.ReconcileRepository
+	openaiTokenRepository   repository.OpenaiTokenRepository
+	openaiAccountRepository repository.OpenaiAccountRepository
+	openaiAccountService    OpenaiAccountService
+	// shareTokenInfo 查询上游的共享令牌信息
+	shareTokenInfo func(ctx context.Context, shareToken string, accessToken string, logger *log.Logger) (util.ShareTokenInfo, error)
+}
+
+func (s *reconcileService) Reconcile(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "ReconcileService.Reconcile")
+	defer span.End()
+
+	tokens, err := s.openaiTokenRepository.GetAllToken(ctx)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetAllToken error", zap.Any("err", err))
+		return err
+	}
+	type accountTask struct {
+		token   *model.OpenaiToken
+		account *model.OpenaiAccount
+	}
+	var tasks []accountTask
+	for _, token := range tokens {
+		accounts, err := s.openaiAccountRepository.SearchAccount(ctx, token.ID)
+		if err != nil {
+			s.logger.WithContext(ctx).Error("SearchAccount error", zap.Any("err", err))
+			return err
+		}
+		for _, account := range accounts {
+			tasks = append(tasks, accountTask{token: token, account: account})
+		}
+	}
+
+	config := commonConfig.GetConfig()
+	var mu sync.Mutex
+	drifts := make([]*model.ShareTokenDrift, 0)
+	timeout := time.Duration(config.RefreshTimeout) * time.Second
+	util.Parallel(ctx, config.RefreshWorkers, timeout, tasks, func(ctx context.Context, task accountTask) {
+		account := task.account
+		drift, err := s.check(ctx, task.token, account)
+		if err != nil {
+			scheduler.RecordFailure(ctx, model.JobItemOpenaiAccount, account.ID, account.Account, err)
+			return
+		}
+		if drift == nil {
+			scheduler.RecordSkipped(ctx)
+			return
+		}
+		message := fmt.Sprintf("%s: %s", drift.Type, drift.Detail)
+		if config.ReconcileAutoHeal {
+			if err := s.heal(ctx, drift); err != nil {
+				scheduler.RecordFailure(ctx, model.JobItemOpenaiAccount, account.ID, account.Account,
+					fmt.Errorf("%s, heal error: %w", message, err))
+			} else {
+				scheduler.RecordSuccess(ctx, model.JobItemOpenaiAccount, account.ID, account.Account, message+", healed")
+			}
+		} else {
+			scheduler.RecordSuccess(ctx, model.JobItemOpenaiAccount, account.ID, account.Account, message)
+		}
+		mu.Lock()
+		drifts = append(drifts, drift)
+		mu.Unlock()
+	})
+
+	if err := s.reconcileRepository.ReplaceDrifts(ctx, drifts); err != nil {
+		s.logger.WithContext(ctx).Error("ReplaceDrifts error", zap.Any("err", err))
+		return err
+	}
+	s.logger.WithContext(ctx).Info("Reconcile finish", zap.Int("accounts", len(tasks)), zap.Int("drifts", len(drifts)))
+	return nil
+}
+
+// check 核对一个账号, 没有差异时返回 nil
+func (s *reconcileService) check(ctx context.Context, token *model.OpenaiToken, account *model.OpenaiAccount) (*model.ShareTokenDrift, error) {
+	drift := &model.ShareTokenDrift{
+		AccountId:  account.ID,
+		Account:    account.Account,
+		TokenId:    token.ID,
+		Status:     model.DriftOpen,
+		DetectTime: time.Now(),
+	}
+	if account.ShareToken == "" {
+		if account.Status != 1 {
+			return nil, nil
+		}
+		drift.Type = model.DriftRevoked
+		drift.Detail = "local share token is empty"
+		return drift, nil
+	}
+
+	info, err := s.shareTokenInfo(ctx, account.ShareToken, token.AccessToken, s.logger)
+	revoked := errors.Is(err, util.ErrShareTokenNotFound)
+	if err != nil && !revoked {
+		return nil, err
+	}
+	expired := !revoked && info.ExpireAt > 0 && time.Unix(info.ExpireAt, 0).Before(drift.DetectTime)
+
+	if account.Status != 1 {
+		if revoked || expired {
+			return nil, nil
+		}
+		drift.Type = model.DriftActiveDisabled
+		drift.Detail = "account is disabled locally but share token is still valid upstream"
+		if info.ExpireAt > 0 {
+			drift.Detail += fmt.Sprintf(" until %s", time.Unix(info.ExpireAt, 0).Format(time.DateTime))
+		}
+		return drift, nil
+	}
+	switch {
+	case revoked:
+		drift.Type = model.DriftRevoked
+		drift.Detail = "share token not found upstream"
+	case expired:
+		drift.Type = model.DriftExpired
+		drift.Detail = fmt.Sprintf("share token expired upstream at %s", time.Unix(info.ExpireAt, 0).Format(time.DateTime))
+	default:
+		mismatch := limitMismatch(account, &info)
+		if len(mismatch) == 0 {
+			return nil, nil
+		}
+		drift.Type = model.DriftLimitMismatch
+		drift.Detail = strings.Join(mismatch, ", ")
+	}
+	return drift, nil
+}
+
+// limitMismatch 比较本地与上游的使用次数限制, 上游未返回的限制不比较
+func limitMismatch(account *model.OpenaiAccount, info *util.ShareTokenInfo) []string {
+	var mismatch []string
+	for _, limit := range []struct {
+		name     string
+		local    int
+		upstream interface{}
+	}{
+		{"gpt35_limit", account.Gpt35Limit, info.Gpt35Limit},
+		{"gpt4_limit", account.Gpt4Limit, info.Gpt4Limit},
+		{"gpt4o_limit", account.Gpt4oLimit, info.Gpt4oLimit},
+		{"gpt4o_mini_limit", account.Gpt4oMiniLimit, info.Gpt4oMiniLimit},
+		{"o1_limit", account.O1Limit, info.O1Limit},
+		{"o1_mini_limit", account.O1MiniLimit, info.O1MiniLimit},
+	} {
+		if limit.upstream == nil {
+			continue
+		}
+		upstream, err := cast.ToIntE(limit.upstream)
+		if err != nil || upstream != limit.local {
+			mismatch = append(mismatch, fmt.Sprintf("%s local %d upstream %v", limit.name, limit.local, limit.upstream))
+		}
+	}
+	return mismatch
+}
+
+// heal 按账号当前的本地状态修复差异, 并记录修复结果
+func (s *reconcileService) heal(ctx context.Context, drift *model.ShareTokenDrift) error {
+	account, err := s.openaiAccountRepository.GetAccount(ctx, drift.AccountId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return v1.ErrNotFound
+		}
+		return err
+	}
+	if account.Status == 1 {
+		// 按本地的限制重新生成共享令牌, 不改变账号的有效期
+		err = s.openaiAccountService.Update(ctx, account)
+		drift.HealMessage = "share token reissued"
+	} else {
+		// 只撤销上游的共享令牌, 本地已是停用状态, 不改变到期时间与更新时间
+		err = s.openaiAccountService.RevokeShareToken(ctx, account.ID)
+		drift.HealMessage = "share token revoked"
+	}
+	if err != nil {
+		drift.HealMessage = err.Error()
+		return err
+	}
+	drift.Status = model.DriftHealed
+	drift.HealTime = time.Now()
+	return nil
+}
+
+func (s *reconcileService) SearchDrift(ctx context.Context) ([]*model.ShareTokenDrift, error) {
+	ctx, span := tracing.Start(ctx, "ReconcileService.SearchDrift")
+	defer span.End()
+
+	return s.reconcileRepository.SearchDrift(ctx)
+}
+
+func (s *reconcileService) HealDrift(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "ReconcileService.HealDrift")
+	defer span.End()
+
+	drift, err := s.reconcileRepository.GetDrift(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return v1.ErrNotFound
+		}
+		s.logger.WithContext(ctx).Error("GetDrift error", zap.Any("err", err))
+		return err
+	}
+	if drift.Status == model.DriftHealed {
+		return nil
+	}
+	healErr := s.heal(ctx, drift)
+	if healErr != nil {
+		s.logger.WithContext(ctx).Error("HealDrift error", zap.Int64("accountId", drift.AccountId), zap.Any("err", healErr))
+	}
+	if err := s.reconcileRepository.UpdateDrift(ctx, drift); err != nil {
+		s.logger.WithContext(ctx).Error("UpdateDrift error", zap.Any("err", err))
+		return err
+	}
+	return healErr
+}
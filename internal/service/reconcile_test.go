@@ -0,0 +1,148 @@
+package service
+
+import (
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/util"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestReconcileCheck(t *testing.T) {
+	errUpstream := errors.New("upstream unavailable")
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+	tests := []struct {
+		name    string
+		account model.OpenaiAccount
+		info    util.ShareTokenInfo
+		infoErr error
+		// wantType 为空时没有差异
+		wantType   string
+		wantDetail string
+		wantErr    bool
+	}{
+		{name: "in sync", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1", Gpt4Limit: 10},
+			info: util.ShareTokenInfo{ExpireAt: future, Gpt4Limit: float64(10)}},
+		{name: "revoked", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1"},
+			infoErr: util.ErrShareTokenNotFound, wantType: model.DriftRevoked, wantDetail: "share token not found upstream"},
+		{name: "revoked while disabled", account: model.OpenaiAccount{Status: 0, ShareToken: "fk-1"},
+			infoErr: util.ErrShareTokenNotFound},
+		{name: "expired", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1"},
+			info: util.ShareTokenInfo{ExpireAt: past}, wantType: model.DriftExpired},
+		{name: "expired while disabled", account: model.OpenaiAccount{Status: 0, ShareToken: "fk-1"},
+			info: util.ShareTokenInfo{ExpireAt: past}},
+		{name: "active while disabled", account: model.OpenaiAccount{Status: 0, ShareToken: "fk-1"},
+			info: util.ShareTokenInfo{ExpireAt: 0}, wantType: model.DriftActiveDisabled,
+			wantDetail: "account is disabled locally but share token is still valid upstream"},
+		{name: "limit mismatch", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1", Gpt4Limit: 10, O1Limit: 5},
+			info:     util.ShareTokenInfo{ExpireAt: future, Gpt4Limit: float64(20), O1Limit: "5"},
+			wantType: model.DriftLimitMismatch, wantDetail: "gpt4_limit local 10 upstream 20"},
+		// 上游未返回的限制不比较
+		{name: "upstream limit missing", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1", Gpt4Limit: 10},
+			info: util.ShareTokenInfo{ExpireAt: future}},
+		{name: "upstream limit not numeric", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1", Gpt4Limit: 10},
+			info:     util.ShareTokenInfo{ExpireAt: future, Gpt4Limit: "unlimited"},
+			wantType: model.DriftLimitMismatch, wantDetail: "gpt4_limit local 10 upstream unlimited"},
+		// 本地没有共享令牌时不查询上游
+		{name: "empty local share token", account: model.OpenaiAccount{Status: 1},
+			infoErr: errUpstream, wantType: model.DriftRevoked, wantDetail: "local share token is empty"},
+		{name: "empty local share token while disabled", account: model.OpenaiAccount{Status: 0},
+			infoErr: errUpstream},
+		{name: "upstream error", account: model.OpenaiAccount{Status: 1, ShareToken: "fk-1"},
+			infoErr: errUpstream, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &reconcileService{
+				Service: &Service{logger: &log.Logger{Logger: zap.NewNop()}},
+				shareTokenInfo: func(ctx context.Context, shareToken string, accessToken string, logger *log.Logger) (util.ShareTokenInfo, error) {
+					if shareToken != tt.account.ShareToken || accessToken != "access" {
+						t.Errorf("shareTokenInfo(%q, %q), want %q, access", shareToken, accessToken, tt.account.ShareToken)
+					}
+					return tt.info, tt.infoErr
+				},
+			}
+			account := tt.account
+			account.ID = 1
+			drift, err := s.check(context.Background(), &model.OpenaiToken{ID: 2, AccessToken: "access"}, &account)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantType == "" {
+				if drift != nil {
+					t.Errorf("check() = %s: %s, want no drift", drift.Type, drift.Detail)
+				}
+				return
+			}
+			if drift == nil {
+				t.Fatalf("check() = nil, want %s", tt.wantType)
+			}
+			if drift.Type != tt.wantType || drift.AccountId != 1 || drift.TokenId != 2 || drift.Status != model.DriftOpen {
+				t.Errorf("check() = %+v, want type %s", drift, tt.wantType)
+			}
+			if tt.wantDetail != "" && drift.Detail != tt.wantDetail {
+				t.Errorf("check() detail = %q, want %q", drift.Detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+// fakeOpenaiAccountService 记录修复时调用的方法
+type fakeOpenaiAccountService struct {
+	OpenaiAccountService
+	calls []string
+}
+
+func (s *fakeOpenaiAccountService) Update(ctx context.Context, account *model.OpenaiAccount) error {
+	s.calls = append(s.calls, "Update")
+	return nil
+}
+
+func (s *fakeOpenaiAccountService) DisableAccount(ctx context.Context, id int64) error {
+	s.calls = append(s.calls, "DisableAccount")
+	return nil
+}
+
+func (s *fakeOpenaiAccountService) RevokeShareToken(ctx context.Context, id int64) error {
+	s.calls = append(s.calls, "RevokeShareToken")
+	return nil
+}
+
+func TestReconcileHeal(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantCalls   []string
+		wantMessage string
+	}{
+		{name: "enabled reissued", status: 1, wantCalls: []string{"Update"}, wantMessage: "share token reissued"},
+		// 本地已停用的账号只撤销共享令牌, 不通过 DisableAccount 改写到期时间
+		{name: "disabled revoked only", status: 0, wantCalls: []string{"RevokeShareToken"}, wantMessage: "share token revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := &fakeOpenaiAccountService{}
+			s := &reconcileService{
+				Service:                 &Service{logger: &log.Logger{Logger: zap.NewNop()}},
+				openaiAccountRepository: &fakeOpenaiAccountRepository{account: &model.OpenaiAccount{ID: 1, Status: tt.status}},
+				openaiAccountService:    accounts,
+			}
+			drift := &model.ShareTokenDrift{AccountId: 1, Status: model.DriftOpen}
+			if err := s.heal(context.Background(), drift); err != nil {
+				t.Fatalf("heal() error = %v", err)
+			}
+			if !reflect.DeepEqual(accounts.calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", accounts.calls, tt.wantCalls)
+			}
+			if drift.Status != model.DriftHealed || drift.HealMessage != tt.wantMessage {
+				t.Errorf("drift status, message = %d, %q, want healed, %q", drift.Status, drift.HealMessage, tt.wantMessage)
+			}
+		})
+	}
+}
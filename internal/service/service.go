@@ -8,17 +8,19 @@ import (
 )
 
 type Service struct {
-	logger *log.Logger
-	sid    *sid.Sid
-	jwt    *jwt.JWT
-	tm     repository.Transaction
+	logger   *log.Logger
+	sid      *sid.Sid
+	jwt      *jwt.JWT
+	tm       repository.Transaction
+	settings *Settings
 }
 
-func NewService(tm repository.Transaction, logger *log.Logger, sid *sid.Sid, jwt *jwt.JWT) *Service {
+func NewService(tm repository.Transaction, logger *log.Logger, sid *sid.Sid, jwt *jwt.JWT, settings *Settings) *Service {
 	return &Service{
-		logger: logger,
-		sid:    sid,
-		jwt:    jwt,
-		tm:     tm,
+		logger:   logger,
+		sid:      sid,
+		jwt:      jwt,
+		tm:       tm,
+		settings: settings,
 	}
 }
@@ -0,0 +1,100 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type SettingService interface {
+	SearchSetting(ctx context.Context) []*v1.SettingItem
+	UpdateSetting(ctx context.Context, req *v1.UpdateSettingRequest) error
+	ResetSetting(ctx context.Context, name string) error
+}
+
+func NewSettingService(service *Service, settingRepository repository.SettingRepository) SettingService {
+	return &settingService{
+		Service:           service,
+		settingRepository: settingRepository,
+	}
+}
+
+type settingService struct {
+	*Service
+	settingRepository repository.SettingRepository
+}
+
+func (s *settingService) SearchSetting(ctx context.Context) []*v1.SettingItem {
+	ctx, span := tracing.Start(ctx, "SettingService.SearchSetting")
+	defer span.End()
+
+	config := commonConfig.GetConfig()
+	stored := s.settings.Stored(ctx)
+	items := make([]*v1.SettingItem, 0, len(SettingDefinitions))
+	for _, definition := range SettingDefinitions {
+		item := &v1.SettingItem{
+			Name:        definition.Name,
+			Type:        definition.Type,
+			Description: definition.Description,
+			Value:       s.settings.Value(ctx, definition.Name),
+			Default:     definition.Default(config),
+		}
+		if setting, ok := stored[definition.Name]; ok {
+			item.Modified = true
+			item.UpdateTime = &setting.UpdateTime
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s *settingService) UpdateSetting(ctx context.Context, req *v1.UpdateSettingRequest) error {
+	ctx, span := tracing.Start(ctx, "SettingService.UpdateSetting")
+	defer span.End()
+
+	definition := GetSettingDefinition(req.Name)
+	if definition == nil {
+		return v1.ErrInvalidSetting
+	}
+	value := req.Value
+	if definition.Type != model.SettingTypeString {
+		value = strings.TrimSpace(value)
+	}
+	if !definition.Validate(value) {
+		return v1.ErrInvalidSetting
+	}
+	err := s.settingRepository.SaveSetting(ctx, &model.Setting{
+		Name:       definition.Name,
+		Value:      value,
+		UpdateTime: time.Now(),
+	})
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SaveSetting error", zap.Any("err", err))
+		return err
+	}
+	s.settings.Invalidate()
+	return nil
+}
+
+// ResetSetting 删除后台修改的值, 恢复使用配置中的值
+func (s *settingService) ResetSetting(ctx context.Context, name string) error {
+	ctx, span := tracing.Start(ctx, "SettingService.ResetSetting")
+	defer span.End()
+
+	if GetSettingDefinition(name) == nil {
+		return v1.ErrInvalidSetting
+	}
+	if err := s.settingRepository.DeleteSetting(ctx, name); err != nil {
+		s.logger.WithContext(ctx).Error("DeleteSetting error", zap.Any("err", err))
+		return err
+	}
+	s.settings.Invalidate()
+	return nil
+}
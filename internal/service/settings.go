@@ -0,0 +1,214 @@
+package service
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// settingCacheTTL 设置缓存时间, 多副本部署时其他副本修改的设置最迟在此时间后生效
+const settingCacheTTL = 30 * time.Second
+
+// 运行时设置名称
+const (
+	SettingModerationMessage    = "moderationMessage"
+	SettingStrikeSuspendMessage = "strikeSuspendMessage"
+	SettingStrikeDisableMessage = "strikeDisableMessage"
+	SettingHiddenUserInfo       = "hiddenUserInfo"
+	SettingUserExpireDays       = "userExpireDays"
+	SettingAccountRenewDays     = "accountRenewDays"
+)
+
+// SettingDefinition 运行时设置的定义
+type SettingDefinition struct {
+	Name        string
+	Type        string
+	Description string
+	// Min 整数设置的最小值
+	Min int
+	// Default 未在后台修改时的值, 来自配置文件、环境变量或内置默认值
+	Default func(config *commonConfig.Config) string
+}
+
+// SettingDefinitions 可以在后台修改的设置, 按展示顺序排列
+var SettingDefinitions = []*SettingDefinition{
+	{
+		Name:        SettingModerationMessage,
+		Type:        model.SettingTypeString,
+		Description: "消息被审查拦截时返回给用户的提示",
+		Default:     func(config *commonConfig.Config) string { return config.ModerationMessage },
+	},
+	{
+		Name:        SettingStrikeSuspendMessage,
+		Type:        model.SettingTypeString,
+		Description: "账号因违规被暂停时的提示, {until} 替换为暂停截止时间",
+		Default:     func(config *commonConfig.Config) string { return config.StrikeSuspendMessage },
+	},
+	{
+		Name:        SettingStrikeDisableMessage,
+		Type:        model.SettingTypeString,
+		Description: "用户因违规被禁用时的提示",
+		Default:     func(config *commonConfig.Config) string { return config.StrikeDisableMessage },
+	},
+	{
+		Name:        SettingHiddenUserInfo,
+		Type:        model.SettingTypeBool,
+		Description: "是否隐藏上游账号的用户信息",
+		Default:     func(config *commonConfig.Config) string { return strconv.FormatBool(config.HiddenUserInfo) },
+	},
+	{
+		Name:        SettingUserExpireDays,
+		Type:        model.SettingTypeInt,
+		Description: "新增用户未指定过期时间时的有效天数",
+		Min:         1,
+		Default:     func(config *commonConfig.Config) string { return "365" },
+	},
+	{
+		Name:        SettingAccountRenewDays,
+		Type:        model.SettingTypeInt,
+		Description: "启用 OpenAI 账号时延长的有效天数",
+		Min:         1,
+		Default:     func(config *commonConfig.Config) string { return "30" },
+	},
+}
+
+// GetSettingDefinition 按名称查找设置定义, 不存在时返回 nil
+func GetSettingDefinition(name string) *SettingDefinition {
+	for _, definition := range SettingDefinitions {
+		if definition.Name == name {
+			return definition
+		}
+	}
+	return nil
+}
+
+// Validate 检查设置的值能否按类型解析
+func (d *SettingDefinition) Validate(value string) bool {
+	switch d.Type {
+	case model.SettingTypeInt:
+		n, err := strconv.Atoi(value)
+		return err == nil && n >= d.Min
+	case model.SettingTypeBool:
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	}
+	return true
+}
+
+// Settings 读取运行时设置, 后台修改过的设置优先, 否则使用配置中的值
+type Settings struct {
+	logger            *log.Logger
+	settingRepository repository.SettingRepository
+	mu                sync.Mutex
+	values            map[string]*model.Setting
+	expiresAt         time.Time
+}
+
+func NewSettings(logger *log.Logger, settingRepository repository.SettingRepository) *Settings {
+	return &Settings{
+		logger:            logger,
+		settingRepository: settingRepository,
+	}
+}
+
+// Stored 返回后台修改过的设置, 查询失败时沿用上次的结果
+func (s *Settings) Stored(ctx context.Context) map[string]*model.Setting {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values != nil && time.Now().Before(s.expiresAt) {
+		return s.values
+	}
+	settings, err := s.settingRepository.GetSettings(ctx)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetSettings error", zap.Any("err", err))
+		return s.values
+	}
+	values := make(map[string]*model.Setting, len(settings))
+	for _, setting := range settings {
+		values[setting.Name] = setting
+	}
+	s.values = values
+	s.expiresAt = time.Now().Add(settingCacheTTL)
+	return values
+}
+
+// Invalidate 清空缓存, 修改设置后调用
+func (s *Settings) Invalidate() {
+	s.mu.Lock()
+	s.values = nil
+	s.mu.Unlock()
+}
+
+// Value 返回设置当前的值, 存储的值无法解析时使用配置中的值
+func (s *Settings) Value(ctx context.Context, name string) string {
+	definition := GetSettingDefinition(name)
+	if definition == nil {
+		return ""
+	}
+	if setting, ok := s.Stored(ctx)[name]; ok && definition.Validate(setting.Value) {
+		return setting.Value
+	}
+	return definition.Default(commonConfig.GetConfig())
+}
+
+func (s *Settings) Int(ctx context.Context, name string) int {
+	n, _ := strconv.Atoi(s.Value(ctx, name))
+	return n
+}
+
+func (s *Settings) Bool(ctx context.Context, name string) bool {
+	b, _ := strconv.ParseBool(s.Value(ctx, name))
+	return b
+}
+
+// AdminPasswordHash 命令行重置过的管理员密码哈希, 未重置时为空, 使用 ADMIN_PASSWORD
+func (s *Settings) AdminPasswordHash(ctx context.Context) string {
+	if setting, ok := s.Stored(ctx)[model.SettingAdminPassword]; ok {
+		return setting.Value
+	}
+	return ""
+}
+
+// AdminTokenGeneration 管理员令牌当前的代数, 代数不同的令牌已因重置密码失效
+//
+// 其他进程(例如命令行)重置密码后, 最迟在设置缓存过期后生效
+func (s *Settings) AdminTokenGeneration(ctx context.Context) int64 {
+	if setting, ok := s.Stored(ctx)[model.SettingAdminTokenGeneration]; ok {
+		generation, _ := strconv.ParseInt(setting.Value, 10, 64)
+		return generation
+	}
+	return 0
+}
+
+func (s *Settings) ModerationMessage(ctx context.Context) string {
+	return s.Value(ctx, SettingModerationMessage)
+}
+
+func (s *Settings) StrikeSuspendMessage(ctx context.Context) string {
+	return s.Value(ctx, SettingStrikeSuspendMessage)
+}
+
+func (s *Settings) StrikeDisableMessage(ctx context.Context) string {
+	return s.Value(ctx, SettingStrikeDisableMessage)
+}
+
+func (s *Settings) HiddenUserInfo(ctx context.Context) bool {
+	return s.Bool(ctx, SettingHiddenUserInfo)
+}
+
+// UserExpiration 新增用户默认的有效期
+func (s *Settings) UserExpiration(ctx context.Context) time.Duration {
+	return time.Hour * 24 * time.Duration(s.Int(ctx, SettingUserExpireDays))
+}
+
+// AccountRenewal 启用账号时延长的有效期
+func (s *Settings) AccountRenewal(ctx context.Context) time.Duration {
+	return time.Hour * 24 * time.Duration(s.Int(ctx, SettingAccountRenewDays))
+}
@@ -0,0 +1,580 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/internal/scheduler"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// strikeCacheTTL 反代请求识别用户与查询暂停状态的缓存时间
+const strikeCacheTTL = 30 * time.Second
+
+// ModerationIdentity 反代请求中可以用来识别用户的信息
+type ModerationIdentity struct {
+	Product         string
+	ShareToken      string
+	ClaudeAccountId int64
+}
+
+// ModerationUser 识别出的用户与账号, 无法识别时 UserId 为 0
+type ModerationUser struct {
+	UserId      int64
+	UserName    string
+	AccountId   int64
+	Account     string
+	BlockUpload bool
+	BlockImage  bool
+}
+
+type StrikeService interface {
+	ResolveUser(ctx context.Context, identity *ModerationIdentity) *ModerationUser
+	ActiveSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error)
+	SuspensionMessage(ctx context.Context, suspension *model.UserSuspension) string
+	Strike(ctx context.Context, userId int64, product string) (*model.UserSuspension, error)
+	LiftExpired(ctx context.Context) error
+	LiftSuspension(ctx context.Context, id int64) error
+	SearchStrike(ctx context.Context, keyword string) ([]*v1.StrikeUserResponseData, error)
+	ResetStrike(ctx context.Context, userId int64) error
+	SearchSuspension(ctx context.Context, userId int64, status *int) ([]*model.UserSuspension, error)
+
+	CreatePolicy(ctx context.Context, policy *model.StrikePolicy) error
+	UpdatePolicy(ctx context.Context, policy *model.StrikePolicy) error
+	DeletePolicy(ctx context.Context, id int64) error
+	SearchPolicy(ctx context.Context, keyword string) ([]*model.StrikePolicy, error)
+}
+
+func NewStrikeService(service *Service, strikeRepository repository.StrikeRepository,
+	moderationEventRepository repository.ModerationEventRepository, userRepository repository.UserRepository,
+	openaiAccountRepository repository.OpenaiAccountRepository, claudeAccountRepository repository.ClaudeAccountRepository,
+	userService UserService, coordinator *Coordinator) StrikeService {
+	return &strikeService{
+		Service:                   service,
+		strikeRepository:          strikeRepository,
+		moderationEventRepository: moderationEventRepository,
+		userRepository:            userRepository,
+		openaiAccountRepository:   openaiAccountRepository,
+		claudeAccountRepository:   claudeAccountRepository,
+		userService:               userService,
+		openaiAccountService:      coordinator.OpenaiAccountSvc,
+		claudeAccountService:      coordinator.ClaudeAccountSvc,
+		users:                     make(map[string]*userCacheEntry),
+		suspensions:               make(map[int64]*suspensionCacheEntry),
+		strikeLocks:               make(map[int64]*strikeLock),
+	}
+}
+
+type strikeService struct {
+	*Service
+	strikeRepository          repository.StrikeRepository
+	moderationEventRepository repository.ModerationEventRepository
+	userRepository            repository.UserRepository
+	openaiAccountRepository   repository.OpenaiAccountRepository
+	claudeAccountRepository   repository.ClaudeAccountRepository
+	userService               UserService
+	openaiAccountService      OpenaiAccountService
+	claudeAccountService      ClaudeAccountService
+
+	// 每个对话请求都要识别用户并检查暂停状态, 缓存查询结果减少数据库访问
+	mu          sync.Mutex
+	users       map[string]*userCacheEntry
+	suspensions map[int64]*suspensionCacheEntry
+	// strikeLocks 同一用户的 Strike 串行执行, 并发的审查事件不会各自检查后重复触发策略
+	strikeLocks map[int64]*strikeLock
+}
+
+// strikeLock 用户的 Strike 锁, refs 为持有或等待的调用数, 为 0 时从 strikeLocks 中删除
+type strikeLock struct {
+	sync.Mutex
+	refs int
+}
+
+type userCacheEntry struct {
+	user      *ModerationUser
+	expiresAt time.Time
+}
+
+type suspensionCacheEntry struct {
+	suspension *model.UserSuspension
+	expiresAt  time.Time
+}
+
+// ResolveUser 根据共享token或 Claude 账号标识识别用户
+func (s *strikeService) ResolveUser(ctx context.Context, identity *ModerationIdentity) *ModerationUser {
+	ctx, span := tracing.Start(ctx, "StrikeService.ResolveUser")
+	defer span.End()
+
+	key := fmt.Sprintf("%s:%s:%d", identity.Product, identity.ShareToken, identity.ClaudeAccountId)
+	s.mu.Lock()
+	entry, ok := s.users[key]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.user
+	}
+
+	user := &ModerationUser{}
+	switch identity.Product {
+	case model.ModerationProductOpenai:
+		if identity.ShareToken != "" {
+			if account, err := s.openaiAccountRepository.GetAccountByShareToken(ctx, identity.ShareToken); err == nil {
+				user.AccountId, user.Account, user.UserId = account.ID, account.Account, account.UserId
+			}
+		}
+	case model.ModerationProductClaude:
+		if identity.ClaudeAccountId > 0 {
+			if account, err := s.claudeAccountRepository.GetAccount(ctx, identity.ClaudeAccountId); err == nil {
+				user.AccountId, user.Account, user.UserId = account.ID, account.Account, account.UserId
+			}
+		}
+	}
+	if user.UserId > 0 {
+		if u, err := s.userRepository.GetUser(ctx, user.UserId); err == nil {
+			user.UserName = u.UniqueName
+			user.BlockUpload = u.BlockUpload == 1
+			user.BlockImage = u.BlockImage == 1
+		}
+	}
+
+	s.mu.Lock()
+	s.users[key] = &userCacheEntry{user: user, expiresAt: time.Now().Add(strikeCacheTTL)}
+	s.mu.Unlock()
+	return user
+}
+
+// ActiveSuspension 查询用户生效中的暂停记录, 不存在时返回 nil
+func (s *strikeService) ActiveSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error) {
+	if userId <= 0 {
+		return nil, nil
+	}
+	s.mu.Lock()
+	entry, ok := s.suspensions[userId]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.suspension, nil
+	}
+
+	suspension, err := s.strikeRepository.GetActiveSuspension(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.suspensions[userId] = &suspensionCacheEntry{suspension: suspension, expiresAt: time.Now().Add(strikeCacheTTL)}
+	s.mu.Unlock()
+	return suspension, nil
+}
+
+// SuspensionMessage 返回给用户的提示, {until} 替换为暂停截止时间
+func (s *strikeService) SuspensionMessage(ctx context.Context, suspension *model.UserSuspension) string {
+	if suspension.Action == model.StrikeActionDisable {
+		return s.settings.StrikeDisableMessage(ctx)
+	}
+	return strings.ReplaceAll(s.settings.StrikeSuspendMessage(ctx), "{until}", suspension.SuspendUntil.Local().Format(time.DateTime))
+}
+
+// Strike 在用户新增审查事件后检查违规策略, 触发时返回新的暂停记录
+//
+// disable 策略统计窗口内的全部违规, suspend 策略只统计上一次暂停之后的违规, 避免解除暂停后立即再次触发
+func (s *strikeService) Strike(ctx context.Context, userId int64, product string) (*model.UserSuspension, error) {
+	ctx, span := tracing.Start(ctx, "StrikeService.Strike")
+	defer span.End()
+
+	if userId <= 0 {
+		return nil, nil
+	}
+	unlock := s.lockStrike(userId)
+	defer unlock()
+
+	active, err := s.strikeRepository.GetActiveSuspension(ctx, userId)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetActiveSuspension error", zap.Any("err", err))
+		return nil, err
+	}
+	if active != nil {
+		return active, nil
+	}
+
+	policies, err := s.strikeRepository.GetEnablePolicies(ctx)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetEnablePolicies error", zap.Any("err", err))
+		return nil, err
+	}
+	// 先检查禁用策略, 同类策略按触发次数从高到低检查
+	sort.Slice(policies, func(i, j int) bool {
+		if policies[i].Action != policies[j].Action {
+			return policies[i].Action == model.StrikeActionDisable
+		}
+		return policies[i].Threshold > policies[j].Threshold
+	})
+
+	latest, err := s.strikeRepository.GetLatestSuspension(ctx, userId)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetLatestSuspension error", zap.Any("err", err))
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, policy := range policies {
+		if policy.Product != model.ModerationProductAll && policy.Product != product {
+			continue
+		}
+		var since time.Time
+		if policy.WindowMinutes > 0 {
+			since = now.Add(-time.Duration(policy.WindowMinutes) * time.Minute)
+		}
+		if policy.Action == model.StrikeActionSuspend && latest != nil && latest.CreateTime.After(since) {
+			since = latest.CreateTime
+		}
+		strikes, err := s.moderationEventRepository.CountStrike(ctx, userId, policy.Product, since)
+		if err != nil {
+			s.logger.WithContext(ctx).Error("CountStrike error", zap.Any("err", err))
+			return nil, err
+		}
+		if strikes < int64(policy.Threshold) {
+			continue
+		}
+		return s.apply(ctx, userId, policy, strikes)
+	}
+	return nil, nil
+}
+
+// apply 执行策略: suspend 禁用用户的账号, 到期后由定时任务恢复; disable 直接禁用用户
+func (s *strikeService) apply(ctx context.Context, userId int64, policy *model.StrikePolicy, strikes int64) (*model.UserSuspension, error) {
+	now := time.Now()
+	suspension := &model.UserSuspension{
+		UserId:     userId,
+		PolicyId:   policy.ID,
+		Action:     policy.Action,
+		Reason:     fmt.Sprintf("%s: %d strikes", policy.Name, strikes),
+		Strikes:    strikes,
+		Status:     model.SuspensionActive,
+		CreateTime: now,
+	}
+
+	user, err := s.userRepository.GetUser(ctx, userId)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetUser error", zap.Any("err", err))
+		return nil, err
+	}
+	switch policy.Action {
+	case model.StrikeActionDisable:
+		user.Enable = 0
+		if err := s.userService.Update(ctx, user); err != nil {
+			s.logger.WithContext(ctx).Error("Failed to disable user", zap.Any("err", err))
+			return nil, err
+		}
+	default:
+		suspension.SuspendUntil = now.Add(time.Duration(policy.SuspendMinutes) * time.Minute)
+		if account, err := s.openaiAccountRepository.GetAccountByUserId(ctx, userId); err == nil && account.Status == 1 {
+			if err := s.openaiAccountService.SuspendAccount(ctx, account.ID); err != nil {
+				s.logger.WithContext(ctx).Error("Failed to disable OpenAI account", zap.Any("err", err))
+			}
+		}
+		if account, err := s.claudeAccountRepository.GetAccountByUserId(ctx, userId); err == nil && account.Status == 1 {
+			if err := s.claudeAccountService.DisableAccount(ctx, account.ID); err != nil {
+				s.logger.WithContext(ctx).Error("Failed to disable Claude account", zap.Any("err", err))
+			}
+		}
+	}
+
+	// 其他实例已为该用户创建生效中的记录时以已有的记录为准
+	active, err := s.strikeRepository.CreateSuspension(ctx, suspension)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("CreateSuspension error", zap.Any("err", err))
+		return nil, err
+	}
+	s.clearCache()
+	if active != nil {
+		return active, nil
+	}
+	s.logger.WithContext(ctx).Info(fmt.Sprintf("user %s %s by strike policy %s, strikes: %d", user.UniqueName, policy.Action, policy.Name, strikes))
+	return suspension, nil
+}
+
+// lift 解除暂停, suspend 恢复用户仍在使用的账号; disable 只结束记录, 用户需要管理员手动启用
+func (s *strikeService) lift(ctx context.Context, suspension *model.UserSuspension) error {
+	if suspension.Action == model.StrikeActionSuspend {
+		user, err := s.userRepository.GetUser(ctx, suspension.UserId)
+		if err != nil {
+			s.logger.WithContext(ctx).Error("GetUser error", zap.Any("err", err))
+			return err
+		}
+		if user.Enable == 1 && user.ExpirationTime.After(time.Now()) {
+			if user.Openai == 1 {
+				if account, err := s.openaiAccountRepository.GetAccountByUserId(ctx, user.ID); err == nil && account.Status == 0 {
+					if err := s.openaiAccountService.RestoreAccount(ctx, account.ID); err != nil {
+						s.logger.WithContext(ctx).Error("Failed to enable OpenAI account", zap.Any("err", err))
+						return err
+					}
+				}
+			}
+			if user.Claude == 1 {
+				if account, err := s.claudeAccountRepository.GetAccountByUserId(ctx, user.ID); err == nil && account.Status == 0 {
+					if err := s.claudeAccountService.EnableAccount(ctx, account.ID); err != nil {
+						s.logger.WithContext(ctx).Error("Failed to enable Claude account", zap.Any("err", err))
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	suspension.Status = model.SuspensionLifted
+	suspension.LiftTime = time.Now()
+	if err := s.strikeRepository.UpdateSuspension(ctx, suspension); err != nil {
+		s.logger.WithContext(ctx).Error("UpdateSuspension error", zap.Any("err", err))
+		return err
+	}
+	s.clearCache()
+	return nil
+}
+
+// LiftExpired 解除已到期的暂停, 由定时任务调用
+func (s *strikeService) LiftExpired(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "StrikeService.LiftExpired")
+	defer span.End()
+
+	suspensions, err := s.strikeRepository.GetExpiredSuspensions(ctx, time.Now())
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetExpiredSuspensions error", zap.Any("err", err))
+		return err
+	}
+	for _, suspension := range suspensions {
+		if err := s.lift(ctx, suspension); err != nil {
+			scheduler.RecordFailure(ctx, model.JobItemSuspension, suspension.ID, fmt.Sprintf("user %d", suspension.UserId), err)
+			s.logger.WithContext(ctx).Error(fmt.Sprintf("lift suspension %d error: %v", suspension.ID, err))
+			continue
+		}
+		scheduler.RecordSuccess(ctx, model.JobItemSuspension, suspension.ID, fmt.Sprintf("user %d", suspension.UserId), "lifted")
+		s.logger.WithContext(ctx).Info(fmt.Sprintf("suspension %d of user %d lifted", suspension.ID, suspension.UserId))
+	}
+	return nil
+}
+
+// LiftSuspension 管理员手动解除一条生效中的记录
+func (s *strikeService) LiftSuspension(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "StrikeService.LiftSuspension")
+	defer span.End()
+
+	suspension, err := s.strikeRepository.GetSuspension(ctx, id)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetSuspension error", zap.Any("err", err))
+		return err
+	}
+	if suspension.Status != model.SuspensionActive {
+		return nil
+	}
+	return s.lift(ctx, suspension)
+}
+
+// liftDisabled 管理员重新启用用户或账号时解除该用户生效中的 disable 记录, 否则反代仍会按禁用拦截;
+// 反代对暂停状态的缓存最迟 strikeCacheTTL 后过期
+func liftDisabled(ctx context.Context, strikeRepository repository.StrikeRepository, userId int64) error {
+	if userId <= 0 {
+		return nil
+	}
+	_, err := strikeRepository.LiftSuspensions(ctx, userId, model.StrikeActionDisable, time.Now())
+	return err
+}
+
+// SearchStrike 查询有违规记录或处于暂停中的用户
+func (s *strikeService) SearchStrike(ctx context.Context, keyword string) ([]*v1.StrikeUserResponseData, error) {
+	ctx, span := tracing.Start(ctx, "StrikeService.SearchStrike")
+	defer span.End()
+
+	users, err := s.userRepository.SearchUser(ctx, keyword)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchUser error", zap.Any("err", err))
+		return nil, err
+	}
+	userIds := make([]int64, 0, len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.ID)
+	}
+	strikes := make(map[int64]int64)
+	if len(userIds) > 0 {
+		summaries, err := s.moderationEventRepository.StrikeSummary(ctx, userIds)
+		if err != nil {
+			s.logger.WithContext(ctx).Error("StrikeSummary error", zap.Any("err", err))
+			return nil, err
+		}
+		for _, summary := range summaries {
+			strikes[summary.UserId] = summary.Strikes
+		}
+	}
+	status := model.SuspensionActive
+	suspensions, err := s.strikeRepository.SearchSuspension(ctx, 0, &status)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("SearchSuspension error", zap.Any("err", err))
+		return nil, err
+	}
+	active := make(map[int64]*model.UserSuspension)
+	for _, suspension := range suspensions {
+		if _, ok := active[suspension.UserId]; !ok {
+			active[suspension.UserId] = suspension
+		}
+	}
+
+	result := make([]*v1.StrikeUserResponseData, 0)
+	for _, user := range users {
+		if strikes[user.ID] == 0 && active[user.ID] == nil {
+			continue
+		}
+		result = append(result, &v1.StrikeUserResponseData{
+			UserId:     user.ID,
+			UniqueName: user.UniqueName,
+			Enable:     user.Enable,
+			Strikes:    strikes[user.ID],
+			Suspension: active[user.ID],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Strikes > result[j].Strikes
+	})
+	return result, nil
+}
+
+// ResetStrike 清零用户的违规次数并解除生效中的暂停
+func (s *strikeService) ResetStrike(ctx context.Context, userId int64) error {
+	ctx, span := tracing.Start(ctx, "StrikeService.ResetStrike")
+	defer span.End()
+
+	if err := s.moderationEventRepository.ResetStrike(ctx, userId); err != nil {
+		s.logger.WithContext(ctx).Error("ResetStrike error", zap.Any("err", err))
+		return err
+	}
+	active, err := s.strikeRepository.GetActiveSuspension(ctx, userId)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetActiveSuspension error", zap.Any("err", err))
+		return err
+	}
+	if active != nil {
+		return s.lift(ctx, active)
+	}
+	s.clearCache()
+	return nil
+}
+
+func (s *strikeService) SearchSuspension(ctx context.Context, userId int64, status *int) ([]*model.UserSuspension, error) {
+	ctx, span := tracing.Start(ctx, "StrikeService.SearchSuspension")
+	defer span.End()
+
+	return s.strikeRepository.SearchSuspension(ctx, userId, status)
+}
+
+func (s *strikeService) CreatePolicy(ctx context.Context, policy *model.StrikePolicy) error {
+	ctx, span := tracing.Start(ctx, "StrikeService.CreatePolicy")
+	defer span.End()
+
+	if err := validateStrikePolicy(policy); err != nil {
+		return err
+	}
+	now := time.Now()
+	policy.ID = 0
+	policy.CreateTime = now
+	policy.UpdateTime = now
+	if err := s.strikeRepository.CreatePolicy(ctx, policy); err != nil {
+		s.logger.WithContext(ctx).Error("CreatePolicy error", zap.Any("err", err))
+		return err
+	}
+	return nil
+}
+
+func (s *strikeService) UpdatePolicy(ctx context.Context, policy *model.StrikePolicy) error {
+	ctx, span := tracing.Start(ctx, "StrikeService.UpdatePolicy")
+	defer span.End()
+
+	if err := validateStrikePolicy(policy); err != nil {
+		return err
+	}
+	oldPolicy, err := s.strikeRepository.GetPolicy(ctx, policy.ID)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("GetPolicy error", zap.Any("err", err))
+		return err
+	}
+	policy.CreateTime = oldPolicy.CreateTime
+	policy.UpdateTime = time.Now()
+	if err := s.strikeRepository.UpdatePolicy(ctx, policy); err != nil {
+		s.logger.WithContext(ctx).Error("UpdatePolicy error", zap.Any("err", err))
+		return err
+	}
+	return nil
+}
+
+func (s *strikeService) DeletePolicy(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "StrikeService.DeletePolicy")
+	defer span.End()
+
+	return s.strikeRepository.DeletePolicy(ctx, id)
+}
+
+func (s *strikeService) SearchPolicy(ctx context.Context, keyword string) ([]*model.StrikePolicy, error) {
+	ctx, span := tracing.Start(ctx, "StrikeService.SearchPolicy")
+	defer span.End()
+
+	return s.strikeRepository.SearchPolicy(ctx, keyword)
+}
+
+// lockStrike 获取用户的 Strike 锁, 返回释放锁的函数
+func (s *strikeService) lockStrike(userId int64) func() {
+	s.mu.Lock()
+	lock, ok := s.strikeLocks[userId]
+	if !ok {
+		lock = &strikeLock{}
+		s.strikeLocks[userId] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		s.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(s.strikeLocks, userId)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *strikeService) clearCache() {
+	s.mu.Lock()
+	s.users = make(map[string]*userCacheEntry)
+	s.suspensions = make(map[int64]*suspensionCacheEntry)
+	s.mu.Unlock()
+}
+
+// validateStrikePolicy 补全默认值并校验策略
+func validateStrikePolicy(policy *model.StrikePolicy) error {
+	if policy.Product == "" {
+		policy.Product = model.ModerationProductAll
+	}
+	if policy.Action == "" {
+		policy.Action = model.StrikeActionSuspend
+	}
+	switch policy.Product {
+	case model.ModerationProductAll, model.ModerationProductOpenai, model.ModerationProductClaude:
+	default:
+		return v1.ErrInvalidStrikePolicy
+	}
+	if policy.Threshold <= 0 || policy.WindowMinutes < 0 {
+		return v1.ErrInvalidStrikePolicy
+	}
+	switch policy.Action {
+	case model.StrikeActionSuspend:
+		if policy.SuspendMinutes <= 0 {
+			return v1.ErrInvalidStrikePolicy
+		}
+	case model.StrikeActionDisable:
+	default:
+		return v1.ErrInvalidStrikePolicy
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+func TestValidateStrikePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      model.StrikePolicy
+		wantProduct string
+		wantAction  string
+		wantErr     bool
+	}{
+		{name: "defaults", policy: model.StrikePolicy{Threshold: 3, SuspendMinutes: 60},
+			wantProduct: model.ModerationProductAll, wantAction: model.StrikeActionSuspend},
+		{name: "disable without duration", policy: model.StrikePolicy{Product: model.ModerationProductClaude, Threshold: 1, Action: model.StrikeActionDisable},
+			wantProduct: model.ModerationProductClaude, wantAction: model.StrikeActionDisable},
+		{name: "suspend without duration", policy: model.StrikePolicy{Threshold: 3}, wantErr: true},
+		{name: "zero threshold", policy: model.StrikePolicy{SuspendMinutes: 60}, wantErr: true},
+		{name: "negative window", policy: model.StrikePolicy{Threshold: 3, WindowMinutes: -1, SuspendMinutes: 60}, wantErr: true},
+		{name: "unknown product", policy: model.StrikePolicy{Product: "gemini", Threshold: 3, SuspendMinutes: 60}, wantErr: true},
+		{name: "unknown action", policy: model.StrikePolicy{Threshold: 3, Action: "ban"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			err := validateStrikePolicy(&policy)
+			if tt.wantErr {
+				if !errors.Is(err, v1.ErrInvalidStrikePolicy) {
+					t.Errorf("validateStrikePolicy() error = %v, want ErrInvalidStrikePolicy", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateStrikePolicy() error = %v", err)
+			}
+			if policy.Product != tt.wantProduct || policy.Action != tt.wantAction {
+				t.Errorf("product, action = %s, %s, want %s, %s", policy.Product, policy.Action, tt.wantProduct, tt.wantAction)
+			}
+		})
+	}
+}
+
+// fakeStrikeRepository 内存中的暂停记录, CreateSuspension 不检查已有记录, 用于验证服务自身的串行化
+type fakeStrikeRepository struct {
+	repository.StrikeRepository
+	mu          sync.Mutex
+	policies    []*model.StrikePolicy
+	suspensions []*model.UserSuspension
+}
+
+func (r *fakeStrikeRepository) GetEnablePolicies(ctx context.Context) ([]*model.StrikePolicy, error) {
+	return r.policies, nil
+}
+
+func (r *fakeStrikeRepository) GetActiveSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, suspension := range r.suspensions {
+		if suspension.UserId == userId && suspension.Status == model.SuspensionActive {
+			return suspension, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeStrikeRepository) GetLatestSuspension(ctx context.Context, userId int64) (*model.UserSuspension, error) {
+	return nil, nil
+}
+
+func (r *fakeStrikeRepository) CreateSuspension(ctx context.Context, suspension *model.UserSuspension) (*model.UserSuspension, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	suspension.ID = int64(len(r.suspensions) + 1)
+	r.suspensions = append(r.suspensions, suspension)
+	return nil, nil
+}
+
+// fakeModerationEventRepository 返回固定的违规次数, 统计前等待一段时间让并发的调用交错执行
+type fakeModerationEventRepository struct {
+	repository.ModerationEventRepository
+	strikes int64
+}
+
+func (r *fakeModerationEventRepository) CountStrike(ctx context.Context, userId int64, product string, since time.Time) (int64, error) {
+	time.Sleep(10 * time.Millisecond)
+	return r.strikes, nil
+}
+
+type fakeUserRepository struct {
+	repository.UserRepository
+}
+
+func (r *fakeUserRepository) GetUser(ctx context.Context, id int64) (*model.User, error) {
+	return &model.User{ID: id, UniqueName: "alice", Enable: 1}, nil
+}
+
+// fakeOpenaiAccountRepository account 为 nil 时按用户查询账号返回不存在
+type fakeOpenaiAccountRepository struct {
+	repository.OpenaiAccountRepository
+	account *model.OpenaiAccount
+}
+
+func (r *fakeOpenaiAccountRepository) GetAccount(ctx context.Context, id int64) (*model.OpenaiAccount, error) {
+	if r.account == nil || r.account.ID != id {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.account, nil
+}
+
+func (r *fakeOpenaiAccountRepository) GetAccountByUserId(ctx context.Context, id int64) (*model.OpenaiAccount, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeClaudeAccountRepository struct {
+	repository.ClaudeAccountRepository
+}
+
+func (r *fakeClaudeAccountRepository) GetAccountByUserId(ctx context.Context, id int64) (*model.ClaudeAccount, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func TestStrikeConcurrent(t *testing.T) {
+	strikes := &fakeStrikeRepository{policies: []*model.StrikePolicy{
+		{ID: 1, Name: "spam", Product: model.ModerationProductAll, Threshold: 3, Action: model.StrikeActionSuspend, SuspendMinutes: 60},
+	}}
+	s := &strikeService{
+		Service:                   &Service{logger: &log.Logger{Logger: zap.NewNop()}},
+		strikeRepository:          strikes,
+		moderationEventRepository: &fakeModerationEventRepository{strikes: 3},
+		userRepository:            &fakeUserRepository{},
+		openaiAccountRepository:   &fakeOpenaiAccountRepository{},
+		claudeAccountRepository:   &fakeClaudeAccountRepository{},
+		users:                     make(map[string]*userCacheEntry),
+		suspensions:               make(map[int64]*suspensionCacheEntry),
+		strikeLocks:               make(map[int64]*strikeLock),
+	}
+
+	// 同一用户的两个审查事件同时达到阈值, 只创建一条暂停记录, 两次调用返回同一条记录
+	results := make([]*model.UserSuspension, 2)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			suspension, err := s.Strike(context.Background(), 1, model.ModerationProductOpenai)
+			if err != nil {
+				t.Errorf("Strike() error = %v", err)
+			}
+			results[i] = suspension
+		}(i)
+	}
+	wg.Wait()
+
+	if len(strikes.suspensions) != 1 {
+		t.Fatalf("suspensions = %d, want 1", len(strikes.suspensions))
+	}
+	for i, suspension := range results {
+		if suspension != strikes.suspensions[0] {
+			t.Errorf("Strike() #%d = %v, want %v", i, suspension, strikes.suspensions[0])
+		}
+	}
+	if len(s.strikeLocks) != 0 {
+		t.Errorf("strikeLocks = %d, want released", len(s.strikeLocks))
+	}
+}
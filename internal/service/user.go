@@ -1,11 +1,14 @@
 package service
 
 import (
+	v1 "PandoraFuclaudePlusHelper/api/v1"
 	"PandoraFuclaudePlusHelper/internal/model"
 	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
 	"context"
 	"errors"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 	"time"
 )
 
@@ -21,7 +24,7 @@ type UserService interface {
 func NewUserService(service *Service, userRepository repository.UserRepository,
 	openaiTokenRepository repository.OpenaiTokenRepository, openaiAccountRepository repository.OpenaiAccountRepository,
 	claudeTokenRepository repository.ClaudeTokenRepository, claudeAccountRepository repository.ClaudeAccountRepository,
-	coordinator *Coordinator) UserService {
+	strikeRepository repository.StrikeRepository, coordinator *Coordinator) UserService {
 	return &userService{
 		Service:                 service,
 		userRepository:          userRepository,
@@ -29,6 +32,7 @@ func NewUserService(service *Service, userRepository repository.UserRepository,
 		openaiAccountRepository: openaiAccountRepository,
 		claudeTokenRepository:   claudeTokenRepository,
 		claudeAccountRepository: claudeAccountRepository,
+		strikeRepository:        strikeRepository,
 		openaiAccountService:    coordinator.OpenaiAccountSvc,
 		claudeAccountService:    coordinator.ClaudeAccountSvc,
 	}
@@ -41,22 +45,57 @@ type userService struct {
 	openaiAccountRepository repository.OpenaiAccountRepository
 	claudeTokenRepository   repository.ClaudeTokenRepository
 	claudeAccountRepository repository.ClaudeAccountRepository
+	strikeRepository        repository.StrikeRepository
 	openaiAccountService    OpenaiAccountService
 	claudeAccountService    ClaudeAccountService
 }
 
 func (s *userService) Create(ctx context.Context, user *model.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.Create")
+	defer span.End()
+
+	// 先生成共享令牌, 再在一个事务中写入用户与账号, 任一步骤失败时不写入本地数据并撤销已生成的共享令牌
+	return s.transaction(ctx, func(ctx context.Context) error {
+		return s.create(ctx, user)
+	})
+}
+
+func (s *userService) create(ctx context.Context, user *model.User) error {
+	// 用户名或密码重复时写入会失败, 先检查, 避免在此之前调用上游
+	exists, err := s.userRepository.ExistsUser(ctx, user.UniqueName, user.Password)
+	if err != nil {
+		s.logger.WithContext(ctx).Error("ExistsUser error", zap.Any("err", err))
+		return err
+	}
+	if exists {
+		return v1.ErrUserAlreadyExists
+	}
+
 	now := time.Now()
 	// 默认的类型处理
 	if user.ExpirationTime.IsZero() {
-		user.ExpirationTime = now.Add(time.Hour * time.Duration(24*365))
+		user.ExpirationTime = now.Add(s.settings.UserExpiration(ctx))
 	}
 	user.CreateTime = now
 	user.UpdateTime = now
 
-	err := s.userRepository.Create(ctx, user)
+	// 在 transaction 中写入延迟到最后执行, 写入用户后才有用户 ID, 再补到随后写入的账号上
+	var openaiAccount *model.OpenaiAccount
+	var claudeAccount *model.ClaudeAccount
+	err = write(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.Create(ctx, user); err != nil {
+			s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
+			return err
+		}
+		if openaiAccount != nil {
+			openaiAccount.UserId = user.ID
+		}
+		if claudeAccount != nil {
+			claudeAccount.UserId = user.ID
+		}
+		return nil
+	})
 	if err != nil {
-		s.logger.Error("Create error", zap.Any("err", err))
 		return err
 	}
 	// 未启用账户，新增完毕直接返回
@@ -67,15 +106,15 @@ func (s *userService) Create(ctx context.Context, user *model.User) error {
 	if user.Openai == 1 && user.OpenaiToken > 0 {
 		token, err := s.openaiTokenRepository.GetToken(ctx, user.OpenaiToken)
 		if err != nil {
-			s.logger.Error("GetToken error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("GetToken error", zap.Any("err", err))
 			return err
 		}
 		if token == nil {
-			s.logger.Error("token not found")
+			s.logger.WithContext(ctx).Error("token not found")
 			return errors.New("token not found")
 		}
 		// 组装一个Account
-		account := &model.OpenaiAccount{
+		openaiAccount = &model.OpenaiAccount{
 			UserId:            user.ID,
 			Account:           user.UniqueName,
 			ExpirationTime:    user.ExpirationTime,
@@ -90,9 +129,9 @@ func (s *userService) Create(ctx context.Context, user *model.User) error {
 			TemporaryChat:     0,
 			TokenID:           token.ID,
 		}
-		err = s.openaiAccountService.Create(ctx, account)
+		err = s.openaiAccountService.Create(ctx, openaiAccount)
 		if err != nil {
-			s.logger.Error("Create error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
 			return err
 		}
 	}
@@ -100,23 +139,23 @@ func (s *userService) Create(ctx context.Context, user *model.User) error {
 	if user.Claude == 1 && user.ClaudeToken > 0 {
 		token, err := s.claudeTokenRepository.GetToken(ctx, user.ClaudeToken)
 		if err != nil {
-			s.logger.Error("GetToken error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("GetToken error", zap.Any("err", err))
 			return err
 		}
 		if token == nil {
-			s.logger.Error("token not found")
+			s.logger.WithContext(ctx).Error("token not found")
 			return errors.New("token not found")
 		}
 		// 组装一个Account
-		account := &model.ClaudeAccount{
+		claudeAccount = &model.ClaudeAccount{
 			UserId:  user.ID,
 			Account: user.UniqueName,
 			Status:  1,
 			TokenID: token.ID,
 		}
-		err = s.claudeAccountService.Create(ctx, account)
+		err = s.claudeAccountService.Create(ctx, claudeAccount)
 		if err != nil {
-			s.logger.Error("Create error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("Create error", zap.Any("err", err))
 			return err
 		}
 	}
@@ -124,23 +163,33 @@ func (s *userService) Create(ctx context.Context, user *model.User) error {
 }
 
 func (s *userService) Update(ctx context.Context, user *model.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.Update")
+	defer span.End()
+
+	// 先更新上游的共享令牌, 再在一个事务中更新用户与账号, 任一步骤失败时不写入本地数据并恢复上游的共享令牌
+	return s.transaction(ctx, func(ctx context.Context) error {
+		return s.update(ctx, user)
+	})
+}
+
+func (s *userService) update(ctx context.Context, user *model.User) error {
 	// 获取当前用户信息
 	his, err := s.userRepository.GetUser(ctx, user.ID)
 	if err != nil {
-		s.logger.Error("Failed to get user", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("Failed to get user", zap.Any("err", err))
 		return err
 	}
 
 	// 获取 OpenAI 账号信息
 	account, err := s.openaiAccountRepository.GetAccountByUserId(ctx, user.ID)
 	if err != nil {
-		s.logger.Error("Failed to get OpenAI account", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("Failed to get OpenAI account", zap.Any("err", err))
 	}
 
 	// 获取 Claude 账号信息
 	claudeAccount, err := s.claudeAccountRepository.GetAccountByUserId(ctx, user.ID)
 	if err != nil {
-		s.logger.Error("Failed to get Claude account", zap.Any("err", err))
+		s.logger.WithContext(ctx).Error("Failed to get Claude account", zap.Any("err", err))
 	}
 
 	// 处理用户启用状态
@@ -152,7 +201,7 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 		// 禁用 OpenAI 账号
 		if account != nil {
 			if err := s.openaiAccountService.DisableAccount(ctx, account.ID); err != nil {
-				s.logger.Error("Failed to disable OpenAI account", zap.Any("err", err))
+				s.logger.WithContext(ctx).Error("Failed to disable OpenAI account", zap.Any("err", err))
 				return err
 			}
 		}
@@ -160,7 +209,7 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 		// 禁用 Claude 账号
 		if claudeAccount != nil {
 			if err := s.claudeAccountService.DisableAccount(ctx, claudeAccount.ID); err != nil {
-				s.logger.Error("Failed to disable Claude account", zap.Any("err", err))
+				s.logger.WithContext(ctx).Error("Failed to disable Claude account", zap.Any("err", err))
 				return err
 			}
 		}
@@ -170,7 +219,7 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 			// 获取 OpenAI Token
 			token, err := s.openaiTokenRepository.GetToken(ctx, user.OpenaiToken)
 			if err != nil || token == nil {
-				s.logger.Error("OpenAI token not found", zap.Any("err", err))
+				s.logger.WithContext(ctx).Error("OpenAI token not found", zap.Any("err", err))
 				return errors.New("OpenAI token not found")
 			}
 
@@ -192,7 +241,7 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 					TokenID:           user.OpenaiToken,
 				}
 				if err := s.openaiAccountService.Create(ctx, account); err != nil {
-					s.logger.Error("Failed to create OpenAI account", zap.Any("err", err))
+					s.logger.WithContext(ctx).Error("Failed to create OpenAI account", zap.Any("err", err))
 					return err
 				}
 			} else {
@@ -202,18 +251,18 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 					account.ExpirationTime = user.ExpirationTime
 					account.Status = 1
 					if err := s.openaiAccountService.Update(ctx, account); err != nil {
-						s.logger.Error("Failed to update OpenAI account", zap.Any("err", err))
+						s.logger.WithContext(ctx).Error("Failed to update OpenAI account", zap.Any("err", err))
 						return err
 					}
 				} else if err := s.openaiAccountService.EnableAccount(ctx, account.ID); err != nil {
-					s.logger.Error("Failed to enable OpenAI account", zap.Any("err", err))
+					s.logger.WithContext(ctx).Error("Failed to enable OpenAI account", zap.Any("err", err))
 					return err
 				}
 			}
 		} else if account != nil {
 			// 禁用不需要的 OpenAI 账号
 			if err := s.openaiAccountService.DisableAccount(ctx, account.ID); err != nil {
-				s.logger.Error("Failed to disable OpenAI account", zap.Any("err", err))
+				s.logger.WithContext(ctx).Error("Failed to disable OpenAI account", zap.Any("err", err))
 				return err
 			}
 		}
@@ -223,7 +272,7 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 			// 获取 Claude Token
 			token, err := s.claudeTokenRepository.GetToken(ctx, user.ClaudeToken)
 			if err != nil || token == nil {
-				s.logger.Error("Claude token not found", zap.Any("err", err))
+				s.logger.WithContext(ctx).Error("Claude token not found", zap.Any("err", err))
 				return errors.New("Claude token not found")
 			}
 
@@ -236,7 +285,7 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 					TokenID: user.ClaudeToken,
 				}
 				if err := s.claudeAccountService.Create(ctx, claudeAccount); err != nil {
-					s.logger.Error("Failed to create Claude account", zap.Any("err", err))
+					s.logger.WithContext(ctx).Error("Failed to create Claude account", zap.Any("err", err))
 					return err
 				}
 			} else {
@@ -245,24 +294,25 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 					claudeAccount.TokenID = user.ClaudeToken
 					claudeAccount.Status = 1
 					if err := s.claudeAccountService.Update(ctx, claudeAccount); err != nil {
-						s.logger.Error("Failed to update Claude account", zap.Any("err", err))
+						s.logger.WithContext(ctx).Error("Failed to update Claude account", zap.Any("err", err))
 						return err
 					}
 				} else if err := s.claudeAccountService.EnableAccount(ctx, claudeAccount.ID); err != nil {
-					s.logger.Error("Failed to enable Claude account", zap.Any("err", err))
+					s.logger.WithContext(ctx).Error("Failed to enable Claude account", zap.Any("err", err))
 					return err
 				}
 			}
 		} else if claudeAccount != nil {
 			// 禁用不需要的 Claude 账号
 			if err := s.claudeAccountService.DisableAccount(ctx, claudeAccount.ID); err != nil {
-				s.logger.Error("Failed to disable Claude account", zap.Any("err", err))
+				s.logger.WithContext(ctx).Error("Failed to disable Claude account", zap.Any("err", err))
 				return err
 			}
 		}
 	}
 
 	// 更新用户信息
+	enabled := his.Enable == 1
 	his.UniqueName = user.UniqueName
 	his.Password = user.Password
 	his.Enable = user.Enable
@@ -278,61 +328,88 @@ func (s *userService) Update(ctx context.Context, user *model.User) error {
 	his.UpdateTime = time.Now()
 
 	// 保存更新后的用户信息
-	if err := s.userRepository.Update(ctx, his); err != nil {
-		s.logger.Error("Failed to update user", zap.Any("err", err))
-		return err
-	}
-
-	return nil
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.Update(ctx, his); err != nil {
+			s.logger.WithContext(ctx).Error("Failed to update user", zap.Any("err", err))
+			return err
+		}
+		if !enabled && his.Enable == 1 {
+			if err := liftDisabled(ctx, s.strikeRepository, his.ID); err != nil {
+				s.logger.WithContext(ctx).Error("LiftSuspensions error", zap.Any("err", err))
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func (s *userService) SearchUser(ctx context.Context, keyword string) ([]*model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.SearchUser")
+	defer span.End()
+
 	return s.userRepository.SearchUser(ctx, keyword)
 }
 
 func (s *userService) DeleteUser(ctx context.Context, id int64) error {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
+	// 先撤销上游的共享令牌, 再在一个事务中删除用户与账号, 任一步骤失败时不写入本地数据并恢复已撤销的共享令牌
+	return s.transaction(ctx, func(ctx context.Context) error {
+		return s.deleteUser(ctx, id)
+	})
+}
+
+func (s *userService) deleteUser(ctx context.Context, id int64) error {
+	// 用户可能只开通了其中一种账号, 未开通的账号不存在
 	account, err := s.openaiAccountRepository.GetAccountByUserId(ctx, id)
-	if err != nil {
-		s.logger.Error("GetAccountByUserId error", zap.Any("err", err))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.WithContext(ctx).Error("GetAccountByUserId error", zap.Any("err", err))
 		return err
 	}
 	// 1.删除 openai account
 	if account != nil {
 		err = s.openaiAccountService.DeleteAccount(ctx, account.ID)
 		if err != nil {
-			s.logger.Error("DeleteAccount error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("DeleteAccount error", zap.Any("err", err))
 			return err
 		}
 	}
 	// 2.删除 claude account
 	claudeAccount, err := s.claudeAccountRepository.GetAccountByUserId(ctx, id)
-	if err != nil {
-		s.logger.Error("GetAccountByUserId error", zap.Any("err", err))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.WithContext(ctx).Error("GetAccountByUserId error", zap.Any("err", err))
 		return err
 	}
 	if claudeAccount != nil {
 		err = s.claudeAccountService.DeleteAccount(ctx, claudeAccount.ID)
 		if err != nil {
-			s.logger.Error("DeleteAccount error", zap.Any("err", err))
+			s.logger.WithContext(ctx).Error("DeleteAccount error", zap.Any("err", err))
 			return err
 		}
 	}
 
 	// 3.删除user
-	err = s.userRepository.DeleteUser(ctx, id)
-	if err != nil {
-		s.logger.Error("DeleteUser error", zap.Any("err", err))
-		return err
-	}
-	return nil
-
+	return write(ctx, func(ctx context.Context) error {
+		if err := s.userRepository.DeleteUser(ctx, id); err != nil {
+			s.logger.WithContext(ctx).Error("DeleteUser error", zap.Any("err", err))
+			return err
+		}
+		return nil
+	})
 }
 
 func (s *userService) GetUser(ctx context.Context, id int64) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUser")
+	defer span.End()
+
 	user, err := s.userRepository.GetUser(ctx, id)
 	return user, err
 }
 
 func (s *userService) GetAllUser(ctx context.Context) ([]*model.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAllUser")
+	defer span.End()
+
 	return s.userRepository.GetAllUser(ctx)
 }
@@ -0,0 +1,148 @@
+package transfer
+
+import (
+	"PandoraFuclaudePlusHelper/internal/backup"
+	"PandoraFuclaudePlusHelper/internal/migration"
+	"PandoraFuclaudePlusHelper/internal/model"
+	"PandoraFuclaudePlusHelper/internal/repository"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// batchSize 每批复制的行数
+const batchSize = 200
+
+// Tables 复制的数据表, 除备份的数据表外还包括任务执行记录; 任务租约只在运行中有效, 对账结果下次对账时重新生成,
+// 迁移记录由目标库的迁移生成
+var Tables = append(append([]backup.Table(nil), backup.Tables...),
+	&model.JobRun{},
+	&model.JobRunItem{},
+)
+
+// Result 一张表的复制结果
+type Result struct {
+	Table string
+	// Source 源数据库中的行数
+	Source int64
+	// Copied 写入的行数
+	Copied int64
+	// Target 复制完成后目标数据库中的行数
+	Target int64
+}
+
+// Transfer 将一个数据库的全部数据复制到另一个数据库, 可以跨驱动
+type Transfer struct {
+	logger *log.Logger
+	source *gorm.DB
+	target *gorm.DB
+}
+
+func NewTransfer(logger *log.Logger, source *gorm.DB, target *gorm.DB) *Transfer {
+	return &Transfer{
+		logger: logger,
+		source: source,
+		target: target,
+	}
+}
+
+// Run 复制所有数据表并校验行数
+//
+// 源数据库需要已执行全部迁移, 目标数据库先执行迁移到最新版本; 目标表中已有数据时,
+// clear 为 true 则先清空, 否则拒绝复制. 数据在源数据库的只读事务中读取, 在目标数据库的一个事务中写入,
+// 失败时目标数据库保持不变
+func (t *Transfer) Run(ctx context.Context, clear bool) ([]*Result, error) {
+	pending, err := migration.NewMigrator(t.source, t.logger).Check(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("check source schema: %w", err)
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("source database has %d pending migrations, run migrate up on it first", pending)
+	}
+	if err := migration.NewMigrator(t.target, t.logger).Up(ctx, 0); err != nil {
+		return nil, fmt.Errorf("migrate target schema: %w", err)
+	}
+
+	sourceRepository := repository.NewBackupRepository(repository.NewRepository(t.logger, t.source))
+	targetRepository := repository.NewRepository(t.logger, t.target)
+	targetBackupRepository := repository.NewBackupRepository(targetRepository)
+
+	if !clear {
+		var nonEmpty []string
+		for _, table := range Tables {
+			count, err := targetBackupRepository.CountTable(ctx, table)
+			if err != nil {
+				return nil, fmt.Errorf("count target %s: %w", table.TableName(), err)
+			}
+			if count > 0 {
+				nonEmpty = append(nonEmpty, fmt.Sprintf("%s(%d)", table.TableName(), count))
+			}
+		}
+		if len(nonEmpty) > 0 {
+			return nil, fmt.Errorf("target tables are not empty: %s", strings.Join(nonEmpty, ", "))
+		}
+	}
+
+	results := make([]*Result, 0, len(Tables))
+	err = sourceRepository.Snapshot(ctx, func(sourceCtx context.Context) error {
+		return targetRepository.Transaction(ctx, func(targetCtx context.Context) error {
+			for _, table := range Tables {
+				result := &Result{Table: table.TableName()}
+				source, err := sourceRepository.CountTable(sourceCtx, table)
+				if err != nil {
+					return fmt.Errorf("count source %s: %w", result.Table, err)
+				}
+				result.Source = source
+				if clear {
+					if err := targetBackupRepository.ClearTable(targetCtx, table); err != nil {
+						return fmt.Errorf("clear target %s: %w", result.Table, err)
+					}
+				}
+				err = sourceRepository.ExportTable(sourceCtx, table, batchSize, func(rows interface{}) error {
+					if err := targetBackupRepository.ImportRows(targetCtx, rows); err != nil {
+						return err
+					}
+					result.Copied += int64(rowCount(rows))
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("copy %s: %w", result.Table, err)
+				}
+				if err := targetBackupRepository.ResetSequence(targetCtx, table); err != nil {
+					return fmt.Errorf("reset sequence %s: %w", result.Table, err)
+				}
+				t.logger.Info("table copied", zap.String("table", result.Table), zap.Int64("rows", result.Copied))
+				results = append(results, result)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 提交后重新统计目标数据库, 确认写入的数据与源数据库一致
+	var mismatch []string
+	for i, table := range Tables {
+		result := results[i]
+		if result.Target, err = targetBackupRepository.CountTable(ctx, table); err != nil {
+			return results, fmt.Errorf("count target %s: %w", result.Table, err)
+		}
+		if result.Target != result.Source || result.Copied != result.Source {
+			mismatch = append(mismatch, result.Table)
+		}
+	}
+	if len(mismatch) > 0 {
+		return results, fmt.Errorf("row counts do not match: %s", strings.Join(mismatch, ", "))
+	}
+	return results, nil
+}
+
+func rowCount(rows interface{}) int {
+	return reflect.Indirect(reflect.ValueOf(rows)).Len()
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/jwt"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClaudeIdentityKey Claude 登录链接中的身份参数, 反代收到后转为同名 cookie
+// fuclaude 的会话中没有可以对应到本系统用户的信息, 审查记录依赖该 cookie 识别账号
+const ClaudeIdentityKey = "helper_uid"
+
+const claudeIdentityPrefix = "claude:"
+
+// ClaudeIdentityLoginUrl 在 Claude 登录链接上附加签名后的账号标识
+func ClaudeIdentityLoginUrl(j *jwt.JWT, loginUrl string, accountId int64, expiresAt time.Time) (string, error) {
+	token, err := j.GenToken(fmt.Sprintf("%s%d", claudeIdentityPrefix, accountId), jwt.AudienceClaudeIdentity, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(loginUrl)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(ClaudeIdentityKey, token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// ParseClaudeIdentity 校验账号标识, 返回 Claude 账号ID与过期时间
+func ParseClaudeIdentity(j *jwt.JWT, token string) (int64, time.Time, error) {
+	claims, err := j.ParseToken(token, jwt.AudienceClaudeIdentity)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !strings.HasPrefix(claims.UserId, claudeIdentityPrefix) || claims.ExpiresAt == nil {
+		return 0, time.Time{}, errors.New("invalid claude identity")
+	}
+	accountId, err := strconv.ParseInt(strings.TrimPrefix(claims.UserId, claudeIdentityPrefix), 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return accountId, claims.ExpiresAt.Time, nil
+}
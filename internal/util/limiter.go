@@ -0,0 +1,79 @@
+package util
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// hostLimiter 按上游主机限制并发请求数, 替代之前每个接口一把全局锁的做法
+type hostLimiter struct {
+	mu         sync.Mutex
+	semaphores map[string]chan struct{}
+}
+
+var upstreamLimiter = &hostLimiter{semaphores: make(map[string]chan struct{})}
+
+func init() {
+	// 并发数配置热更新后按新配置重建, 正在进行的请求仍归还到原来的名额
+	commonConfig.OnReload(func(*commonConfig.Config) {
+		upstreamLimiter.reset()
+	})
+}
+
+// acquireUpstream 等待访问 rawUrl 所在主机的并发名额, ctx 结束时放弃等待
+func acquireUpstream(ctx context.Context, rawUrl string) (func(), error) {
+	semaphore := upstreamLimiter.semaphore(upstreamHost(rawUrl))
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *hostLimiter) semaphore(host string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	semaphore, ok := l.semaphores[host]
+	if !ok {
+		semaphore = make(chan struct{}, hostConcurrency(host))
+		l.semaphores[host] = semaphore
+	}
+	return semaphore
+}
+
+func (l *hostLimiter) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.semaphores = make(map[string]chan struct{})
+}
+
+func upstreamHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return rawUrl
+	}
+	return u.Hostname()
+}
+
+// hostConcurrency 读取 UPSTREAM_HOST_CONCURRENCY 中单个主机的并发数, 未配置时使用 UPSTREAM_CONCURRENCY
+func hostConcurrency(host string) int {
+	concurrency := commonConfig.GetConfig().UpstreamConcurrency
+	for _, item := range strings.Split(commonConfig.GetConfig().UpstreamHostConcurrency, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), host) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			concurrency = n
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return concurrency
+}
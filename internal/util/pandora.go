@@ -3,36 +3,41 @@ package util
 import (
 	commonConfig "PandoraFuclaudePlusHelper/config"
 	"PandoraFuclaudePlusHelper/pkg/log"
+	"PandoraFuclaudePlusHelper/pkg/tracing"
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"net/http"
-	"sync"
 	"time"
 )
 
-var genAccessTokenMutex sync.Mutex
-var checkSubscriptionStatusMutex sync.Mutex
-var genShareTokenMutex sync.Mutex
-var getShareTokenInfoMutex sync.Mutex
-var executeShareAuthMutex sync.Mutex
-var executeClaudeAuthMutex sync.Mutex
+// newClient 创建带链路追踪的 HTTP 客户端, 每次调用单独创建以免共享 Cookie
+func newClient() *resty.Client {
+	return resty.New().SetTransport(tracing.Transport(nil))
+}
+
+const officialTokenUrl = "https://auth0.openai.com/oauth/token"
+
+const checkSubscriptionStatusUrl = "https://new.oaifree.com/backend-api/accounts/check/v4-2023-04-27?timezone_offset_min=-480"
 
 // GenAccessToken generates an access token based on the refresh token
-func GenAccessToken(refreshToken string, logger *log.Logger) (string, int, error) {
-	genAccessTokenMutex.Lock()
-	defer genAccessTokenMutex.Unlock()
+func GenAccessToken(ctx context.Context, refreshToken string, logger *log.Logger) (_ string, _ int, err error) {
+	ctx, span := tracing.Start(ctx, "util.GenAccessToken")
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
 
 	// 优先使用 Pandora 的刷新令牌生成访问令牌
-	accessToken, expiresIn, err := GenAccessTokenPandora(refreshToken, logger)
+	accessToken, expiresIn, err := GenAccessTokenPandora(ctx, refreshToken, logger)
 	if err == nil {
 		return accessToken, expiresIn, nil
 	}
 	// 如果使用 Pandora 的刷新令牌生成访问令牌失败，则使用官方的刷新令牌生成访问令牌
-	accessToken, expiresIn, err = GenAccessTokenOfficial(refreshToken, logger)
+	accessToken, expiresIn, err = GenAccessTokenOfficial(ctx, refreshToken, logger)
 	if err != nil {
 		return "", -1, err
 	} else {
@@ -41,14 +46,24 @@ func GenAccessToken(refreshToken string, logger *log.Logger) (string, int, error
 }
 
 // GenAccessTokenPandora generates an access token based on the refresh token
-func GenAccessTokenPandora(refreshToken string, logger *log.Logger) (string, int, error) {
+func GenAccessTokenPandora(ctx context.Context, refreshToken string, logger *log.Logger) (_ string, _ int, err error) {
+	ctx, span := tracing.Start(ctx, "util.GenAccessTokenPandora")
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
+
+	release, err := acquireUpstream(ctx, commonConfig.GetConfig().TokenUrl)
+	if err != nil {
+		return "", -1, err
+	}
+	defer release()
 
 	var resp struct {
 		AccessToken string `json:"access_token"`
 		ExpiresIn   int    `json:"expires_in"`
 	}
-	client := resty.New()
+	client := newClient()
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
 		SetHeader("User-Agent", fmt.Sprintf("pandora-plus-helper/%s", commonConfig.GetConfig().Version)).
 		SetFormData(map[string]string{
@@ -64,7 +79,7 @@ func GenAccessTokenPandora(refreshToken string, logger *log.Logger) (string, int
 
 	if response.StatusCode() != http.StatusOK {
 		logger.Error(fmt.Sprintf("GenAccessToken by pandora error, code: %d", response.StatusCode()))
-		return "", -1, errors.New(fmt.Sprintf("GenAccessToken by pandora error, code: %d", response.StatusCode))
+		return "", -1, errors.New(fmt.Sprintf("GenAccessToken by pandora error, code: %d", response.StatusCode()))
 
 	}
 
@@ -72,7 +87,10 @@ func GenAccessTokenPandora(refreshToken string, logger *log.Logger) (string, int
 }
 
 // GenAccessTokenOfficial generates an access token based on the refresh token
-func GenAccessTokenOfficial(refreshToken string, logger *log.Logger) (string, int, error) {
+func GenAccessTokenOfficial(ctx context.Context, refreshToken string, logger *log.Logger) (_ string, _ int, err error) {
+	ctx, span := tracing.Start(ctx, "util.GenAccessTokenOfficial")
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
 
 	// 定义并初始化 RefreshRequest 结构体
 	RefreshRequest := struct {
@@ -92,14 +110,21 @@ func GenAccessTokenOfficial(refreshToken string, logger *log.Logger) (string, in
 		ExpiresIn   int    `json:"expires_in"`
 	}
 
-	client := resty.New()
+	release, err := acquireUpstream(ctx, officialTokenUrl)
+	if err != nil {
+		return "", -1, err
+	}
+	defer release()
+
+	client := newClient()
 
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36").
 		SetBody(RefreshRequest).
 		SetResult(&resp).
-		Post("https://auth0.openai.com/oauth/token")
+		Post(officialTokenUrl)
 	if err != nil {
 		logger.Error(fmt.Sprintf("GenAccessToken by official error, response: %v, error: %v", response, err))
 		return "", -1, err
@@ -108,7 +133,7 @@ func GenAccessTokenOfficial(refreshToken string, logger *log.Logger) (string, in
 
 	if response.StatusCode() != http.StatusOK {
 		logger.Error(fmt.Sprintf("GenAccessToken by official error, code: %d", response.StatusCode()))
-		return "", -1, errors.New(fmt.Sprintf("GenAccessToken by official error, code: %d", response.StatusCode))
+		return "", -1, errors.New(fmt.Sprintf("GenAccessToken by official error, code: %d", response.StatusCode()))
 
 	}
 
@@ -116,25 +141,33 @@ func GenAccessTokenOfficial(refreshToken string, logger *log.Logger) (string, in
 }
 
 // CheckSubscriptionStatus GenShareToken generates a share token based on the access token
-func CheckSubscriptionStatus(accessToken string, logger *log.Logger) int {
-
-	checkSubscriptionStatusMutex.Lock()
-	defer checkSubscriptionStatusMutex.Unlock()
+func CheckSubscriptionStatus(ctx context.Context, accessToken string, logger *log.Logger) int {
+	ctx, span := tracing.Start(ctx, "util.CheckSubscriptionStatus")
+	defer span.End()
+	logger = logger.WithContext(ctx)
 
 	if accessToken == "" {
 		logger.Error("CheckSubscriptionStatus: 1, because of empty access token")
 		return 1
 	}
 
-	client := resty.New()
+	release, err := acquireUpstream(ctx, checkSubscriptionStatusUrl)
+	if err != nil {
+		logger.Error(fmt.Sprintf("CheckSubscriptionStatus: 1, because of %v", err))
+		return 1
+	}
+	defer release()
+
+	client := newClient()
 	var responseBody Response
 
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", fmt.Sprintf("pandora-plus-helper/%s", commonConfig.GetConfig().Version)).
 		SetHeader("Authorization", fmt.Sprintf("Bearer %s", accessToken)).
 		SetResult(&responseBody).
-		Get("https://new.oaifree.com/backend-api/accounts/check/v4-2023-04-27?timezone_offset_min=-480")
+		Get(checkSubscriptionStatusUrl)
 
 	if err != nil {
 		logger.Error(fmt.Sprintf("CheckSubscriptionStatus error, response: %v, error: %v", response, err))
@@ -176,7 +209,8 @@ func CheckSubscriptionStatus(accessToken string, logger *log.Logger) int {
 }
 
 // GenShareToken generates a share token based on the access token
-func GenShareToken(accessToken string,
+func GenShareToken(ctx context.Context,
+	accessToken string,
 	uniqueName string,
 	expiresIn int,
 	gpt35Limit int,
@@ -189,10 +223,16 @@ func GenShareToken(accessToken string,
 	showUserinfo bool,
 	resetLimit bool,
 	temporaryChat bool,
-	logger *log.Logger) (string, string, int64, error) {
+	logger *log.Logger) (_ string, _ string, _ int64, err error) {
+	ctx, span := tracing.Start(ctx, "util.GenShareToken", attribute.String("unique_name", uniqueName))
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
 
-	genShareTokenMutex.Lock()
-	defer genShareTokenMutex.Unlock()
+	release, err := acquireUpstream(ctx, commonConfig.GetConfig().ShareTokenUrl)
+	if err != nil {
+		return "", "", -1, err
+	}
+	defer release()
 
 	var resp struct {
 		ExpireAt          int64  `json:"expire_at"`
@@ -209,8 +249,9 @@ func GenShareToken(accessToken string,
 		TokenKey          string `json:"token_key"`
 		UniqueName        string `json:"unique_name"`
 	}
-	client := resty.New()
+	client := newClient()
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
 		SetHeader("User-Agent", fmt.Sprintf("pandora-plus-helper/%s", commonConfig.GetConfig().Version)).
 		SetFormData(map[string]string{
@@ -262,21 +303,31 @@ type ShareTokenInfo struct {
 	UserID         string                 `json:"user_id,omitempty"`
 }
 
-// GetShareTokenInfo gets the share token information based on the share token and access token
-func GetShareTokenInfo(shareToken string, accessToken string, logger *log.Logger) (ShareTokenInfo, error) {
+// ErrShareTokenNotFound 上游不存在该共享令牌, 通常是已被撤销
+var ErrShareTokenNotFound = errors.New("share token not found")
 
-	getShareTokenInfoMutex.Lock()
-	defer getShareTokenInfoMutex.Unlock()
+// GetShareTokenInfo gets the share token information based on the share token and access token
+func GetShareTokenInfo(ctx context.Context, shareToken string, accessToken string, logger *log.Logger) (_ ShareTokenInfo, err error) {
+	ctx, span := tracing.Start(ctx, "util.GetShareTokenInfo")
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
 
 	if shareToken == "" || accessToken == "" {
 		logger.Error("GetShareTokenInfo or accessToken is empty")
 		return ShareTokenInfo{}, errors.New("shareToken or accessToken is empty")
 
 	}
+	release, err := acquireUpstream(ctx, commonConfig.GetConfig().ShareTokenInfoUrl)
+	if err != nil {
+		return ShareTokenInfo{}, err
+	}
+	defer release()
+
 	shareTokenInfoUrl := fmt.Sprintf("%s/%s", commonConfig.GetConfig().ShareTokenInfoUrl, shareToken)
 	var resp ShareTokenInfo
-	client := resty.New()
+	client := newClient()
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", fmt.Sprintf("pandora-plus-helper/%s", commonConfig.GetConfig().Version)).
 		SetHeader("Authorization", fmt.Sprintf("Bearer %s", accessToken)).
@@ -289,6 +340,9 @@ func GetShareTokenInfo(shareToken string, accessToken string, logger *log.Logger
 
 	logger.Info(fmt.Sprintf("GetShareTokenInfo by pandora, StatusCode: %d, responseContent: %s", response.StatusCode(), string(response.Body())))
 
+	if response.StatusCode() == http.StatusNotFound {
+		return ShareTokenInfo{}, ErrShareTokenNotFound
+	}
 	if response.StatusCode() != http.StatusOK {
 		logger.Error(fmt.Sprintf("GetShareTokenInfo error, code: %d", response.StatusCode()))
 		return ShareTokenInfo{}, errors.New(fmt.Sprintf("GetShareTokenInfo error, code: %d", response.StatusCode()))
@@ -298,21 +352,27 @@ func GetShareTokenInfo(shareToken string, accessToken string, logger *log.Logger
 }
 
 // ExecuteShareAuth executes the share auth based on the share token
-func ExecuteShareAuth(shareToken string, logger *log.Logger) (string, error) {
-
-	executeShareAuthMutex.Lock()
-	defer executeShareAuthMutex.Unlock()
+func ExecuteShareAuth(ctx context.Context, shareToken string, logger *log.Logger) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "util.ExecuteShareAuth")
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
 
 	if shareToken == "" {
 		logger.Error("ExecuteShareAuth shareToken is empty")
 		return "", errors.New("shareToken is empty")
 	}
+	release, err := acquireUpstream(ctx, commonConfig.GetConfig().OpenAiAuthSite)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	var resp struct {
 		LoginUrl   string `json:"login_url"`
 		OauthToken string `json:"oauth_token"`
 	}
-	client := resty.New()
+	client := newClient()
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", fmt.Sprintf("pandora-plus-helper/%s", commonConfig.GetConfig().Version)).
 		SetHeader("Origin", commonConfig.GetConfig().OpenAiAuthSite).
@@ -328,7 +388,7 @@ func ExecuteShareAuth(shareToken string, logger *log.Logger) (string, error) {
 
 	if response.StatusCode() != http.StatusOK {
 		logger.Error(fmt.Sprintf("ExecuteShareAuth error, code: %d", response.StatusCode()))
-		return "", errors.New(fmt.Sprintf("ExecuteShareAuth error, code: %d", response.StatusCode))
+		return "", errors.New(fmt.Sprintf("ExecuteShareAuth error, code: %d", response.StatusCode()))
 	}
 
 	if resp.LoginUrl == "" {
@@ -338,10 +398,16 @@ func ExecuteShareAuth(shareToken string, logger *log.Logger) (string, error) {
 	return resp.LoginUrl, nil
 }
 
-func ExecuteClaudeAuth(sessionToken string, accountName string, seconds int, logger *log.Logger) (string, error) {
+func ExecuteClaudeAuth(ctx context.Context, sessionToken string, accountName string, seconds int, logger *log.Logger) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "util.ExecuteClaudeAuth")
+	defer func() { tracing.End(span, err) }()
+	logger = logger.WithContext(ctx)
 
-	executeClaudeAuthMutex.Lock()
-	defer executeClaudeAuthMutex.Unlock()
+	release, err := acquireUpstream(ctx, commonConfig.GetConfig().ClaudeAuthSite)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 
 	var resp struct {
 		ExpiresAt  int64  `json:"expires_at"`
@@ -357,8 +423,9 @@ func ExecuteClaudeAuth(sessionToken string, accountName string, seconds int, log
 		requestBody = fmt.Sprintf(`{"session_key": "%s","unique_name":"%s", "expires_in": %d}`, sessionToken, accountName, seconds)
 	}
 
-	client := resty.New()
+	client := newClient()
 	response, err := client.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", fmt.Sprintf("pandora-plus-helper/%s", commonConfig.GetConfig().Version)).
 		SetBody(requestBody).
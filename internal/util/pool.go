@@ -0,0 +1,41 @@
+package util
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Parallel 使用 workers 个协程并行处理 items, 每项单独设置 timeout 超时, ctx 结束后剩余的项不再处理
+func Parallel[T any](ctx context.Context, workers int, timeout time.Duration, items []T, fn func(ctx context.Context, item T)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+	queue := make(chan T)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				itemCtx, cancel := ctx, context.CancelFunc(func() {})
+				if timeout > 0 {
+					itemCtx, cancel = context.WithTimeout(ctx, timeout)
+				}
+				fn(itemCtx, item)
+				cancel()
+			}
+		}()
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- item
+	}
+	close(queue)
+	wg.Wait()
+}
@@ -12,6 +12,8 @@ import (
 type App struct {
 	name    string
 	servers []server.Server
+	// beforeStart 启动服务前依次执行, 出错时不启动服务
+	beforeStart []func(ctx context.Context) error
 }
 
 type Option func(a *App)
@@ -30,6 +32,13 @@ func WithServer(servers ...server.Server) Option {
 	}
 }
 
+// WithBeforeStart 设置启动服务前需要完成的工作, 例如数据库迁移
+func WithBeforeStart(fns ...func(ctx context.Context) error) Option {
+	return func(a *App) {
+		a.beforeStart = append(a.beforeStart, fns...)
+	}
+}
+
 func WithName(name string) Option {
 	return func(a *App) {
 		a.name = name
@@ -41,6 +50,12 @@ func (a *App) Run(ctx context.Context) error {
 	ctx, cancel = context.WithCancel(ctx)
 	defer cancel()
 
+	for _, fn := range a.beforeStart {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
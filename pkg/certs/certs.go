@@ -0,0 +1,189 @@
+package certs
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reloader 证书热加载器, 定期检查证书文件的修改时间, 变更后重新加载;
+// 证书只在 TLS 握手时读取, 替换证书不会影响已建立的连接 (例如进行中的 SSE 流)
+type Reloader struct {
+	logger   *log.Logger
+	interval time.Duration
+	entries  []*entry
+	mu       sync.RWMutex
+	cancel   context.CancelFunc
+}
+
+type entry struct {
+	hostname string
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	cert     *tls.Certificate
+}
+
+type Option func(r *Reloader)
+
+func NewReloader(logger *log.Logger, opts ...Option) (*Reloader, error) {
+	r := &Reloader{
+		logger:   logger,
+		interval: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if len(r.entries) == 0 {
+		return nil, errors.New("no certificate configured")
+	}
+	for _, e := range r.entries {
+		if err := r.load(e); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// WithDefaultCertificate 默认证书, 在 SNI 未匹配到任何域名时使用
+func WithDefaultCertificate(certFile string, keyFile string) Option {
+	return WithCertificate("", certFile, keyFile)
+}
+
+// WithCertificate 指定域名使用的证书, 域名支持 *.example.com 形式的通配
+func WithCertificate(hostname string, certFile string, keyFile string) Option {
+	return func(r *Reloader) {
+		r.entries = append(r.entries, &entry{
+			hostname: strings.ToLower(strings.TrimSpace(hostname)),
+			certFile: certFile,
+			keyFile:  keyFile,
+		})
+	}
+}
+
+// WithInterval 证书文件的检查间隔
+func WithInterval(interval time.Duration) Option {
+	return func(r *Reloader) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// TLSConfig 返回按 SNI 选择证书的 TLS 配置, 未启用 TLS 时返回 nil
+func (r *Reloader) TLSConfig() *tls.Config {
+	if r == nil {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// GetCertificate 按 SNI 选择证书: 精确匹配优先, 其次通配域名, 最后使用默认证书
+func (r *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	serverName := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	var wildcard, fallback *tls.Certificate
+	for _, e := range r.entries {
+		switch {
+		case e.hostname != "" && e.hostname == serverName:
+			return e.cert, nil
+		case strings.HasPrefix(e.hostname, "*.") && strings.HasSuffix(serverName, e.hostname[1:]):
+			if wildcard == nil {
+				wildcard = e.cert
+			}
+		case e.hostname == "":
+			fallback = e.cert
+		}
+	}
+	if wildcard != nil {
+		return wildcard, nil
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	// 未配置默认证书时使用第一个证书
+	return r.entries[0].cert, nil
+}
+
+func (r *Reloader) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.reload()
+		}
+	}
+}
+
+func (r *Reloader) Stop(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.logger.Info("Certificate reloader stop")
+	return nil
+}
+
+// reload 重新加载修改过的证书, 加载失败时继续使用旧证书
+func (r *Reloader) reload() {
+	for _, e := range r.entries {
+		modTime, err := latestModTime(e.certFile, e.keyFile)
+		if err != nil {
+			r.logger.Error(fmt.Sprintf("Stat certificate %s error: %v", e.certFile, err))
+			continue
+		}
+		if !modTime.After(e.modTime) {
+			continue
+		}
+		if err := r.load(e); err != nil {
+			r.logger.Error(fmt.Sprintf("Reload certificate %s error: %v", e.certFile, err))
+			continue
+		}
+		r.logger.Info(fmt.Sprintf("Certificate reloaded: %s", e.certFile))
+	}
+}
+
+func (r *Reloader) load(e *entry) error {
+	modTime, err := latestModTime(e.certFile, e.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(e.certFile, e.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s failed: %v", e.certFile, err)
+	}
+	r.mu.Lock()
+	e.cert = &cert
+	e.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// latestModTime 返回证书与私钥中较新的修改时间
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
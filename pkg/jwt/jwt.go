@@ -13,8 +13,21 @@ type JWT struct {
 	key []byte
 }
 
+// 令牌的用途, 写入 aud 声明, 解析时必须一致, 避免一种用途的令牌被当作另一种使用
+const (
+	// AudienceAdmin 管理后台登录
+	AudienceAdmin = "admin"
+	// AudienceClaudeIdentity Claude 登录链接中的账号标识
+	AudienceClaudeIdentity = "claude-identity"
+)
+
+// AdminUserId 管理员令牌中的用户ID
+const AdminUserId = "1"
+
 type MyCustomClaims struct {
 	UserId string
+	// Generation 管理员令牌签发时的代数, 与当前代数不同的令牌已失效
+	Generation int64 `json:",omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -24,9 +37,19 @@ func NewJwt() *JWT {
 	}
 }
 
-func (j *JWT) GenToken(userId string, expiresAt time.Time) (string, error) {
+func (j *JWT) GenToken(userId string, audience string, expiresAt time.Time) (string, error) {
+	return j.genToken(userId, audience, 0, expiresAt)
+}
+
+// GenAdminToken 签发管理员令牌, generation 为当前的管理员令牌代数
+func (j *JWT) GenAdminToken(generation int64, expiresAt time.Time) (string, error) {
+	return j.genToken(AdminUserId, AudienceAdmin, generation, expiresAt)
+}
+
+func (j *JWT) genToken(userId string, audience string, generation int64, expiresAt time.Time) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, MyCustomClaims{
-		UserId: userId,
+		UserId:     userId,
+		Generation: generation,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -34,7 +57,7 @@ func (j *JWT) GenToken(userId string, expiresAt time.Time) (string, error) {
 			Issuer:    "",
 			Subject:   "",
 			ID:        "",
-			Audience:  []string{},
+			Audience:  []string{audience},
 		},
 	})
 
@@ -46,7 +69,8 @@ func (j *JWT) GenToken(userId string, expiresAt time.Time) (string, error) {
 	return tokenString, nil
 }
 
-func (j *JWT) ParseToken(tokenString string) (*MyCustomClaims, error) {
+// ParseToken 校验令牌, 用途与 audience 不一致时返回错误
+func (j *JWT) ParseToken(tokenString string, audience string) (*MyCustomClaims, error) {
 	re := regexp.MustCompile(`(?i)Bearer `)
 	tokenString = re.ReplaceAllString(tokenString, "")
 	if tokenString == "" {
@@ -54,7 +78,7 @@ func (j *JWT) ParseToken(tokenString string) (*MyCustomClaims, error) {
 	}
 	token, err := jwt.ParseWithClaims(tokenString, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return j.key, nil
-	})
+	}, jwt.WithAudience(audience))
 	// 检查是否有错误发生，或 token 是否为 nil
 	if err != nil || token == nil {
 		return nil, err // 如果有错误或 token 是 nil，直接返回错误
@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTokenAudience(t *testing.T) {
+	j := &JWT{key: []byte("secret")}
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		userId   string
+		issued   string
+		expected string
+		wantErr  bool
+	}{
+		{name: "admin token as admin", userId: AdminUserId, issued: AudienceAdmin, expected: AudienceAdmin},
+		{name: "claude identity as claude identity", userId: "claude:1", issued: AudienceClaudeIdentity, expected: AudienceClaudeIdentity},
+		{name: "claude identity as admin", userId: "claude:1", issued: AudienceClaudeIdentity, expected: AudienceAdmin, wantErr: true},
+		{name: "admin token as claude identity", userId: AdminUserId, issued: AudienceAdmin, expected: AudienceClaudeIdentity, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := j.GenToken(tt.userId, tt.issued, expiresAt)
+			if err != nil {
+				t.Fatalf("GenToken() error = %v", err)
+			}
+			claims, err := j.ParseToken("Bearer "+token, tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.UserId != tt.userId {
+				t.Errorf("ParseToken() UserId = %s, want %s", claims.UserId, tt.userId)
+			}
+		})
+	}
+}
+
+func TestParseTokenWithoutAudience(t *testing.T) {
+	j := &JWT{key: []byte("secret")}
+	// 旧版本签发的令牌没有 aud 声明, 不能再作为管理员令牌使用
+	token, err := j.GenToken(AdminUserId, "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenToken() error = %v", err)
+	}
+	if _, err := j.ParseToken(token, AudienceAdmin); err == nil {
+		t.Error("ParseToken() accepted a token without audience")
+	}
+}
+
+func TestGenAdminTokenGeneration(t *testing.T) {
+	j := &JWT{key: []byte("secret")}
+	token, err := j.GenAdminToken(3, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenAdminToken() error = %v", err)
+	}
+	claims, err := j.ParseToken(token, AudienceAdmin)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	if claims.UserId != AdminUserId || claims.Generation != 3 {
+		t.Errorf("ParseToken() = %s generation %d, want %s generation 3", claims.UserId, claims.Generation, AdminUserId)
+	}
+}
@@ -0,0 +1,83 @@
+package dispatch
+
+import (
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Server struct {
+	http.Handler
+	httpSrv *http.Server
+	host    string
+	port    int
+	tls     *tls.Config
+	logger  *log.Logger
+}
+type Option func(s *Server)
+
+func NewServer(handler http.Handler, logger *log.Logger, opts ...Option) *Server {
+	s := &Server{
+		Handler: handler,
+		logger:  logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+func WithServerHost(host string) Option {
+	return func(s *Server) {
+		s.host = host
+	}
+}
+func WithServerPort(port int) Option {
+	return func(s *Server) {
+		s.port = port
+	}
+}
+
+// WithTLSConfig 启用 HTTPS, 证书由 TLS 配置提供, 为 nil 时使用 HTTP
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = config
+	}
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	s.httpSrv = &http.Server{
+		Addr:      fmt.Sprintf("%s:%d", s.host, s.port),
+		Handler:   s,
+		TLSConfig: s.tls,
+	}
+
+	var err error
+	if s.tls != nil {
+		err = s.httpSrv.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpSrv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Sugar().Fatalf("listen: %s\n", err)
+	}
+
+	return nil
+}
+func (s *Server) Stop(ctx context.Context) error {
+	s.logger.Sugar().Info("Shutting down server...")
+
+	// The context is used to inform the server it has 5 seconds to finish
+	// the request it is currently handling
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.httpSrv.Shutdown(ctx); err != nil {
+		s.logger.Sugar().Fatal("Server forced to shutdown: ", err)
+	}
+
+	s.logger.Sugar().Info("Server exiting")
+	return nil
+}
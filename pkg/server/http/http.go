@@ -3,6 +3,7 @@ package http
 import (
 	"PandoraFuclaudePlusHelper/pkg/log"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,7 @@ type Server struct {
 	httpSrv *http.Server
 	host    string
 	port    int
+	tls     *tls.Config
 	logger  *log.Logger
 }
 type Option func(s *Server)
@@ -40,13 +42,27 @@ func WithServerPort(port int) Option {
 	}
 }
 
+// WithTLSConfig 启用 HTTPS, 证书由 TLS 配置提供, 为 nil 时使用 HTTP
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = config
+	}
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	s.httpSrv = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", s.host, s.port),
-		Handler: s,
+		Addr:      fmt.Sprintf("%s:%d", s.host, s.port),
+		Handler:   s,
+		TLSConfig: s.tls,
 	}
 
-	if err := s.httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	var err error
+	if s.tls != nil {
+		err = s.httpSrv.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpSrv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Sugar().Fatalf("listen: %s\n", err)
 	}
 
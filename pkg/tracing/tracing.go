@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	commonConfig "PandoraFuclaudePlusHelper/config"
+	"PandoraFuclaudePlusHelper/pkg/log"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const instrumentationName = "PandoraFuclaudePlusHelper"
+
+// Init 根据 OTEL_EXPORTER 初始化全局 TracerProvider, 未配置时使用 otel 默认的空实现, 不产生任何开销
+// 返回的函数用于退出前刷新并关闭 exporter
+func Init(logger *log.Logger) (func(ctx context.Context) error, error) {
+	config := commonConfig.GetConfig()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch config.OtelExporter {
+	case "":
+		return func(ctx context.Context) error { return nil }, nil
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if config.OtelEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(config.OtelEndpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER: %s", config.OtelExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(config.OtelServiceName),
+		semconv.ServiceVersion(config.Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn(fmt.Sprintf("opentelemetry error: %v", err))
+	}))
+	logger.Info(fmt.Sprintf("opentelemetry tracing enabled, exporter: %s", config.OtelExporter))
+	return provider.Shutdown, nil
+}
+
+// Start 创建子 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span, err 不为空时记录错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport 为出站请求创建客户端 span 并注入 traceparent, base 为空时使用 http.DefaultTransport
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// Middleware 为 gin 请求创建服务端 span, 并将 trace_id 写入请求上下文中的日志
+// proxy 为 true 时按请求路径命名 span, 反代的请求大多不会匹配到路由
+func Middleware(logger *log.Logger, server string, proxy bool) gin.HandlersChain {
+	var opts []otelgin.Option
+	if proxy {
+		opts = append(opts, otelgin.WithSpanNameFormatter(func(r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+	}
+	return gin.HandlersChain{
+		otelgin.Middleware(server, opts...),
+		func(c *gin.Context) {
+			c.Request = c.Request.WithContext(WithLogger(c.Request.Context(), logger))
+			c.Next()
+		},
+	}
+}
+
+// WithLogger 将当前 span 的 trace_id 写入 ctx 中的日志, 之后通过 logger.WithContext(ctx) 打印的日志都会带上 trace_id
+func WithLogger(ctx context.Context, logger *log.Logger) context.Context {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ctx
+	}
+	return logger.WithValue(ctx, zap.String("trace_id", spanContext.TraceID().String()))
+}
+
+// Job 为定时任务创建根 span
+func Job(name string, logger *log.Logger, job func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ctx, span := Start(ctx, "Task."+name)
+		defer span.End()
+		job(WithLogger(ctx, logger))
+	}
+}
@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	gormlogger "gorm.io/gorm/logger"
 )
@@ -64,6 +69,8 @@ func (l Logger) Error(ctx context.Context, msg string, data ...interface{}) {
 }
 
 func (l Logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	traceQuery(ctx, begin, fc, err)
+
 	if l.LogLevel <= gormlogger.Silent {
 		return
 	}
@@ -126,3 +133,38 @@ func (l Logger) logger(ctx context.Context) *zap.Logger {
 	}
 	return logger
 }
+
+var (
+	sqlStringLiteral       = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	sqlDoubleQuotedLiteral = regexp.MustCompile(`"(?:[^"\\]|\\.|"")*"`)
+)
+
+// traceQuery 为 SQL 创建 span, 上游没有在采样的 span 时跳过, 避免无意义地生成 SQL
+func traceQuery(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if ctx == nil || !trace.SpanFromContext(ctx).IsRecording() {
+		return
+	}
+	sql, rows := fc()
+	// SQL 中的参数已被展开, 去掉字符串字面量避免密码等敏感数据被导出
+	// mysql/sqlite 用反引号包裹标识符, 双引号同样是字符串; postgres 的双引号是标识符, 保留
+	sql = sqlStringLiteral.ReplaceAllString(sql, "?")
+	if strings.Contains(sql, "`") {
+		sql = sqlDoubleQuotedLiteral.ReplaceAllString(sql, "?")
+	}
+	operation := sql
+	if i := strings.IndexByte(sql, ' '); i > 0 {
+		operation = sql[:i]
+	}
+	_, span := otel.Tracer("gorm").Start(ctx, "gorm "+strings.ToUpper(operation),
+		trace.WithTimestamp(begin),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.statement", sql),
+			attribute.Int64("db.rows_affected", rows),
+		))
+	if err != nil && !errors.Is(err, gormlogger.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}